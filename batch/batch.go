@@ -0,0 +1,178 @@
+// Package batch renders one template against a stream of data records with a
+// pool of workers, e.g. for mail merge or notification generation, results
+// are delivered in the order of the records.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+
+	"arhat.dev/tlang"
+)
+
+// Result is the output of rendering a single record.
+type Result struct {
+	Index  int    // index of the record in the input, starting from 0.
+	Record any    // the record.
+	Output []byte // output of the execution, partial if Err is not nil.
+	Err    error  // error of the execution.
+}
+
+// Renderer renders a template against records concurrently.
+type Renderer struct {
+	// Template is the template to execute, it MUST NOT be modified while
+	// rendering.
+	Template *tlang.Template
+
+	// Name is the name of the associated template to execute, Template
+	// itself is executed if empty.
+	Name string
+
+	// Workers is the number of concurrent executions, defaults to
+	// runtime.GOMAXPROCS(0) when not positive.
+	Workers int
+}
+
+// job is a record waiting for a worker.
+type job struct {
+	Result
+	done chan Result
+}
+
+// Render renders the template against every record received from records
+// until it is closed or ctx is done, the returned channel delivers results in
+// the order of records and is closed afterwards.
+//
+// Records are read ahead of the consumer of results by a window proportional
+// to the number of workers, so memory stays bounded with slow consumers.
+func (r *Renderer) Render(ctx context.Context, records <-chan any) <-chan Result {
+	workers := r.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	var (
+		jobs    = make(chan *job)
+		pending = make(chan chan Result, workers)
+		results = make(chan Result)
+	)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range jobs {
+				j.done <- r.render(j.Result)
+			}
+		}()
+	}
+
+	// dispatch records, keeping the order of their results
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+
+		for i := 0; ; i++ {
+			var (
+				rec any
+				ok  bool
+			)
+			select {
+			case <-ctx.Done():
+				return
+			case rec, ok = <-records:
+				if !ok {
+					return
+				}
+			}
+
+			j := &job{
+				Result: Result{Index: i, Record: rec},
+				done:   make(chan Result, 1),
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case pending <- j.done:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- j:
+			}
+		}
+	}()
+
+	go func() {
+		defer close(results)
+
+		for done := range pending {
+			select {
+			case <-ctx.Done():
+				return
+			case res := <-done:
+				select {
+				case <-ctx.Done():
+					return
+				case results <- res:
+				}
+			}
+		}
+	}()
+
+	return results
+}
+
+// RenderIter is like Render, but records are pulled from next until it
+// returns false.
+func (r *Renderer) RenderIter(ctx context.Context, next func() (any, bool)) <-chan Result {
+	records := make(chan any)
+	go func() {
+		defer close(records)
+
+		for {
+			rec, ok := next()
+			if !ok {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case records <- rec:
+			}
+		}
+	}()
+
+	return r.Render(ctx, records)
+}
+
+// RenderSlice renders the template against all records, returning results
+// in the order of records.
+func (r *Renderer) RenderSlice(ctx context.Context, records []any) []Result {
+	i := 0
+	results := r.RenderIter(ctx, func() (any, bool) {
+		if i == len(records) {
+			return nil, false
+		}
+		i++
+		return records[i-1], true
+	})
+
+	ret := make([]Result, 0, len(records))
+	for res := range results {
+		ret = append(ret, res)
+	}
+	return ret
+}
+
+// render executes the template with res.Record.
+func (r *Renderer) render(res Result) Result {
+	var buf bytes.Buffer
+	if r.Name == "" {
+		res.Err = r.Template.Execute(&buf, res.Record)
+	} else {
+		res.Err = r.Template.ExecuteTemplate(&buf, r.Name, res.Record)
+	}
+	res.Output = buf.Bytes()
+	return res
+}
@@ -0,0 +1,55 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"arhat.dev/tlang"
+)
+
+func TestRenderer(t *testing.T) {
+	tmpl := tlang.Must(tlang.New("mail").Funcs(tlang.FuncMap{
+		"sleep": func(n int) string {
+			// finish later records first
+			time.Sleep(time.Duration(10-n) * time.Millisecond)
+			return ""
+		},
+	}).Parse(`sleep .; "Dear "; .`))
+
+	r := &Renderer{Template: tmpl, Workers: 4}
+
+	records := make([]any, 10)
+	for i := range records {
+		records[i] = i
+	}
+	records[3] = "x"
+
+	results := r.RenderSlice(context.Background(), records)
+	assert.Len(t, results, len(records))
+	for i, res := range results {
+		assert.Equal(t, i, res.Index)
+		if i == 3 {
+			assert.Error(t, res.Err)
+			continue
+		}
+
+		assert.NoError(t, res.Err)
+		assert.Equal(t, fmt.Sprint("Dear ", i), string(res.Output))
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		records := make(chan any)
+		results := r.Render(ctx, records)
+		records <- 9
+		assert.Equal(t, "Dear 9", string((<-results).Output))
+
+		cancel()
+		_, ok := <-results
+		assert.False(t, ok)
+	})
+}
@@ -99,3 +99,110 @@ func BenchmarkParsing_tlang(b *testing.B) {
 
 	return
 }
+
+type benchItem struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+type benchData struct {
+	Title string
+	Items []benchItem
+	Meta  map[string]string
+}
+
+func newBenchData() *benchData {
+	d := &benchData{Title: "bench", Meta: map[string]string{"a": "1", "b": "2"}}
+	for i := 0; i < 100; i++ {
+		d.Items = append(d.Items, benchItem{
+			Name:  fmt.Sprintf("item-%d", i),
+			Count: i,
+			Tags:  []string{"x", "y"},
+		})
+	}
+	return d
+}
+
+// benchExec benchmarks executions of the same templates in text/template and
+// tlang, texts are tlang templates, converted by wrapping lines in braces.
+func benchExec(b *testing.B, text string) {
+	data := newBenchData()
+
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		sb.WriteString("{{")
+		sb.WriteString(strings.TrimSpace(line))
+		sb.WriteString("}}")
+	}
+
+	tt := template.Must(template.New("").Parse(sb.String()))
+	tl := tlang.Must(tlang.New("").Parse(text))
+
+	b.Run("text", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := tt.Execute(io.Discard, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("tlang", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := tl.Execute(io.Discard, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkExec_fields(b *testing.B) {
+	benchExec(b, `
+range .Items
+  .Name
+  .Count
+end
+`)
+}
+
+func BenchmarkExec_variables(b *testing.B) {
+	benchExec(b, `
+$title := .Title
+range $i, $item := .Items
+  $i
+  $item.Name
+  $title
+end
+`)
+}
+
+func BenchmarkExec_nested(b *testing.B) {
+	benchExec(b, `
+range .Items
+  $name := .Name
+  range .Tags
+    $name
+    .
+  end
+end
+`)
+}
+
+func BenchmarkExec_with(b *testing.B) {
+	benchExec(b, `
+range .Items
+  with .Tags
+    .
+  end
+  if .Count
+    .Count
+  end
+end
+range $k, $v := .Meta
+  $k
+  $v
+end
+`)
+}
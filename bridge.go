@@ -0,0 +1,156 @@
+package tlang
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	ttparse "text/template/parse"
+
+	"arhat.dev/tlang/parse"
+)
+
+// TextTemplate converts t and all templates associated with it into a
+// text/template set.
+//
+// Every parse tree is rendered in the {{}} syntax of text/template, parsed
+// again by text/template/parse and installed with AddParseTree, functions
+// referenced by the trees are looked up from t's function map, and converted
+// like FuncMap.TextFuncMap does.
+func (t *Template) TextTemplate() (*texttemplate.Template, error) {
+	trees, funcs, err := t.bridgeTrees()
+	if err != nil {
+		return nil, err
+	}
+
+	opt, _ := t.config()
+	ret := texttemplate.New(t.name).Funcs(funcs).Option("missingkey=" + opt.missingKey.String())
+	for name, tree := range trees {
+		if _, err = ret.AddParseTree(name, tree); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// HTMLTemplate is like TextTemplate but creates a html/template set, so that
+// templates authored in tlang syntax are contextually escaped at runtime.
+func (t *Template) HTMLTemplate() (*htmltemplate.Template, error) {
+	trees, funcs, err := t.bridgeTrees()
+	if err != nil {
+		return nil, err
+	}
+
+	opt, _ := t.config()
+	ret := htmltemplate.New(t.name).Funcs(htmltemplate.FuncMap(funcs)).Option("missingkey=" + opt.missingKey.String())
+	for name, tree := range trees {
+		if _, err = ret.AddParseTree(name, tree); err != nil {
+			return nil, err
+		}
+	}
+
+	// html/template creates a new template when adding a tree with the
+	// same name, lookup the defined one
+	if defined := ret.Lookup(t.name); defined != nil {
+		return defined, nil
+	}
+
+	return ret, nil
+}
+
+// bridgeTrees converts all defined templates associated with t into
+// text/template parse trees, it also collects functions used by these trees.
+func (t *Template) bridgeTrees() (map[string]*ttparse.Tree, texttemplate.FuncMap, error) {
+	t.init()
+
+	_, tfuncs := t.config()
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+
+	var (
+		trees = make(map[string]*ttparse.Tree)
+		funcs = make(texttemplate.FuncMap)
+	)
+
+	for name, tmpl := range t.tmpl {
+		if tmpl.Tree == nil || tmpl.Root == nil {
+			continue
+		}
+		if len(tmpl.Params) != 0 {
+			return nil, nil, fmt.Errorf("template: %s: parameters are not supported by text/template", name)
+		}
+
+		parse.Inspect(tmpl.Root, func(n parse.Node) bool {
+			ident, ok := n.(*parse.IdentifierNode)
+			if !ok || tfuncs == nil {
+				return true
+			}
+
+			if fn := tfuncs.GetByName(ident.Ident); fn.IsValid() {
+				funcs[ident.Ident] = textFunc(fn)
+			}
+
+			return true
+		})
+
+		root := tmpl.Root.CopyList()
+		parse.Inspect(root, func(n parse.Node) bool {
+			list, ok := n.(*parse.ListNode)
+			if !ok {
+				return true
+			}
+
+			// string literals are the text of tlang templates, keep them as
+			// text so html/template can tell markup from data
+			nodes := list.Nodes[:0]
+			for _, c := range list.Nodes {
+				if action, ok := c.(*parse.ActionNode); ok && len(action.Pipe.Cmds) == 0 {
+					// empty actions are not valid in text/template
+					continue
+				}
+				if text, ok := literalText(c); ok {
+					c = &parse.TextNode{
+						NodeType: parse.NodeText,
+						Pos:      c.Position(),
+						Text:     []byte(strings.ReplaceAll(text, "{{", `{{"{{"}}`)),
+					}
+				}
+				nodes = append(nodes, c)
+			}
+			list.Nodes = nodes
+
+			return true
+		})
+
+		tree := ttparse.New(name)
+		tree.Mode = ttparse.SkipFuncCheck
+		_, err := tree.Parse(root.String(), "{{", "}}", trees)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return trees, funcs, nil
+}
+
+// literalText returns the text of an action consisting of a single string
+// constant.
+func literalText(n parse.Node) (string, bool) {
+	action, ok := n.(*parse.ActionNode)
+	if !ok || len(action.Pipe.Decl) != 0 || len(action.Pipe.Cmds) != 1 {
+		return "", false
+	}
+
+	args := action.Pipe.Cmds[0].Args
+	if len(args) != 1 {
+		return "", false
+	}
+
+	str, ok := args[0].(*parse.StringNode)
+	if !ok {
+		return "", false
+	}
+
+	return str.Text, true
+}
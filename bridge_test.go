@@ -0,0 +1,56 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const bridgeText = `define "item"
+  "<li>"; upper .; "</li>"
+end
+
+$n := 0
+range .
+  $n = 1
+  template "item" .
+end
+$n
+`
+
+func TestTemplate_TextTemplate(t *testing.T) {
+	tmpl := Must(New("list").Funcs(FuncMap{"upper": strings.ToUpper}).Parse(bridgeText))
+
+	tt, err := tmpl.TextTemplate()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var sb strings.Builder
+	assert.NoError(t, tt.Execute(&sb, []string{"a", "<b>"}))
+	assert.Equal(t, "<li>A</li><li><B></li>1", sb.String())
+
+	// functions taking Env get a default one
+	tmpl = Must(New("env").Funcs(TimeFuncs()).Parse(`unixTime`))
+	tt, err = tmpl.TextTemplate()
+	if !assert.NoError(t, err) {
+		return
+	}
+	sb.Reset()
+	assert.NoError(t, tt.Execute(&sb, nil))
+	assert.Regexp(t, `^[1-9][0-9]*$`, sb.String())
+}
+
+func TestTemplate_HTMLTemplate(t *testing.T) {
+	tmpl := Must(New("list").Funcs(FuncMap{"upper": strings.ToUpper}).Parse(bridgeText))
+
+	ht, err := tmpl.HTMLTemplate()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var sb strings.Builder
+	assert.NoError(t, ht.Execute(&sb, []string{"a", "<b>"}))
+	assert.Equal(t, "<li>A</li><li>&lt;B&gt;</li>1", sb.String())
+}
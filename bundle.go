@@ -0,0 +1,205 @@
+package tlang
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"arhat.dev/tlang/parse"
+)
+
+// BundleFormat is the version of the bundle format written by PackBundle,
+// LoadBundle rejects bundles of newer formats.
+const BundleFormat = 1
+
+// BundleManifestFile is the name of the manifest in bundles.
+const BundleManifestFile = "manifest.json"
+
+// BundleManifest describes a template bundle, a zip archive distributing a
+// template set as a single artifact, which can be signed and verified as a
+// whole, e.g. with Verifier.Verify. The manifest is stored as JSON in
+// BundleManifestFile, next to the template files.
+type BundleManifest struct {
+	// Format is the version of the bundle format, set by PackBundle.
+	Format int `json:"format"`
+
+	// Name is the name of the template set, and of the template loaded
+	// first.
+	Name string `json:"name"`
+
+	// Version is the version of the template set.
+	Version string `json:"version,omitempty"`
+
+	// EntryPoints are names of templates meant to be executed, they must be
+	// defined by the bundle.
+	EntryPoints []string `json:"entryPoints,omitempty"`
+
+	// Options are options of the template set, see Template.Option.
+	Options []string `json:"options,omitempty"`
+
+	// Files are the template files in the order they are parsed.
+	Files []string `json:"files"`
+
+	// Funcs are the functions called by the templates, which must be
+	// provided when loading the bundle, set by PackBundle.
+	Funcs []string `json:"funcs,omitempty"`
+
+	// Schema is the JSON Schema of the data the templates expect, set as
+	// the schema of the loaded template, see Template.Schema.
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
+// Bundle is a template set loaded by LoadBundle.
+type Bundle struct {
+	Manifest *BundleManifest
+
+	// Template is the template named as the bundle, associated with all
+	// templates of the bundle.
+	Template *Template
+}
+
+// PackBundle writes a bundle to w with the manifest m and the files listed in
+// m.Files read from fsys. The templates are parsed to check them and to list
+// the functions they call in the manifest.
+func PackBundle(w io.Writer, m BundleManifest, fsys fs.FS) error {
+	if len(m.Files) == 0 {
+		return fmt.Errorf("template: bundle %q has no files", m.Name)
+	}
+
+	m.Format = BundleFormat
+	tmpl := New(m.Name).Option(m.Options...)
+	tmpl.option.parseMode |= parse.SkipFuncCheck
+	tmpl, err := tmpl.ParseFS(fsys, m.Files...)
+	if err != nil {
+		return err
+	}
+	if err := checkEntryPoints(tmpl, &m); err != nil {
+		return err
+	}
+
+	m.Funcs = calledFuncs(tmpl)
+
+	zw := zip.NewWriter(w)
+	mw, err := zw.Create(BundleManifestFile)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&m); err != nil {
+		return err
+	}
+
+	for _, file := range m.Files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+
+		fw, err := zw.Create(file)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// LoadBundle loads the bundle of size bytes read from r, its templates may
+// call functions in funcs, which must provide every function listed in the
+// manifest.
+func LoadBundle(r io.ReaderAt, size int64, funcs FuncMap) (*Bundle, error) {
+	return loadBundle(r, size, funcs)
+}
+
+// loadBundle is LoadBundle with any function set.
+func loadBundle(r io.ReaderAt, size int64, funcs parse.TemplateFuncs) (*Bundle, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("template: reading bundle: %w", err)
+	}
+
+	data, err := fs.ReadFile(zr, BundleManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("template: reading bundle manifest: %w", err)
+	}
+
+	m := new(BundleManifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("template: decoding bundle manifest: %w", err)
+	}
+	if m.Format > BundleFormat {
+		return nil, fmt.Errorf("template: bundle %q has unsupported format %d", m.Name, m.Format)
+	}
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("template: bundle %q has no files", m.Name)
+	}
+
+	var missing []string
+	for _, name := range m.Funcs {
+		if funcs == nil || !funcs.Has(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) != 0 {
+		return nil, fmt.Errorf("template: bundle %q requires undefined functions %s", m.Name, strings.Join(missing, ", "))
+	}
+
+	tmpl, err := New(m.Name).Option(m.Options...).Funcs(funcs).ParseFS(zr, m.Files...)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Schema) != 0 {
+		var schema any
+		if err := json.Unmarshal(m.Schema, &schema); err != nil {
+			return nil, fmt.Errorf("template: decoding schema of bundle %q: %w", m.Name, err)
+		}
+		tmpl.Schema(schema)
+	}
+	if err := checkEntryPoints(tmpl, m); err != nil {
+		return nil, err
+	}
+
+	return &Bundle{Manifest: m, Template: tmpl}, nil
+}
+
+// checkEntryPoints checks that entry points of m are defined in t.
+func checkEntryPoints(t *Template, m *BundleManifest) error {
+	for _, name := range m.EntryPoints {
+		if t.Lookup(name) == nil {
+			return fmt.Errorf("template: bundle %q has undefined entry point %q", m.Name, name)
+		}
+	}
+	return nil
+}
+
+// calledFuncs returns names of functions called by templates associated
+// with t, sorted.
+func calledFuncs(t *Template) []string {
+	called := make(map[string]struct{})
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		parse.Inspect(tmpl.Root, func(n parse.Node) bool {
+			if id, ok := n.(*parse.IdentifierNode); ok {
+				called[id.Ident] = struct{}{}
+			}
+			return true
+		})
+	}
+
+	ret := make([]string, 0, len(called))
+	for name := range called {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,52 @@
+package tlang
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.tl":           {Data: []byte(`template "greet" .`)},
+		"partials/greet.tl": {Data: []byte(`define "greet"; "hello "; upper .; end`)},
+	}
+	funcs := FuncMap{"upper": strings.ToUpper}
+
+	var buf bytes.Buffer
+	err := PackBundle(&buf, BundleManifest{
+		Name:        "main.tl",
+		Version:     "1.2.0",
+		EntryPoints: []string{"main.tl", "greet"},
+		Files:       []string{"main.tl", "partials/greet.tl"},
+		Schema:      []byte(`{"type":"string"}`),
+	}, fsys)
+	require.NoError(t, err)
+
+	b, err := LoadBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()), funcs)
+	require.NoError(t, err)
+	assert.Equal(t, BundleFormat, b.Manifest.Format)
+	assert.Equal(t, "1.2.0", b.Manifest.Version)
+	assert.Equal(t, []string{"upper"}, b.Manifest.Funcs)
+	assert.JSONEq(t, `{"type":"string"}`, string(b.Manifest.Schema))
+
+	var sb strings.Builder
+	require.NoError(t, b.Template.Execute(&sb, "world"))
+	assert.Equal(t, "hello WORLD", sb.String())
+
+	_, err = LoadBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+	assert.EqualError(t, err, `template: bundle "main.tl" requires undefined functions upper`)
+
+	err = PackBundle(&buf, BundleManifest{Name: "main.tl", EntryPoints: []string{"missing"}, Files: []string{"main.tl"}}, fsys)
+	assert.EqualError(t, err, `template: bundle "main.tl" has undefined entry point "missing"`)
+
+	err = PackBundle(&buf, BundleManifest{Name: "empty"}, fsys)
+	assert.Error(t, err)
+
+	_, err = LoadBundle(strings.NewReader("not a zip"), 9, funcs)
+	assert.Error(t, err)
+}
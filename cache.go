@@ -0,0 +1,125 @@
+package tlang
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"arhat.dev/tlang/parse"
+)
+
+// ParseCache stores encoded parse trees by content addressed keys, so that
+// parsing the same text again can be skipped, e.g. by CLIs rendering the
+// same large template sets repeatedly.
+//
+// Implementations must be safe for concurrent use, errors of Put are
+// ignored.
+type ParseCache interface {
+	Get(key string) ([]byte, bool)
+	Put(key string, data []byte) error
+}
+
+// DirCache is a ParseCache storing entries as files in a directory, which
+// is created when missing.
+type DirCache string
+
+// Get implements ParseCache.
+func (d DirCache) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(filepath.Join(string(d), key))
+	return data, err == nil
+}
+
+// Put implements ParseCache, the entry is written to a temporary file
+// renamed to the key, so that readers never see partial entries.
+func (d DirCache) Put(key string, data []byte) error {
+	err := os.MkdirAll(string(d), 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(string(d), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(string(d), key))
+}
+
+// Cache sets the cache of parse trees used by subsequent calls to Parse,
+// ParseFiles, ParseGlob and ParseFS, entries are keyed by the hash of the
+// text, the parse options and parse.EncodingVersion. Parsing is not cached
+// when a normalization function is set by Normalize. A nil cache disables
+// caching. The return value is the template, so calls can be chained.
+func (t *Template) Cache(c ParseCache) *Template {
+	return t.configure("Cache", func() {
+		t.option.cache = c
+	})
+}
+
+// cacheKey returns the key of the trees of the template name parsed from
+// text with opt, empty if parsing is not cached.
+func cacheKey(opt *option, name, text string) string {
+	if opt.cache == nil || opt.normalize != nil {
+		return ""
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%q\x00%d\x00%+v\x00%v\x00", parse.EncodingVersion, name, opt.parseMode, opt.limits, opt.dataType)
+	h.Write([]byte(text))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedTrees returns trees stored in the cache by key, nil if there is no
+// valid entry or a function used is not in funcs.
+func cachedTrees(opt *option, funcs parse.TemplateFuncs, key string) map[string]*parse.Tree {
+	data, ok := opt.cache.Get(key)
+	if !ok {
+		return nil
+	}
+
+	var trees map[string]*parse.Tree
+	if gob.NewDecoder(bytes.NewReader(data)).Decode(&trees) != nil {
+		return nil
+	}
+
+	if opt.parseMode&parse.SkipFuncCheck != 0 {
+		return trees
+	}
+
+	for _, tree := range trees {
+		defined := true
+		parse.Inspect(tree.Root, func(n parse.Node) bool {
+			if id, ok := n.(*parse.IdentifierNode); ok && (funcs == nil || !funcs.Has(id.Ident)) {
+				defined = false
+			}
+			return defined
+		})
+		if !defined {
+			// parse again for the error
+			return nil
+		}
+	}
+
+	return trees
+}
+
+// cacheTrees stores trees in the cache by key.
+func cacheTrees(opt *option, key string, trees map[string]*parse.Tree) {
+	var buf bytes.Buffer
+	if gob.NewEncoder(&buf).Encode(trees) == nil {
+		_ = opt.cache.Put(key, buf.Bytes())
+	}
+}
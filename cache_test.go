@@ -0,0 +1,50 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingCache struct {
+	DirCache
+	hits int
+}
+
+func (c *countingCache) Get(key string) ([]byte, bool) {
+	data, ok := c.DirCache.Get(key)
+	if ok {
+		c.hits++
+	}
+	return data, ok
+}
+
+func TestCache(t *testing.T) {
+	const text = "define \"item\"\n  upper .\nend\nrange .\n  template \"item\" .\nend"
+
+	cache := &countingCache{DirCache: DirCache(t.TempDir())}
+	funcs := FuncMap{"upper": strings.ToUpper}
+	for i := 0; i < 2; i++ {
+		tmpl := Must(New("page").Funcs(funcs).Cache(cache).Parse(text))
+		assert.Equal(t, i, cache.hits)
+
+		var sb strings.Builder
+		assert.NoError(t, tmpl.Execute(&sb, []string{"a", "b"}))
+		assert.Equal(t, "AB", sb.String())
+
+		err := tmpl.Execute(&sb, true)
+		assert.ErrorContains(t, err, "template: page:4:6: executing \"page\" at <.>")
+	}
+
+	t.Run("undefined function", func(t *testing.T) {
+		_, err := New("page").Cache(cache).Parse(text)
+		assert.EqualError(t, err, `template: page:2: function "upper" not defined`)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		hits := cache.hits
+		Must(New("page").Funcs(funcs).Cache(cache).Option("maxstring=10").Parse(text))
+		assert.Equal(t, hits, cache.hits)
+	})
+}
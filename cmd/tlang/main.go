@@ -0,0 +1,190 @@
+// Command tlang runs tlang templates.
+//
+// Usage:
+//
+//	tlang map [-json] [-e text | file]
+//	tlang lint [-threshold severity] file...
+//	tlang replay [-v] trace
+//
+// map applies the template to every line (or JSON document with -json) read
+// from the standard input, see tlang.Template.Map.
+//
+// lint prints findings of the built-in lint rules in template files, and
+// fails if any is at or above the threshold (low, medium, high or
+// critical), see tlang.Linter.
+//
+// replay writes the output of an execution traced by tlang.ExecOptions.Trace,
+// with -v every event is also printed to the standard error.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"arhat.dev/tlang"
+	"arhat.dev/tlang/funcs/semver"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "map":
+		err = runMap(os.Args[2:])
+	case "lint":
+		err = runLint(os.Args[2:])
+	case "replay":
+		err = runReplay(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: tlang map [-json] [-e text | file]")
+	fmt.Fprintln(os.Stderr, "       tlang lint [-threshold severity] file...")
+	fmt.Fprintln(os.Stderr, "       tlang replay [-v] trace")
+	os.Exit(2)
+}
+
+func runMap(args []string) error {
+	fs := flag.NewFlagSet("map", flag.ExitOnError)
+	var (
+		jsonInput = fs.Bool("json", false, "read JSON documents instead of lines")
+		text      = fs.String("e", "", "template text, instead of a file")
+	)
+	_ = fs.Parse(args)
+
+	var (
+		tmpl *tlang.Template
+		err  error
+	)
+	switch {
+	case *text != "" && fs.NArg() == 0:
+		tmpl, err = tlang.New("map").Funcs(funcs()).Parse(*text)
+	case *text == "" && fs.NArg() == 1:
+		tmpl, err = tlang.New(filepath.Base(fs.Arg(0))).Funcs(funcs()).ParseFiles(fs.Arg(0))
+	default:
+		usage()
+	}
+	if err != nil {
+		return err
+	}
+
+	mode := tlang.MapLines
+	if *jsonInput {
+		mode = tlang.MapJSON
+	}
+
+	return tmpl.Map(os.Stdout, os.Stdin, mode, nil)
+}
+
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	threshold := fs.String("threshold", "low", "lowest severity of findings failing lint")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		usage()
+	}
+
+	l := &tlang.Linter{Threshold: -1}
+	for sev := tlang.SeverityLow; sev <= tlang.SeverityCritical; sev++ {
+		if sev.String() == *threshold {
+			l.Threshold = sev
+		}
+	}
+	if l.Threshold < 0 {
+		return fmt.Errorf("unknown severity %q", *threshold)
+	}
+
+	var errs tlang.MultiError
+	for _, file := range fs.Args() {
+		tmpl, err := tlang.New(filepath.Base(file)).Funcs(funcs()).ParseFiles(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		failed := false
+		for _, f := range l.Lint(tmpl) {
+			fmt.Println(f)
+			failed = failed || f.Severity >= l.Threshold
+		}
+		if failed {
+			errs = append(errs, fmt.Errorf("%s: findings at or above %s", file, l.Threshold))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &errs
+}
+
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	verbose := fs.Bool("v", false, "print events to the standard error")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	trace, err := tlang.ReadTrace(f)
+	if err != nil {
+		return err
+	}
+
+	var step func(ev *tlang.TraceEvent) bool
+	if *verbose {
+		step = func(ev *tlang.TraceEvent) bool {
+			switch ev.Kind {
+			case tlang.TraceNode:
+				fmt.Fprintf(os.Stderr, "%s: %s dot=%s\n", ev.Location, ev.Node, ev.Dot)
+			case tlang.TraceCall:
+				fmt.Fprintf(os.Stderr, "%s: %s%s = %s %s\n", ev.Location, ev.Func, ev.Args, ev.Result, ev.Error)
+			}
+			return true
+		}
+	}
+
+	return trace.Replay(os.Stdout, step)
+}
+
+// funcs returns the functions available to templates.
+func funcs() tlang.FuncMap {
+	ret := tlang.FuncMap{}
+	for _, fm := range []tlang.FuncMap{
+		tlang.ArithmeticFuncs(),
+		tlang.ComparisonFuncs(),
+		tlang.TextFuncs(),
+		tlang.EscapeFuncs(),
+		tlang.CSVFuncs(),
+		tlang.IterFuncs(),
+		tlang.YAMLFuncs(),
+		semver.Funcs(),
+		tlang.TimeFuncs(),
+	} {
+		for name, fn := range fm {
+			ret[name] = fn
+		}
+	}
+	return ret
+}
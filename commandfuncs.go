@@ -0,0 +1,245 @@
+package tlang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Default limits of commands run by CommandFuncs.
+const (
+	DefaultCommandTimeout   = 10 * time.Second
+	DefaultCommandMaxOutput = 1 << 20
+)
+
+// Command is an external command templates are allowed to run, see
+// CommandFuncs.
+type Command struct {
+	// Path is the executable, looked up in the PATH of the host if it
+	// contains no path separator.
+	Path string
+
+	// Args are expressions (see EvalExpr) evaluated with the arguments of
+	// the call as dot, a []any, into the arguments of the command, e.g.
+	// `"--format=json"` and `.[0]`. A string is one argument, a
+	// []string or []any expands to its elements, other values are formatted
+	// with fmt.Sprint. If nil, the arguments of the call are passed as they are.
+	Args []string
+
+	// Env is the environment of the command in "key=value" form, nothing is
+	// inherited from the host except variables named in InheritEnv.
+	Env []string
+
+	// InheritEnv are names of variables of the host passed to the command
+	// when they are set, e.g. "HOME".
+	InheritEnv []string
+
+	// Dir is the working directory of the command, the one of the host if
+	// empty.
+	Dir string
+
+	// Timeout bounds the running time of the command, which is killed when
+	// exceeding it or when the context of the execution is done, defaults
+	// to DefaultCommandTimeout. Processes started by
+	// the command are not killed, and keep the execution waiting as long
+	// as they hold its output open.
+	Timeout time.Duration
+
+	// MaxOutput is the maximum size in bytes of both the standard output
+	// and the standard error of the command, defaults to
+	// DefaultCommandMaxOutput.
+	MaxOutput int
+
+	// AllowFailure reports a non-zero exit status in CommandResult.ExitCode
+	// instead of failing the execution.
+	AllowFailure bool
+}
+
+// CommandResult is the result of running a Command, printed as its standard
+// output.
+type CommandResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// String returns the standard output of the command.
+func (r *CommandResult) String() string { return r.Stdout }
+
+// CommandFuncs returns functions running external commands, only the ones in
+// commands by name, so that templates cannot run arbitrary programs:
+//
+//	exec name [args...]
+//		Runs the command registered as name with args and returns its
+//		*CommandResult, a non-zero exit status is an error including
+//		the standard error of the command unless AllowFailure is set.
+//		The command reads no input.
+//
+// For example, with commands["git-rev"] running `git rev-parse --short`:
+//
+//	"revision: "; exec "git-rev" "HEAD"
+//
+// It panics if an expression in Command.Args cannot be parsed. Like other
+// functions accessing the host, exec is denied by Restricted.
+func CommandFuncs(commands map[string]Command) FuncMap {
+	runners := make(map[string]*commandRunner, len(commands))
+	for name, cmd := range commands {
+		r := &commandRunner{name: name, cmd: cmd}
+		for _, arg := range cmd.Args {
+			e, err := CompileExpr(arg, nil)
+			if err != nil {
+				panic(fmt.Sprintf("invalid argument of command %q: %v", name, err))
+			}
+			r.args = append(r.args, e)
+		}
+		runners[name] = r
+	}
+
+	return FuncMap{
+		"exec": func(env Env, name string, args ...any) (*CommandResult, error) {
+			r, ok := runners[name]
+			if !ok {
+				return nil, fmt.Errorf("command %q not allowed", name)
+			}
+			return r.run(env.Context(), args)
+		},
+	}
+}
+
+// commandRunner runs a Command with its compiled arguments.
+type commandRunner struct {
+	name string
+	cmd  Command
+	args []*Expression
+}
+
+// run runs the command with the arguments of the call, killing it when ctx
+// is done.
+func (r *commandRunner) run(parent context.Context, callArgs []any) (*CommandResult, error) {
+	args, err := r.expandArgs(callArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := r.cmd.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	maxOutput := r.cmd.MaxOutput
+	if maxOutput <= 0 {
+		maxOutput = DefaultCommandMaxOutput
+	}
+	stdout := &cappedBuffer{n: maxOutput}
+	stderr := &cappedBuffer{n: maxOutput}
+
+	c := exec.CommandContext(ctx, r.cmd.Path, args...)
+	c.Dir = r.cmd.Dir
+	c.Env = r.env()
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	err = c.Run()
+	switch {
+	case parent.Err() != nil:
+		return nil, fmt.Errorf("command %q: %w", r.name, parent.Err())
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("command %q timed out after %v", r.name, timeout)
+	case stdout.exceeded || stderr.exceeded:
+		return nil, fmt.Errorf("output of command %q exceeds %d bytes", r.name, maxOutput)
+	}
+
+	ret := &CommandResult{Stdout: stdout.String(), Stderr: stderr.String()}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		if err != nil {
+			return nil, fmt.Errorf("command %q: %w", r.name, err)
+		}
+		return ret, nil
+	}
+
+	ret.ExitCode = exitErr.ExitCode()
+	if r.cmd.AllowFailure {
+		return ret, nil
+	}
+	if msg := strings.TrimSpace(ret.Stderr); msg != "" {
+		return nil, fmt.Errorf("command %q exited with status %d: %s", r.name, ret.ExitCode, msg)
+	}
+	return nil, fmt.Errorf("command %q exited with status %d", r.name, ret.ExitCode)
+}
+
+// expandArgs returns the arguments of the command for the arguments of the
+// call.
+func (r *commandRunner) expandArgs(callArgs []any) ([]string, error) {
+	if r.cmd.Args == nil {
+		args := make([]string, len(callArgs))
+		for i, arg := range callArgs {
+			args[i] = fmt.Sprint(arg)
+		}
+		return args, nil
+	}
+
+	var args []string
+	for _, e := range r.args {
+		v, err := e.Eval(callArgs)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q of command %q: %w", e, r.name, err)
+		}
+
+		switch v := v.(type) {
+		case string:
+			args = append(args, v)
+		case []string:
+			args = append(args, v...)
+		case []any:
+			for _, arg := range v {
+				args = append(args, fmt.Sprint(arg))
+			}
+		case nil:
+			return nil, fmt.Errorf("argument %q of command %q has no value", e, r.name)
+		default:
+			args = append(args, fmt.Sprint(v))
+		}
+	}
+	return args, nil
+}
+
+// env returns the environment of the command, never nil so that the
+// environment of the host is not inherited.
+func (r *commandRunner) env() []string {
+	env := make([]string, 0, len(r.cmd.Env)+len(r.cmd.InheritEnv))
+	env = append(env, r.cmd.Env...)
+	for _, key := range r.cmd.InheritEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+// cappedBuffer keeps up to n bytes written to it, and records whether more
+// were written, without failing writes so that commands are not blocked.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	n        int
+	exceeded bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.n - b.buf.Len(); len(p) > room {
+		b.exceeded = true
+		b.buf.Write(p[:room])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string { return b.buf.String() }
@@ -0,0 +1,108 @@
+package tlang
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandFuncs(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	t.Setenv("TLANG_SECRET", "secret")
+	t.Setenv("TLANG_SHARED", "shared")
+
+	sh := func(script string, args ...string) Command {
+		return Command{Path: "sh", Args: append([]string{`"-c"`, strconv.Quote(script), `"sh"`}, args...)}
+	}
+
+	commands := map[string]Command{
+		"echo": {Path: "echo"},
+		"greet": func() Command {
+			cmd := sh(`printf '%s, %s' "$GREETING" "$1"`, ".[0]")
+			cmd.Env = []string{"GREETING=hello"}
+			return cmd
+		}(),
+		"env": func() Command {
+			cmd := sh(`printf '[%s][%s]' "$TLANG_SECRET" "$TLANG_SHARED"`)
+			cmd.InheritEnv = []string{"TLANG_SHARED"}
+			return cmd
+		}(),
+		"count": sh(`printf '%d' "$#"`, "."),
+		"fail":  sh(`echo oops >&2; exit 3`),
+		"tolerated": func() Command {
+			cmd := sh(`echo oops >&2; exit 3`)
+			cmd.AllowFailure = true
+			return cmd
+		}(),
+		"slow": func() Command {
+			cmd := sh(`exec sleep 5`)
+			cmd.Timeout = 50 * time.Millisecond
+			return cmd
+		}(),
+		"verbose": func() Command {
+			cmd := sh(`printf '0123456789'`)
+			cmd.MaxOutput = 4
+			return cmd
+		}(),
+	}
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+		err      string
+	}{
+		{"passthrough", `exec "echo" "a" 1 true`, "a 1 true\n", ""},
+		{"templated args", `exec "greet" "world"`, "hello, world", ""},
+		{"scrubbed env", `exec "env"`, "[][shared]", ""},
+		{"expanded args", `exec "count" "a" "b" "c"`, "3", ""},
+		{"failure", `exec "fail"`, "", `command "fail" exited with status 3: oops`},
+		{"allowed failure", `$r := exec "tolerated"; $r.ExitCode; " "; $r.Stderr`, "3 oops\n", ""},
+		{"timeout", `exec "slow"`, "", `command "slow" timed out after 50ms`},
+		{"output limit", `exec "verbose"`, "", `output of command "verbose" exceeds 4 bytes`},
+		{"not allowed", `exec "rm" "-rf" "/"`, "", `command "rm" not allowed`},
+		{"missing arg", `exec "greet"`, "", `argument ".[0]" of command "greet"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := Must(New(test.name).Funcs(CommandFuncs(commands)).Parse(test.input))
+
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, nil)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		tmpl := Must(New("canceled").Funcs(CommandFuncs(map[string]Command{
+			"sleep": sh(`exec sleep 5`),
+		})).Parse(`exec "sleep"`))
+
+		start := time.Now()
+		err := tmpl.ExecuteContext(ctx, &strings.Builder{}, nil)
+		assert.ErrorContains(t, err, `command "sleep": context deadline exceeded`)
+		assert.Less(t, time.Since(start), 4*time.Second)
+	})
+
+	assert.Panics(t, func() { CommandFuncs(map[string]Command{"bad": {Path: "echo", Args: []string{"if"}}}) })
+
+	tmpl := Restricted("restricted").Funcs(CommandFuncs(commands))
+	_, err := tmpl.Parse(`exec "echo"`)
+	assert.ErrorContains(t, err, `function "exec" not defined`)
+}
@@ -0,0 +1,70 @@
+package tlang
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ExecuteContext is like Execute, but stops the execution with an error
+// wrapping the error of ctx when it is done, and exposes values of ctx to
+// templates, see ContextValues.
+func (t *Template) ExecuteContext(ctx context.Context, wr io.Writer, data any) error {
+	return t.execute(wr, data, &ExecOptions{Context: ctx}, nil)
+}
+
+// ContextFuncs returns functions accessing the context of the execution, see
+// ExecuteContext:
+//
+//	ctxValue name
+//		Returns the value of the context for the key exposed as name by
+//		Template.ContextValues, nil if the context has none, e.g.
+//		ctxValue "traceID". Names not exposed are errors.
+func ContextFuncs() FuncMap {
+	return FuncMap{
+		"ctxValue": func(env Env, name string) (any, error) {
+			return env.ContextValue(name)
+		},
+	}
+}
+
+// ContextValues exposes values of the context of executions of t to
+// templates, see ContextFuncs, keys maps names used in templates to the
+// keys of the values in the context, so that request-scoped values like
+// trace IDs or locales can be used without adding them to the data. Values
+// of other keys are never exposed. The return value is the template, so
+// calls can be chained.
+func (t *Template) ContextValues(keys map[string]any) *Template {
+	return t.configure("ContextValues", func() {
+		exposed := make(map[string]any, len(t.option.ctxKeys)+len(keys))
+		for name, key := range t.option.ctxKeys {
+			exposed[name] = key
+		}
+		for name, key := range keys {
+			exposed[name] = key
+		}
+		t.option.ctxKeys = exposed
+	})
+}
+
+func (e *execEnv) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+func (e *execEnv) ContextValue(name string) (any, error) {
+	key, ok := e.ctxKeys[name]
+	if !ok {
+		names := make([]string, 0, len(e.ctxKeys))
+		for n := range e.ctxKeys {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("context value %q not exposed, exposed values: %q", name, names)
+	}
+
+	return e.Context().Value(key), nil
+}
@@ -0,0 +1,47 @@
+package tlang
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testContextKey string
+
+func TestExecuteContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), testContextKey("trace"), "abc123")
+	ctx = context.WithValue(ctx, testContextKey("token"), "secret")
+
+	tmpl := Must(New("test").Funcs(ContextFuncs()).ContextValues(map[string]any{
+		"traceID": testContextKey("trace"),
+		"locale":  testContextKey("locale"),
+	}).Parse(`"trace="; ctxValue "traceID"; " locale="; ctxValue "locale"`))
+
+	var sb strings.Builder
+	assert.NoError(t, tmpl.ExecuteContext(ctx, &sb, nil))
+	assert.Equal(t, "trace=abc123 locale=<no value>", sb.String())
+
+	// without context
+	sb.Reset()
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+	assert.Equal(t, "trace=<no value> locale=<no value>", sb.String())
+
+	tmpl = Must(tmpl.New("token").Parse(`ctxValue "token"`))
+	err := tmpl.ExecuteContext(ctx, &sb, nil)
+	assert.ErrorContains(t, err, `context value "token" not exposed, exposed values: ["locale" "traceID"]`)
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		tmpl := Must(New("test").Funcs(FuncMap{
+			"cancel": func() string { cancel(); return "" },
+		}).Parse(`"a"; cancel; "b"`))
+
+		var sb strings.Builder
+		err := tmpl.ExecuteContext(ctx, &sb, nil)
+		assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+		assert.Equal(t, "a", sb.String())
+	})
+}
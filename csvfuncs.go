@@ -0,0 +1,183 @@
+package tlang
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSVFuncs returns functions reading tabular data:
+//
+//	csv input [options...]
+//		Returns records of the CSV input, a string, []byte or io.Reader.
+//		Records are maps from header fields (the first record) to values,
+//		so that fields are accessed by name (e.g. .name), missing values
+//		are empty strings. Records of an io.Reader are read one at a time
+//		when iterated by range, see Cursor. Options in "key=value" form:
+//		- header=true|false: whether the first record is the header,
+//		  defaults to true, records are lists of values if false.
+//		- comma=C: field delimiter, defaults to ",".
+//		- comment=C: lines starting with C are ignored.
+//		- trim=true|false: trim leading space of fields.
+//	tsv input [options...]
+//		Like csv, with tab delimited fields.
+//
+// For example:
+//
+//	range csv .Data
+//	  .name; ": "; .email; "\n"
+//	end
+func CSVFuncs() FuncMap {
+	return FuncMap{
+		"csv": func(input any, options ...string) (any, error) {
+			return readCSV(input, ',', options)
+		},
+		"tsv": func(input any, options ...string) (any, error) {
+			return readCSV(input, '\t', options)
+		},
+	}
+}
+
+// CSVCursor is a Cursor over records read from CSV input, see CSVFuncs for
+// the form of records.
+type CSVCursor struct {
+	r      *csv.Reader
+	header []string
+	noHead bool
+
+	record []string
+	err    error
+}
+
+// NewCSVCursor creates a CSVCursor reading r, configured by options in
+// "key=value" form, see CSVFuncs for available options.
+func NewCSVCursor(r io.Reader, options ...string) (*CSVCursor, error) {
+	return newCSVCursor(r, ',', options)
+}
+
+func newCSVCursor(r io.Reader, comma rune, options []string) (*CSVCursor, error) {
+	c := &CSVCursor{r: csv.NewReader(r)}
+	c.r.Comma = comma
+	c.r.FieldsPerRecord = -1
+
+	for _, opt := range options {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "header", "trim":
+			var b bool
+			switch value {
+			case "true":
+				b = true
+			case "false":
+			default:
+				return nil, fmt.Errorf("csv: invalid %s %q", key, value)
+			}
+			if key == "header" {
+				c.noHead = !b
+			} else {
+				c.r.TrimLeadingSpace = b
+			}
+		case "comma", "comment":
+			ch, size := utf8.DecodeRuneInString(value)
+			if size == 0 || size != len(value) {
+				return nil, fmt.Errorf("csv: invalid %s %q", key, value)
+			}
+			if key == "comma" {
+				c.r.Comma = ch
+			} else {
+				c.r.Comment = ch
+			}
+		default:
+			return nil, fmt.Errorf("csv: unknown option %q", opt)
+		}
+	}
+
+	return c, nil
+}
+
+// Next implements Cursor.
+func (c *CSVCursor) Next() bool {
+	if c.err != nil {
+		return false
+	}
+
+	if c.header == nil && !c.noHead {
+		c.header, c.err = c.r.Read()
+		if c.err != nil {
+			return false
+		}
+	}
+
+	c.record, c.err = c.r.Read()
+	return c.err == nil
+}
+
+// Value implements Cursor, it returns the current record.
+func (c *CSVCursor) Value() (any, error) {
+	if c.noHead {
+		return c.record, nil
+	}
+
+	ret := make(map[string]string, len(c.header))
+	for i, name := range c.header {
+		if i < len(c.record) {
+			ret[name] = c.record[i]
+		} else {
+			ret[name] = ""
+		}
+	}
+	return ret, nil
+}
+
+// Err implements Cursor.
+func (c *CSVCursor) Err() error {
+	if c.err == io.EOF {
+		return nil
+	}
+	return c.err
+}
+
+// readCSV reads all records of input, or returns a cursor if input is an
+// io.Reader.
+func readCSV(input any, comma rune, options []string) (any, error) {
+	var r io.Reader
+	switch in := input.(type) {
+	case string:
+		r = strings.NewReader(in)
+	case []byte:
+		r = bytes.NewReader(in)
+	case io.Reader:
+		return newCSVCursor(in, comma, options)
+	default:
+		return nil, fmt.Errorf("csv: unsupported input type %T", input)
+	}
+
+	c, err := newCSVCursor(r, comma, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		records []map[string]string
+		rows    [][]string
+	)
+	for c.Next() {
+		v, _ := c.Value()
+		if c.noHead {
+			rows = append(rows, v.([]string))
+		} else {
+			records = append(records, v.(map[string]string))
+		}
+	}
+	if err = c.Err(); err != nil {
+		return nil, err
+	}
+
+	if c.noHead {
+		return rows, nil
+	}
+	return records, nil
+}
@@ -0,0 +1,45 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVFuncs(t *testing.T) {
+	const data = "name,email\nbob,bob@example.com\nalice\n"
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		data     any
+		expected string
+		err      string
+	}{
+		{"header", `range csv .; .name; "="; .email; ";"; end`, data, "bob=bob@example.com;alice=;", ""},
+		{"reader", `range $i, $r := csv .; $i; $r.name; end`, strings.NewReader(data), "0bob1alice", ""},
+		{"sorted reader", `range sorted csv . by .name; .name; end`, strings.NewReader(data), "alicebob", ""},
+		{"no header", `range csv . "header=false"; range .; .; end; ";"; end`, data, "nameemail;bobbob@example.com;alice;", ""},
+		{"tsv", `range tsv .; .b; end`, "a\tb\n1\t2\n", "2", ""},
+		{"options", `range csv . "comma=;" "comment=#" "trim=true"; .b; end`, "a;b\n# skipped\n1; 2\n", "2", ""},
+		{"empty", `range csv .; .; else; "none"; end`, "", "none", ""},
+		{"unknown option", `csv . "x=1"`, data, "", `csv: unknown option "x=1"`},
+		{"bad input", `range csv .; end`, "a\n\"b\n", "", `extraneous or missing " in quoted-field`},
+		{"bad reader", `range csv .; end`, strings.NewReader("a\n\"b\n"), "", `extraneous or missing " in quoted-field`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := Must(New(test.name).Funcs(CSVFuncs()).Parse(test.input))
+
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, test.data)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+}
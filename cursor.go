@@ -0,0 +1,197 @@
+package tlang
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Cursor is implemented by data sources range iterates one element at a
+// time, so that large results, e.g. database rows, are streamed through the
+// template instead of being loaded at once.
+//
+// range calls Next before each element and Value to get it, Err is checked
+// when Next returns false. If the cursor implements io.Closer, it is closed
+// when range finishes, including by break or an error.
+type Cursor interface {
+	Next() bool
+	Value() (any, error)
+	Err() error
+}
+
+var cursorType = reflect.TypeOf((*Cursor)(nil)).Elem()
+
+// entryCursor is implemented by cursors of this package setting both the
+// index and the element of range, instead of the position and Value.
+type entryCursor interface {
+	Cursor
+	entry() (index, elem reflect.Value)
+}
+
+// asCursor returns v as a Cursor if v implements it.
+func asCursor(v reflect.Value) (Cursor, bool) {
+	v = indirectInterface(v)
+	if !v.IsValid() || !v.Type().Implements(cursorType) {
+		return nil, false
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+	}
+
+	if !v.CanInterface() {
+		return nil, false
+	}
+
+	c, ok := v.Interface().(Cursor)
+	return c, ok
+}
+
+// rangeCursor calls f with each element of c, it reports whether there was
+// any element.
+func (s *state) rangeCursor(c Cursor, f func(index, elem reflect.Value)) bool {
+	if closer, ok := c.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	ec, isEntries := c.(entryCursor)
+	i := 0
+	for ; c.Next(); i++ {
+		if isEntries {
+			f(ec.entry())
+			continue
+		}
+		v, err := c.Value()
+		if err != nil {
+			s.errorf("range: reading element %d: %w", i, err)
+		}
+		f(reflect.ValueOf(i), reflect.ValueOf(v))
+	}
+	if err := c.Err(); err != nil {
+		s.errorf("range: %w", err)
+	}
+
+	return i != 0
+}
+
+// cursorEntries collects indices and elements of c for sorted range.
+func (s *state) cursorEntries(c Cursor) (indices, elems []reflect.Value) {
+	s.rangeCursor(c, func(index, elem reflect.Value) {
+		indices = append(indices, index)
+		elems = append(elems, elem)
+	})
+	return
+}
+
+// SQLRows returns a Cursor over rows, elements are maps from column names to
+// column values, []byte values are converted to strings:
+//
+//	range $user := sqlRows
+//	  $user.name; " "; $user.email
+//	end
+//
+// Rows are closed when range finishes.
+func SQLRows(rows *sql.Rows) Cursor {
+	return &sqlCursor{rows: rows}
+}
+
+// SQLRowsOf returns a Cursor over rows like SQLRows, but elements are
+// values of the struct type T, columns are mapped to fields by the `db`
+// struct tag, or else by field name case-insensitively, columns without
+// matching fields are discarded.
+//
+// It panics if T is not a struct type.
+func SQLRowsOf[T any](rows *sql.Rows) Cursor {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		panic(fmt.Errorf("SQLRowsOf: %v is not a struct type", typ))
+	}
+
+	return &sqlCursor{rows: rows, typ: typ}
+}
+
+type sqlCursor struct {
+	rows *sql.Rows
+	typ  reflect.Type // struct type of elements, nil for maps.
+
+	cols   []string
+	fields [][]int // field indices by column, nil if discarded.
+}
+
+func (c *sqlCursor) Next() bool { return c.rows.Next() }
+
+func (c *sqlCursor) Err() error { return c.rows.Err() }
+
+func (c *sqlCursor) Close() error { return c.rows.Close() }
+
+func (c *sqlCursor) Value() (any, error) {
+	if c.cols == nil {
+		cols, err := c.rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		c.cols = cols
+		if c.typ != nil {
+			c.fields = columnFields(c.typ, cols)
+		}
+	}
+
+	dest := make([]any, len(c.cols))
+	if c.typ != nil {
+		elem := reflect.New(c.typ).Elem()
+		for i, index := range c.fields {
+			if index == nil {
+				dest[i] = new(any)
+				continue
+			}
+			dest[i] = elem.FieldByIndex(index).Addr().Interface()
+		}
+
+		if err := c.rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		return elem.Interface(), nil
+	}
+
+	for i := range dest {
+		dest[i] = new(any)
+	}
+	if err := c.rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]any, len(c.cols))
+	for i, col := range c.cols {
+		v := *dest[i].(*any)
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		ret[col] = v
+	}
+	return ret, nil
+}
+
+// columnFields returns indices of exported fields of the struct type typ
+// matching cols.
+func columnFields(typ reflect.Type, cols []string) [][]int {
+	ret := make([][]int, len(cols))
+	for i, col := range cols {
+		for _, f := range reflect.VisibleFields(typ) {
+			if !f.IsExported() || f.Anonymous {
+				continue
+			}
+
+			name, _, _ := strings.Cut(f.Tag.Get("db"), ",")
+			if name == col || name == "" && strings.EqualFold(f.Name, col) {
+				ret[i] = f.Index
+				break
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,96 @@
+package tlang
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver serves the same fixed rows for every query.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error                               { return nil }
+func (fakeStmt) NumInput() int                              { return -1 }
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &fakeRows{rows: [][]driver.Value{
+		{"bob", int64(30), []byte("bob@example.com")},
+		{"alice", int64(25), []byte("alice@example.com")},
+	}}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"name", "age", "email_address"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("tlangtest", fakeDriver{})
+}
+
+func TestSQLRows(t *testing.T) {
+	db, err := sql.Open("tlangtest", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	query := func() *sql.Rows {
+		rows, err := db.Query("SELECT")
+		assert.NoError(t, err)
+		return rows
+	}
+
+	type user struct {
+		Name  string
+		Age   int
+		Email string `db:"email_address"`
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		cursor   func() Cursor
+		expected string
+	}{
+		{"Maps", `range $i, $u := .; $i; $u.name; $u.email_address; end`, func() Cursor { return SQLRows(query()) }, "0bobbob@example.com1alicealice@example.com"},
+		{"Structs", `range .; .Name; .Age; .Email; end`, func() Cursor { return SQLRowsOf[user](query()) }, "bob30bob@example.comalice25alice@example.com"},
+		{"Sorted", `range sorted . by .age; .name; end`, func() Cursor { return SQLRows(query()) }, "alicebob"},
+		{"Break", `range .; .name; break; end`, func() Cursor { return SQLRows(query()) }, "bob"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var sb strings.Builder
+			assert.NoError(t, Must(New(test.name).Parse(test.text)).Execute(&sb, test.cursor()))
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	t.Run("Closed", func(t *testing.T) {
+		rows := query()
+		assert.NoError(t, Must(New("x").Parse(`range .; break; end`)).Execute(io.Discard, SQLRows(rows)))
+		assert.False(t, rows.Next())
+	})
+}
@@ -0,0 +1,230 @@
+// Package data assembles the data templates are executed with from
+// environment variables, command-line flags and YAML or JSON files, so that
+// CLIs built on tlang merge their data consistently.
+//
+// Providers load maps with string keys, which are merged by Merge in order,
+// values of later providers take precedence, and nested maps are merged
+// recursively, e.g. defaults from files overridden by the environment and
+// then by flags:
+//
+//	dot, err := data.Merge(
+//		data.Files("defaults.yaml", "site.json"),
+//		data.Env("SITE_"),
+//		data.Flags(flag.CommandLine),
+//	)
+package data
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Provider provides a part of the data.
+type Provider interface {
+	Load() (map[string]any, error)
+}
+
+// ProviderFunc is a function implementing Provider.
+type ProviderFunc func() (map[string]any, error)
+
+// Load implements Provider.
+func (f ProviderFunc) Load() (map[string]any, error) {
+	return f()
+}
+
+// Merge loads the data of providers and merges it in order.
+func Merge(providers ...Provider) (map[string]any, error) {
+	ret := make(map[string]any)
+	for _, p := range providers {
+		m, err := p.Load()
+		if err != nil {
+			return nil, err
+		}
+		merge(ret, m)
+	}
+	return ret, nil
+}
+
+// merge merges src into dst, maps in both are merged recursively, other
+// values of src replace values of dst.
+func merge(dst, src map[string]any) {
+	for k, v := range src {
+		sm, ok := v.(map[string]any)
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		dm, ok := dst[k].(map[string]any)
+		if !ok {
+			dm = make(map[string]any, len(sm))
+			dst[k] = dm
+		}
+		merge(dm, sm)
+	}
+}
+
+// set sets the value at the path of keys in m, creating maps along the path,
+// a path through a value which is not a map replaces it.
+func set(m map[string]any, path []string, value any) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			m[k] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = value
+}
+
+// Env provides the environment variables with the prefix, as strings by
+// their lowercased names without the prefix, so that they match keys of
+// files, double underscores in names separate keys of nested maps, e.g. with
+// prefix "APP_", APP_DB__HOST=x is {"db": {"host": "x"}}.
+func Env(prefix string) Provider {
+	return ProviderFunc(func() (map[string]any, error) {
+		ret := make(map[string]any)
+		for _, kv := range os.Environ() {
+			name, value, _ := strings.Cut(kv, "=")
+			if !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+				continue
+			}
+
+			set(ret, strings.Split(strings.ToLower(name[len(prefix):]), "__"), value)
+		}
+		return ret, nil
+	})
+}
+
+// Flags provides the flags of fs set on the command line, by their names,
+// dots in names separate keys of nested maps. Values of flags implementing
+// flag.Getter, like all flags defined by the flag package, are provided as
+// returned by Get, other values as strings, and data of flags implementing
+// Provider, like Sets, is merged at the top level. fs must be parsed before
+// the data is loaded.
+func Flags(fs *flag.FlagSet) Provider {
+	return ProviderFunc(func() (ret map[string]any, err error) {
+		ret = make(map[string]any)
+		fs.Visit(func(f *flag.Flag) {
+			switch v := f.Value.(type) {
+			case Provider:
+				m, e := v.Load()
+				if e != nil && err == nil {
+					err = fmt.Errorf("flag -%s: %w", f.Name, e)
+				}
+				merge(ret, m)
+			case flag.Getter:
+				set(ret, strings.Split(f.Name, "."), v.Get())
+			default:
+				set(ret, strings.Split(f.Name, "."), v.String())
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ret, nil
+	})
+}
+
+// Sets is a flag.Value collecting key=value assignments from repeated flags,
+// e.g. -set db.host=localhost -set db.port=5432, dots in keys separate keys
+// of nested maps. Values are decoded as YAML, so that numbers and booleans
+// are typed, later assignments override earlier ones.
+//
+// Sets is also a Provider of the assignments.
+type Sets []string
+
+// String implements flag.Value.
+func (s *Sets) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set implements flag.Value.
+func (s *Sets) Set(value string) error {
+	key, _, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid assignment %q, want key=value", value)
+	}
+
+	*s = append(*s, value)
+	return nil
+}
+
+// Load implements Provider.
+func (s *Sets) Load() (map[string]any, error) {
+	ret := make(map[string]any)
+	for _, kv := range *s {
+		key, text, _ := strings.Cut(kv, "=")
+
+		var value any = text
+		if text != "" {
+			// invalid YAML like "a: b: c" is kept as text
+			if err := yaml.Unmarshal([]byte(text), &value); err == nil {
+				value = normalize(value)
+			}
+		}
+		set(ret, strings.Split(key, "."), value)
+	}
+	return ret, nil
+}
+
+// Files provides the data of YAML or JSON files, which must contain maps,
+// merged in order.
+func Files(paths ...string) Provider {
+	return ProviderFunc(func() (map[string]any, error) {
+		ret := make(map[string]any)
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			var m any
+			// YAML is a superset of JSON, decoding both the same way keeps
+			// types of numbers consistent
+			if err := yaml.Unmarshal(content, &m); err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", path, err)
+			}
+
+			switch m := normalize(m).(type) {
+			case nil:
+				// empty file
+			case map[string]any:
+				merge(ret, m)
+			default:
+				return nil, fmt.Errorf("decoding %s: want a map, got %T", path, m)
+			}
+		}
+		return ret, nil
+	})
+}
+
+// normalize converts maps with keys of other types than string decoded from
+// YAML to maps with string keys, recursively.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+		return v
+	case map[any]any:
+		ret := make(map[string]any, len(v))
+		for k, e := range v {
+			ret[fmt.Sprint(k)] = normalize(e)
+		}
+		return ret
+	case []any:
+		for i, e := range v {
+			v[i] = normalize(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
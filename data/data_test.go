@@ -0,0 +1,65 @@
+package data
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	defaults := write("defaults.yaml", "name: site\ndb:\n  host: localhost\n  port: 5432\ntags: [a, b]\n1: one\n")
+	site := write("site.json", `{"db": {"host": "db.internal"}, "debug": false}`)
+
+	t.Setenv("SITE_DB__USER", "admin")
+	t.Setenv("SITE_NAME", "env")
+	t.Setenv("OTHER_NAME", "other")
+	t.Setenv("SITE_", "ignored")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("debug", false, "")
+	fs.Int("db.port", 0, "")
+	fs.String("unset", "default", "")
+	var sets Sets
+	fs.Var(&sets, "set", "")
+	require.NoError(t, fs.Parse([]string{
+		"-debug", "-db.port=6432",
+		"-set", "db.pool=10", "-set", "name=flags", "-set", "extra.ratio=0.5", "-set", "raw=a: b: c", "-set", "empty=",
+	}))
+
+	dot, err := Merge(Files(defaults, site), Env("SITE_"), Flags(fs))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"name": "flags",
+		"db": map[string]any{
+			"host": "db.internal",
+			"port": 6432,
+			"user": "admin",
+			"pool": 10,
+		},
+		"tags":  []any{"a", "b"},
+		"1":     "one",
+		"debug": true,
+		"extra": map[string]any{"ratio": 0.5},
+		"raw":   "a: b: c",
+		"empty": "",
+	}, dot)
+
+	_, err = Merge(Files(filepath.Join(dir, "missing.yaml")))
+	assert.Error(t, err)
+
+	_, err = Merge(Files(write("list.yaml", "- a\n")))
+	assert.ErrorContains(t, err, "want a map")
+
+	assert.Error(t, sets.Set("novalue"))
+}
@@ -0,0 +1,289 @@
+package tlang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// OutputDiff is the difference between a previous output and a new
+// rendering of a template, see Template.DiffOutput.
+type OutputDiff struct {
+	// Output is the new output.
+	Output []byte
+
+	// Result is the result of the rendering, with its source map.
+	Result *ExecResult
+
+	// Unified is the unified diff from the previous to the new output, with
+	// three lines of context, empty if the output did not change.
+	Unified string
+
+	// Changes are the lines of the new output not in the previous one, in
+	// order, attributed to the actions producing them.
+	Changes []LineChange
+
+	// Removed is the number of lines of the previous output not in the new
+	// one.
+	Removed int
+}
+
+// Changed reports whether the output differs from the previous one.
+func (d *OutputDiff) Changed() bool {
+	return len(d.Changes) != 0 || d.Removed != 0
+}
+
+// LineChange is a line added or changed in the new output.
+type LineChange struct {
+	// Line is the line number in the new output, starting at 1.
+	Line int
+
+	// Text is the line without its line ending.
+	Text string
+
+	// Spans are the parts of the source map overlapping the line.
+	Spans []SourceSpan
+}
+
+// diffContext is the number of unchanged lines around changes in unified
+// diffs.
+const diffContext = 3
+
+// DiffOutput renders the template with data like ExecuteWithResult, the
+// source map is always recorded, and compares the output with prev, the
+// output of a previous rendering, to preview what changed and why.
+func (t *Template) DiffOutput(prev []byte, data any, opts *ExecOptions) (*OutputDiff, error) {
+	o := ExecOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.SourceMap = true
+
+	var buf bytes.Buffer
+	result, err := t.ExecuteWithResult(&buf, data, &o)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		a   = splitLines(prev)
+		b   = splitLines(buf.Bytes())
+		ops = diffLines(a, b)
+		ret = &OutputDiff{Output: buf.Bytes(), Result: result}
+	)
+
+	offsets := make([]int64, len(b)+1)
+	for i, line := range b {
+		offsets[i+1] = offsets[i] + int64(len(line))
+	}
+
+	for _, op := range ops {
+		switch op.kind {
+		case '-':
+			ret.Removed++
+		case '+':
+			ret.Changes = append(ret.Changes, LineChange{
+				Line:  op.b + 1,
+				Text:  strings.TrimSuffix(b[op.b], "\n"),
+				Spans: result.spans(offsets[op.b], offsets[op.b+1]),
+			})
+		}
+	}
+
+	if ret.Changed() {
+		ret.Unified = unifiedDiff("previous", t.Name(), a, b, ops)
+	}
+
+	return ret, nil
+}
+
+// DiffFile is like DiffOutput, with the previous output read from file, a
+// missing file is an empty previous output.
+func (t *Template) DiffFile(file string, data any, opts *ExecOptions) (*OutputDiff, error) {
+	prev, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return t.DiffOutput(prev, data, opts)
+}
+
+// spans returns parts of the source map overlapping the output from start to
+// end.
+func (r *ExecResult) spans(start, end int64) (ret []SourceSpan) {
+	i := sort.Search(len(r.SourceMap), func(i int) bool {
+		return r.SourceMap[i].End > start
+	})
+	for ; i < len(r.SourceMap) && r.SourceMap[i].Start < end; i++ {
+		ret = append(ret, r.SourceMap[i])
+	}
+	return
+}
+
+// splitLines splits text into lines with their line endings.
+func splitLines(text []byte) []string {
+	if len(text) == 0 {
+		return nil
+	}
+
+	lines := strings.SplitAfter(string(text), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOp is an operation of an edit script from lines a to lines b, kind is
+// ' ' for a line kept, '-' for a line of a removed, '+' for a line of b
+// inserted, a and b are positions in both before the operation.
+type diffOp struct {
+	kind byte
+	a, b int
+}
+
+// diffLines returns the shortest edit script from a to b, with the Myers
+// algorithm.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	var (
+		v     = make([]int, 2*max+2)
+		trace [][]int
+	)
+	// prev returns the diagonal the furthest path to diagonal k in round d
+	// comes from.
+	prev := func(v []int, d, k int) int {
+		if k == -d || k != d && v[max+k-1] < v[max+k+1] {
+			return k + 1
+		}
+		return k - 1
+	}
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if pk := prev(v, d, k); pk == k+1 {
+				x = v[max+pk]
+			} else {
+				x = v[max+pk] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[max+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		pk := prev(v, d, x-y)
+		px := v[max+pk]
+		py := px - pk
+
+		for x > px && y > py {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', x, y})
+		}
+		if d > 0 {
+			if x == px {
+				y--
+				ops = append(ops, diffOp{'+', x, y})
+			} else {
+				x--
+				ops = append(ops, diffOp{'-', x, y})
+			}
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// unifiedDiff formats ops from lines a to lines b as a unified diff.
+func unifiedDiff(nameA, nameB string, a, b []string, ops []diffOp) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk while changes are close enough to share context
+		start, end := i-diffContext, i
+		for j := i; j < len(ops) && j-end <= 2*diffContext+1; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		if start < 0 {
+			start = 0
+		}
+		i = end + 1
+		end += diffContext
+		if end >= len(ops) {
+			end = len(ops) - 1
+		}
+
+		hunk := ops[start : end+1]
+		countA, countB := 0, 0
+		for _, op := range hunk {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(hunk[0].a, countA), hunkRange(hunk[0].b, countB))
+
+		for _, op := range hunk {
+			line := b[op.b:]
+			if op.kind == '-' {
+				line = a[op.a:]
+			}
+			sb.WriteByte(op.kind)
+			sb.WriteString(line[0])
+			if !strings.HasSuffix(line[0], "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// hunkRange formats the range of count lines from the 0-based start in hunk
+// headers.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,82 @@
+package tlang
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffOutput(t *testing.T) {
+	tmpl := Must(New("config").Parse(`"name: "; .Name; "\n"
+range .Items; "- "; .; "\n"; end
+"end\n"
+`))
+
+	data := map[string]any{"Name": "a", "Items": []string{"x", "y", "z"}}
+	var prev strings.Builder
+	require.NoError(t, tmpl.Execute(&prev, data))
+
+	d, err := tmpl.DiffOutput([]byte(prev.String()), data, nil)
+	require.NoError(t, err)
+	assert.False(t, d.Changed())
+	assert.Empty(t, d.Unified)
+	assert.Equal(t, prev.String(), string(d.Output))
+
+	data["Items"] = []string{"x", "w", "z"}
+	d, err = tmpl.DiffOutput([]byte(prev.String()), data, nil)
+	require.NoError(t, err)
+	assert.True(t, d.Changed())
+	assert.Equal(t, 1, d.Removed)
+	assert.Equal(t, `--- previous
++++ config
+@@ -1,5 +1,5 @@
+ name: a
+ - x
+-- y
++- w
+ - z
+ end
+`, d.Unified)
+
+	if assert.Len(t, d.Changes, 1) {
+		c := d.Changes[0]
+		assert.Equal(t, 3, c.Line)
+		assert.Equal(t, "- w", c.Text)
+		var locations []string
+		for _, span := range c.Spans {
+			locations = append(locations, span.Location)
+		}
+		assert.Equal(t, []string{"config:2:14", "config:2:20", "config:2:23"}, locations)
+	}
+
+	file := filepath.Join(t.TempDir(), "out")
+	d, err = tmpl.DiffFile(file, data, nil)
+	require.NoError(t, err)
+	assert.Len(t, d.Changes, 5)
+	assert.True(t, strings.HasPrefix(d.Unified, "--- previous\n+++ config\n@@ -0,0 +1,5 @@\n+name: a\n"))
+
+	require.NoError(t, os.WriteFile(file, d.Output, 0o644))
+	d, err = tmpl.DiffFile(file, data, nil)
+	require.NoError(t, err)
+	assert.False(t, d.Changed())
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want string
+	}{
+		{"a\nb\n", "a\nb", "@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n", "@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -7,4 +8,3 @@\n 7\n 8\n 9\n-10\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n", "0\n1\n2\n3\n4\n5\n6\n", "@@ -1,7 +1,7 @@\n+0\n 1\n 2\n 3\n 4\n 5\n 6\n-7\n"},
+		{"a\n", "", "@@ -1 +0,0 @@\n-a\n"},
+	} {
+		a, b := splitLines([]byte(test.a)), splitLines([]byte(test.b))
+		got := unifiedDiff("a", "b", a, b, diffLines(a, b))
+		assert.Equal(t, "--- a\n+++ b\n"+test.want, got, "%q -> %q", test.a, test.b)
+	}
+}
@@ -21,7 +21,10 @@ The input text for a template is UTF-8-encoded text in any format.
 Except for raw strings, actions may not span newlines, although comments can.
 
 Once parsed, a template may be executed safely in parallel, although if parallel
-executions share a Writer the output may be interleaved.
+executions share a Writer the output may be interleaved. Executions may also
+run concurrently with calls of Parse, Funcs, Option and other methods changing
+templates, each execution uses the options and functions set when it starts,
+see Template.Freeze and Template.Seal to seal templates once they are complete.
 
 Here is a trivial example that prints "17 items are made of wool".
 
@@ -85,7 +88,7 @@ data, defined in detail in the corresponding sections that follow.
 		If the value of the pipeline is empty, no output is generated;
 		otherwise, T1 is executed. The empty values are false, 0, any
 		nil pointer or interface value, and any array, slice, map, or
-		string of length zero.
+		string of length zero, unless changed by the truthiness option.
 		Dot is unaffected.
 
 	{{if pipeline}} T1 {{else}} T0 {{end}}
@@ -99,26 +102,127 @@ data, defined in detail in the corresponding sections that follow.
 			{{if pipeline}} T1 {{else}}{{if pipeline}} T0 {{end}}{{end}}
 
 	{{range pipeline}} T1 {{end}}
-		The value of the pipeline must be an array, slice, map, or channel.
-		If the value of the pipeline has length zero, nothing is output;
-		otherwise, dot is set to the successive elements of the array,
-		slice, or map and T1 is executed. If the value is a map and the
-		keys are of basic type with a defined order, the elements will be
-		visited in sorted key order.
+		The value of the pipeline must be an array, slice, map, channel
+		or integer. If the value of the pipeline has length zero, nothing
+		is output; otherwise, dot is set to the successive elements of the
+		array, slice, or map and T1 is executed. If the value is a map and
+		the keys are of basic type with a defined order, the elements will
+		be visited in sorted key order. Like in Go, an integer n is ranged
+		over as the numbers 0 to n-1, of the type of n.
 
 	{{range pipeline}} T1 {{else}} T0 {{end}}
-		The value of the pipeline must be an array, slice, map, or channel.
+		The value of the pipeline must be an array, slice, map, channel
+		or integer.
 		If the value of the pipeline has length zero, dot is unaffected and
 		T0 is executed; otherwise, dot is set to the successive elements
 		of the array, slice, or map and T1 is executed.
 
+	{{range pipeline}} T1 {{else $var}} T0 {{end}}
+		Like range with else, but $var is set to the reason T0 is
+		executed in T0: "nil" if the value is nil or missing, "empty" if
+		it has no elements, or "type" if it can't be iterated over, which
+		is an error otherwise.
+
+	{{range sorted pipeline}} T1 {{end}}
+		Like range, but all elements are collected first and visited in
+		ascending order of their values, or of their keys for maps. Only
+		numbers and strings can be sorted. An {{else}} is also allowed.
+
+	{{range sorted pipeline by pipeline}} T1 {{end}}
+		Like range sorted, but elements are ordered by the value of the
+		pipeline after "by", evaluated with dot set to each element and
+		with variables declared by the range set accordingly. Elements
+		with equal sort keys keep their original order.
+
+	{{range pipeline | stage | ...}} T1 {{end}}
+		Like range, but elements are passed through the stages in order
+		before T1 is executed for each of them. Elements are pulled
+		through the stages one at a time, so that channels and cursors
+		are not read past a limit. The stages are:
+
+		filter pipeline
+			Keep elements for which the pipeline, evaluated with dot
+			set to the element and with variables declared by the
+			range set accordingly, is true.
+		sortBy [key...]
+			Sort elements in ascending order of the fields or map keys
+			named by the keys, or of the elements if there is no key,
+			a key prefixed with "-" sorts in descending order. All
+			remaining elements are collected when sorting.
+		limit n
+			Stop after n elements.
+		chunk n
+			Group every n consecutive elements into a slice, the last
+			one may be shorter, e.g. rows of a grid. Indices are the
+			numbers of the chunks.
+		window n
+			Slide a window of n consecutive elements over elements,
+			yielding a slice for each position. Indices are the
+			positions of the first elements.
+
+		For example:
+
+		{{range .Items | filter .Enabled | sortBy "Name" | limit 10}}
+
+		Stages are allowed in any range, including range sorted, where
+		they are applied before sorting, and indices of elements are not
+		changed by them.
+
+		Inside a range, "sorted", "by", "filter", "sortBy", "limit",
+		"chunk" and "window" are keywords and cannot be used as function
+		names there.
+
+	{{for init; condition; post}} T1 {{end}}
+		The init pipeline is evaluated once, then T1 is executed as long
+		as the value of the condition pipeline is true, evaluating the
+		post pipeline after every iteration, e.g.
+			{{for $i := 0; $i < 10; $i = add $i 1}} T1 {{end}}
+		Variables declared by init are scoped to the loop, the three
+		pipelines may also be separated by newlines. init and post must
+		declare or assign variables. Any of them may be left empty, as
+		in {{for ; ; ;}}, without a condition the loop runs until break.
+
 	{{break}}
-		The innermost {{range pipeline}} loop is ended early, stopping the
-		current iteration and bypassing all remaining iterations.
+		The innermost {{range pipeline}} or {{for}} loop is ended early,
+		stopping the current iteration and bypassing all remaining
+		iterations.
 
 	{{continue}}
-		The current iteration of the innermost {{range pipeline}} loop is
-		stopped, and the loop starts the next iteration.
+		The current iteration of the innermost {{range pipeline}} or
+		{{for}} loop is stopped, and the loop starts the next iteration,
+		after evaluating the post pipeline of a for loop.
+
+	{{break}} and {{continue}} may be nested in if and with actions within
+	the body of a loop, but not in the {{else}} of a range unless it is
+	itself inside the body of an enclosing loop, which they then end or
+	continue.
+
+	{{try}} T1 {{end}}
+	{{try}} T1 {{catch}} T0 {{end}}
+	{{try}} T1 {{catch $err}} T0 {{end}}
+		T1 is executed, if it fails, e.g. a function returns an error,
+		execution continues after T1 with T0 executed instead of the rest
+		of T1, output already written by T1 is kept. The error, an
+		ExecError, is bound to the variable of catch if present.
+		Variables declared in T1 are not visible in T0. Errors writing
+		the output, exceeding limits set by options, and cancellation
+		are not caught.
+
+	{{switch pipeline}} {{case pipeline}} T1 {{case pipeline}} T2 {{end}}
+	{{switch pipeline}} {{case pipeline}} T1 {{default}} T0 {{end}}
+		The pipeline of the switch is evaluated once, then the list of
+		the first case whose value is equal to it, as with ==, is
+		executed, or else T0. Cases are compared in order, and nothing
+		but spaces and comments may appear before the first case.
+
+	{{switch}} {{case pipeline}} T1 {{case pipeline}} T2 {{end}}
+		Without a pipeline, the list of the first case whose value is
+		true is executed, like a chain of if and else if.
+
+		switch is a keyword only as the first word of an action, and case
+		and default only as the first word of an action in the switch,
+		elsewhere they are identifiers, e.g. {{.X | default 1}} calls a
+		function named default.
 
 	{{template "name"}}
 		The template with the specified name is executed with nil data.
@@ -127,6 +231,44 @@ data, defined in detail in the corresponding sections that follow.
 		The template with the specified name is executed with dot set
 		to the value of the pipeline.
 
+	{{template "name" arg1 arg2...}}
+		The template with the specified name, defined with parameters
+		as in {{define "name" $param1 $param2...}}, is executed with
+		its parameters set to the arguments in order, and dot unchanged.
+		Arguments are the operands following the name, the number of
+		which must match the parameters. A function call, a comparison
+		or a pipeline of several commands is a single argument, e.g.
+		{{template "greet" (upper .Name) "hi"}}.
+
+	{{template "name" param1=arg1 param2=arg2...}}
+		Like the above, with arguments bound to the parameters named
+		without dollar signs, in any order, e.g.
+		{{template "greet" greeting="hi" name=.Name}}. Every parameter
+		must be given, values are operands, e.g. function calls must be
+		parenthesized.
+
+	{{recurse pipeline}}
+		The template being defined, i.e. the innermost define or block,
+		or else the top level template, is executed with dot set to the
+		value of the pipeline, e.g. to render trees. The depth of nested
+		invocations is limited by the maxdepth option, so that runaway
+		recursion on cyclic data stops with an error.
+		(recurse pipeline) may be used as a value like template below.
+
+	{{return}}
+	{{return pipeline}}
+		Execution of the current template stops, the value of the
+		pipeline (if present) is returned to the invoking expression
+		described below.
+
+	(template "name" pipeline)
+		A template invocation may be used as a value in a pipeline when
+		parenthesized, e.g. {{$r := (template "calc" .X)}}. The value is
+		the one returned by {{return pipeline}} in the template, or the
+		output of the template if nothing is returned, in which case the
+		output is not written. The pipeline of the invocation extends to
+		the closing parenthesis.
+
 	{{block "name" pipeline}} T1 {{end}}
 		A block is shorthand for defining a template
 			{{define "name"}} T1 {{end}}
@@ -206,6 +348,16 @@ An argument is a simple value, denoted by one of the following.
 	  may be accessed by a field or map key invocation.
 		print (.F1 arg1) (.F2 arg2)
 		(.StructValuedMethod "arg").Field
+	- One of the above, other than a constant, followed by a pipeline in
+	  brackets, such as
+		.Items[0]
+		$labels["app"]
+	  The result is the element of the array, slice or string indexed by
+	  the integer value of the pipeline, or the element of the map indexed
+	  by it. Indexing out of range is an error, missing map keys are
+	  handled as map keys invoked by name. Subscripts may be chained and
+	  combined with fields:
+	    .Items[$i].Tags[0]
 
 Arguments may evaluate to any type; if they are pointers the implementation
 automatically indirects to the base type when required.
@@ -232,6 +384,28 @@ value (argument) or a function or method call, possibly with multiple arguments:
 		with the name:
 			function(Argument1, etc.)
 		Functions and function names are described below.
+	Command Operator Command
+		The result is the boolean result of comparing the values of
+		both commands, Operator is one of == != < <= > >=, with the
+		semantics of eq, ne, lt, le, gt and ge of ComparisonFuncs:
+			if len .Items > 3
+			if $x == 3
+		A value passed by a chained pipeline is the last argument of
+		the left command. Comparisons can't be chained without
+		parentheses.
+	Command && Command, Command || Command
+		Logical operations, evaluated like the and and or functions of
+		text/template: the right command is evaluated only if the left
+		one doesn't decide the result, which is the value of the last
+		command evaluated, e.g.
+			if .A && (!.B || .C)
+			.Title || "untitled"
+		Comparisons bind tighter than &&, which binds tighter than ||.
+		A value passed by a chained pipeline is the last argument of
+		the leftmost command.
+	!Argument
+		The result is true if the argument is empty, false otherwise,
+		with the truth of if.
 
 A pipeline may be "chained" by separating a sequence of commands with pipeline
 characters '|'. In a chained pipeline, the result of each command is
@@ -266,16 +440,32 @@ variables, separated by a comma:
 in which case $index and $element are set to the successive values of the
 array/slice index or map key and element, respectively. Note that if there is
 only one variable, it is assigned the element; this is opposite to the
-convention in Go range clauses.
+convention in Go range clauses. A range over an integer may only declare one
+variable.
 
 A variable's scope extends to the "end" action of the control structure ("if",
-"with", or "range") in which it is declared, or to the end of the template if
+"with", "range" or "for") in which it is declared, or to the end of the template if
 there is no such control structure. A template invocation does not inherit
 variables from the point of its invocation.
 
 When execution begins, $ is set to the data argument passed to Execute, that is,
 to the starting value of dot.
 
+Variables named with two dollar signs, like $$total, are global variables. They
+are not scoped, and are shared by all templates invoked within one execution,
+so a template can accumulate results for its caller:
+
+	$$total := 0
+	range .Items
+	  template "add" .
+	end
+	$$total
+
+where "add" may contain `$$total = add $$total .Price`. Declaring and assigning a
+global variable are the same, reading one never set is an error. A "range"
+cannot declare global variables. The host can set global variables before
+execution and read them afterwards with ExecOptions.Vars.
+
 Examples
 
 Here are some example one-line templates demonstrating pipelines and variables.
@@ -0,0 +1,234 @@
+package tlang
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Env is the environment of a template execution.
+//
+// A function (or method) whose first parameter has type Env receives the
+// environment of the executing template, the parameter is not filled by
+// template arguments, e.g. func(env Env, layout string) string is called
+// as `now "2006-01-02"`.
+type Env interface {
+	// Now returns the current time of the execution.
+	Now() time.Time
+
+	// Rand returns the random number generator of the execution, it is not
+	// safe for concurrent use.
+	Rand() *rand.Rand
+
+	// Scratch returns the key/value store of the execution, see ScratchFuncs.
+	Scratch() *Scratch
+
+	// CurrentLine returns the output written since the last newline, e.g.
+	// to indent text inserted at the current column.
+	CurrentLine() string
+
+	// SetResult sets the named result of the execution, reported in
+	// ExecResult.Results, see ResultFuncs.
+	SetResult(name string, value any)
+
+	// Feature reports whether the feature flag name is enabled, see
+	// FlagFuncs. Every flag is evaluated once per execution, so that the
+	// whole output sees the same value, and is reported in
+	// ExecResult.Flags.
+	Feature(name string) (bool, error)
+
+	// Context returns the context of the execution, see ExecuteContext.
+	Context() context.Context
+
+	// ContextValue returns the value of the context of the execution for
+	// the key exposed as name, see ContextFuncs.
+	ContextValue(name string) (any, error)
+}
+
+var envType = reflect.TypeOf((*Env)(nil)).Elem()
+
+// takesEnv reports whether the function type typ expects Env as its first
+// argument.
+func takesEnv(typ reflect.Type) bool {
+	return typ.NumIn() != 0 && typ.In(0) == envType
+}
+
+// sourceDateEpoch is the environment variable defining the time of
+// reproducible renders, as in https://reproducible-builds.org/specs/source-date-epoch/
+const sourceDateEpoch = "SOURCE_DATE_EPOCH"
+
+// reproducibleSeed seeds the random number generator of reproducible renders.
+const reproducibleSeed = 1
+
+// execEnv implements Env for a single execution.
+type execEnv struct {
+	now  func() time.Time
+	seed func() int64
+	rand *rand.Rand
+	out  *lineWriter // writer of the current output.
+
+	scratch Scratch
+	result  *ExecResult // result of the execution, nil if not collected.
+	steps   int         // number of executed nodes, for the maxsteps option.
+
+	flags    FlagProvider    // provider of feature flags, nil if disabled.
+	features map[string]bool // feature flags evaluated in the execution.
+
+	ctx     context.Context // context of the execution, nil if none.
+	done    <-chan struct{} // done channel of ctx, nil if it is never done.
+	ctxKeys map[string]any  // context keys exposed by name.
+}
+
+// Clock tells the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+func newExecEnv(opt *option, execOpts *ExecOptions) *execEnv {
+	env := new(execEnv)
+	env.init(opt, execOpts)
+	return env
+}
+
+// init initializes the zero env for an execution.
+func (env *execEnv) init(opt *option, execOpts *ExecOptions) {
+	env.now = time.Now
+	env.seed = func() int64 { return time.Now().UnixNano() }
+	env.flags = opt.flags
+	env.ctxKeys = opt.ctxKeys
+
+	if opt.reproducible {
+		fixed := time.Unix(0, 0).UTC()
+		if epoch, err := strconv.ParseInt(os.Getenv(sourceDateEpoch), 10, 64); err == nil {
+			fixed = time.Unix(epoch, 0).UTC()
+		}
+
+		env.now = func() time.Time { return fixed }
+		env.seed = func() int64 { return reproducibleSeed }
+	}
+
+	if execOpts != nil {
+		if execOpts.Clock != nil {
+			env.now = execOpts.Clock.Now
+		}
+
+		if execOpts.Rand != nil {
+			env.rand = rand.New(execOpts.Rand)
+		}
+
+		if execOpts.Flags != nil {
+			env.flags = execOpts.Flags
+		}
+
+		if execOpts.Context != nil {
+			env.ctx = execOpts.Context
+			env.done = env.ctx.Done()
+		}
+	}
+}
+
+func (e *execEnv) Now() time.Time { return e.now() }
+
+func (e *execEnv) Rand() *rand.Rand {
+	if e.rand == nil {
+		e.rand = rand.New(rand.NewSource(e.seed()))
+	}
+
+	return e.rand
+}
+
+func (e *execEnv) Scratch() *Scratch { return &e.scratch }
+
+func (e *execEnv) SetResult(name string, value any) {
+	if e.result == nil {
+		return
+	}
+
+	if e.result.Results == nil {
+		e.result.Results = make(map[string]any)
+	}
+	e.result.Results[name] = value
+}
+
+func (e *execEnv) CurrentLine() string {
+	if e.out == nil {
+		return ""
+	}
+
+	return string(e.out.line)
+}
+
+// detach returns a copy of e for a call running concurrently with the
+// execution, with ctx as its context. It shares no mutable state with e,
+// its scratch, results and feature flags are copies joined back by join,
+// and its random numbers come from a generator seeded by the one of e.
+func (e *execEnv) detach(ctx context.Context) *execEnv {
+	d := &execEnv{
+		now:     e.now,
+		seed:    e.seed,
+		rand:    rand.New(rand.NewSource(e.Rand().Int63())),
+		out:     &lineWriter{w: io.Discard, line: []byte(e.CurrentLine())},
+		flags:   e.flags,
+		ctx:     ctx,
+		done:    ctx.Done(),
+		ctxKeys: e.ctxKeys,
+	}
+
+	if e.scratch.values != nil {
+		d.scratch.values = make(map[string]any, len(e.scratch.values))
+		for k, v := range e.scratch.values {
+			d.scratch.values[k] = v
+		}
+	}
+	if e.features != nil {
+		d.features = make(map[string]bool, len(e.features))
+		for name, enabled := range e.features {
+			d.features[name] = enabled
+		}
+	}
+	if e.result != nil {
+		d.result = new(ExecResult)
+	}
+	return d
+}
+
+// join applies the changes made through d, detached from e, by a call which
+// returned in time.
+func (e *execEnv) join(d *execEnv) {
+	e.scratch = d.scratch
+	e.features = d.features
+	if e.result == nil {
+		return
+	}
+
+	for name, value := range d.result.Results {
+		e.SetResult(name, value)
+	}
+	for name, enabled := range d.result.Flags {
+		if e.result.Flags == nil {
+			e.result.Flags = make(map[string]bool)
+		}
+		e.result.Flags[name] = enabled
+	}
+}
+
+// lineWriter remembers the last line written to w.
+type lineWriter struct {
+	w    io.Writer
+	line []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	n, err := lw.w.Write(p)
+	if i := bytes.LastIndexByte(p[:n], '\n'); i >= 0 {
+		lw.line = append(lw.line[:0], p[i+1:n]...)
+	} else {
+		lw.line = append(lw.line, p[:n]...)
+	}
+	return n, err
+}
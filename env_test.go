@@ -0,0 +1,103 @@
+package tlang
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnv(t *testing.T) {
+	funcs := FuncMap{
+		"now": func(env Env, layout string) string {
+			return env.Now().Format(layout)
+		},
+		"rand": func(env Env) int {
+			return env.Rand().Intn(1000000)
+		},
+		"join": func(env Env, sep string, args ...string) string {
+			return strings.Join(args, sep)
+		},
+	}
+
+	render := func(t *testing.T, text string, opts ...string) (string, error) {
+		var sb strings.Builder
+		tmpl := Must(New("test").Funcs(funcs).Option(opts...).Parse(text))
+		err := tmpl.Execute(&sb, nil)
+		return sb.String(), err
+	}
+
+	t.Run("args", func(t *testing.T) {
+		out, err := render(t, `join "-" "a" "b"; "b" | join ","`)
+		assert.NoError(t, err)
+		assert.Equal(t, "a-bb", out)
+
+		_, err = render(t, `now`)
+		assert.ErrorContains(t, err, "want 1 got 0")
+	})
+
+	t.Run("default", func(t *testing.T) {
+		out, err := render(t, `now "2006"`)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Now().Format("2006"), out)
+	})
+
+	t.Run("reproducible", func(t *testing.T) {
+		t.Setenv(sourceDateEpoch, "")
+
+		text := `now "2006-01-02T15:04:05Z07:00"; " "; rand; " "; rand`
+		out, err := render(t, text, "reproducible=on")
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out, "1970-01-01T00:00:00Z "))
+
+		again, err := render(t, text, "reproducible=on")
+		assert.NoError(t, err)
+		assert.Equal(t, out, again)
+
+		t.Setenv(sourceDateEpoch, "86400")
+		out, err = render(t, `now "2006-01-02"`, "reproducible=on")
+		assert.NoError(t, err)
+		assert.Equal(t, "1970-01-02", out)
+	})
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestExecOptions(t *testing.T) {
+	funcs := FuncMap{}
+	for _, fm := range []FuncMap{TimeFuncs(), RandomFuncs()} {
+		for name, fn := range fm {
+			funcs[name] = fn
+		}
+	}
+
+	tmpl := Must(New("test").Funcs(funcs).Parse(
+		`date "2006-01-02"; " "; unixTime; " "; now | date "15:04"; " "; randInt 100; " "; randAlphaNum 8; " "; randHex 4`,
+	))
+
+	render := func(opts *ExecOptions) string {
+		var sb strings.Builder
+		assert.NoError(t, tmpl.ExecuteWithOptions(&sb, nil, opts))
+		return sb.String()
+	}
+
+	newOpts := func() *ExecOptions {
+		return &ExecOptions{
+			Clock: fixedClock(time.Date(2022, 8, 1, 12, 30, 0, 0, time.UTC)),
+			Rand:  rand.NewSource(42),
+		}
+	}
+
+	out := render(newOpts())
+	assert.True(t, strings.HasPrefix(out, "2022-08-01 1659357000 12:30 "), out)
+	assert.Len(t, strings.Fields(out), 6)
+	assert.Equal(t, out, render(newOpts()))
+
+	var sb strings.Builder
+	err := Must(New("test").Funcs(funcs).Parse(`randInt 0`)).ExecuteWithOptions(&sb, nil, nil)
+	assert.ErrorContains(t, err, "invalid range 0")
+}
@@ -0,0 +1,55 @@
+package tlang
+
+import (
+	"regexp"
+	"strings"
+)
+
+// EscapeFuncs returns functions escaping text for embedding in generated
+// documents, scripts and patterns:
+//
+//	markdown s
+//		Escapes Markdown punctuation in s with backslashes, so that it is
+//		rendered as plain text.
+//	shellQuote s
+//		Quotes s as a single POSIX shell word in single quotes, no
+//		expansion happens inside.
+//	shellDoubleQuote s
+//		Quotes s in double quotes, escaping the characters special inside
+//		them ($, `, " and \), so that s is a single word without expansion.
+//	regexpQuote s
+//		Escapes regular expression metacharacters in s, the result matches
+//		s literally.
+func EscapeFuncs() FuncMap {
+	return FuncMap{
+		"markdown":         markdownEscaper.Replace,
+		"shellQuote":       shellQuote,
+		"shellDoubleQuote": shellDoubleQuote,
+		"regexpQuote":      regexp.QuoteMeta,
+	}
+}
+
+// markdownEscaper escapes ASCII punctuation with a meaning in CommonMark or
+// common extensions, every ASCII punctuation can be escaped with a backslash.
+var markdownEscaper = func() *strings.Replacer {
+	var pairs []string
+	for _, c := range "\\`*_{}[]<>()#+-.!|~&" {
+		pairs = append(pairs, string(c), "\\"+string(c))
+	}
+	return strings.NewReplacer(pairs...)
+}()
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+var shellDoubleQuoteEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`$`, `\$`,
+	"`", "\\`",
+	`"`, `\"`,
+)
+
+func shellDoubleQuote(s string) string {
+	return `"` + shellDoubleQuoteEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,47 @@
+package tlang
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeFuncs(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		data     any
+		expected string
+	}{
+		{"markdown", `markdown .`, "*a* [b](c) #1 a_b", `\*a\* \[b\]\(c\) \#1 a\_b`},
+		{"markdown plain", `markdown .`, "plain text", "plain text"},
+		{"shellQuote", `shellQuote .`, "it's $HOME", `'it'\''s $HOME'`},
+		{"shellQuote empty", `shellQuote .`, "", `''`},
+		{"shellDoubleQuote", `shellDoubleQuote .`, "a \"b\" $c `d` \\e", "\"a \\\"b\\\" \\$c \\`d\\` \\\\e\""},
+		{"regexpQuote", `regexpQuote .`, "a.b*c", `a\.b\*c`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := Must(New(test.name).Funcs(EscapeFuncs()).Parse(test.input))
+
+			var sb strings.Builder
+			assert.NoError(t, tmpl.Execute(&sb, test.data))
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	t.Run("shell roundtrip", func(t *testing.T) {
+		sh, err := exec.LookPath("sh")
+		if err != nil {
+			t.Skip("no sh")
+		}
+
+		const s = "it's \"$HOME\" `id` \\n !x\nnext"
+		for _, quote := range []func(string) string{shellQuote, shellDoubleQuote} {
+			out, err := exec.Command(sh, "-c", "printf '%s' "+quote(s)).Output()
+			assert.NoError(t, err)
+			assert.Equal(t, s, string(out))
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package tlang
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// EvaluateBool executes the template as a rule and reports the truth of its
+// verdict, in the sense of IsTrue or the truthiness option, output is
+// discarded. The verdict is the value returned by a top level return action,
+// or else the value of the last action evaluated at the top level of the
+// template:
+//
+//	if eq .Role "admin"
+//	  return true
+//	end
+//	ge .Age 18
+func (t *Template) EvaluateBool(data any) (bool, error) {
+	result, err := t.ExecuteWithResult(io.Discard, data, nil)
+	if err != nil {
+		return false, err
+	}
+
+	var verdict reflect.Value
+	switch {
+	case result.returned:
+		verdict = reflect.ValueOf(result.Value)
+	case result.evaluated:
+		verdict = result.last
+	default:
+		return false, fmt.Errorf("template: %s: no verdict evaluated", t.name)
+	}
+
+	opt, _ := t.config()
+	truth, ok := opt.truth.isTrue(indirectInterface(verdict))
+	if !ok {
+		return false, fmt.Errorf("template: %s: verdict of type %s has no truth value", t.name, typeString(verdict))
+	}
+	return truth, nil
+}
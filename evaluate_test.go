@@ -0,0 +1,37 @@
+package tlang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateBool(t *testing.T) {
+	for _, test := range []struct {
+		text     string
+		data     map[string]any
+		expected bool
+		err      string
+	}{
+		{`if eq .Role "admin"; return true; end; ge .Age 18`, map[string]any{"Role": "admin", "Age": 1}, true, ""},
+		{`if eq .Role "admin"; return true; end; ge .Age 18`, map[string]any{"Role": "user", "Age": 20}, true, ""},
+		{`if eq .Role "admin"; return true; end; ge .Age 18`, map[string]any{"Role": "user", "Age": 1}, false, ""},
+		{`define "x"; true; end; $x := .Role; template "x"; .Role`, map[string]any{"Role": ""}, false, ""},
+		{`.Missing`, nil, false, ""},
+		{`return`, nil, false, ""},
+		{`return .Tags`, map[string]any{"Tags": []string{"a"}}, true, ""},
+		{`$x := true`, nil, false, "template: test: no verdict evaluated"},
+	} {
+		t.Run(test.text, func(t *testing.T) {
+			tmpl := Must(New("test").Funcs(ComparisonFuncs()).Parse(test.text))
+			truth, err := tmpl.EvaluateBool(test.data)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, truth)
+		})
+	}
+}
@@ -5,32 +5,55 @@
 package tlang
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"reflect"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 
 	"arhat.dev/tlang/internal/fmtsort"
 	"arhat.dev/tlang/parse"
 )
 
-// maxExecDepth specifies the maximum stack depth of templates within
-// templates. This limit is only practically reached by accidentally
-// recursive template invocations. This limit allows us to return
-// an error instead of triggering a stack overflow.
-const maxExecDepth = 100000
+// defaultMaxExecDepth specifies the default maximum stack depth of templates
+// within templates, see the maxdepth option. This limit is only practically
+// reached by accidentally recursive template invocations. This limit allows
+// us to return an error instead of triggering a stack overflow.
+const defaultMaxExecDepth = 1000
 
 // state represents the state of an execution. It's not part of the
 // template so that multiple executions of the same template
 // can execute in parallel.
 type state struct {
-	tmpl  *Template
-	wr    io.Writer
-	node  parse.Node // current node, for errors
-	vars  []variable // push-down stack of variable values.
-	depth int        // the height of the stack of executing templates.
+	tmpl   *Template
+	opt    *option             // options of the execution, see execSnapshot.
+	funcs  parse.TemplateFuncs // functions of the execution.
+	consts map[string]constVar // constants of the executed templates.
+	wr     io.Writer
+	node   parse.Node // current node, for errors
+	vars   []variable // push-down stack of variable values.
+	depth  int        // the height of the stack of executing templates.
+	stack  []string   // names of executing templates, for errors.
+
+	templates map[string]*Template     // templates of a Sealed, nil to look them up when invoked.
+	globals   map[string]reflect.Value // global variables, shared by all templates.
+	result    *ExecResult              // statistics of the execution, nil if not collected.
+	out       *countingWriter          // output to record the source map of, nil if not recorded.
+	env       *execEnv                 // environment passed to functions expecting Env.
+	invalid   *MultiError              // validation errors, shared by all templates.
+	snap      *snapshotter             // recorder of snapshots on errors, nil if not captured.
+	trace     *tracer                  // recorder of the execution trace, nil if not traced.
+	buf       []byte                   // scratch buffer to format plain values in.
 }
 
 // variable holds the dynamic value of a variable such as $, $x etc.
@@ -57,6 +80,13 @@ func (s *state) pop(mark int) {
 // setVar overwrites the last declared variable with the given name.
 // Used by variable assignments.
 func (s *state) setVar(name string, value reflect.Value) {
+	if parse.IsGlobalVar(name) {
+		if _, ok := s.consts[name]; ok {
+			s.errorf("cannot assign constant %s", name)
+		}
+		s.globals[name] = value
+		return
+	}
 	for i := s.mark() - 1; i >= 0; i-- {
 		if s.vars[i].name == name {
 			s.vars[i].value = value
@@ -73,6 +103,13 @@ func (s *state) setTopVar(n int, value reflect.Value) {
 
 // varValue returns the value of the named variable.
 func (s *state) varValue(name string) reflect.Value {
+	if parse.IsGlobalVar(name) {
+		value, ok := s.globals[name]
+		if !ok {
+			s.errorf("global variable %s not set", name)
+		}
+		return value
+	}
 	for i := s.mark() - 1; i >= 0; i-- {
 		if s.vars[i].name == name {
 			return s.vars[i].value
@@ -109,6 +146,12 @@ func doublePercent(str string) string {
 type ExecError struct {
 	Name string // Name of template.
 	Err  error  // Pre-formatted error.
+
+	// Snapshot is the state of the execution when it failed, only captured
+	// when ExecOptions.Snapshot is set.
+	Snapshot *Snapshot
+
+	fatal bool // not caught by try, see state.fatalf.
 }
 
 func (e ExecError) Error() string {
@@ -121,6 +164,20 @@ func (e ExecError) Unwrap() error {
 
 // errorf records an ExecError and terminates processing.
 func (s *state) errorf(format string, args ...any) {
+	panic(s.execError(format, args...))
+}
+
+// fatalf is like errorf, but the error ends the execution even inside a try
+// block, it is used for limits and cancellation that templates must not be
+// able to ignore.
+func (s *state) fatalf(format string, args ...any) {
+	err := s.execError(format, args...)
+	err.fatal = true
+	panic(err)
+}
+
+// execError returns an ExecError at the current node.
+func (s *state) execError(format string, args ...any) ExecError {
 	name := doublePercent(s.tmpl.Name())
 	if s.node == nil {
 		format = fmt.Sprintf("template: %s: %s", name, format)
@@ -128,10 +185,14 @@ func (s *state) errorf(format string, args ...any) {
 		location, context := s.tmpl.ErrorContext(s.node)
 		format = fmt.Sprintf("template: %s: executing %q at <%s>: %s", location, name, doublePercent(context), format)
 	}
-	panic(ExecError{
+	err := ExecError{
 		Name: s.tmpl.Name(),
 		Err:  fmt.Errorf(format, args...),
-	})
+	}
+	if s.snap != nil {
+		err.Snapshot = s.snap.snapshot(s)
+	}
+	return err
 }
 
 // writeError is the wrapper type used internally when Execute has an
@@ -192,27 +253,170 @@ func (t *Template) ExecuteTemplate(wr io.Writer, name string, data any) error {
 // If data is a reflect.Value, the template applies to the concrete
 // value that the reflect.Value holds, as in fmt.Print.
 func (t *Template) Execute(wr io.Writer, data any) error {
-	return t.execute(wr, data)
+	return t.execute(wr, data, nil, nil)
+}
+
+// ExecOptions customizes a single execution of a template.
+type ExecOptions struct {
+	// Clock overrides the clock reported by Env.Now.
+	Clock Clock
+
+	// Rand overrides the source of random numbers of Env.Rand, it is used
+	// by one execution only, since sources are not safe for concurrent use.
+	Rand rand.Source
+
+	// Context stops the execution with an error wrapping its error when it
+	// is done, and holds values exposed to templates, see ExecuteContext.
+	Context context.Context
+
+	// Flags overrides the provider of feature flags set by Template.Flags,
+	// e.g. to evaluate flags for the user of a request, see Env.Feature.
+	Flags FlagProvider
+
+	// Vars preseeds global variables by name without dollar signs, e.g.
+	// Vars["debug"] is $$debug in templates. After execution, even if it
+	// failed, Vars is updated with the final values of all global variables
+	// set in the execution.
+	Vars map[string]any
+
+	// SourceMap records which action produced every part of the output in
+	// ExecResult.SourceMap, it only applies to ExecuteWithResult.
+	SourceMap bool
+
+	// Digest computes the hash of the output in ExecResult.Digest while it
+	// is written, it only applies to ExecuteWithResult.
+	Digest bool
+
+	// Snapshot, if positive, is the number of last executed nodes recorded,
+	// so that an ExecError captures the state of the failed execution in
+	// its Snapshot, see ExecError.Report.
+	Snapshot int
+
+	// Redact, if set, replaces values captured in snapshots, e.g. to hide
+	// secrets, name is "." for dot or the name of a variable with dollar
+	// signs.
+	Redact func(name string, value any) any
+
+	// Trace, if set, records executed nodes with values of dot, function
+	// calls with their arguments and results, output and the error of the
+	// execution as JSON lines, see TraceEvent. The trace can be read by
+	// ReadTrace and replayed without the data of the execution.
+	Trace io.Writer
+}
+
+// ExecuteWithOptions is like Execute, but customizes the execution with
+// opts, a nil opts is the same as Execute.
+func (t *Template) ExecuteWithOptions(wr io.Writer, data any, opts *ExecOptions) error {
+	return t.execute(wr, data, opts, nil)
+}
+
+func (t *Template) execute(wr io.Writer, data any, opts *ExecOptions, result *ExecResult) error {
+	tmpl, snap := t.snapshot()
+	return snap.execute(tmpl, wr, data, opts, result)
 }
 
-func (t *Template) execute(wr io.Writer, data any) (err error) {
+// execute executes t with the options, functions and templates of snap.
+func (snap *execSnapshot) execute(t *Template, wr io.Writer, data any, opts *ExecOptions, result *ExecResult) (err error) {
+	var (
+		invalid MultiError
+		trace   *tracer
+	)
+	defer func() { err = joinValidation(invalid, err) }()
+	if opts != nil && opts.Trace != nil {
+		trace = newTracer(opts.Trace)
+		defer func() {
+			if err != nil {
+				_ = trace.enc.Encode(&TraceEvent{Kind: TraceError, Error: err.Error()})
+			}
+		}()
+	}
 	defer errRecover(&err)
 	value, ok := data.(reflect.Value)
 	if !ok {
 		value = reflect.ValueOf(data)
 	}
 	state := &state{
-		tmpl: t,
-		wr:   wr,
-		vars: []variable{{"$", value}},
+		tmpl:   t,
+		opt:    &snap.opt,
+		funcs:  snap.funcs,
+		consts: snap.consts,
+		wr:     wr,
+		vars:   []variable{{"$", value}},
+		stack:  []string{t.Name()},
+
+		templates: snap.templates,
+		globals:   make(map[string]reflect.Value),
+		result:    result,
+		invalid:   &invalid,
+		trace:     trace,
+	}
+	if result != nil {
+		result.Templates[t.Name()]++
 	}
 	if t.Tree == nil || t.Root == nil {
 		state.errorf("%q is an incomplete or empty template", t.Name())
 	}
-	state.walk(value, t.Root)
+	if state.opt.denyCycles {
+		state.checkRecursion(t)
+	}
+	if t.schema != nil {
+		if err := t.checkSchema(value); err != nil {
+			return err
+		}
+	}
+	state.env = newExecEnv(state.opt, opts)
+	state.env.result = result
+	state.env.out = &lineWriter{w: wr}
+	state.wr = state.env.out
+	if state.opt.maxOutput > 0 {
+		state.wr = &limitWriter{w: state.wr, n: state.opt.maxOutput}
+	}
+	if trace != nil {
+		state.wr = &traceWriter{w: state.wr, s: state}
+	}
+	if result != nil && opts != nil && opts.SourceMap {
+		state.out, _ = wr.(*countingWriter)
+	}
+	if opts != nil && opts.Snapshot > 0 {
+		state.snap = newSnapshotter(opts.Snapshot, opts.Redact)
+	}
+	for name, v := range state.consts {
+		state.globals[name] = v.value
+	}
+	if opts != nil && opts.Vars != nil {
+		for name, v := range opts.Vars {
+			if _, ok := state.consts["$$"+name]; ok {
+				state.errorf("cannot set constant $$%s", name)
+			}
+			state.globals["$$"+name] = reflect.ValueOf(v)
+		}
+		defer state.exportGlobals(opts.Vars)
+	}
+	ret, returned := state.walkBody(value, t.Root)
+	if result != nil {
+		result.returned = returned
+		if ret.IsValid() && ret.CanInterface() {
+			result.Value = ret.Interface()
+		}
+	}
 	return
 }
 
+// exportGlobals stores values of global variables into vars.
+func (s *state) exportGlobals(vars map[string]any) {
+	for name, v := range s.globals {
+		if _, ok := s.consts[name]; ok {
+			continue
+		}
+		name = strings.TrimPrefix(name, "$$")
+		if !v.IsValid() || !v.CanInterface() {
+			vars[name] = nil
+			continue
+		}
+		vars[name] = v.Interface()
+	}
+}
+
 // DefinedTemplates returns a string listing the defined templates,
 // prefixed by the string "; defined templates are: ". If there are none,
 // it returns the empty string. For generating an error message here
@@ -244,16 +448,47 @@ var (
 	walkContinue = errors.New("continue")
 )
 
+// walkReturn is used with panic to signal the return of a template, value is
+// invalid if nothing is returned.
+type walkReturn struct {
+	value reflect.Value
+}
+
 // Walk functions step through the major pieces of the template structure,
 // generating output as they go.
 func (s *state) walk(dot reflect.Value, node parse.Node) {
 	s.at(node)
+	if max := s.opt.maxSteps; max > 0 {
+		if s.env.steps++; s.env.steps > max {
+			s.fatalf("exceeded maximum number of executed nodes (%d)", max)
+		}
+	}
+	if s.env.done != nil {
+		select {
+		case <-s.env.done:
+			s.fatalf("%w", s.env.ctx.Err())
+		default:
+		}
+	}
+	if s.snap != nil {
+		s.snap.record(s.tmpl, dot, node)
+	}
+	if s.trace != nil {
+		s.trace.node(s, dot, node)
+	}
 	switch node := node.(type) {
 	case *parse.ActionNode:
+		if len(node.Pipe.Cmds) == 0 {
+			// empty action, like the ones between ";;"
+			break
+		}
 		// Do not pop variables so they persist until next end.
 		// Also, if the action declares variables, don't print the result.
 		val := s.evalPipeline(dot, node.Pipe)
 		if len(node.Pipe.Decl) == 0 {
+			if s.result != nil && s.depth == 0 {
+				s.result.evaluated, s.result.last = true, val
+			}
 			s.printValue(node, val)
 		}
 	case *parse.BreakNode:
@@ -261,6 +496,8 @@ func (s *state) walk(dot reflect.Value, node parse.Node) {
 	case *parse.CommentNode:
 	case *parse.ContinueNode:
 		panic(walkContinue)
+	case *parse.ForNode:
+		s.walkFor(dot, node)
 	case *parse.IfNode:
 		s.walkIfOrWith(parse.NodeIf, dot, node.Pipe, node.List, node.ElseList)
 	case *parse.ListNode:
@@ -269,12 +506,24 @@ func (s *state) walk(dot reflect.Value, node parse.Node) {
 		}
 	case *parse.RangeNode:
 		s.walkRange(dot, node)
+	case *parse.ReturnNode:
+		var value reflect.Value
+		if node.Pipe != nil {
+			value = s.evalPipeline(dot, node.Pipe)
+		}
+		panic(walkReturn{value})
+	case *parse.SwitchNode:
+		s.walkSwitch(dot, node)
 	case *parse.TemplateNode:
 		s.walkTemplate(dot, node)
+	case *parse.TryNode:
+		s.walkTry(dot, node)
 	case *parse.TextNode:
+		start := s.offset()
 		if _, err := s.wr.Write(node.Text); err != nil {
 			s.writeError(err)
 		}
+		s.mapSource(node, start)
 	case *parse.WithNode:
 		s.walkIfOrWith(parse.NodeWith, dot, node.Pipe, node.List, node.ElseList)
 	default:
@@ -282,13 +531,101 @@ func (s *state) walk(dot reflect.Value, node parse.Node) {
 	}
 }
 
+// walkTry walks a 'try' node: an error executing its list stops it, output
+// already written is kept, and the catch list runs instead with the error,
+// an ExecError, bound to its variable.
+func (s *state) walkTry(dot reflect.Value, t *parse.TryNode) {
+	defer s.pop(s.mark())
+	err := s.try(dot, t.List)
+	if err == nil || t.Catch == nil {
+		return
+	}
+	if t.ErrVar != nil {
+		s.push(t.ErrVar.Ident[0], reflect.ValueOf(err))
+	}
+	s.walk(dot, t.Catch)
+}
+
+// try walks list and returns the error stopping it, if any. Errors that
+// are not execution errors, like write errors, and fatal ones are not
+// caught.
+func (s *state) try(dot reflect.Value, list *parse.ListNode) (err error) {
+	mark := s.mark()
+	defer func() {
+		e := recover()
+		if e == nil {
+			return
+		}
+		execErr, ok := e.(ExecError)
+		if !ok || execErr.fatal {
+			panic(e)
+		}
+		s.pop(mark)
+		err = execErr
+	}()
+	s.walk(dot, list)
+	return nil
+}
+
+// walkSwitch walks a 'switch' node: the list of the first case whose value
+// equals the value of the switch, or whose condition is true if it has
+// none, is executed, or else the default list.
+func (s *state) walkSwitch(dot reflect.Value, n *parse.SwitchNode) {
+	defer s.pop(s.mark())
+	var val reflect.Value
+	if n.Pipe != nil {
+		val = s.evalPipeline(dot, n.Pipe)
+	}
+	for _, c := range n.Cases {
+		if s.matchCase(dot, n.Pipe != nil, val, c) {
+			s.walk(dot, c.List)
+			return
+		}
+	}
+	if n.Default != nil {
+		s.walk(dot, n.Default)
+	}
+}
+
+// matchCase reports whether the case c matches, comparing its value with
+// val if compare, or else evaluating it as a condition.
+func (s *state) matchCase(dot reflect.Value, compare bool, val reflect.Value, c *parse.CaseNode) bool {
+	v := s.evalPipeline(dot, c.Pipe)
+	s.at(c)
+	if compare {
+		ok, err := equal(val, v)
+		if err != nil {
+			s.errorf("error comparing case %s: %w", c.Pipe, err)
+		}
+		return ok
+	}
+
+	rule := s.opt.truth
+	truth, ok := rule.isTrue(indirectInterface(v))
+	if !ok {
+		if rule == truthStrict {
+			s.errorf("case requires a bool condition, got %s", typeString(v))
+		}
+		s.errorf("case can't use %v", v)
+	}
+	return truth
+}
+
 // walkIfOrWith walks an 'if' or 'with' node. The two control structures
 // are identical in behavior except that 'with' sets dot.
 func (s *state) walkIfOrWith(typ parse.NodeType, dot reflect.Value, pipe *parse.PipeNode, list, elseList *parse.ListNode) {
 	defer s.pop(s.mark())
 	val := s.evalPipeline(dot, pipe)
-	truth, ok := isTrue(indirectInterface(val))
+	rule := s.opt.truth
+	if typ == parse.NodeWith && rule == truthStrict {
+		// with sets dot to values of any type.
+		rule = truthDefault
+	}
+	truth, ok := rule.isTrue(indirectInterface(val))
 	if !ok {
+		if rule == truthStrict {
+			s.errorf("if requires a bool condition, got %s", typeString(val))
+		}
 		s.errorf("if/with can't use %v", val)
 	}
 	if truth {
@@ -310,6 +647,12 @@ func IsTrue(val any) (truth, ok bool) {
 }
 
 func isTrue(val reflect.Value) (truth, ok bool) {
+	if v, isValuer, err := unwrapValuer(val); isValuer {
+		if err != nil {
+			return false, false
+		}
+		val = v
+	}
 	if !val.IsValid() {
 		// Something like var x interface{}, never set. It's a form of nil.
 		return false, true
@@ -337,18 +680,130 @@ func isTrue(val reflect.Value) (truth, ok bool) {
 	return truth, true
 }
 
+// isTrue is like the function isTrue, but under the truth rule r.
+func (r truthRule) isTrue(val reflect.Value) (truth, ok bool) {
+	switch r {
+	case truthStrict:
+		if v, isValuer, err := unwrapValuer(val); isValuer {
+			if err != nil {
+				return false, false
+			}
+			val = v
+		}
+		if !val.IsValid() || val.Kind() != reflect.Bool {
+			return false, false
+		}
+		return val.Bool(), true
+	case truthDeep:
+		if v, isValuer, err := unwrapValuer(val); isValuer {
+			if err != nil {
+				return false, false
+			}
+			val = v
+		}
+		for val.IsValid() && (val.Kind() == reflect.Pointer || val.Kind() == reflect.Interface) {
+			if val.IsNil() {
+				return false, true
+			}
+			val = val.Elem()
+		}
+		if val.Kind() == reflect.Struct {
+			return !val.IsZero(), true
+		}
+	}
+	return isTrue(val)
+}
+
+// typeString returns the type of val for errors, "nil" if val is invalid.
+func typeString(val reflect.Value) string {
+	if !val.IsValid() {
+		return "nil"
+	}
+	return val.Type().String()
+}
+
+// walkFor walks a 'for' node, variables declared by its init statement live
+// until the end of the loop, those declared in the body until the end of
+// an iteration.
+func (s *state) walkFor(dot reflect.Value, f *parse.ForNode) {
+	s.at(f)
+	defer func() {
+		if r := recover(); r != nil && r != walkBreak {
+			panic(r)
+		}
+	}()
+	defer s.pop(s.mark())
+	s.evalPipeline(dot, f.Init)
+	// mark top of stack before any variables in the body are pushed.
+	mark := s.mark()
+	oneIteration := func() {
+		defer s.pop(mark)
+		defer func() {
+			// Consume panic(walkContinue)
+			if r := recover(); r != nil && r != walkContinue {
+				panic(r)
+			}
+		}()
+		s.walk(dot, f.List)
+	}
+	rule := s.opt.truth
+	for {
+		// without a condition, loop until break
+		if f.Cond != nil {
+			val := s.evalPipeline(dot, f.Cond)
+			truth, ok := rule.isTrue(indirectInterface(val))
+			if !ok {
+				if rule == truthStrict {
+					s.errorf("for requires a bool condition, got %s", typeString(val))
+				}
+				s.errorf("for can't use %v", val)
+			}
+			if !truth {
+				return
+			}
+		}
+		oneIteration()
+		s.evalPipeline(dot, f.Post)
+		s.pop(mark)
+	}
+}
+
 func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 	s.at(r)
+	// break in the else branch ends the enclosing loop, not this range.
+	inElse := false
 	defer func() {
-		if r := recover(); r != nil && r != walkBreak {
+		if r := recover(); r != nil && (r != walkBreak || inElse) {
 			panic(r)
 		}
 	}()
 	defer s.pop(s.mark())
-	val, _ := indirect(s.evalPipeline(dot, r.Pipe))
+	pipe := s.evalPipeline(dot, r.Pipe)
+	cursor, isCursor := asCursor(pipe)
+	val, isNil := indirect(pipe)
 	// mark top of stack before any variables in the body are pushed.
 	mark := s.mark()
-	oneIteration := func(index, elem reflect.Value) {
+	if r.ElseVar != nil && !isCursor {
+		// the else branch handles values range can't iterate over
+		switch val.Kind() {
+		case reflect.Array, reflect.Slice, reflect.Map, reflect.Chan, reflect.Invalid,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			if isNil {
+				inElse = true
+				s.walkRangeElse(dot, r, rangeElseNil)
+			} else {
+				inElse = true
+				s.walkRangeElse(dot, r, rangeElseType)
+			}
+			return
+		}
+	}
+	if !isCursor && isCount(val) && len(r.Pipe.Decl) > 1 {
+		s.errorf("can't use %v to iterate over more than one variable", val)
+	}
+	setVars := func(index, elem reflect.Value) {
 		// Set top var (lexically the second if there are two) to the element.
 		if len(r.Pipe.Decl) > 0 {
 			s.setTopVar(1, elem)
@@ -357,6 +812,12 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 		if len(r.Pipe.Decl) > 1 {
 			s.setTopVar(2, index)
 		}
+	}
+	if len(r.Stages) != 0 {
+		cursor, isCursor = s.rangeStages(dot, pipe, r, setVars, mark), true
+	}
+	oneIteration := func(index, elem reflect.Value) {
+		setVars(index, elem)
 		defer s.pop(mark)
 		defer func() {
 			// Consume panic(walkContinue)
@@ -366,71 +827,394 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 		}()
 		s.walk(elem, r.List)
 	}
+	if r.Sorted {
+		var indices, elems []reflect.Value
+		if isCursor {
+			indices, elems = s.cursorEntries(cursor)
+		} else {
+			indices, elems = s.rangeEntries(val)
+		}
+		if len(elems) != 0 {
+			keys := make([]reflect.Value, len(elems))
+			for i := range elems {
+				switch {
+				case r.SortBy != nil:
+					setVars(indices[i], elems[i])
+					keys[i] = s.evalPipeline(elems[i], r.SortBy)
+					s.pop(mark)
+				case !isCursor && val.Kind() == reflect.Map:
+					keys[i] = indices[i]
+				default:
+					keys[i] = elems[i]
+				}
+			}
+
+			order := make([]int, len(elems))
+			for i := range order {
+				order[i] = i
+			}
+			s.at(r)
+			sort.SliceStable(order, func(i, j int) bool {
+				c, unordered, err := compare(keys[order[i]], keys[order[j]])
+				if err != nil {
+					s.errorf("range sorted: %v", err)
+				}
+				return !unordered && c < 0
+			})
+
+			for _, i := range order {
+				oneIteration(indices[i], elems[i])
+			}
+			return
+		}
+	} else if isCursor {
+		if s.rangeCursor(cursor, oneIteration) {
+			return
+		}
+	} else {
+		switch val.Kind() {
+		case reflect.Array, reflect.Slice:
+			if val.Len() == 0 {
+				break
+			}
+			for i := 0; i < val.Len(); i++ {
+				oneIteration(reflect.ValueOf(i), val.Index(i))
+			}
+			return
+		case reflect.Map:
+			if val.Len() == 0 {
+				break
+			}
+			om := fmtsort.Sort(val)
+			for i, key := range om.Key {
+				oneIteration(key, om.Value[i])
+			}
+			return
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n := countLen(val)
+			if n == 0 {
+				break
+			}
+			for i := 0; i < n; i++ {
+				oneIteration(reflect.ValueOf(i), countElem(val, i))
+			}
+			return
+		case reflect.Chan:
+			if val.IsNil() {
+				break
+			}
+			if val.Type().ChanDir() == reflect.SendDir {
+				s.errorf("range over send-only channel %v", val)
+				break
+			}
+			i := 0
+			for ; ; i++ {
+				elem, ok := val.Recv()
+				if !ok {
+					break
+				}
+				oneIteration(reflect.ValueOf(i), elem)
+			}
+			if i == 0 {
+				break
+			}
+			return
+		case reflect.Invalid:
+			break // An invalid value is likely a nil map, etc. and acts like an empty map.
+		default:
+			s.errorf("range can't iterate over %v", val)
+		}
+	}
+	reason := rangeElseEmpty
 	switch val.Kind() {
-	case reflect.Array, reflect.Slice:
-		if val.Len() == 0 {
-			break
+	case reflect.Invalid:
+		reason = rangeElseNil
+	case reflect.Map, reflect.Slice, reflect.Chan:
+		if val.IsNil() {
+			reason = rangeElseNil
 		}
+	}
+	inElse = true
+	s.walkRangeElse(dot, r, reason)
+}
+
+// Reasons bound to the variable of {{range}} ... {{else $var}}.
+const (
+	rangeElseNil   = "nil"   // the value is nil or missing.
+	rangeElseEmpty = "empty" // the value has no elements.
+	rangeElseType  = "type"  // the value can't be iterated over.
+)
+
+// walkRangeElse walks the else branch of r, if any, binding its variable to
+// reason.
+func (s *state) walkRangeElse(dot reflect.Value, r *parse.RangeNode, reason string) {
+	if r.ElseList == nil {
+		return
+	}
+	if r.ElseVar != nil {
+		s.push(r.ElseVar.Ident[0], reflect.ValueOf(reason))
+	}
+	s.walk(dot, r.ElseList)
+}
+
+// rangeEntries collects indices (or keys) and elements of val for sorted
+// range, maps are collected in key order.
+func (s *state) rangeEntries(val reflect.Value) (indices, elems []reflect.Value) {
+	switch val.Kind() {
+	case reflect.Array, reflect.Slice:
 		for i := 0; i < val.Len(); i++ {
-			oneIteration(reflect.ValueOf(i), val.Index(i))
+			indices = append(indices, reflect.ValueOf(i))
+			elems = append(elems, val.Index(i))
 		}
-		return
 	case reflect.Map:
-		if val.Len() == 0 {
-			break
-		}
 		om := fmtsort.Sort(val)
-		for i, key := range om.Key {
-			oneIteration(key, om.Value[i])
-		}
-		return
+		return om.Key, om.Value
 	case reflect.Chan:
 		if val.IsNil() {
 			break
 		}
 		if val.Type().ChanDir() == reflect.SendDir {
 			s.errorf("range over send-only channel %v", val)
-			break
 		}
-		i := 0
-		for ; ; i++ {
+		for i := 0; ; i++ {
 			elem, ok := val.Recv()
 			if !ok {
 				break
 			}
-			oneIteration(reflect.ValueOf(i), elem)
+			indices = append(indices, reflect.ValueOf(i))
+			elems = append(elems, elem)
 		}
-		if i == 0 {
-			break
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		for i := 0; i < countLen(val); i++ {
+			indices = append(indices, reflect.ValueOf(i))
+			elems = append(elems, countElem(val, i))
 		}
-		return
 	case reflect.Invalid:
-		break // An invalid value is likely a nil map, etc. and acts like an empty map.
+		// nil map, etc. acts like an empty map.
 	default:
 		s.errorf("range can't iterate over %v", val)
 	}
-	if r.ElseList != nil {
-		s.walk(dot, r.ElseList)
+	return
+}
+
+// isCount reports whether val is an integer, ranged over as a count like in
+// Go.
+func isCount(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// countLen returns the number of iterations of range over the integer val,
+// 0 if it is negative.
+func countLen(val reflect.Value) int {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := val.Int(); n > 0 {
+			if n > math.MaxInt {
+				return math.MaxInt
+			}
+			return int(n)
+		}
+	default:
+		if n := val.Uint(); n <= math.MaxInt {
+			return int(n)
+		}
+		return math.MaxInt
 	}
+	return 0
+}
+
+// countElem returns the element i of range over the integer val, which has
+// the type of val.
+func countElem(val reflect.Value, i int) reflect.Value {
+	return reflect.ValueOf(i).Convert(val.Type())
 }
 
 func (s *state) walkTemplate(dot reflect.Value, t *parse.TemplateNode) {
+	s.invokeTemplate(dot, t, s.wr)
+}
+
+// evalTemplate evaluates a template invocation used as a value, the value is
+// the one returned by the template, or its output if nothing is returned.
+func (s *state) evalTemplate(dot reflect.Value, t *parse.TemplateNode) reflect.Value {
+	var buf bytes.Buffer
+	defer func(out *lineWriter) { s.env.out = out }(s.env.out)
+	s.env.out = &lineWriter{w: &buf}
+	value := s.invokeTemplate(dot, t, s.env.out)
+	if value.IsValid() {
+		return value
+	}
+	return reflect.ValueOf(buf.String())
+}
+
+// invokeTemplate executes the template invoked by t with output to wr, it
+// returns the value returned by the template.
+func (s *state) invokeTemplate(dot reflect.Value, t *parse.TemplateNode, wr io.Writer) reflect.Value {
 	s.at(t)
-	tmpl := s.tmpl.Lookup(t.Name)
+	tmpl := s.lookup(t.Name)
 	if tmpl == nil {
-		s.errorf("template %q not defined", t.Name)
+		s.missingTemplate(t.Name, wr)
+		return reflect.Value{}
 	}
-	if s.depth == maxExecDepth {
-		s.errorf("exceeded maximum template depth (%v)", maxExecDepth)
+	if maxDepth := s.opt.maxDepth; s.depth >= maxDepth {
+		s.fatalf("exceeded maximum template depth (%v)%s", maxDepth, s.cycle(t.Name))
+	}
+	s.checkNesting(t.Name)
+	var args []variable
+	if len(tmpl.Params) != 0 || len(t.Named) != 0 {
+		args = s.templateArgs(dot, t, tmpl.Params)
+	} else {
+		// Variables declared by the pipeline persist.
+		dot = s.evalPipeline(dot, t.Pipe)
 	}
-	// Variables declared by the pipeline persist.
-	dot = s.evalPipeline(dot, t.Pipe)
 	newState := *s
+	newState.wr = wr
 	newState.depth++
+	newState.stack = append(s.stack, t.Name)
 	newState.tmpl = tmpl
 	// No dynamic scoping: template invocations inherit no variables.
-	newState.vars = []variable{{"$", dot}}
-	newState.walk(dot, tmpl.Root)
+	newState.vars = append([]variable{{"$", dot}}, args...)
+	if s.result != nil {
+		s.result.Templates[t.Name]++
+	}
+	value, _ := newState.walkBody(dot, tmpl.Root)
+	return value
+}
+
+// templateArgs binds the arguments of the invocation t to params, the
+// parameters of the invoked template. Arguments are the named arguments of
+// t, or else the operands of its pipeline, unless it is a single value like
+// a function call, a comparison or a pipeline of commands.
+func (s *state) templateArgs(dot reflect.Value, t *parse.TemplateNode, params []string) []variable {
+	if len(t.Named) != 0 {
+		return s.namedTemplateArgs(dot, t, params)
+	}
+
+	var values []reflect.Value
+	switch pipe := t.Pipe; {
+	case pipe == nil:
+	case len(pipe.Decl) == 0 && len(pipe.Cmds) == 1 && isOperandList(pipe.Cmds[0]):
+		for _, arg := range pipe.Cmds[0].Args {
+			values = append(values, s.evalOperand(dot, arg))
+		}
+	default:
+		// Variables declared by the pipeline persist.
+		values = append(values, s.evalPipeline(dot, pipe))
+	}
+
+	s.at(t)
+	if len(values) != len(params) {
+		s.errorf("wrong number of args for template %q: want %d got %d", t.Name, len(params), len(values))
+	}
+	args := make([]variable, len(params))
+	for i, name := range params {
+		args[i] = variable{name, values[i]}
+	}
+	return args
+}
+
+// namedTemplateArgs binds the named arguments of the invocation t to params,
+// which must all be given.
+func (s *state) namedTemplateArgs(dot reflect.Value, t *parse.TemplateNode, params []string) []variable {
+	args := make([]variable, len(params))
+	for _, arg := range t.Named {
+		i := 0
+		for i < len(params) && params[i] != "$"+arg.Name {
+			i++
+		}
+		if i == len(params) {
+			s.at(t)
+			s.errorf("template %q has no parameter $%s", t.Name, arg.Name)
+		}
+		args[i] = variable{params[i], s.evalOperand(dot, arg.Value)}
+	}
+
+	s.at(t)
+	for i, name := range params {
+		if args[i].name == "" {
+			s.errorf("missing argument %s for template %q", strings.TrimPrefix(name, "$"), t.Name)
+		}
+	}
+	return args
+}
+
+// evalOperand evaluates the operand arg of a template invocation, a sole nil
+// is the untyped nil.
+func (s *state) evalOperand(dot reflect.Value, arg parse.Node) reflect.Value {
+	cmd := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: arg.Position(), Args: []parse.Node{arg}}
+	return s.evalComparand(dot, cmd, missingVal)
+}
+
+// isOperandList reports whether the arguments of cmd are separate operands
+// rather than a call of a function.
+func isOperandList(cmd *parse.CommandNode) bool {
+	switch cmd.Args[0].(type) {
+	case *parse.IdentifierNode, *parse.ComparisonNode, *parse.LogicalNode:
+		return len(cmd.Args) == 1
+	}
+	return true
+}
+
+// missingTemplate renders the placeholder of the template name which is not
+// defined, or fails if the missingtemplate option is not set.
+func (s *state) missingTemplate(name string, wr io.Writer) {
+	placeholder := s.opt.missingTemplate
+	if placeholder == nil {
+		s.errorf("template %q not defined", name)
+	}
+
+	s.warnf("template %q not defined, rendered placeholder", name)
+	if *placeholder == "" {
+		return
+	}
+	start := s.offset()
+	if _, err := io.WriteString(wr, strings.ReplaceAll(*placeholder, "{name}", name)); err != nil {
+		s.writeError(err)
+	}
+	s.mapSource(s.node, start)
+}
+
+// walkBody walks the body of a template, stopping at {{return}}, returned
+// reports whether it stopped at {{return}}.
+func (s *state) walkBody(dot reflect.Value, root *parse.ListNode) (value reflect.Value, returned bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ret, ok := r.(walkReturn)
+			if !ok {
+				panic(r)
+			}
+			value, returned = ret.value, true
+		}
+	}()
+	s.walk(dot, root)
+	return
+}
+
+// cycle describes the latest cycle of template invocations ending with the
+// invocation of name, e.g. ` in cycle "a" -> "b" -> "a"`.
+func (s *state) cycle(name string) string {
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		if s.stack[i] != name {
+			continue
+		}
+
+		var sb strings.Builder
+		sb.WriteString(" in cycle ")
+		for _, n := range s.stack[i:] {
+			sb.WriteString(strconv.Quote(n))
+			sb.WriteString(" -> ")
+		}
+		sb.WriteString(strconv.Quote(name))
+		return sb.String()
+	}
+
+	return ""
 }
 
 // Eval functions evaluate pipelines, commands, and their elements and extract
@@ -455,7 +1239,7 @@ func (s *state) evalPipeline(dot reflect.Value, pipe *parse.PipeNode) (value ref
 		}
 	}
 	for _, variable := range pipe.Decl {
-		if pipe.IsAssign {
+		if pipe.IsAssign || parse.IsGlobalVar(variable.Ident[0]) {
 			s.setVar(variable.Ident[0], value)
 		} else {
 			s.push(variable.Ident[0], value)
@@ -477,6 +1261,9 @@ func (s *state) evalCommand(dot reflect.Value, cmd *parse.CommandNode, final ref
 		return s.evalFieldNode(dot, n, cmd.Args, final)
 	case *parse.ChainNode:
 		return s.evalChainNode(dot, n, cmd.Args, final)
+	case *parse.IndexNode:
+		s.notAFunction(cmd.Args, final)
+		return s.evalIndexNode(dot, n)
 	case *parse.IdentifierNode:
 		// Must be a function.
 		return s.evalFunction(dot, n, cmd, cmd.Args, final)
@@ -484,8 +1271,19 @@ func (s *state) evalCommand(dot reflect.Value, cmd *parse.CommandNode, final ref
 		// Parenthesized pipeline. The arguments are all inside the pipeline; final must be absent.
 		s.notAFunction(cmd.Args, final)
 		return s.evalPipeline(dot, n)
+	case *parse.TemplateNode:
+		// The arguments are all inside the invocation; final must be absent.
+		s.notAFunction(cmd.Args, final)
+		return s.evalTemplate(dot, n)
 	case *parse.VariableNode:
 		return s.evalVariableNode(dot, n, cmd.Args, final)
+	case *parse.ComparisonNode:
+		return s.evalComparison(dot, n, final)
+	case *parse.LogicalNode:
+		return s.evalLogical(dot, n, final)
+	case *parse.NotNode:
+		s.notAFunction(cmd.Args, final)
+		return s.evalNot(dot, n)
 	}
 	s.at(firstWord)
 	s.notAFunction(cmd.Args, final)
@@ -505,6 +1303,89 @@ func (s *state) evalCommand(dot reflect.Value, cmd *parse.CommandNode, final ref
 	panic("unreachable")
 }
 
+// evalComparison evaluates the comparison n with the semantics of the
+// comparison functions, see ComparisonFuncs, final is passed to the left
+// operand.
+func (s *state) evalComparison(dot reflect.Value, n *parse.ComparisonNode, final reflect.Value) reflect.Value {
+	left := s.evalComparand(dot, n.Left, final)
+	right := s.evalComparand(dot, n.Right, missingVal)
+	s.at(n)
+
+	var (
+		ret bool
+		err error
+	)
+	switch n.Operator {
+	case "==":
+		ret, err = funcEq(left, right)
+	case "!=":
+		ret, err = funcNe(left, right)
+	case "<":
+		ret, err = funcLt(left, right)
+	case "<=":
+		ret, err = funcLe(left, right)
+	case ">":
+		ret, err = funcGt(left, right)
+	case ">=":
+		ret, err = funcGe(left, right)
+	default:
+		s.errorf("unknown comparison operator %q", n.Operator)
+	}
+	if err != nil {
+		s.errorf("error evaluating %s: %w", n, err)
+	}
+
+	return reflect.ValueOf(ret)
+}
+
+// evalLogical evaluates the logical operation n with short-circuit, like the
+// and and or functions of text/template, the result is the first operand
+// deciding it, final is passed to the left operand.
+func (s *state) evalLogical(dot reflect.Value, n *parse.LogicalNode, final reflect.Value) reflect.Value {
+	left := s.evalComparand(dot, n.Left, final)
+	if s.operandTruth(n.Operator, left) == (n.Operator == "||") {
+		return left
+	}
+	return s.evalComparand(dot, n.Right, missingVal)
+}
+
+// evalNot evaluates the negation of an operand to a bool.
+func (s *state) evalNot(dot reflect.Value, n *parse.NotNode) reflect.Value {
+	var v reflect.Value
+	switch arg := n.Operand.(type) {
+	case *parse.NilNode:
+		v = zero
+	case *parse.ChainNode:
+		v = s.evalChainNode(dot, arg, nil, missingVal)
+	default:
+		v = s.evalEmptyInterface(dot, arg)
+	}
+	return reflect.ValueOf(!s.operandTruth("!", v))
+}
+
+// operandTruth returns the truth of the operand val of the logical operator
+// op under the truth rule of the template.
+func (s *state) operandTruth(op string, val reflect.Value) bool {
+	rule := s.opt.truth
+	truth, ok := rule.isTrue(indirectInterface(val))
+	if !ok {
+		if rule == truthStrict {
+			s.errorf("%s requires a bool condition, got %s", op, typeString(val))
+		}
+		s.errorf("%s can't use %v", op, val)
+	}
+	return truth
+}
+
+// evalComparand evaluates an operand of a comparison or a logical operation,
+// a sole nil is the untyped nil.
+func (s *state) evalComparand(dot reflect.Value, cmd *parse.CommandNode, final reflect.Value) reflect.Value {
+	if _, ok := cmd.Args[0].(*parse.NilNode); ok && len(cmd.Args) == 1 && final == missingVal {
+		return zero
+	}
+	return s.evalCommand(dot, cmd, final)
+}
+
 // idealConstant is called to return the value of a number in a context where
 // we don't know the type. In that case, the syntax of the number tells us
 // its type, and we use Go rules to resolve. Note there is no such thing as
@@ -562,6 +1443,95 @@ func (s *state) evalChainNode(dot reflect.Value, chain *parse.ChainNode, args []
 	return s.evalFieldChain(dot, pipe, chain, chain.Field, args, final)
 }
 
+// evalIndexNode evaluates the operand of n indexed by its subscript. Arrays,
+// slices and strings are indexed by integers in range, maps by keys of their
+// key type, missing keys are handled as of the missingkey option like fields
+// of maps.
+func (s *state) evalIndexNode(dot reflect.Value, n *parse.IndexNode) reflect.Value {
+	s.at(n)
+	item := s.evalArg(dot, nil, n.Node)
+	index := indirectInterface(s.evalPipeline(dot, n.Index))
+	s.at(n)
+
+	if !item.IsValid() {
+		if s.opt.missingKey == mapError {
+			s.errorf("can't index missing value")
+		}
+		return zero
+	}
+
+	item, isNil := indirect(item)
+	switch item.Kind() {
+	case reflect.Array, reflect.Slice, reflect.String:
+		if !isCount(index) {
+			s.errorf("can't index %s with %s", item.Type(), describeIndex(index))
+		}
+		i, length := countLen(index), item.Len()
+		if i >= length || isNegative(index) {
+			s.errorf("index out of range [%v] with length %d", index, length)
+		}
+		return item.Index(i)
+	case reflect.Map:
+		key := s.mapKey(index, item.Type().Key())
+		result := item.MapIndex(key)
+		if !result.IsValid() {
+			switch s.opt.missingKey {
+			case mapZeroValue:
+				result = reflect.Zero(item.Type().Elem())
+			case mapError:
+				s.errorf("map has no entry for key %v", key)
+			}
+		}
+		return GetLazyValue(result)
+	}
+	if isNil {
+		s.errorf("nil pointer indexing %s", n.Node)
+	}
+	s.errorf("can't index item of type %s", item.Type())
+	panic("unreachable")
+}
+
+// mapKey returns index as a key of maps with keys of type typ, integers are
+// converted to integer keys they fit in.
+func (s *state) mapKey(index reflect.Value, typ reflect.Type) reflect.Value {
+	switch {
+	case !index.IsValid():
+		if canBeNil(typ) {
+			return reflect.Zero(typ)
+		}
+	case index.Type().AssignableTo(typ):
+		return index
+	case isCount(index) && isCount(reflect.Zero(typ)):
+		key := index.Convert(typ)
+		back := key.Convert(index.Type())
+		fits := isNegative(key) == isNegative(index)
+		if index.Kind() <= reflect.Int64 {
+			fits = fits && back.Int() == index.Int()
+		} else {
+			fits = fits && back.Uint() == index.Uint()
+		}
+		if fits {
+			return key
+		}
+		s.errorf("key %v overflows %s", index, typ)
+	}
+	s.errorf("can't use %s as key of type %s", describeIndex(index), typ)
+	panic("unreachable")
+}
+
+// isNegative reports whether the integer v is negative.
+func isNegative(v reflect.Value) bool {
+	return v.Kind() <= reflect.Int64 && v.Int() < 0
+}
+
+// describeIndex describes the subscript index in errors.
+func describeIndex(index reflect.Value) string {
+	if !index.IsValid() {
+		return "nil"
+	}
+	return "value of type " + index.Type().String()
+}
+
 func (s *state) evalVariableNode(dot reflect.Value, variable *parse.VariableNode, args []parse.Node, final reflect.Value) reflect.Value {
 	// $x.Field has $x as the first ident, Field as the second. Eval the var, then the fields.
 	s.at(variable)
@@ -579,8 +1549,14 @@ func (s *state) evalVariableNode(dot reflect.Value, variable *parse.VariableNode
 func (s *state) evalFieldChain(dot, receiver reflect.Value, node parse.Node, ident []string, args []parse.Node, final reflect.Value) reflect.Value {
 	n := len(ident)
 	for i := 0; i < n-1; i++ {
+		if r, ok := asResolver(receiver); ok {
+			return s.evalResolver(r, node, ident[i:], args, final)
+		}
 		receiver = s.evalField(dot, ident[i], node, nil, missingVal, receiver)
 	}
+	if r, ok := asResolver(receiver); ok {
+		return s.evalResolver(r, node, ident[n-1:], args, final)
+	}
 	// Now if it's a method, it gets the arguments.
 	return s.evalField(dot, ident[n-1], node, args, final, receiver)
 }
@@ -588,10 +1564,13 @@ func (s *state) evalFieldChain(dot, receiver reflect.Value, node parse.Node, ide
 func (s *state) evalFunction(dot reflect.Value, node *parse.IdentifierNode, cmd parse.Node, args []parse.Node, final reflect.Value) reflect.Value {
 	s.at(node)
 	name := node.Ident
-	function, isBuiltin, ok := findFunction(name, s.tmpl)
+	function, isBuiltin, ok := findFunction(name, s.funcs)
 	if !ok {
 		s.errorf("%q is not a defined function", name)
 	}
+	if s.result != nil {
+		s.result.Funcs[name]++
+	}
 	return s.evalCall(dot, function, isBuiltin, cmd, name, args, final)
 }
 
@@ -600,7 +1579,7 @@ func (s *state) evalFunction(dot reflect.Value, node *parse.IdentifierNode, cmd
 // value of the pipeline, if any.
 func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node, args []parse.Node, final, receiver reflect.Value) reflect.Value {
 	if !receiver.IsValid() {
-		if s.tmpl.option.missingKey == mapError { // Treat invalid value as missing map key.
+		if s.opt.missingKey == mapError { // Treat invalid value as missing map key.
 			s.errorf("nil data; no entry for key %q", fieldName)
 		}
 		return zero
@@ -627,10 +1606,13 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 	// It's not a method; must be a field of a struct or an element of a map.
 	switch receiver.Kind() {
 	case reflect.Struct:
-		tField, ok := receiver.Type().FieldByName(fieldName)
+		tField, ok := s.fieldByName(receiver.Type(), fieldName)
 		if ok {
 			field, err := receiver.FieldByIndexErr(tField.Index)
 			if !tField.IsExported() {
+				if getter := s.getter(ptr, fieldName); getter.IsValid() {
+					return s.evalCall(dot, getter, false, node, fieldName, args, final)
+				}
 				s.errorf("%s is an unexported field of struct type %s", fieldName, typ)
 			}
 			if err != nil {
@@ -644,14 +1626,12 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 		}
 	case reflect.Map:
 		// If it's a map, attempt to use the field name as a key.
-		nameVal := reflect.ValueOf(fieldName)
-		if nameVal.Type().AssignableTo(receiver.Type().Key()) {
+		if result, ok := mapIndex(receiver, fieldName); ok {
 			if hasArgs {
 				s.errorf("%s is not a method but has arguments", fieldName)
 			}
-			result := receiver.MapIndex(nameVal)
 			if !result.IsValid() {
-				switch s.tmpl.option.missingKey {
+				switch s.opt.missingKey {
 				case mapInvalid:
 					// Just use the invalid value.
 				case mapZeroValue:
@@ -665,7 +1645,7 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 	case reflect.Pointer:
 		etyp := receiver.Type().Elem()
 		if etyp.Kind() == reflect.Struct {
-			if _, ok := etyp.FieldByName(fieldName); !ok {
+			if _, ok := s.fieldByName(etyp, fieldName); !ok {
 				// If there's no such field, say "can't evaluate"
 				// instead of "nil pointer evaluating".
 				break
@@ -675,10 +1655,148 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 			s.errorf("nil pointer evaluating %s.%s", typ, fieldName)
 		}
 	}
+	if getter := s.getter(ptr, fieldName); getter.IsValid() {
+		return s.evalCall(dot, getter, false, node, fieldName, args, final)
+	}
 	s.errorf("can't evaluate field %s in type %s", fieldName, typ)
 	panic("unreachable")
 }
 
+// getter returns the accessor method of fieldName on receiver according to
+// the getters option, it returns the zero Value if there is no such method.
+func (s *state) getter(receiver reflect.Value, fieldName string) reflect.Value {
+	if len(s.opt.getterPrefixes) == 0 || fieldName == "" {
+		return zero
+	}
+
+	r, size := utf8.DecodeRuneInString(fieldName)
+	name := string(unicode.ToUpper(r)) + fieldName[size:]
+	for _, prefix := range s.opt.getterPrefixes {
+		if method := receiver.MethodByName(prefix + name); method.IsValid() {
+			return method
+		}
+	}
+
+	return zero
+}
+
+// fieldByName returns the struct field with the given name, falling back to
+// field tags and case-insensitive matching according to the template options.
+func (s *state) fieldByName(typ reflect.Type, fieldName string) (reflect.StructField, bool) {
+	if f, ok := typ.FieldByName(fieldName); ok {
+		return f, true
+	}
+
+	opt := s.opt
+	if len(opt.fieldTags) == 0 && !opt.foldCase {
+		return reflect.StructField{}, false
+	}
+
+	var (
+		folded reflect.StructField
+		found  bool
+	)
+	for _, f := range reflect.VisibleFields(typ) {
+		if !f.IsExported() {
+			continue
+		}
+
+		for _, key := range opt.fieldTags {
+			name, _, _ := strings.Cut(f.Tag.Get(key), ",")
+			switch {
+			case name == fieldName:
+				return f, true
+			case !found && opt.foldCase && strings.EqualFold(name, fieldName):
+				folded, found = f, true
+			}
+		}
+
+		if !found && opt.foldCase && strings.EqualFold(f.Name, fieldName) {
+			folded, found = f, true
+		}
+	}
+
+	return folded, found
+}
+
+// mapIndex looks up the map m with fieldName as the key, converting fieldName
+// to the key type of m when necessary, so integer and boolean keyed maps can be
+// accessed as fields. ok is false when fieldName can not be used as a key of m.
+func mapIndex(m reflect.Value, fieldName string) (result reflect.Value, ok bool) {
+	keyType := m.Type().Key()
+	nameVal := reflect.ValueOf(fieldName)
+	if !nameVal.Type().AssignableTo(keyType) {
+		key, ok := convertKey(fieldName, keyType)
+		if !ok {
+			return zero, false
+		}
+		return m.MapIndex(key), true
+	}
+
+	result = m.MapIndex(nameVal)
+	if result.IsValid() || keyType.Kind() != reflect.Interface {
+		return result, true
+	}
+
+	// Maps like map[interface{}]interface{} decoded from yaml may have
+	// keys of numbers and booleans.
+	for _, typ := range scalarKeyTypes {
+		key, ok := convertKey(fieldName, typ)
+		if !ok {
+			continue
+		}
+		if result = m.MapIndex(key); result.IsValid() {
+			break
+		}
+	}
+
+	return result, true
+}
+
+// scalarKeyTypes are non-string key types tried for maps with interface keys.
+var scalarKeyTypes = [...]reflect.Type{
+	reflect.TypeOf(int(0)),
+	reflect.TypeOf(uint64(0)),
+	reflect.TypeOf(float64(0)),
+	reflect.TypeOf(false),
+}
+
+// convertKey converts fieldName to a value of the map key type typ.
+func convertKey(fieldName string, typ reflect.Type) (reflect.Value, bool) {
+	key := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.String:
+		key.SetString(fieldName)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(fieldName, 10, typ.Bits())
+		if err != nil {
+			return zero, false
+		}
+		key.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(fieldName, 10, typ.Bits())
+		if err != nil {
+			return zero, false
+		}
+		key.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(fieldName, typ.Bits())
+		if err != nil {
+			return zero, false
+		}
+		key.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(fieldName)
+		if err != nil {
+			return zero, false
+		}
+		key.SetBool(b)
+	default:
+		return zero, false
+	}
+	return key, true
+}
+
 var (
 	errorType        = reflect.TypeOf((*error)(nil)).Elem()
 	fmtStringerType  = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
@@ -693,18 +1811,23 @@ func (s *state) evalCall(dot, fun reflect.Value, isBuiltin bool, node parse.Node
 		args = args[1:] // Zeroth arg is function name/node; not passed to function.
 	}
 	typ := fun.Type()
-	numIn := len(args)
+	// Env is passed as the first argument, not by the template.
+	first := 0
+	if takesEnv(typ) {
+		first = 1
+	}
+	numIn := first + len(args)
 	if final != missingVal {
 		numIn++
 	}
-	numFixed := len(args)
+	numFixed := first + len(args)
 	if typ.IsVariadic() {
 		numFixed = typ.NumIn() - 1 // last arg is the variadic one.
 		if numIn < numFixed {
-			s.errorf("wrong number of args for %s: want at least %d got %d", name, typ.NumIn()-1, len(args))
+			s.errorf("wrong number of args for %s: want at least %d got %d", name, typ.NumIn()-1-first, len(args))
 		}
 	} else if numIn != typ.NumIn() {
-		s.errorf("wrong number of args for %s: want %d got %d", name, typ.NumIn(), numIn)
+		s.errorf("wrong number of args for %s: want %d got %d", name, typ.NumIn()-first, numIn-first)
 	}
 	if !goodFunc(typ) {
 		// TODO: This could still be a confusing error; maybe goodFunc should provide info.
@@ -744,16 +1867,19 @@ func (s *state) evalCall(dot, fun reflect.Value, isBuiltin bool, node parse.Node
 
 	// Build the arg list.
 	argv := make([]reflect.Value, numIn)
+	if first != 0 {
+		argv[0] = reflect.ValueOf(Env(s.env))
+	}
 	// Args must be evaluated. Fixed args first.
-	i := 0
-	for ; i < numFixed && i < len(args); i++ {
-		argv[i] = s.evalArg(dot, typ.In(i), args[i])
+	i := first
+	for ; i < numFixed && i-first < len(args); i++ {
+		argv[i] = s.evalArg(dot, typ.In(i), args[i-first])
 	}
 	// Now the ... args.
 	if typ.IsVariadic() {
 		argType := typ.In(typ.NumIn() - 1).Elem() // Argument is a slice.
-		for ; i < len(args); i++ {
-			argv[i] = s.evalArg(dot, argType, args[i])
+		for ; i-first < len(args); i++ {
+			argv[i] = s.evalArg(dot, argType, args[i-first])
 		}
 	}
 	// Add final value if necessary.
@@ -772,11 +1898,23 @@ func (s *state) evalCall(dot, fun reflect.Value, isBuiltin bool, node parse.Node
 		}
 		argv[i] = s.validateType(final, t)
 	}
-	v, err := safeCall(fun, argv)
+	v, abandoned, err := timedCall(s.env, first != 0, fun, argv, s.opt.timeoutOf(name))
+	if s.trace != nil {
+		s.trace.call(s, node, name, argv[first:], v, err)
+	}
 	// If we have an error that is not nil, stop execution and return that
 	// error to the caller.
 	if err != nil {
 		s.at(node)
+		if abandoned {
+			// the call may still be running, try cannot recover from it
+			s.fatalf("error calling %s: %w", name, err)
+		}
+		var invalid *ValidationError
+		if errors.As(err, &invalid) {
+			*s.invalid = append(*s.invalid, s.execError("error calling %s: %w", name, err))
+			return unwrap(v)
+		}
 		s.errorf("error calling %s: %w", name, err)
 	}
 	return unwrap(v)
@@ -857,10 +1995,16 @@ func (s *state) evalArg(dot reflect.Value, typ reflect.Type, n parse.Node) refle
 		return s.validateType(s.evalVariableNode(dot, arg, nil, missingVal), typ)
 	case *parse.PipeNode:
 		return s.validateType(s.evalPipeline(dot, arg), typ)
+	case *parse.TemplateNode:
+		return s.validateType(s.evalTemplate(dot, arg), typ)
 	case *parse.IdentifierNode:
 		return s.validateType(s.evalFunction(dot, arg, arg, nil, missingVal), typ)
 	case *parse.ChainNode:
 		return s.validateType(s.evalChainNode(dot, arg, nil, missingVal), typ)
+	case *parse.IndexNode:
+		return s.validateType(s.evalIndexNode(dot, arg), typ)
+	case *parse.NotNode:
+		return s.validateType(s.evalNot(dot, arg), typ)
 	}
 	switch typ.Kind() {
 	case reflect.Bool:
@@ -975,6 +2119,12 @@ func (s *state) evalEmptyInterface(dot reflect.Value, n parse.Node) reflect.Valu
 		return s.evalVariableNode(dot, n, nil, missingVal)
 	case *parse.PipeNode:
 		return s.evalPipeline(dot, n)
+	case *parse.TemplateNode:
+		return s.evalTemplate(dot, n)
+	case *parse.NotNode:
+		return s.evalNot(dot, n)
+	case *parse.IndexNode:
+		return s.evalIndexNode(dot, n)
 	}
 	s.errorf("can't handle assignment of %s to empty interface argument", n)
 	panic("unreachable")
@@ -1010,14 +2160,238 @@ func indirectInterface(v reflect.Value) reflect.Value {
 // the template.
 func (s *state) printValue(n parse.Node, v reflect.Value) {
 	s.at(n)
+	if s.printPlain(n, v) {
+		return
+	}
+	if !hasPrintMethod(v) {
+		u, isValuer, err := unwrapValuer(v)
+		if err != nil {
+			s.errorf("can't print %s: %w", n, err)
+		}
+		if isValuer {
+			v = u
+		}
+	}
+	if s.opt.printNil != nilDefault {
+		if e, isNil := indirect(v); isNil || !e.IsValid() {
+			s.printNil(n, v)
+			return
+		}
+	}
+	start := s.offset()
+	if str, ok := s.formatByMethod(n, v); ok {
+		if _, err := io.WriteString(s.wr, str); err != nil {
+			s.writeError(err)
+		}
+		s.mapSource(n, start)
+		return
+	}
+	if s.opt.strictStruct {
+		if e, _ := indirect(v); e.Kind() == reflect.Struct {
+			s.errorf("can't print %s of struct type %s without explicit formatting", n, e.Type())
+		}
+	}
+	if s.opt.strictPrint {
+		if typ := s.unprintable(v); typ != nil {
+			s.errorf("can't print %s: value of type %s has no textual representation", n, typ)
+		}
+	}
 	iface, ok := printableValue(v)
 	if !ok {
 		s.errorf("can't print %s of type %s", n, v.Type())
 	}
+	s.warnMissing(n, v)
 	_, err := fmt.Fprint(s.wr, iface)
 	if err != nil {
 		s.writeError(err)
 	}
+	s.mapSource(n, start)
+}
+
+// printPlain prints v without boxing it for fmt if it is a string, an integer
+// or a bool without methods changing its textual representation, and reports
+// whether it did. Such values print the same with every option.
+func (s *state) printPlain(n parse.Node, v reflect.Value) bool {
+	v = indirectInterface(v)
+	if !v.IsValid() {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		return false
+	}
+
+	if m := methodsOf(v.Type()); m.printer || m.valuer {
+		return false
+	}
+
+	start := s.offset()
+	var err error
+	switch v.Kind() {
+	case reflect.String:
+		_, err = io.WriteString(s.wr, v.String())
+	case reflect.Bool:
+		s.buf = strconv.AppendBool(s.buf[:0], v.Bool())
+		_, err = s.wr.Write(s.buf)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.buf = strconv.AppendInt(s.buf[:0], v.Int(), 10)
+		_, err = s.wr.Write(s.buf)
+	default:
+		s.buf = strconv.AppendUint(s.buf[:0], v.Uint(), 10)
+		_, err = s.wr.Write(s.buf)
+	}
+	if err != nil {
+		s.writeError(err)
+	}
+	s.mapSource(n, start)
+	return true
+}
+
+// unprintable returns the type of v, or of an element of v, which has no
+// textual representation for the printable option, nil if there is none.
+// Pointers are followed at the top level only, as fmt does, values printed
+// by the printmethods option are handled before.
+func (s *state) unprintable(v reflect.Value) reflect.Type {
+	v, _ = indirect(v)
+	return s.unprintableElem(v)
+}
+
+func (s *state) unprintableElem(v reflect.Value) reflect.Type {
+	v = indirectInterface(v)
+	if !v.IsValid() {
+		return nil
+	}
+
+	typ := v.Type()
+	if hasPrintMethods(typ) {
+		return nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Struct:
+		return typ
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if t := s.unprintableElem(v.Index(i)); t != nil {
+				return t
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if t := s.unprintableElem(iter.Key()); t != nil {
+				return t
+			}
+			if t := s.unprintableElem(iter.Value()); t != nil {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// hasPrintMethods reports whether values of typ, or pointers to them, are
+// printed by methods when nested in other values, which fmt does for error
+// and fmt.Stringer only.
+func hasPrintMethods(typ reflect.Type) bool {
+	return methodsOf(typ).stringer
+}
+
+// typeMethods records the interfaces relevant to printing which a type, or
+// pointers to it, implement.
+type typeMethods struct {
+	stringer bool // error or fmt.Stringer.
+	printer  bool // error, fmt.Stringer or encoding.TextMarshaler.
+	valuer   bool // driver.Valuer.
+}
+
+// typeMethodsCache caches typeMethods by reflect.Type, since checking
+// interfaces on every printed value dominates the cost of printing.
+var typeMethodsCache sync.Map // map[reflect.Type]typeMethods
+
+// methodsOf returns the typeMethods of typ.
+func methodsOf(typ reflect.Type) typeMethods {
+	if m, ok := typeMethodsCache.Load(typ); ok {
+		return m.(typeMethods)
+	}
+
+	ptr := reflect.PointerTo(typ)
+	implements := func(iface reflect.Type) bool {
+		return typ.Implements(iface) || ptr.Implements(iface)
+	}
+
+	m := typeMethods{
+		stringer: implements(errorType) || implements(fmtStringerType),
+		valuer:   implements(driverValuerType),
+	}
+	m.printer = m.stringer || implements(textMarshalerType)
+	typeMethodsCache.Store(typ, m)
+	return m
+}
+
+// printNil prints the nil or invalid value v as of the printnil option.
+func (s *state) printNil(n parse.Node, v reflect.Value) {
+	var str string
+	switch s.opt.printNil {
+	case nilError:
+		if v.IsValid() {
+			s.errorf("can't print nil %s of type %s", n, v.Type())
+		}
+		s.errorf("can't print %s: no value", n)
+	case nilNoValue:
+		str = "<no value>"
+	}
+	s.warnMissing(n, v)
+	start := s.offset()
+	if _, err := io.WriteString(s.wr, str); err != nil {
+		s.writeError(err)
+	}
+	s.mapSource(n, start)
+}
+
+// formatByMethod formats v with the first method it implements in the order
+// of the printmethods option, ok is false if v implements none of them.
+//
+// Nil pointers are left to fmt.Fprint, which handles panics in methods
+// with nil receivers.
+func (s *state) formatByMethod(n parse.Node, v reflect.Value) (str string, ok bool) {
+	v = indirectInterface(v)
+	for v.Kind() == reflect.Pointer && v.Elem().Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	switch {
+	case !v.IsValid():
+		return "", false
+	case v.Kind() == reflect.Pointer:
+		if v.IsNil() || !methodsOf(v.Type().Elem()).printer {
+			return "", false
+		}
+	case !methodsOf(v.Type()).printer:
+		return "", false
+	case v.CanAddr():
+		v = v.Addr()
+	}
+
+	for _, m := range s.opt.printMethods {
+		if !v.Type().Implements(m.iface()) {
+			continue
+		}
+
+		ret, err := safeCall(v.MethodByName(m.method()), nil)
+		if err != nil {
+			s.errorf("error calling %s of %s: %w", m.method(), n, err)
+		}
+		if ret.Kind() == reflect.String {
+			return ret.String(), true
+		}
+		return string(ret.Bytes()), true
+	}
+
+	return "", false
 }
 
 // printableValue returns the, possibly indirected, interface value inside v that
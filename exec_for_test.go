@@ -0,0 +1,64 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForLoop(t *testing.T) {
+	funcs := FuncMap{
+		"add": func(a, b int) int { return a + b },
+		"mul": func(a, b int) int { return a * b },
+	}
+
+	for _, test := range []struct {
+		input   string
+		output  string
+		options []string
+		ok      bool
+	}{
+		{`for $i := 0; $i < 5; $i = add $i 1; $i; end`, "01234", nil, true},
+		{`for $i := 0; $i < .N; $i = add $i 1; $i; end`, "012", nil, true},
+		{"for $i := 1\n$i < 100\n$i = mul $i 2\n  $i; \",\"\nend", "1,2,4,8,16,32,64,", nil, true},
+		{`for $i := 0; $i < 0; $i = add $i 1; "x"; end`, "", nil, true},
+		{`for $i := 0; $i < 10; $i = add $i 1; if $i == 3; break; end; $i; end`, "012", nil, true},
+		{`for $i := 0; $i < 5; $i = add $i 1; if $i == 2; continue; end; $i; end`, "0134", nil, true},
+		{`for $i := 0; $i < 3; $i = add $i 1; range .L; if . == $i; continue; end; .; end; "|"; end`, "12|02|01|", nil, true},
+		{`for $i := 0; $i < 3; $i = add $i 1; range .L; break; end; $i; end`, "012", nil, true},
+		{`range .L; for $i := 0; true; $i = add $i 1; if $i == .; break; end; $i; end; ","; end`, ",0,01,", nil, true},
+		{`for $i := 0; $i < 3; $i = add $i 1; $x := mul $i 2; $x; end`, "024", nil, true},
+		{`$i := 10; for $i = 0; $i < 3; $i = add $i 1; end; $i`, "3", nil, true},
+		{`for $i := 0; $i < 3; $i = add $i 1; end; $i`, "", nil, false}, // $i is scoped to the loop
+		{`for $i := 0; .S; $i = add $i 1; break; end`, "", nil, true},
+		{`for $i := 0; .S; $i = add $i 1; break; end`, "", []string{"truthiness=strict"}, false},
+		{`for $i := 0; true; $i = add $i 1; end`, "", []string{"maxsteps=100"}, false},
+		{`for $i := 0; $i < 3; end`, "", nil, false},
+		{`for $i := 0; $i < 3; $i = add $i 1; else; end`, "", nil, false},
+		{`for $i := 0; $i < 3; $i = add $i 1`, "", nil, false},
+		{`$i := 0; for ; ; $i = add $i 1; if $i == 3; break; end; $i; end`, "012", nil, true},
+		{`for $i := 0; ; ; $i; $i = add $i 1; if $i == 3; break; end; end`, "012", nil, true},
+		{`for $i < 3; $i; $i = add $i 1; end`, "", nil, false}, // init must declare or assign
+		{`for $i := 0; $i < 3; add $i 1; end`, "", nil, false}, // post must declare or assign
+		{`define "loop"; for $i := 0; $i < 2; $i = add $i 1; $i; end; end; template "loop"`, "01", nil, true},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			tmpl, err := New("test").Option(test.options...).Funcs(funcs).Parse(test.input)
+			if err != nil {
+				assert.False(t, test.ok, err)
+				return
+			}
+
+			var sb strings.Builder
+			err = tmpl.Execute(&sb, map[string]any{"N": 3, "L": []int{0, 1, 2}, "S": ""})
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
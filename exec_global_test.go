@@ -0,0 +1,78 @@
+package tlang
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobalVariables(t *testing.T) {
+	const defs = `define "add"; $$total = add $$total .; end
+define "names"; $$names := printf "%s%s," $$names .; end
+`
+
+	data := []int{1, 2, 3}
+	funcs := ArithmeticFuncs()
+	funcs["printf"] = fmt.Sprintf
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		{`$$total := 0; range .; template "add" .; end; $$total`, "6", true},
+		{`$$names := ""; range .; template "names" "x"; end; $$names`, "x,x,x,", true},
+		{`$$x := 1; with .; $$x = 2; end; $$x`, "2", true},
+		{`$$x := 1; if true; $$x := 2; end; $$x`, "2", true},
+		{`$$m := .; $$m.Len`, "", false},
+		{`template "add" 1`, "", false},
+		{`$$unset`, "", false},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			var sb strings.Builder
+			tmpl := Must(New("test").Funcs(funcs).Parse(defs))
+			err := Must(tmpl.Parse(test.input)).Execute(&sb, data)
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+
+	for _, text := range []string{
+		`range $$x := .; end`,
+		`range $$i, $v := .; $v; end`,
+		`$$`,
+	} {
+		_, err := New("test").Parse(text)
+		assert.Error(t, err, text)
+	}
+
+	_, err := New("test").Option("strictvars=on").Parse(`$$x := 1`)
+	assert.NoError(t, err)
+}
+
+func TestExecOptionsVars(t *testing.T) {
+	tmpl := Must(New("test").Funcs(ArithmeticFuncs()).Parse(`define "count"; $$count = add $$count 1; end
+if $$verbose; "verbose "; end
+range .; template "count"; end
+$$count
+$$result := "done"`))
+
+	vars := map[string]any{"verbose": true, "count": 10}
+
+	var sb strings.Builder
+	assert.NoError(t, tmpl.ExecuteWithOptions(&sb, []int{1, 2}, &ExecOptions{Vars: vars}))
+	assert.Equal(t, "verbose 12", sb.String())
+	assert.Equal(t, map[string]any{"verbose": true, "count": 12, "result": "done"}, vars)
+
+	sb.Reset()
+	vars = map[string]any{"verbose": false, "count": "x"}
+	assert.Error(t, tmpl.ExecuteWithOptions(&sb, []int{1}, &ExecOptions{Vars: vars}))
+	assert.Equal(t, map[string]any{"verbose": false, "count": "x"}, vars)
+}
@@ -0,0 +1,104 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type indexItem struct {
+	Name string
+	Tags []string
+}
+
+func TestIndex(t *testing.T) {
+	funcs := FuncMap{
+		"add": func(a, b int) int { return a + b },
+	}
+
+	data := map[string]any{
+		"Items":  []*indexItem{{Name: "a", Tags: []string{"x", "y"}}, {Name: "b"}},
+		"Labels": map[string]string{"app": "web"},
+		"Codes":  map[uint8]string{200: "ok"},
+		"Deltas": map[int8]string{-1: "down"},
+		"Grid":   [2][2]int{{1, 2}, {3, 4}},
+		"Str":    "abc",
+		"Any":    []any{map[string]any{"k": 1}},
+		"I":      1,
+		"Nil":    (*indexItem)(nil),
+	}
+
+	for _, test := range []struct {
+		input   string
+		output  string
+		options []string
+		ok      bool
+	}{
+		{`.Items[0].Name`, "a", nil, true},
+		{`.Items[0].Tags[1]`, "y", nil, true},
+		{`.Items[.I].Name`, "b", nil, true},
+		{`.Items[add .I -1].Name`, "a", nil, true},
+		{`$items := .Items; $items[1].Name`, "b", nil, true},
+		{`.Labels["app"]`, "web", nil, true},
+		{`.Labels["missing"]`, "<no value>", nil, true},
+		{`.Labels["missing"]`, "", []string{"missingkey=zero"}, true},
+		{`.Labels["missing"]`, "", []string{"missingkey=error"}, false},
+		{`.Codes[200]`, "ok", nil, true},
+		{`.Codes[256]`, "", nil, false},
+		{`.Codes[-1]`, "", nil, false},
+		{`.Deltas[-1]`, "down", nil, true},
+		{`.Deltas[-129]`, "", nil, false},
+		{`.Deltas[255]`, "", nil, false},
+		{`.Grid[1][0]`, "3", nil, true},
+		{`.Str[1]`, "98", nil, true},
+		{`.Any[0]["k"]`, "1", nil, true},
+		{`.Any[0].k`, "1", nil, true},
+		{`(.Items)[1].Name`, "b", nil, true},
+		{`if .Items[0].Tags[0] == "x"; "yes"; end`, "yes", nil, true},
+		{`range $i, $e := .Items[0].Tags; $i; $e; end`, "0x1y", nil, true},
+		{`.[ "Str" ]`, "abc", nil, true},
+		{`.Missing[0]`, "<no value>", nil, true},
+		{`.Items[2]`, "", nil, false},
+		{`.Items[-1]`, "", nil, false},
+		{`.Items["a"]`, "", nil, false},
+		{`.Labels[1]`, "", nil, false},
+		{`.I[0]`, "", nil, false},
+		{`.Nil[0]`, "", nil, false},
+		{`.Items[0] 1`, "", nil, false},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			tmpl, err := New("test").Option(test.options...).Funcs(funcs).Parse(test.input)
+			if err != nil {
+				assert.False(t, test.ok, err)
+				return
+			}
+
+			var sb strings.Builder
+			err = tmpl.Execute(&sb, data)
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	data := map[string]any{"L": []int{1, 2}, "M": map[string]int{}}
+
+	for _, test := range []struct {
+		input string
+		err   string
+	}{
+		{`.L[2]`, "index out of range [2] with length 2"},
+		{`.L["x"]`, "can't index []int with value of type string"},
+		{`.M[.Missing]`, "can't use nil as key of type string"},
+	} {
+		err := Must(New("test").Parse(test.input)).Execute(&strings.Builder{}, data)
+		assert.ErrorContains(t, err, test.err, test.input)
+	}
+}
@@ -0,0 +1,69 @@
+package tlang
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogicalOperators(t *testing.T) {
+	funcs := FuncMap{
+		"fail":   func() (string, error) { return "", errors.New("evaluated") },
+		"printf": fmt.Sprintf,
+	}
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		{`if .A && (!.B || .C); "yes"; else; "no"; end`, "yes", true},
+		{`if .B || !.C; "yes"; else; "no"; end`, "no", true},
+		{`.A && !.B`, "true", true},
+		{`.S || "default"`, "x", true},
+		{`.E || "default"`, "default", true},
+		{`.E && "other"`, "", true},
+		{`.N > 1 && .N < 5 || fail`, "true", true},
+		{`.A || fail`, "true", true},
+		{`.B && fail`, "false", true},
+		{`.A && fail`, "", false},
+		{`.L | len && .A`, "", false}, // len is not defined
+		{`!(.N == 3)`, "false", true},
+		{`!.E`, "true", true},
+		{`!!.S`, "true", true},
+		{`!nil`, "true", true},
+		{`printf "%v %v" !.A !$.B`, "false true", true},
+		{`$x := .B || .N; $x`, "3", true},
+		{`.S | printf "%s" && .A`, "true", true},
+		{`.S | !.A`, "", false},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			tmpl, err := New("test").Option("missingkey=error").Funcs(funcs).Parse(test.input)
+			if err != nil {
+				assert.False(t, test.ok, err)
+				return
+			}
+
+			var sb strings.Builder
+			err = tmpl.Execute(&sb, map[string]any{
+				"A": true,
+				"B": false,
+				"C": true,
+				"N": 3,
+				"S": "x",
+				"E": "",
+				"L": []int{1},
+			})
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
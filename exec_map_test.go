@@ -0,0 +1,57 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapKeyConversion(t *testing.T) {
+	type Key string
+
+	data := map[string]any{
+		// as decoded by yaml.v2
+		"Y": map[any]any{
+			"name": "yaml",
+			1:      "one",
+			true:   "yes",
+			"nested": map[any]any{
+				2: "two",
+			},
+		},
+		"I": map[int]string{1: "int"},
+		"U": map[uint8]string{2: "uint8"},
+		"K": map[Key]string{"k": "key"},
+	}
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		{`.Y.name`, "yaml", true},
+		{`.Y.1`, "one", true},
+		{`.Y.true`, "yes", true},
+		{`.Y.nested.2`, "two", true},
+		{`$y := .Y; $y.1`, "one", true},
+		{`.Y.missing`, "<no value>", true},
+		{`.I.1`, "int", true},
+		{`.U.2`, "uint8", true},
+		{`.U.256`, "", false},
+		{`.I.x`, "", false},
+		{`.K.k`, "key", true},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			var sb strings.Builder
+			err := Must(New("test").Parse(test.input)).Execute(&sb, data)
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateParams(t *testing.T) {
+	const defs = `define "greet" $name $greeting
+  $greeting; ", "; $name; "!"
+end
+define "dot" $suffix
+  .Name; $suffix
+end
+define "count" $n
+  if $n > 0; $n; " "; recurse (sub $n 1); end
+end
+define "pair" $a $b
+  $a; "/"; $b
+end
+define "scope" $x
+  $y := 1; $x; $y
+end
+`
+
+	data := map[string]any{
+		"Name": "bob",
+		"Tags": []string{"a", "b"},
+	}
+
+	for _, test := range []struct {
+		input  string
+		output string
+		err    string
+	}{
+		{`template "greet" "bob" "hi"`, "hi, bob!", ""},
+		{`template "greet" .Name "hello"`, "hello, bob!", ""},
+		{`$g := "hey"; template "greet" (upper .Name) $g`, "hey, BOB!", ""},
+		{`template "dot" "?"`, "bob?", ""},
+		{`template "dot" upper .Name`, "bobBOB", ""},
+		{`template "dot" .Name | upper`, "bobBOB", ""},
+		{`template "count" 3`, "3 2 1 ", ""},
+		{`template "pair" .Tags[0] nil`, "a/<no value>", ""},
+		{`(template "greet" "x" "y")`, "y, x!", ""},
+		{`template "scope" 0`, "01", ""},
+		{`template "greet" "bob"`, "", `wrong number of args for template "greet": want 2 got 1`},
+		{`template "greet"`, "", `wrong number of args for template "greet": want 2 got 0`},
+		{`template "dot" "a" "b"`, "", `wrong number of args for template "dot": want 1 got 2`},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			funcs := ArithmeticFuncs()
+			funcs["upper"] = strings.ToUpper
+			tmpl := Must(Must(New("test").Funcs(funcs).Parse(defs)).Parse(test.input))
+
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, data)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+
+	info, ok := Must(New("test").Funcs(ArithmeticFuncs()).Parse(defs)).Info("greet")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"$name", "$greeting"}, info.Params)
+
+	_, err := Must(New("test").Funcs(ArithmeticFuncs()).Parse(defs)).TextTemplate()
+	assert.ErrorContains(t, err, "parameters are not supported by text/template")
+}
+
+func TestTemplateNamedArgs(t *testing.T) {
+	const defs = `define "card" $name $count
+  $name; ":"; $count
+end
+define "plain"
+  "plain"
+end
+`
+
+	data := map[string]any{"User": map[string]any{"Name": "bob"}, "N": 2}
+
+	for _, test := range []struct {
+		input  string
+		output string
+		err    string
+	}{
+		{`template "card" name="bob" count=3`, "bob:3", ""},
+		{`template "card" count=.N name=.User.Name`, "bob:2", ""},
+		{`template "card" name=(upper .User.Name) count=(add .N 1)`, "BOB:3", ""},
+		{`$c := (template "card" name="x" count=nil); $c`, "x:<no value>", ""},
+		{`template "card" name="bob"`, "", `missing argument count for template "card"`},
+		{`template "card" name="bob" count=1 size=2`, "", `template "card" has no parameter $size`},
+		{`template "plain" name="bob"`, "", `template "plain" has no parameter $name`},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			funcs := ArithmeticFuncs()
+			funcs["upper"] = strings.ToUpper
+			tmpl := Must(Must(New("test").Funcs(funcs).Parse(defs)).Parse(test.input))
+
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, data)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
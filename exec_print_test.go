@@ -0,0 +1,65 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type plainInt int
+
+type stringerInt int
+
+func (i stringerInt) String() string { return "#" + strings.Repeat("i", int(i)) }
+
+type textString string
+
+func (s *textString) MarshalText() ([]byte, error) { return []byte(strings.ToUpper(string(*s))), nil }
+
+func TestPrintPlainValues(t *testing.T) {
+	data := struct {
+		Str    string
+		Int    int
+		Neg    int8
+		Uint   uint64
+		Bool   bool
+		Plain  plainInt
+		Any    any
+		Method stringerInt
+		Text   textString
+	}{
+		Str:    "foo",
+		Int:    1234,
+		Neg:    -5,
+		Uint:   1 << 63,
+		Bool:   true,
+		Plain:  300,
+		Any:    stringerInt(2),
+		Method: 3,
+		Text:   "bar",
+	}
+
+	for _, test := range []struct {
+		input  string
+		output string
+	}{
+		{`.Str`, "foo"},
+		{`.Int`, "1234"},
+		{`.Neg`, "-5"},
+		{`.Uint`, "9223372036854775808"},
+		{`.Bool`, "true"},
+		{`.Plain`, "300"},
+		{`.Int; .Neg; .Plain`, "1234-5300"},
+		{`.Any`, "#ii"},
+		{`.Method`, "#iii"},
+		{`.Text`, "BAR"},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			var sb strings.Builder
+			err := Must(New("test").Parse(test.input)).Execute(&sb, &data)
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package tlang
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortedRange(t *testing.T) {
+	type Item struct {
+		Name  string
+		Value int
+	}
+
+	data := map[string]any{
+		"S":  []int{3, 1, 2},
+		"N":  []any{2.5, 1, uint(2)},
+		"M":  map[string]int{"b": 1, "a": 3, "c": 2},
+		"MI": map[string]Item{"x": {"x", 2}, "y": {"y", 1}, "z": {"z", 2}},
+		"SI": []Item{{"b", 2}, {"a", 1}, {"c", 2}},
+		"E":  []int{},
+		"B":  []any{1, "a"},
+	}
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		{`range sorted .S; .; end`, "123", true},
+		{`range sorted .N; .; ","; end`, "1,2,2.5,", true},
+		{`range sorted .M; .; end`, "312", true},
+		{`range sorted $k, $v := .M; $k; end`, "abc", true},
+		{`range sorted .M by .; .; end`, "123", true},
+		{`range sorted $k, $v := .M by $v; $k; end`, "bca", true},
+		{`range sorted .MI by .Value; .Name; end`, "yxz", true},
+		{`range sorted $i, $e := .SI by .Value; $i; .Name; end`, "1a0b2c", true},
+		{`range sorted .SI by .Name; .Name; end`, "abc", true},
+		{`range sorted .E by .; .; else; "empty"; end`, "empty", true},
+		{`range sorted .B; .; end`, "", false},
+		{`range sorted .SI; .; end`, "", false},
+		{`range .S; .; end`, "312", true},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			var sb strings.Builder
+			err := Must(New("test").Parse(test.input)).Execute(&sb, data)
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
+
+func TestSortedRange_String(t *testing.T) {
+	for _, test := range []struct {
+		input  string
+		output string
+	}{
+		{`range sorted .M; .; end`, `{{range sorted .M}}{{.}}{{end}}`},
+		{`range sorted $k, $v := .M by $v; $k; end`, `{{range sorted $k, $v := .M by $v}}{{$k}}{{end}}`},
+		{`range sorted (by .M) by (by .); end`, `{{range sorted (by .M) by (by .)}}{{end}}`},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			tmpl := Must(New("test").Funcs(FuncMap{"by": func(v any) any { return v }}).Parse(test.input))
+			assert.Equal(t, test.output, tmpl.Tree.Root.String())
+		})
+	}
+}
+
+func TestRangeElseReason(t *testing.T) {
+	var nilPtr *[]int
+	data := map[string]any{
+		"S":   []int{1},
+		"E":   []int{},
+		"Nil": []int(nil),
+		"P":   nilPtr,
+		"I":   0,
+		"B":   true,
+		"C":   make(chan int),
+	}
+	close(data["C"].(chan int))
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		{`range .S; .; else $why; $why; end`, "1", true},
+		{`range .E; .; else $why; $why; end`, "empty", true},
+		{`range sorted .E; .; else $why; $why; end`, "empty", true},
+		{`range .Nil; .; else $why; $why; end`, "nil", true},
+		{`range .Missing; .; else $why; $why; end`, "nil", true},
+		{`range .P; .; else $why; $why; end`, "nil", true},
+		{`range .C; .; else $why; $why; end`, "empty", true},
+		{`range .I; .; else $why; $why; end`, "empty", true},
+		{`range .B; .; else $why; $why; end`, "type", true},
+		{`range sorted .B; .; else $why; $why; end`, "type", true},
+		{`range $i, $e := .E; else $why; $why; end`, "empty", true},
+		{`range .B; .; else; "x"; end`, "", false},
+		{`range .E; else $why; end; $why`, "", false},
+		{`if .S; else $why; end`, "", false},
+		{`range .E; else $; end`, "", false},
+		{`range .E; else $$why; end`, "", false},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			tmpl, err := New("test").Parse(test.input)
+			if err == nil {
+				var sb strings.Builder
+				err = tmpl.Execute(&sb, data)
+				if test.ok {
+					assert.NoError(t, err)
+					assert.Equal(t, test.output, sb.String())
+					return
+				}
+			}
+			assert.False(t, test.ok, "unexpected error: %v", err)
+			assert.Error(t, err)
+		})
+	}
+
+	tmpl := Must(New("test").Parse(`range sorted .E; else $why; $why; end`))
+	assert.Equal(t, `{{range sorted .E}}{{else $why}}{{$why}}{{end}}`, tmpl.Tree.Root.String())
+}
+
+func TestBreakInRangeElse(t *testing.T) {
+	data := map[string]any{"S": [][]int{{}, {1}, {}}, "E": []int{}}
+
+	for _, test := range []struct {
+		input  string
+		output string
+	}{
+		// break and continue in the else branch of a range apply to the
+		// enclosing loop
+		{`range .S; range .; .; else; break; end; "x"; end; "-"`, "-"},
+		{`range .S; range .; .; else; continue; end; "x"; end`, "1x"},
+		{`range .S; range .; .; else; if true; break; end; end; "x"; end`, ""},
+		{`for $i := 0; $i < 2; $i = 1; range $.E; else; break; end; "x"; end`, ""},
+		{`range .S; range .; break; else; "e"; end; "x"; end`, "exxex"},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			var sb strings.Builder
+			tmpl := Must(New("test").Option("maxsteps=1000").Parse(test.input))
+			assert.NoError(t, tmpl.Execute(&sb, data))
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
+
+func TestRangeCount(t *testing.T) {
+	funcs := FuncMap{
+		"printf": fmt.Sprintf,
+		"gt":     func(a, b int) bool { return a > b },
+	}
+
+	data := map[string]any{
+		"N":   3,
+		"U":   uint8(2),
+		"Neg": -1,
+		"D":   time.Duration(2),
+	}
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		{`range 5; .; end`, "01234", true},
+		{`range $i := 3; $i; end`, "012", true},
+		{`range .N; .; ","; end`, "0,1,2,", true},
+		{`range .U; printf "%T" .; end`, "uint8uint8", true},
+		{`range .D; .; " "; end`, "0s 1ns ", true},
+		{`range 0; .; else $why; $why; end`, "empty", true},
+		{`range .Neg; .; else; "none"; end`, "none", true},
+		{`range 10; if . == 3; break; end; .; end`, "012", true},
+		{`range sorted .N; .; end`, "012", true},
+		{`range .N | filter (gt . 0); .; end`, "12", true},
+		{`range $i, $v := 3; end`, "", false},
+		{`range $i, $v := .N | limit 1; end`, "", false},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			tmpl, err := New("test").Funcs(funcs).Parse(test.input)
+			if err == nil {
+				var sb strings.Builder
+				err = tmpl.Execute(&sb, data)
+				if test.ok {
+					assert.NoError(t, err)
+					assert.Equal(t, test.output, sb.String())
+					return
+				}
+			}
+			assert.False(t, test.ok, "unexpected error: %v", err)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRangeStages(t *testing.T) {
+	type Item struct {
+		Name    string
+		Age     int
+		Enabled bool
+	}
+
+	items := []Item{
+		{"d", 30, true},
+		{"b", 20, false},
+		{"a", 30, true},
+		{"c", 10, true},
+	}
+
+	pulled := 0
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for i := 0; i < 100; i++ {
+			select {
+			case ch <- i:
+			case <-time.After(time.Second):
+				return
+			}
+		}
+	}()
+
+	data := map[string]any{
+		"Items": items,
+		"M":     map[string]int{"a": 1, "b": 2, "c": 3},
+		"Chan":  ch,
+		"E":     []Item{},
+		"N":     2,
+	}
+
+	funcs := FuncMap{
+		"printf": fmt.Sprintf,
+		"gt":     func(a, b int) bool { return a > b },
+		"count": func(v int) int {
+			pulled++
+			return v
+		},
+	}
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		{`range .Items | sortBy "Name"; .Name; end`, "abcd", true},
+		{`range .Items | sortBy "-Age" "Name"; .Name; end`, "adbc", true},
+		{`range .Items | filter .Enabled; .Name; end`, "dac", true},
+		{`range .Items | filter .Enabled | sortBy "Name" | limit 2; .Name; end`, "ac", true},
+		{`range .Items | limit $.N; .Name; end`, "db", true},
+		{`range $i, $e := .Items | filter (gt $e.Age 15); $i; $e.Name; end`, "0d1b2a", true},
+		{`range $k, $v := .M | filter (gt $v 1); $k; end`, "bc", true},
+		{`range $k, $v := .M | sortBy | limit 1; $k; end`, "a", true},
+		{`range .Items | filter .Enabled | limit 0; .Name; else; "none"; end`, "none", true},
+		{`range .E | filter .Enabled; .Name; else $why; $why; end`, "empty", true},
+		{`range sorted .Items | filter .Enabled by .Name; .Name; end`, "acd", true},
+		{`range .Items | limit 2; .Name; break; end`, "d", true},
+		{`range .Chan | filter (gt (count .) 2) | limit 2; .; end`, "34", true},
+		{`range .Items | sortBy "Missing"; .Name; end`, "", false},
+		{`range .Items | filter .Name; .Name; end`, "dbac", true},
+		{`range .Items | filter; end`, "", false},
+		{`range .Items | limit 1 2; end`, "", false},
+		{`range .Items | limit 1 | printf "%v"; end`, "", false},
+		{`range .Items | sortBy ""; end`, "", false},
+		{`range $i, $c := .Items | chunk 3; $i; ":"; range $c; .Name; end; ";"; end`, "0:dba;1:c;", true},
+		{`range .Items | filter .Enabled | sortBy "Name" | chunk 2; printf "%T" .; end`, "[]tlang.Item[]tlang.Item", true},
+		{`range $i, $w := .Items | window 3; $i; range $w; .Name; end; ";"; end`, "0dba;1bac;", true},
+		{`range .Items | window 5; .; else; "none"; end`, "none", true},
+		{`range .Chan | chunk 2 | limit 2; .; end`, "[5 6][7 8]", true},
+		{`range .Items | chunk 0; end`, "", false},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			tmpl, err := New("test").Funcs(funcs).Parse(test.input)
+			if err == nil {
+				var sb strings.Builder
+				err = tmpl.Execute(&sb, data)
+				if test.ok {
+					assert.NoError(t, err)
+					assert.Equal(t, test.output, sb.String())
+					return
+				}
+			}
+			assert.False(t, test.ok, "unexpected error: %v", err)
+			assert.Error(t, err)
+		})
+	}
+	assert.Equal(t, 5, pulled, "elements are pulled lazily")
+
+	tmpl := Must(New("test").Parse(`range $i, $e := .Items | filter .Enabled | sortBy "Name" "-Age" | limit 3; end`))
+	assert.Equal(t, `{{range $i, $e := .Items | filter .Enabled | sortBy "Name" "-Age" | limit 3}}{{end}}`, tmpl.Tree.Root.String())
+}
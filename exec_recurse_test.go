@@ -0,0 +1,66 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecurse(t *testing.T) {
+	type node struct {
+		Name     string
+		Size     int
+		Children []node
+	}
+
+	tree := node{Name: "root", Size: 1, Children: []node{
+		{Name: "a", Size: 2, Children: []node{{Name: "a1", Size: 3}}},
+		{Name: "b", Size: 4},
+	}}
+
+	const defs = `define "menu"
+  "("; .Name; range .Children; " "; recurse .; end; ")"
+end
+define "size"
+  $n := .Size
+  range .Children; $n = add $n (recurse .); end
+  return $n
+end
+define "outer"; block "inner" .; .Name; range .Children; recurse .; end; end; end
+`
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		{`template "menu" .`, "(root (a (a1)) (b))", true},
+		{`(template "size" .)`, "10", true},
+		{`template "inner" .`, "rootaa1b", true},
+		{`.Name; range .Children; "/"; recurse .; end`, "root/a/a1/b", true},
+		{`recurse .`, "", false},
+		{`$x := recurse .`, "", false},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			tmpl, err := New("test").Funcs(ArithmeticFuncs()).Option("maxdepth=10").Parse(defs)
+			if err == nil {
+				tmpl, err = tmpl.Parse(test.input)
+			}
+			if err == nil {
+				var sb strings.Builder
+				err = tmpl.Execute(&sb, tree)
+				if test.ok {
+					assert.NoError(t, err)
+					assert.Equal(t, test.output, sb.String())
+					return
+				}
+			}
+			assert.False(t, test.ok, "unexpected error: %v", err)
+			assert.Error(t, err)
+		})
+	}
+
+	tmpl := Must(New("test").Parse(`define "x"; recurse .A; (recurse .B); end`))
+	assert.Equal(t, `{{recurse .A}}{{(recurse .B)}}`, tmpl.Lookup("x").Root.String())
+}
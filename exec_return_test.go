@@ -0,0 +1,60 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateAsValue(t *testing.T) {
+	const defs = `define "double"; return mul . 2; end
+define "greet"; "hello "; .; end
+define "first"; range .; return .; end; "none"; end
+define "early"; "partial"; return; "unreachable"; end
+`
+
+	funcs := ArithmeticFuncs()
+	funcs["upper"] = strings.ToUpper
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		{`(template "double" 21)`, "42", true},
+		{`$r := (template "double" .N); add $r 1`, "7", true},
+		{`add (template "double" (template "double" 1)) 0`, "4", true},
+		{`(template "greet" "tlang") | upper`, "HELLO TLANG", true},
+		{`$g := (template "greet" .S | upper); $g`, "hello X", true},
+		{`(template "first" .L)`, "b", true},
+		{`(template "first" .E)`, "none", true},
+		{`(template "early")`, "partial", true},
+		{`template "double" 1; "|"; template "greet" "a"`, "|hello a", true},
+		{`"a"; return; "b"`, "a", true},
+		{`"a"; return 1; "b"`, "a", true},
+		{`(template "missing")`, "", false},
+		{`.N | (template "double")`, "", false},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			var sb strings.Builder
+			tmpl := Must(New("test").Funcs(funcs).Parse(defs))
+			err := Must(tmpl.Parse(test.input)).Execute(&sb, map[string]any{
+				"N": 3,
+				"S": "x",
+				"L": []string{"b", "c"},
+				"E": []string{},
+			})
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+
+	_, err := New("test").Parse(`$r := template "x" .`)
+	assert.ErrorContains(t, err, "must be parenthesized")
+}
@@ -0,0 +1,193 @@
+package tlang
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"arhat.dev/tlang/parse"
+)
+
+// exprName is the name of templates holding expressions, used in errors.
+const exprName = "expr"
+
+// EvalExpr parses and evaluates expr, a single pipeline like "add .A .B",
+// with data as dot and funcs as the functions available, and returns the
+// value of the pipeline, e.g. for config fields holding small expressions
+// rather than whole templates.
+//
+// Statements, like if and range, are not allowed, nor are variable
+// declarations and assignments, in nested pipelines too.
+// Use CompileExpr for expressions evaluated repeatedly.
+func EvalExpr(expr string, data any, funcs FuncMap) (any, error) {
+	e, err := CompileExpr(expr, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Eval(data)
+}
+
+// Expression is a compiled expression, see EvalExpr. It can be evaluated
+// concurrently and repeatedly against different data without parsing again.
+type Expression struct {
+	text    string
+	t       *Template
+	pipe    *parse.PipeNode
+	stack   []string                 // stack of executing templates, for errors.
+	globals map[string]reflect.Value // bound global variables, read only.
+
+	states *sync.Pool // of *exprState, reused by evaluations.
+}
+
+// exprState is the state of an evaluation of an Expression.
+type exprState struct {
+	state
+	env     execEnv
+	out     lineWriter
+	vars    [1]variable
+	invalid MultiError
+}
+
+// CompileExpr parses expr like EvalExpr and returns the compiled Expression.
+func CompileExpr(expr string, funcs FuncMap) (*Expression, error) {
+	t, pipe, err := parseExpr(expr, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Expression{
+		text:    expr,
+		t:       t,
+		pipe:    pipe,
+		stack:   []string{exprName},
+		globals: make(map[string]reflect.Value),
+		states:  &sync.Pool{New: func() any { return new(exprState) }},
+	}, nil
+}
+
+// MustCompileExpr is like CompileExpr but panics if expr cannot be parsed.
+func MustCompileExpr(expr string, funcs FuncMap) *Expression {
+	e, err := CompileExpr(expr, funcs)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the text of the expression.
+func (e *Expression) String() string {
+	return e.text
+}
+
+// Bind returns a copy of the expression with global variables bound by name
+// without dollar signs, e.g. vars["limit"] is $$limit in the expression, in
+// addition to variables bound to e.
+func (e *Expression) Bind(vars map[string]any) *Expression {
+	globals := make(map[string]reflect.Value, len(e.globals)+len(vars))
+	for name, v := range e.globals {
+		globals[name] = v
+	}
+	for name, v := range vars {
+		globals["$$"+name] = reflect.ValueOf(v)
+	}
+
+	ne := *e
+	ne.globals = globals
+	return &ne
+}
+
+// Eval evaluates the expression with data as dot and returns its value.
+func (e *Expression) Eval(data any) (ret any, err error) {
+	es := e.states.Get().(*exprState)
+	defer func() {
+		// do not retain data
+		*es = exprState{invalid: es.invalid[:0]}
+		e.states.Put(es)
+	}()
+	defer func() {
+		if len(es.invalid) != 0 {
+			err = joinValidation(append(MultiError(nil), es.invalid...), err)
+		}
+	}()
+	defer errRecover(&err)
+
+	value, ok := data.(reflect.Value)
+	if !ok {
+		value = reflect.ValueOf(data)
+	}
+
+	es.env.init(&e.t.option, nil)
+	es.out.w = io.Discard
+	es.env.out = &es.out
+	es.vars[0] = variable{"$", value}
+	es.state = state{
+		tmpl:  e.t,
+		opt:   &e.t.option,
+		funcs: e.t.funcs,
+		wr:    &es.out,
+		vars:  es.vars[:1],
+		stack: e.stack,
+
+		globals: e.globals,
+		env:     &es.env,
+		invalid: &es.invalid,
+	}
+
+	v := es.evalPipeline(value, e.pipe)
+	if v.IsValid() && v.CanInterface() {
+		ret = v.Interface()
+	}
+	return
+}
+
+// parseExpr parses expr as a template with a single pipeline.
+func parseExpr(expr string, funcs FuncMap) (*Template, *parse.PipeNode, error) {
+	t := New(exprName)
+	if funcs != nil {
+		t.Funcs(funcs)
+	}
+
+	_, err := t.Parse(expr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(t.tmpl) != 1 || len(t.vars) != 0 {
+		return nil, nil, fmt.Errorf("template: %s: expression defines templates or constants", exprName)
+	}
+
+	var pipe *parse.PipeNode
+	for _, n := range t.Root.Nodes {
+		switch n := n.(type) {
+		case *parse.CommentNode:
+			continue
+		case *parse.ActionNode:
+			if pipe == nil && len(n.Pipe.Decl) == 0 {
+				pipe = n.Pipe
+				continue
+			}
+		}
+
+		return nil, nil, fmt.Errorf("template: %s: %q is not a single pipeline", exprName, expr)
+	}
+	if pipe == nil {
+		return nil, nil, fmt.Errorf("template: %s: empty expression", exprName)
+	}
+
+	// nested pipelines cannot declare or assign variables either, global
+	// variables are shared by evaluations
+	decl := false
+	parse.Inspect(pipe, func(n parse.Node) bool {
+		if p, ok := n.(*parse.PipeNode); ok && len(p.Decl) != 0 {
+			decl = true
+		}
+		return !decl
+	})
+	if decl {
+		return nil, nil, fmt.Errorf("template: %s: %q declares or assigns variables", exprName, expr)
+	}
+
+	return t, pipe, nil
+}
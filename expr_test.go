@@ -0,0 +1,94 @@
+package tlang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalExpr(t *testing.T) {
+	funcs := ArithmeticFuncs()
+	for name, fn := range ComparisonFuncs() {
+		funcs[name] = fn
+	}
+
+	data := map[string]any{"A": 1, "B": 2, "S": []string{"x"}}
+
+	for _, test := range []struct {
+		expr     string
+		expected any
+		err      string
+	}{
+		{"add .A .B", 3, ""},
+		{"# sum\n add .A .B | mul 2 # doubled", 6, ""},
+		{"gt .B .A", true, ""},
+		{".S", []string{"x"}, ""},
+		{".Missing", nil, ""},
+		{"sub .A", nil, "wrong number of args for sub"},
+		{"", nil, "template: expr: empty expression"},
+		{".A; .B", nil, `template: expr: ".A; .B" is not a single pipeline`},
+		{"$x := .A", nil, `template: expr: "$x := .A" is not a single pipeline`},
+		{"if .A; .B; end", nil, `template: expr: "if .A; .B; end" is not a single pipeline`},
+		{"add ($x := .A) 1", nil, `template: expr: "add ($x := .A) 1" declares or assigns variables`},
+		{"($$n = .A)", nil, `template: expr: "($$n = .A)" declares or assigns variables`},
+		{"define \"x\"; 1; end; .A", nil, "template: expr: expression defines templates or constants"},
+		{"undefined .A", nil, `template: expr:1: function "undefined" not defined`},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			v, err := EvalExpr(test.expr, data, funcs)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, v)
+		})
+	}
+}
+
+func TestExpression(t *testing.T) {
+	e := MustCompileExpr("gt .Size $$limit", ComparisonFuncs())
+	assert.Equal(t, "gt .Size $$limit", e.String())
+
+	_, err := e.Eval(map[string]int{"Size": 1})
+	assert.ErrorContains(t, err, "global variable $$limit not set")
+
+	small, large := e.Bind(map[string]any{"limit": 10}), e.Bind(map[string]any{"limit": 100})
+	for _, test := range []struct {
+		e        *Expression
+		size     int
+		expected bool
+	}{
+		{small, 50, true},
+		{large, 50, false},
+		{small.Bind(map[string]any{"limit": 60}), 50, false},
+	} {
+		v, err := test.e.Eval(map[string]int{"Size": test.size})
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, v)
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		done := make(chan bool)
+		for i := 0; i < 8; i++ {
+			go func(i int) {
+				v, err := small.Eval(map[string]int{"Size": i * 3})
+				done <- err == nil && v == (i*3 > 10)
+			}(i)
+		}
+		for i := 0; i < 8; i++ {
+			assert.True(t, <-done)
+		}
+	})
+}
+
+func BenchmarkExpression(b *testing.B) {
+	e := MustCompileExpr("gt .Size $$limit", ComparisonFuncs()).Bind(map[string]any{"limit": 10})
+	data := map[string]int{"Size": 50}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = e.Eval(data)
+	}
+}
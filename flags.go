@@ -0,0 +1,80 @@
+package tlang
+
+import "fmt"
+
+// FlagProvider evaluates feature flags, see FlagFuncs. Implementations must
+// be safe for concurrent use.
+type FlagProvider interface {
+	// Flag reports whether the feature flag name is enabled.
+	Flag(name string) (bool, error)
+}
+
+// FlagProviderFunc is a function implementing FlagProvider.
+type FlagProviderFunc func(name string) (bool, error)
+
+// Flag implements FlagProvider.
+func (f FlagProviderFunc) Flag(name string) (bool, error) { return f(name) }
+
+// StaticFlags is a FlagProvider of fixed flags, flags not in the map are
+// disabled.
+type StaticFlags map[string]bool
+
+// Flag implements FlagProvider.
+func (f StaticFlags) Flag(name string) (bool, error) { return f[name], nil }
+
+// FlagFuncs returns functions for feature flags, so that rollout logic in
+// templates is evaluated the same way everywhere:
+//
+//	feature name
+//		Reports whether the feature flag name is enabled, see Env.Feature.
+//
+// For example:
+//
+//	if feature "new-header"
+//	  template "header-v2" .
+//	else
+//	  template "header" .
+//	end
+func FlagFuncs() FuncMap {
+	return FuncMap{
+		"feature": func(env Env, name string) (bool, error) {
+			return env.Feature(name)
+		},
+	}
+}
+
+// Flags sets the provider of feature flags of executions of t, see
+// FlagFuncs, ExecOptions.Flags overrides it for a single execution. A nil
+// provider disables feature flags. The return value is the template, so
+// calls can be chained.
+func (t *Template) Flags(p FlagProvider) *Template {
+	return t.configure("Flags", func() {
+		t.option.flags = p
+	})
+}
+
+func (e *execEnv) Feature(name string) (bool, error) {
+	if enabled, ok := e.features[name]; ok {
+		return enabled, nil
+	}
+
+	if e.flags == nil {
+		return false, fmt.Errorf("no provider of feature flags for %q", name)
+	}
+	enabled, err := e.flags.Flag(name)
+	if err != nil {
+		return false, fmt.Errorf("feature %q: %w", name, err)
+	}
+
+	if e.features == nil {
+		e.features = make(map[string]bool)
+	}
+	e.features[name] = enabled
+	if e.result != nil {
+		if e.result.Flags == nil {
+			e.result.Flags = make(map[string]bool)
+		}
+		e.result.Flags[name] = enabled
+	}
+	return enabled, nil
+}
@@ -0,0 +1,47 @@
+package tlang
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagFuncs(t *testing.T) {
+	var calls int32
+	provider := FlagProviderFunc(func(name string) (bool, error) {
+		n := atomic.AddInt32(&calls, 1)
+		switch name {
+		case "flaky":
+			// would flip if evaluated again in the same execution
+			return n%2 == 1, nil
+		case "broken":
+			return false, errors.New("unavailable")
+		}
+		return false, nil
+	})
+
+	tmpl := Must(New("test").Funcs(FlagFuncs()).Flags(provider).Parse(
+		`define "part"; if feature "flaky"; "on"; else; "off"; end; end
+template "part"; "/"; template "part"; "/"; feature "other"`))
+
+	var sb strings.Builder
+	result, err := tmpl.ExecuteWithResult(&sb, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "on/on/false", sb.String())
+	assert.Equal(t, map[string]bool{"flaky": true, "other": false}, result.Flags)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+
+	// per execution provider
+	sb.Reset()
+	assert.NoError(t, tmpl.ExecuteWithOptions(&sb, nil, &ExecOptions{Flags: StaticFlags{"flaky": false, "other": true}}))
+	assert.Equal(t, "off/off/true", sb.String())
+
+	tmpl = Must(New("test").Funcs(FlagFuncs()).Flags(provider).Parse(`feature "broken"`))
+	assert.ErrorContains(t, tmpl.Execute(&sb, nil), `feature "broken": unavailable`)
+
+	tmpl = Must(New("test").Funcs(FlagFuncs()).Parse(`feature "any"`))
+	assert.ErrorContains(t, tmpl.Execute(&sb, nil), `no provider of feature flags for "any"`)
+}
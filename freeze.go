@@ -0,0 +1,124 @@
+package tlang
+
+import (
+	"errors"
+	"fmt"
+
+	"arhat.dev/tlang/parse"
+)
+
+// ErrFrozen is wrapped by errors of parsing or changing frozen templates, see
+// Template.Freeze.
+var ErrFrozen = errors.New("template: frozen")
+
+// Freeze seals t and its associated templates once they are complete: later
+// calls of Parse, ParseFiles, ParseGlob, ParseFS and AddParseTree, and of
+// methods changing trees, like Optimize, Inline, Prune, RenameTemplate and
+// ExtractTemplate, fail with ErrFrozen, and methods configuring templates,
+// like Funcs, Option and Schema, panic. Clone returns a copy that is not
+// frozen, so that variants can still be derived from frozen templates. The
+// return value is the template, so calls can be chained.
+//
+// Freezing is not required for executions to be safe: executions run with
+// the options and functions set when they start, and with the definitions
+// of templates found when invoking them, so that concurrent calls of
+// methods configuring or parsing templates never affect a running part of
+// an execution. Freeze makes the point where templates shared by goroutines
+// stop changing explicit, and catches changes made after it, Seal also
+// returns a handle executing frozen templates without locking.
+func (t *Template) Freeze() *Template {
+	t.init()
+	t.muTmpl.Lock()
+	defer t.muTmpl.Unlock()
+	t.muOpt.Lock()
+	defer t.muOpt.Unlock()
+
+	t.frozen = true
+	return t
+}
+
+// Frozen reports whether t was frozen by Freeze.
+func (t *Template) Frozen() bool {
+	if t.common == nil {
+		return false
+	}
+
+	t.muOpt.RLock()
+	defer t.muOpt.RUnlock()
+	return t.frozen
+}
+
+// configure runs f, which changes the options or the functions of t, with
+// them locked, so that an execution starting concurrently sees either all
+// the changes or none. It panics if t is frozen, method naming the caller.
+func (t *Template) configure(method string, f func()) *Template {
+	t.init()
+	t.muOpt.Lock()
+	defer t.muOpt.Unlock()
+
+	if t.frozen {
+		panic(fmt.Sprintf("template: %s: %s called after Freeze", t.name, method))
+	}
+	f()
+	return t
+}
+
+// config returns a copy of the options and the functions of t, executions
+// and parsing run with them so that they are not affected by concurrent
+// calls of configure. Options are never modified in place, so a shallow
+// copy is enough.
+func (t *Template) config() (option, parse.TemplateFuncs) {
+	t.muOpt.RLock()
+	defer t.muOpt.RUnlock()
+	return t.option, t.funcs
+}
+
+// execSnapshot is the state of templates executions run with, so that they
+// are not affected by concurrent calls of Parse, Funcs or Option.
+type execSnapshot struct {
+	opt    option
+	funcs  parse.TemplateFuncs
+	consts map[string]constVar
+
+	// templates are copies of the associated templates of a Sealed, nil if
+	// templates are looked up when invoked.
+	templates map[string]*Template
+}
+
+// snapshot returns a copy of t, read with muTmpl locked so that its tree is
+// not replaced by concurrent calls of Parse or Optimize, and the snapshot
+// of its state to execute it with.
+func (t *Template) snapshot() (*Template, *execSnapshot) {
+	snap := new(execSnapshot)
+	if t.common == nil {
+		return t, snap
+	}
+
+	snap.opt, snap.funcs = t.config()
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+	snap.consts = t.vars
+	return t.copy(t.common), snap
+}
+
+// lookupExec is like Lookup, but returns a copy of the template like
+// snapshot.
+func (t *Template) lookupExec(name string) *Template {
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+
+	tmpl := t.tmpl[name]
+	if tmpl == nil {
+		return nil
+	}
+	return tmpl.copy(tmpl.common)
+}
+
+// lookup returns the template named name invoked by the execution, nil if
+// there is none.
+func (s *state) lookup(name string) *Template {
+	if s.templates != nil {
+		return s.templates[name]
+	}
+	return s.tmpl.lookupExec(name)
+}
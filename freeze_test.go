@@ -0,0 +1,129 @@
+package tlang
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreeze(t *testing.T) {
+	tmpl := Must(New("test").Funcs(FuncMap{"up": strings.ToUpper}).Parse(`define "x"; up .; end; template "x" .`))
+	assert.False(t, tmpl.Frozen())
+	assert.Same(t, tmpl, tmpl.Freeze())
+	assert.True(t, tmpl.Frozen())
+	assert.True(t, tmpl.Lookup("x").Frozen())
+
+	var sb strings.Builder
+	assert.NoError(t, tmpl.Execute(&sb, "a"))
+	assert.Equal(t, "A", sb.String())
+
+	_, err := tmpl.Parse(`"b"`)
+	assert.True(t, errors.Is(err, ErrFrozen))
+	_, err = tmpl.New("y").Parse(`"b"`)
+	assert.True(t, errors.Is(err, ErrFrozen))
+	_, err = tmpl.AddParseTree("y", tmpl.Tree)
+	assert.True(t, errors.Is(err, ErrFrozen))
+	assert.Nil(t, tmpl.Lookup("y"))
+
+	_, err = tmpl.Optimize()
+	assert.ErrorIs(t, err, ErrFrozen)
+	_, err = tmpl.Inline(100)
+	assert.ErrorIs(t, err, ErrFrozen)
+	_, err = tmpl.Prune("test")
+	assert.ErrorIs(t, err, ErrFrozen)
+	assert.Equal(t, "x", tmpl.Lookup("x").Name())
+	assert.ErrorIs(t, tmpl.RenameTemplate("x", "z"), ErrFrozen)
+	assert.Nil(t, tmpl.Lookup("z"))
+	_, err = tmpl.ExtractTemplate("test", 0, 100, "z")
+	assert.ErrorIs(t, err, ErrFrozen)
+	assert.Equal(t, `{{template "x" .}}`, tmpl.Root.String())
+
+	assert.PanicsWithValue(t, "template: test: Funcs called after Freeze", func() { tmpl.Funcs(FuncMap{}) })
+	assert.Panics(t, func() { tmpl.Option("missingkey=error") })
+	assert.Panics(t, func() { tmpl.Schema(`{"type": "string"}`) })
+
+	clone, err := tmpl.Clone()
+	assert.NoError(t, err)
+	assert.False(t, clone.Frozen())
+	_, err = clone.Parse(`define "x"; "b"; end; template "x"`)
+	assert.NoError(t, err)
+
+	sb.Reset()
+	assert.NoError(t, tmpl.Execute(&sb, "a"))
+	assert.Equal(t, "A", sb.String())
+}
+
+func TestConcurrentChanges(t *testing.T) {
+	tmpl := Must(New("test").Funcs(FuncMap{"f": func() string { return "f" }}).Parse(`define "x"; "x"; end; template "x"; f`))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				var sb strings.Builder
+				if !assert.NoError(t, tmpl.Execute(&sb, nil)) {
+					return
+				}
+				out := sb.String()
+				assert.True(t, strings.HasSuffix(out, "f") || strings.HasSuffix(out, "g"), out)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tmpl.Funcs(FuncMap{"f": func() string { return "g" }})
+				tmpl.Option("missingkey=zero")
+				_ = Must(tmpl.New("x").Parse(fmt.Sprintf(`"x%d"; "%d"`, i, j)))
+				_ = Must(tmpl.New("y").Parse(`vars; $$c := 1; end`))
+				tmpl.Optimize()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSeal(t *testing.T) {
+	tmpl := Must(New("test").Funcs(FuncMap{"up": strings.ToUpper}).Parse(`define "x"; up .; end; "<"; template "x" .; ">"`))
+	sealed := tmpl.Seal()
+	assert.True(t, tmpl.Frozen())
+	assert.Same(t, tmpl, sealed.Template())
+	assert.Equal(t, "test", sealed.Name())
+
+	_, err := tmpl.Parse(`"b"`)
+	assert.True(t, errors.Is(err, ErrFrozen))
+	assert.Panics(t, func() { tmpl.Funcs(FuncMap{}) })
+	_, err = tmpl.Optimize()
+	assert.ErrorIs(t, err, ErrFrozen)
+	_, err = tmpl.Inline(100)
+	assert.ErrorIs(t, err, ErrFrozen)
+	assert.ErrorIs(t, tmpl.RenameTemplate("x", "z"), ErrFrozen)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var sb strings.Builder
+			assert.NoError(t, sealed.Execute(&sb, "a"))
+			assert.Equal(t, "<A>", sb.String())
+		}()
+	}
+	wg.Wait()
+
+	var sb strings.Builder
+	assert.NoError(t, sealed.ExecuteTemplate(&sb, "x", "b"))
+	assert.Equal(t, "B", sb.String())
+	assert.ErrorContains(t, sealed.ExecuteTemplate(&sb, "y", nil), `no template "y" associated with template "test"`)
+
+	sb.Reset()
+	result, err := sealed.ExecuteWithResult(&sb, "c", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<C>", sb.String())
+	assert.Equal(t, map[string]int{"test": 1, "x": 1}, result.Templates)
+}
@@ -0,0 +1,510 @@
+package tlang
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Metadata returns the front matter of the template, nil if the parsed text
+// had none.
+//
+// A template text can start with a front matter block, YAML delimited by
+// "---" lines or TOML delimited by "+++" lines, which is decoded into the
+// metadata instead of being parsed as template syntax:
+//
+//	---
+//	title: Home
+//	tags: [a, b]
+//	---
+//	.Content
+func (t *Template) Metadata() map[string]any {
+	if t.common == nil {
+		return t.metadata
+	}
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+	return t.metadata
+}
+
+// SplitFrontMatter splits the front matter at the start of text from the
+// template body, see Template.Metadata for the syntax. In the returned body,
+// the front matter is blanked out with spaces so that positions and line
+// numbers of the body are not changed. The returned metadata is nil if text
+// has no front matter.
+func SplitFrontMatter(text string) (meta map[string]any, body string, err error) {
+	delim, start, ok := frontMatterStart(text)
+	if !ok {
+		return nil, text, nil
+	}
+
+	end, next := -1, len(text)
+	for i := start; i < len(text); {
+		eol := strings.IndexByte(text[i:], '\n')
+		line := text[i:]
+		if eol >= 0 {
+			line = text[i : i+eol]
+		}
+		if strings.TrimRight(line, " \t\r") == delim {
+			end = i
+			if eol >= 0 {
+				next = i + eol
+			}
+			break
+		}
+		if eol < 0 {
+			break
+		}
+		i += eol + 1
+	}
+	if end < 0 {
+		return nil, "", fmt.Errorf("front matter: missing closing %q", delim)
+	}
+
+	// the delimiter line is replaced with an empty line so that decoding
+	// errors report line numbers of text
+	doc := strings.Repeat("\n", strings.Count(text[:start], "\n")) + text[start:end]
+	meta = make(map[string]any)
+	switch delim {
+	case "---":
+		err = yaml.Unmarshal([]byte(doc), &meta)
+		if meta == nil {
+			// yaml.Unmarshal sets meta to nil for empty documents
+			meta = make(map[string]any)
+		}
+	default:
+		err = decodeTOML(doc, meta)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("front matter: %w", err)
+	}
+
+	return meta, blankText(text[:next]) + text[next:], nil
+}
+
+// frontMatterStart returns the delimiter of the front matter at the start of
+// text and the offset of its first line.
+func frontMatterStart(text string) (delim string, start int, ok bool) {
+	for _, delim = range [...]string{"---", "+++"} {
+		if !strings.HasPrefix(text, delim) {
+			continue
+		}
+
+		rest := strings.TrimLeft(text[len(delim):], " \t\r")
+		if strings.HasPrefix(rest, "\n") {
+			return delim, len(text) - len(rest) + 1, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// blankText replaces all characters except newlines in s with spaces.
+func blankText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' {
+			return r
+		}
+		return ' '
+	}, s)
+}
+
+// decodeTOML decodes a TOML document into meta, supporting key/value pairs
+// with (dotted) bare or quoted keys, tables and arrays of tables, strings,
+// integers, floats, booleans, arrays and inline tables. Dates are kept as
+// strings.
+func decodeTOML(text string, meta map[string]any) error {
+	d := &tomlDecoder{text: text}
+	current := meta
+	for d.skipSpace(true); d.pos < len(d.text); d.skipSpace(true) {
+		var err error
+		if d.text[d.pos] == '[' {
+			current, err = d.table(meta)
+		} else {
+			err = d.keyValue(current)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", 1+strings.Count(d.text[:d.pos], "\n"), err)
+		}
+
+		d.skipSpace(false)
+		if d.pos < len(d.text) && d.text[d.pos] != '\n' {
+			return fmt.Errorf("line %d: unexpected %q", 1+strings.Count(d.text[:d.pos], "\n"), d.text[d.pos])
+		}
+	}
+
+	return nil
+}
+
+type tomlDecoder struct {
+	text string
+	pos  int
+
+	// defined holds the tables defined by a header, dotted keys or inline,
+	// by map pointer, TOML forbids defining them again with a header.
+	defined map[uintptr]struct{}
+}
+
+// define records table as defined, and reports whether it already was.
+func (d *tomlDecoder) define(table map[string]any) (redefined bool) {
+	p := reflect.ValueOf(table).Pointer()
+	if _, ok := d.defined[p]; ok {
+		return true
+	}
+	if d.defined == nil {
+		d.defined = make(map[uintptr]struct{})
+	}
+	d.defined[p] = struct{}{}
+	return false
+}
+
+// skipSpace skips spaces and comments, and newlines if multiline is true.
+func (d *tomlDecoder) skipSpace(multiline bool) {
+	for d.pos < len(d.text) {
+		switch d.text[d.pos] {
+		case ' ', '\t', '\r':
+		case '\n':
+			if !multiline {
+				return
+			}
+		case '#':
+			for d.pos < len(d.text) && d.text[d.pos] != '\n' {
+				d.pos++
+			}
+			continue
+		default:
+			return
+		}
+		d.pos++
+	}
+}
+
+// table decodes a [table] or [[array.of.tables]] header, returning the table
+// following key/value pairs belong to.
+func (d *tomlDecoder) table(meta map[string]any) (map[string]any, error) {
+	array := strings.HasPrefix(d.text[d.pos:], "[[")
+	if array {
+		d.pos += 2
+	} else {
+		d.pos++
+	}
+
+	keys, err := d.key()
+	if err != nil {
+		return nil, err
+	}
+
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(d.text[d.pos:], closing) {
+		return nil, fmt.Errorf("missing %q after table name", closing)
+	}
+	d.pos += len(closing)
+
+	parent, err := tomlParent(meta, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	last := keys[len(keys)-1]
+	if array {
+		tables, _ := parent[last].([]any)
+		if _, ok := parent[last]; ok && tables == nil {
+			return nil, fmt.Errorf("key %q redefined", last)
+		}
+		table := make(map[string]any)
+		d.define(table)
+		parent[last] = append(tables, table)
+		return table, nil
+	}
+
+	switch v := parent[last].(type) {
+	case nil:
+		table := make(map[string]any)
+		d.define(table)
+		parent[last] = table
+		return table, nil
+	case map[string]any:
+		// tables created implicitly by the header of a sub-table can be
+		// defined once
+		if d.define(v) {
+			return nil, fmt.Errorf("table %q redefined", strings.Join(keys, "."))
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("key %q redefined", last)
+	}
+}
+
+// keyValue decodes a key = value pair into table.
+func (d *tomlDecoder) keyValue(table map[string]any) error {
+	keys, err := d.key()
+	if err != nil {
+		return err
+	}
+	if d.pos >= len(d.text) || d.text[d.pos] != '=' {
+		return fmt.Errorf("missing '=' after key %q", strings.Join(keys, "."))
+	}
+	d.pos++
+	d.skipSpace(false)
+
+	value, err := d.value()
+	if err != nil {
+		return err
+	}
+
+	parent, err := tomlParent(table, keys)
+	if err != nil {
+		return err
+	}
+
+	last := keys[len(keys)-1]
+	if _, ok := parent[last]; ok {
+		return fmt.Errorf("key %q redefined", last)
+	}
+	parent[last] = value
+
+	// tables of dotted keys are defined by them
+	for _, k := range keys[:len(keys)-1] {
+		if sub, ok := table[k].(map[string]any); ok {
+			d.define(sub)
+			table = sub
+		}
+	}
+	return nil
+}
+
+// tomlParent returns the table holding the last of the dotted keys, creating
+// intermediate tables. The last table of an array of tables is used.
+func tomlParent(table map[string]any, keys []string) (map[string]any, error) {
+	for _, k := range keys[:len(keys)-1] {
+		switch v := table[k].(type) {
+		case nil:
+			sub := make(map[string]any)
+			table[k] = sub
+			table = sub
+		case map[string]any:
+			table = v
+		case []any:
+			sub, ok := v[len(v)-1].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("key %q is not a table", k)
+			}
+			table = sub
+		default:
+			return nil, fmt.Errorf("key %q is not a table", k)
+		}
+	}
+
+	return table, nil
+}
+
+// key decodes a (dotted) key.
+func (d *tomlDecoder) key() (keys []string, err error) {
+	for {
+		d.skipSpace(false)
+
+		var k string
+		switch {
+		case d.pos >= len(d.text):
+			return nil, fmt.Errorf("unexpected end of key")
+		case d.text[d.pos] == '"' || d.text[d.pos] == '\'':
+			k, err = d.string()
+			if err != nil {
+				return nil, err
+			}
+		default:
+			start := d.pos
+			for d.pos < len(d.text) && isTOMLBareKeyChar(d.text[d.pos]) {
+				d.pos++
+			}
+			if start == d.pos {
+				return nil, fmt.Errorf("unexpected %q in key", d.text[d.pos])
+			}
+			k = d.text[start:d.pos]
+		}
+
+		keys = append(keys, k)
+		d.skipSpace(false)
+		if d.pos >= len(d.text) || d.text[d.pos] != '.' {
+			return keys, nil
+		}
+		d.pos++
+	}
+}
+
+func isTOMLBareKeyChar(c byte) bool {
+	return c == '_' || c == '-' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// value decodes a value.
+func (d *tomlDecoder) value() (any, error) {
+	if d.pos >= len(d.text) {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	switch d.text[d.pos] {
+	case '"', '\'':
+		return d.string()
+	case '[':
+		d.pos++
+		arr := []any{}
+		for {
+			d.skipSpace(true)
+			if d.pos < len(d.text) && d.text[d.pos] == ']' {
+				d.pos++
+				return arr, nil
+			}
+
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+
+			d.skipSpace(true)
+			switch {
+			case d.pos < len(d.text) && d.text[d.pos] == ',':
+				d.pos++
+			case d.pos < len(d.text) && d.text[d.pos] == ']':
+			default:
+				return nil, fmt.Errorf("unterminated array")
+			}
+		}
+	case '{':
+		d.pos++
+		table := make(map[string]any)
+		d.define(table)
+		for {
+			d.skipSpace(false)
+			if d.pos < len(d.text) && d.text[d.pos] == '}' {
+				d.pos++
+				return table, nil
+			}
+
+			if err := d.keyValue(table); err != nil {
+				return nil, err
+			}
+
+			d.skipSpace(false)
+			switch {
+			case d.pos < len(d.text) && d.text[d.pos] == ',':
+				d.pos++
+			case d.pos < len(d.text) && d.text[d.pos] == '}':
+			default:
+				return nil, fmt.Errorf("unterminated inline table")
+			}
+		}
+	}
+
+	start := d.pos
+	for d.pos < len(d.text) && !strings.ContainsRune(",]}#\r\n", rune(d.text[d.pos])) {
+		d.pos++
+	}
+	s := strings.TrimRight(d.text[start:d.pos], " \t")
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		f, _ := strconv.ParseFloat(s, 64)
+		return f, nil
+	}
+
+	num := strings.ReplaceAll(s, "_", "")
+	if i, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+	if len(s) >= 10 && s[4] == '-' && s[7] == '-' {
+		// dates and times are kept as written
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("invalid value %q", s)
+}
+
+// string decodes a basic, literal or multi-line string.
+func (d *tomlDecoder) string() (string, error) {
+	quote := d.text[d.pos : d.pos+1]
+	if strings.HasPrefix(d.text[d.pos:], quote+quote+quote) {
+		d.pos += 3
+		// a newline immediately following the opening delimiter is trimmed
+		if strings.HasPrefix(d.text[d.pos:], "\r\n") {
+			d.pos += 2
+		} else if strings.HasPrefix(d.text[d.pos:], "\n") {
+			d.pos++
+		}
+
+		end := strings.Index(d.text[d.pos:], quote+quote+quote)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		s := d.text[d.pos : d.pos+end]
+		d.pos += end + 3
+		if quote == "'" {
+			return s, nil
+		}
+		return unquoteTOML(s)
+	}
+
+	d.pos++
+	for i := d.pos; i < len(d.text) && d.text[i] != '\n'; i++ {
+		switch d.text[i] {
+		case '\\':
+			if quote == `"` {
+				i++
+			}
+		case quote[0]:
+			s := d.text[d.pos:i]
+			d.pos = i + 1
+			if quote == "'" {
+				return s, nil
+			}
+			return unquoteTOML(s)
+		}
+	}
+
+	return "", fmt.Errorf("unterminated string")
+}
+
+// unquoteTOML interprets escape sequences in the content of a basic string.
+func unquoteTOML(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\\')
+		if i < 0 {
+			sb.WriteString(s)
+			break
+		}
+		sb.WriteString(s[:i])
+		s = s[i:]
+
+		if len(s) > 1 && (s[1] == '\n' || s[1] == ' ' || s[1] == '\t' || s[1] == '\r') {
+			// line ending backslash trims following whitespace
+			s = strings.TrimLeft(s[1:], " \t\r\n")
+			continue
+		}
+
+		r, _, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			return "", fmt.Errorf("invalid escape sequence in %q", s)
+		}
+		sb.WriteRune(r)
+		s = tail
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,107 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrontMatter(t *testing.T) {
+	t.Run("yaml", func(t *testing.T) {
+		const page = "---\ntitle: Home\ntags: [a, b]\n---\n\"hello \"; .\n"
+
+		tmpl := Must(New("page").Parse(page))
+		assert.Equal(t, map[string]any{"title": "Home", "tags": []any{"a", "b"}}, tmpl.Metadata())
+
+		var sb strings.Builder
+		assert.NoError(t, tmpl.Execute(&sb, "world"))
+		assert.Equal(t, "hello world", sb.String())
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		const page = `+++
+title = "Home" # comment
+draft = false
+weight = 1_000
+ratio = 0.5
+date = 2022-07-01
+tags = ['a', "b\tc"]
+
+[params]
+author.name = "someone"
+extra = { x = 1 }
+
+[[menu]]
+name = "main"
+[[menu]]
+name = "footer"
++++
+.`
+
+		tmpl := Must(New("page").Parse(page))
+		assert.Equal(t, map[string]any{
+			"title":  "Home",
+			"draft":  false,
+			"weight": int64(1000),
+			"ratio":  0.5,
+			"date":   "2022-07-01",
+			"tags":   []any{"a", "b\tc"},
+			"params": map[string]any{
+				"author": map[string]any{"name": "someone"},
+				"extra":  map[string]any{"x": int64(1)},
+			},
+			"menu": []any{
+				map[string]any{"name": "main"},
+				map[string]any{"name": "footer"},
+			},
+		}, tmpl.Metadata())
+	})
+
+	t.Run("none", func(t *testing.T) {
+		tmpl := Must(New("page").Parse(`"---"`))
+		assert.Nil(t, tmpl.Metadata())
+	})
+
+	t.Run("error line", func(t *testing.T) {
+		_, err := New("page").Parse("---\ntitle: Home\n---\n\n1x")
+		assert.ErrorContains(t, err, "page:5:")
+	})
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		_, err := New("page").Parse("---\ntitle: Home\n\ntitle: Other\n---\n")
+		assert.ErrorContains(t, err, "line 4:")
+
+		_, err = New("page").Parse("---\n# tags\n- a\n---\n")
+		assert.ErrorContains(t, err, "line 3:")
+	})
+
+	t.Run("unclosed", func(t *testing.T) {
+		_, err := New("page").Parse("+++\ntitle = 1\n")
+		assert.EqualError(t, err, `template: page: front matter: missing closing "+++"`)
+	})
+
+	t.Run("invalid toml", func(t *testing.T) {
+		_, err := New("page").Parse("+++\ntitle = 1\ntitle = 2\n+++\n")
+		assert.EqualError(t, err, `template: page: front matter: line 3: key "title" redefined`)
+
+		for _, text := range []string{
+			"[a]\nx = 1\n[a]\ny = 2",
+			"[a.b]\n[a]\n[a]",
+			"[a]\nb.c = 1\n[a.b]",
+			"a = { b = 1 }\n[a]",
+		} {
+			_, err = New("page").Parse("+++\n" + text + "\n+++\n")
+			assert.ErrorContains(t, err, "redefined", text)
+		}
+
+		// tables created implicitly can be defined once, sub-tables of
+		// tables of dotted keys can be defined
+		meta, _, err := SplitFrontMatter("+++\n[a.b]\nx = 1\n[a]\ny = 2\n[c]\nd.e = 1\n[c.d.f]\n+++\n")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{
+			"a": map[string]any{"b": map[string]any{"x": int64(1)}, "y": int64(2)},
+			"c": map[string]any{"d": map[string]any{"e": int64(1), "f": map[string]any{}}},
+		}, meta)
+	})
+}
@@ -5,8 +5,12 @@
 package tlang
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"text/template"
+	"time"
 
 	"arhat.dev/tlang/parse"
 )
@@ -27,6 +31,9 @@ var _ parse.TemplateFuncs = (*FuncMap)(nil)
 // apply to arguments of arbitrary type can use parameters of type interface{} or
 // of type reflect.Value. Similarly, functions meant to return a result of arbitrary
 // type can return interface{} or reflect.Value.
+//
+// A function taking Env as its first parameter receives the environment of
+// the execution in it, see Env.
 type FuncMap map[string]any
 
 func (fm FuncMap) Has(name string) bool {
@@ -38,6 +45,138 @@ func (fm FuncMap) GetByName(name string) reflect.Value {
 	return reflect.ValueOf(ref)
 }
 
+// Signature implements parse.TypedFuncs, the Env parameter is left out,
+// reflect.Value parameters and results are of unknown types.
+func (fm FuncMap) Signature(name string) (sig parse.FuncSignature, ok bool) {
+	typ := reflect.TypeOf(fm[name])
+	if typ == nil || typ.Kind() != reflect.Func {
+		return sig, false
+	}
+
+	first := 0
+	if takesEnv(typ) {
+		first = 1
+	}
+	for i := first; i < typ.NumIn(); i++ {
+		p := typ.In(i)
+		switch {
+		case p == reflectValueType:
+			p = nil
+		case typ.IsVariadic() && i == typ.NumIn()-1 && p.Elem() == reflectValueType:
+			p = nil
+		}
+		sig.Params = append(sig.Params, p)
+	}
+	sig.Variadic = typ.IsVariadic()
+	if typ.NumOut() != 0 && typ.Out(0) != reflectValueType {
+		sig.Result = typ.Out(0)
+	}
+
+	return sig, true
+}
+
+// FuncChain is a function set looking up functions in its sets in order, so
+// that a set can override and extend shared ones without copying them, e.g.
+//
+//	t.Funcs(tlang.FuncChain{tenantFuncs, sharedFuncs})
+//
+// Nil sets are skipped.
+type FuncChain []parse.TemplateFuncs
+
+func (c FuncChain) Has(name string) bool {
+	for _, set := range c {
+		if set != nil && set.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c FuncChain) GetByName(name string) reflect.Value {
+	for _, set := range c {
+		if set != nil && set.Has(name) {
+			return set.GetByName(name)
+		}
+	}
+	return reflect.Value{}
+}
+
+// Signature implements parse.TypedFuncs with the signature of the function
+// found first, if its set is typed.
+func (c FuncChain) Signature(name string) (sig parse.FuncSignature, ok bool) {
+	for _, set := range c {
+		if set != nil && set.Has(name) {
+			if typed, ok := set.(parse.TypedFuncs); ok {
+				return typed.Signature(name)
+			}
+			return sig, false
+		}
+	}
+	return sig, false
+}
+
+// FromTextFuncMap converts a text/template (or html/template) function map
+// into a FuncMap, so existing function libraries can be used in tlang.
+//
+// It panics if a value in the map is not a function with appropriate return
+// type.
+func FromTextFuncMap(funcMap template.FuncMap) FuncMap {
+	ret := make(FuncMap, len(funcMap))
+	for name, fn := range funcMap {
+		v := reflect.ValueOf(fn)
+		if v.Kind() != reflect.Func {
+			panic("value for " + name + " not a function")
+		}
+		if !goodFunc(v.Type()) {
+			panic(fmt.Errorf("can't install method/function %q with %d results", name, v.Type().NumOut()))
+		}
+
+		ret[name] = fn
+	}
+
+	return ret
+}
+
+// TextFuncMap converts fm into a function map for text/template, it is the
+// reverse of FromTextFuncMap. Functions taking Env are wrapped into ones
+// without the Env parameter, which get a new Env with default options for
+// every call, so that values kept in it, like the scratch, do not persist.
+func (fm FuncMap) TextFuncMap() template.FuncMap {
+	ret := make(template.FuncMap, len(fm))
+	for name, fn := range fm {
+		ret[name] = textFunc(reflect.ValueOf(fn))
+	}
+
+	return ret
+}
+
+// textFunc returns the function fn for text/template, see TextFuncMap.
+func textFunc(fn reflect.Value) any {
+	if fn.Kind() != reflect.Func || !takesEnv(fn.Type()) {
+		return fn.Interface()
+	}
+
+	typ := fn.Type()
+	in := make([]reflect.Type, typ.NumIn()-1)
+	for i := range in {
+		in[i] = typ.In(i + 1)
+	}
+	out := make([]reflect.Type, typ.NumOut())
+	for i := range out {
+		out[i] = typ.Out(i)
+	}
+
+	wrapped := reflect.FuncOf(in, out, typ.IsVariadic())
+	return reflect.MakeFunc(wrapped, func(args []reflect.Value) []reflect.Value {
+		env := reflect.ValueOf(Env(newExecEnv(&option{}, nil)))
+		args = append([]reflect.Value{env}, args...)
+		if typ.IsVariadic() {
+			return fn.CallSlice(args)
+		}
+		return fn.Call(args)
+	}).Interface()
+}
+
 // goodFunc reports whether the function or method has the right result signature.
 func goodFunc(typ reflect.Type) bool {
 	// We allow functions with 1 result or 2 results where the second is an error.
@@ -50,10 +189,10 @@ func goodFunc(typ reflect.Type) bool {
 	return false
 }
 
-// findFunction looks for a function in the template, and global map.
-func findFunction(name string, tmpl *Template) (v reflect.Value, isBuiltin, ok bool) {
-	if tmpl != nil && tmpl.common != nil {
-		if v = tmpl.funcs.GetByName(name); v.IsValid() {
+// findFunction looks for a function in funcs, the functions of the execution.
+func findFunction(name string, funcs parse.TemplateFuncs) (v reflect.Value, isBuiltin, ok bool) {
+	if funcs != nil {
+		if v = funcs.GetByName(name); v.IsValid() {
 			return v, false, true
 		}
 	}
@@ -80,3 +219,63 @@ func safeCall(fun reflect.Value, args []reflect.Value) (val reflect.Value, err e
 	}
 	return ret[0], nil
 }
+
+// ErrFuncTimeout is wrapped by errors of function calls exceeding the timeout
+// set by the functimeout option.
+var ErrFuncTimeout = errors.New("template: function call timed out")
+
+// timeoutOf returns the timeout of calls of the function or method name, 0
+// for none.
+func (o *option) timeoutOf(name string) time.Duration {
+	if timeout, ok := o.funcTimeouts[name]; ok {
+		return timeout
+	}
+	return o.funcTimeout
+}
+
+// timedCall is like safeCall, but stops waiting for the call after timeout
+// or when the context of the execution is done, which it reports as
+// abandoned, the call keeps running in the background then. Without
+// timeout, it is safeCall.
+//
+// env is the environment of the execution, if withEnv, the call receives a
+// detached copy of it as the first argument, whose context is done at the
+// timeout, and which is joined back if the call returns in time.
+func timedCall(env *execEnv, withEnv bool, fun reflect.Value, args []reflect.Value, timeout time.Duration) (val reflect.Value, abandoned bool, err error) {
+	if timeout <= 0 {
+		val, err = safeCall(fun, args)
+		return val, false, err
+	}
+
+	parent := env.Context()
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	var detached *execEnv
+	if withEnv {
+		detached = env.detach(ctx)
+		args[0] = reflect.ValueOf(Env(detached))
+	}
+
+	type result struct {
+		val reflect.Value
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		val, err := safeCall(fun, args)
+		done <- result{val, err}
+	}()
+
+	select {
+	case r := <-done:
+		if detached != nil {
+			env.join(detached)
+		}
+		return r.val, false, r.err
+	case <-ctx.Done():
+		if err := parent.Err(); err != nil {
+			return reflect.Value{}, true, err
+		}
+		return reflect.Value{}, true, fmt.Errorf("%w after %v", ErrFuncTimeout, timeout)
+	}
+}
@@ -0,0 +1,124 @@
+// Package net provides template functions for network addresses and URLs.
+package net
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+
+	"arhat.dev/tlang"
+)
+
+// Funcs returns functions for network addresses and URLs. Name resolution
+// depends on the host running the template, so dnsLookup only resolves host
+// names allowed by allowLookup, a nil allowLookup denies all lookups:
+//
+//	dnsLookup host
+//		Returns the addresses of host, see net.LookupHost. The lookup is
+//		cancelled with the context of the execution.
+//	parseIP s
+//		Returns s parsed as netip.Addr, printed in canonical form.
+//	cidrContains cidr ip
+//		Reports whether the network cidr contains the address ip.
+//	cidrSubnet cidr newbits num
+//		Returns the num-th subnet of cidr with newbits more bits in its
+//		prefix, e.g. cidrSubnet "10.0.0.0/16" 8 2 is "10.0.2.0/24".
+//	cidrHost cidr num
+//		Returns the num-th address in cidr, negative num counts from the
+//		last address.
+//	parseURL s
+//		Returns s parsed as *url.URL.
+//	buildURL scheme host path [key value...]
+//		Returns the URL composed of the given parts with path escaped and
+//		query parameters encoded.
+func Funcs(allowLookup func(host string) bool) tlang.FuncMap {
+	return tlang.FuncMap{
+		"dnsLookup": func(env tlang.Env, host string) ([]string, error) {
+			if allowLookup == nil || !allowLookup(host) {
+				return nil, fmt.Errorf("lookup of %q not allowed", host)
+			}
+			return net.DefaultResolver.LookupHost(env.Context(), host)
+		},
+		"parseIP": netip.ParseAddr,
+		"cidrContains": func(cidr, ip string) (bool, error) {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return false, err
+			}
+
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				return false, err
+			}
+
+			return prefix.Contains(addr), nil
+		},
+		"cidrSubnet": cidrSubnet,
+		"cidrHost":   cidrHost,
+		"parseURL":   url.Parse,
+		"buildURL": func(scheme, host, path string, query ...string) (string, error) {
+			if len(query)%2 != 0 {
+				return "", fmt.Errorf("odd number of query arguments")
+			}
+
+			u := &url.URL{Scheme: scheme, Host: host, Path: path}
+			if len(query) != 0 {
+				values := make(url.Values)
+				for i := 0; i < len(query); i += 2 {
+					values.Add(query[i], query[i+1])
+				}
+				u.RawQuery = values.Encode()
+			}
+			return u.String(), nil
+		},
+	}
+}
+
+func cidrSubnet(cidr string, newbits, num int) (string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return "", err
+	}
+
+	bits := prefix.Bits() + newbits
+	if newbits < 0 || bits > prefix.Addr().BitLen() {
+		return "", fmt.Errorf("invalid newbits %d for %s", newbits, cidr)
+	}
+	if num < 0 || big.NewInt(int64(num)).BitLen() > newbits {
+		return "", fmt.Errorf("subnet %d out of range for %d newbits", num, newbits)
+	}
+
+	offset := new(big.Int).Lsh(big.NewInt(int64(num)), uint(prefix.Addr().BitLen()-bits))
+	addr := addrAdd(prefix.Masked().Addr(), offset)
+	return netip.PrefixFrom(addr, bits).String(), nil
+}
+
+func cidrHost(cidr string, num int) (string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return "", err
+	}
+
+	size := new(big.Int).Lsh(big.NewInt(1), uint(prefix.Addr().BitLen()-prefix.Bits()))
+	offset := big.NewInt(int64(num))
+	if num < 0 {
+		offset.Add(offset, size)
+	}
+	if offset.Sign() < 0 || offset.Cmp(size) >= 0 {
+		return "", fmt.Errorf("host %d out of range for %s", num, cidr)
+	}
+
+	return addrAdd(prefix.Masked().Addr(), offset).String(), nil
+}
+
+// addrAdd returns addr plus offset, the result must not overflow.
+func addrAdd(addr netip.Addr, offset *big.Int) netip.Addr {
+	b := addr.AsSlice()
+	n := new(big.Int).SetBytes(b)
+	n.Add(n, offset).FillBytes(b)
+
+	ret, _ := netip.AddrFromSlice(b)
+	return ret
+}
@@ -0,0 +1,56 @@
+package net
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"arhat.dev/tlang"
+)
+
+func TestFuncs(t *testing.T) {
+	allow := func(host string) bool { return host == "localhost" }
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+		err      string
+	}{
+		{"parseIP", `parseIP "2001:DB8::0:1"`, "2001:db8::1", ""},
+		{"parseIP method", `(parseIP "10.0.0.1").Is4`, "true", ""},
+		{"cidrContains", `cidrContains "10.0.0.0/8" "10.1.2.3"`, "true", ""},
+		{"cidrContains outside", `cidrContains "10.0.0.0/8" "11.0.0.1"`, "false", ""},
+		{"cidrSubnet", `cidrSubnet "10.0.0.0/16" 8 2`, "10.0.2.0/24", ""},
+		{"cidrSubnet ipv6", `cidrSubnet "fd00::/56" 8 255`, "fd00:0:0:ff::/64", ""},
+		{"cidrSubnet out of range", `cidrSubnet "10.0.0.0/16" 2 4`, "", "subnet 4 out of range"},
+		{"cidrSubnet too long", `cidrSubnet "10.0.0.0/30" 3 0`, "", "invalid newbits"},
+		{"cidrHost", `cidrHost "10.0.1.0/24" 5`, "10.0.1.5", ""},
+		{"cidrHost last", `cidrHost "10.0.1.0/24" -1`, "10.0.1.255", ""},
+		{"cidrHost out of range", `cidrHost "10.0.1.0/24" 256`, "", "host 256 out of range"},
+		{"parseURL", `(parseURL "https://example.com:8443/a?b=c").Port`, "8443", ""},
+		{"buildURL", `buildURL "https" "example.com" "/a b" "q" "x&y" "n" "1"`, "https://example.com/a%20b?n=1&q=x%26y", ""},
+		{"buildURL odd query", `buildURL "https" "example.com" "/" "q"`, "", "odd number"},
+		{"dnsLookup denied", `dnsLookup "example.com"`, "", `lookup of "example.com" not allowed`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := tlang.Must(tlang.New(test.name).Funcs(Funcs(allow)).Parse(test.input))
+
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, nil)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	t.Run("dnsLookup nil policy", func(t *testing.T) {
+		tmpl := tlang.Must(tlang.New("lookup").Funcs(Funcs(nil)).Parse(`dnsLookup "localhost"`))
+		assert.ErrorContains(t, tmpl.Execute(&strings.Builder{}, nil), "not allowed")
+	})
+}
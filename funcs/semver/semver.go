@@ -0,0 +1,354 @@
+// Package semver provides template functions for semantic versions.
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"arhat.dev/tlang"
+)
+
+// Funcs returns functions for semantic versions (https://semver.org),
+// versions may be prefixed with "v":
+//
+//	semver s
+//		Returns s parsed as Version.
+//	semverCompare a b
+//		Returns -1, 0 or 1 when version a precedes, equals or follows b.
+//	semverMatch constraint v
+//		Reports whether version v satisfies constraint, see Match.
+//	semverBump part v
+//		Returns v with its major, minor or patch part incremented, lower
+//		parts reset and pre-release and build metadata dropped.
+func Funcs() tlang.FuncMap {
+	return tlang.FuncMap{
+		"semver": Parse,
+		"semverCompare": func(a, b string) (int, error) {
+			va, err := Parse(a)
+			if err != nil {
+				return 0, err
+			}
+
+			vb, err := Parse(b)
+			if err != nil {
+				return 0, err
+			}
+
+			return va.Compare(vb), nil
+		},
+		"semverMatch": func(constraint, v string) (bool, error) {
+			ver, err := Parse(v)
+			if err != nil {
+				return false, err
+			}
+
+			return Match(constraint, ver)
+		},
+		"semverBump": func(part, v string) (string, error) {
+			ver, err := Parse(v)
+			if err != nil {
+				return "", err
+			}
+
+			switch part {
+			case "major":
+				ver = Version{Major: ver.Major + 1}
+			case "minor":
+				ver = Version{Major: ver.Major, Minor: ver.Minor + 1}
+			case "patch":
+				ver = Version{Major: ver.Major, Minor: ver.Minor, Patch: ver.Patch + 1}
+			default:
+				return "", fmt.Errorf("invalid version part %q", part)
+			}
+
+			return ver.String(), nil
+		},
+	}
+}
+
+// Version is a semantic version.
+type Version struct {
+	Major, Minor, Patch uint64
+
+	// Prerelease is the dot separated pre-release identifiers, without the
+	// leading "-".
+	Prerelease string
+
+	// Build is the build metadata, without the leading "+", it is ignored
+	// in comparisons.
+	Build string
+}
+
+// Parse parses a semantic version, optionally prefixed with "v".
+func Parse(s string) (Version, error) {
+	v, n, err := parse(s)
+	if err == nil && n != 3 {
+		err = fmt.Errorf("invalid semantic version %q", s)
+	}
+	return v, err
+}
+
+// parse parses a possibly partial version, n is the number of numeric
+// parts present, parts given as x, X or * end the version.
+func parse(s string) (v Version, n int, err error) {
+	invalid := func() (Version, int, error) {
+		return Version{}, 0, fmt.Errorf("invalid semantic version %q", s)
+	}
+
+	rest := strings.TrimPrefix(s, "v")
+	rest, v.Build, _ = strings.Cut(rest, "+")
+	rest, v.Prerelease, _ = strings.Cut(rest, "-")
+
+	if !validIdents(v.Build, false) || !validIdents(v.Prerelease, true) {
+		return invalid()
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return invalid()
+	}
+
+	nums := [3]*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			if i != len(parts)-1 || v.Prerelease != "" || v.Build != "" {
+				return invalid()
+			}
+			break
+		}
+
+		if !isNumericIdent(p) {
+			return invalid()
+		}
+
+		*nums[i], err = strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return invalid()
+		}
+		n++
+	}
+
+	if n != 3 && (v.Prerelease != "" || v.Build != "") {
+		return invalid()
+	}
+
+	return v, n, nil
+}
+
+// validIdents reports whether s is empty or dot separated identifiers,
+// numeric ones without leading zeros when numeric is true.
+func validIdents(s string, numeric bool) bool {
+	if s == "" {
+		return true
+	}
+
+	for _, id := range strings.Split(s, ".") {
+		if id == "" || strings.Trim(id, "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-") != "" {
+			return false
+		}
+		if numeric && strings.Trim(id, "0123456789") == "" && !isNumericIdent(id) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumericIdent(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == "" && (s == "0" || s[0] != '0')
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 when v precedes, equals or follows o in
+// precedence, build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	for _, p := range [][2]uint64{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		switch {
+		case p[0] < p[1]:
+			return -1
+		case p[0] > p[1]:
+			return 1
+		}
+	}
+
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+
+	a, b := strings.Split(v.Prerelease, "."), strings.Split(o.Prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIdent(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareIdent compares pre-release identifiers, numeric ones have lower
+// precedence than alphanumeric ones.
+func compareIdent(a, b string) int {
+	an, bn := isNumericIdent(a), isNumericIdent(b)
+	switch {
+	case an && bn:
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	case an:
+		return -1
+	case bn:
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
+
+// Match reports whether v satisfies constraint.
+//
+// A constraint is alternatives separated by "||", each a list of
+// comparisons separated by commas or spaces that must all hold. A comparison
+// is an operator (=, !=, >, >=, <, <=, ~ or ^, defaults to =) followed by a
+// version, missing or wildcard (x, X, *) parts match any value:
+//
+//	1.2.x       >=1.2.0, <1.3.0
+//	~1.2.3      >=1.2.3, <1.3.0
+//	^1.2.3      >=1.2.3, <2.0.0
+//	^0.2.3      >=0.2.3, <0.3.0
+//	>1.2        >=1.3.0
+func Match(constraint string, v Version) (bool, error) {
+	for _, alt := range strings.Split(constraint, "||") {
+		match := true
+		for _, c := range splitComparisons(alt) {
+			ok, err := matchComparison(c, v)
+			if err != nil {
+				return false, fmt.Errorf("invalid constraint %q: %w", constraint, err)
+			}
+
+			match = match && ok
+		}
+
+		if match {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// splitComparisons splits comparisons separated by commas or spaces,
+// joining operators separated from their versions.
+func splitComparisons(s string) (ret []string) {
+	op := ""
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		if strings.Trim(f, "=!<>~^") == "" {
+			op += f
+			continue
+		}
+
+		ret = append(ret, op+f)
+		op = ""
+	}
+
+	if op != "" || len(ret) == 0 {
+		ret = append(ret, op)
+	}
+
+	return
+}
+
+func matchComparison(c string, v Version) (bool, error) {
+	op := c[:len(c)-len(strings.TrimLeft(c, "=!<>~^"))]
+	base, n, err := parse(c[len(op):])
+	if err != nil {
+		return false, err
+	}
+
+	// upper returns the version following all versions matching the first
+	// k parts of base.
+	upper := func(k int) Version {
+		switch k {
+		case 1:
+			return Version{Major: base.Major + 1}
+		case 2:
+			return Version{Major: base.Major, Minor: base.Minor + 1}
+		default:
+			return Version{Major: base.Major, Minor: base.Minor, Patch: base.Patch + 1}
+		}
+	}
+
+	within := func(k int) bool {
+		if k == 0 {
+			return true
+		}
+		if k == 3 && n == 3 {
+			return v.Compare(base) == 0
+		}
+		return v.Compare(base) >= 0 && v.Compare(upper(k)) < 0
+	}
+
+	switch op {
+	case "", "=":
+		return within(n), nil
+	case "!=":
+		return !within(n), nil
+	case ">":
+		if n == 0 {
+			return false, nil
+		}
+		if n == 3 {
+			return v.Compare(base) > 0, nil
+		}
+		return v.Compare(upper(n)) >= 0, nil
+	case ">=":
+		return v.Compare(base) >= 0, nil
+	case "<":
+		return v.Compare(base) < 0, nil
+	case "<=":
+		if n == 3 || n == 0 {
+			return n == 0 || v.Compare(base) <= 0, nil
+		}
+		return v.Compare(upper(n)) < 0, nil
+	case "~":
+		if n == 3 {
+			n = 2
+		}
+		return v.Compare(base) >= 0 && within(n), nil
+	case "^":
+		k := n
+		switch {
+		case n == 0:
+		case base.Major != 0 || n == 1:
+			k = 1
+		case base.Minor != 0 || n == 2:
+			k = 2
+		}
+		return v.Compare(base) >= 0 && within(k), nil
+	default:
+		return false, fmt.Errorf("unknown operator %q", op)
+	}
+}
@@ -0,0 +1,105 @@
+package semver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"arhat.dev/tlang"
+)
+
+func TestFuncs(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+		err      string
+	}{
+		{"semver", `semver "v1.2.3-rc.1+build.5"`, "1.2.3-rc.1+build.5", ""},
+		{"semver fields", `$v := semver "1.2.3"; $v.Major; $v.Minor; $v.Patch`, "123", ""},
+		{"semver invalid", `semver "1.2"`, "", "invalid semantic version"},
+		{"semver leading zero", `semver "1.02.3"`, "", "invalid semantic version"},
+		{"semverCompare", `semverCompare "1.2.3" "1.10.0"`, "-1", ""},
+		{"semverCompare build", `semverCompare "1.2.3+a" "1.2.3+b"`, "0", ""},
+		{"semverCompare prerelease", `semverCompare "1.0.0" "1.0.0-rc.1"`, "1", ""},
+		{"semverBump major", `semverBump "major" "1.2.3-rc.1"`, "2.0.0", ""},
+		{"semverBump minor", `semverBump "minor" "1.2.3"`, "1.3.0", ""},
+		{"semverBump patch", `semverBump "patch" "v1.2.3+meta"`, "1.2.4", ""},
+		{"semverBump invalid", `semverBump "build" "1.2.3"`, "", "invalid version part"},
+		{"semverMatch", `if semverMatch ">=1.2, <2" .; "yes"; else; "no"; end`, "yes", ""},
+		{"semverMatch invalid", `semverMatch "=>1.2" "1.2.0"`, "", "unknown operator"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := tlang.Must(tlang.New(test.name).Funcs(Funcs()).Parse(test.input))
+
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, "1.5.0")
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	t.Run("precedence", func(t *testing.T) {
+		ordered := []string{
+			"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+			"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "2.0.0",
+		}
+		for i := 1; i < len(ordered); i++ {
+			a, err := Parse(ordered[i-1])
+			assert.NoError(t, err)
+			b, err := Parse(ordered[i])
+			assert.NoError(t, err)
+
+			assert.Equal(t, -1, a.Compare(b), "%s < %s", a, b)
+			assert.Equal(t, 1, b.Compare(a), "%s > %s", b, a)
+		}
+	})
+
+	t.Run("constraints", func(t *testing.T) {
+		for _, test := range []struct {
+			constraint string
+			matches    []string
+			misses     []string
+		}{
+			{"1.2.3", []string{"1.2.3"}, []string{"1.2.4", "1.2.3-rc.1"}},
+			{"1.2.x", []string{"1.2.0", "1.2.9"}, []string{"1.3.0", "1.1.9"}},
+			{"1", []string{"1.0.0", "1.9.9"}, []string{"2.0.0", "0.9.0"}},
+			{"*", []string{"0.0.1", "9.9.9"}, nil},
+			{"!=1.2", []string{"1.3.0", "1.1.0"}, []string{"1.2.5"}},
+			{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+			{">1.2.3", []string{"1.2.4"}, []string{"1.2.3"}},
+			{"<=1.2", []string{"1.2.9"}, []string{"1.3.0"}},
+			{"< 1.2.3", []string{"1.2.3-rc.1", "1.2.2"}, []string{"1.2.3"}},
+			{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0", "1.2.2"}},
+			{"~1", []string{"1.9.0"}, []string{"2.0.0"}},
+			{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"2.0.0", "1.2.2"}},
+			{"^0.2.3", []string{"0.2.9"}, []string{"0.3.0"}},
+			{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+			{"^0", []string{"0.9.9"}, []string{"1.0.0"}},
+			{">=1.0, <1.2 || >=2", []string{"1.1.0", "2.5.0"}, []string{"1.2.0", "0.9.0"}},
+		} {
+			for _, v := range test.matches {
+				ok, err := Match(test.constraint, mustVersion(t, v))
+				assert.NoError(t, err)
+				assert.True(t, ok, "%s matches %s", v, test.constraint)
+			}
+			for _, v := range test.misses {
+				ok, err := Match(test.constraint, mustVersion(t, v))
+				assert.NoError(t, err)
+				assert.False(t, ok, "%s does not match %s", v, test.constraint)
+			}
+		}
+	})
+}
+
+func mustVersion(t *testing.T, s string) Version {
+	v, err := Parse(s)
+	assert.NoError(t, err)
+	return v
+}
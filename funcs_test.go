@@ -0,0 +1,97 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromTextFuncMap(t *testing.T) {
+	fm := FromTextFuncMap(template.FuncMap{"upper": strings.ToUpper})
+
+	var sb strings.Builder
+	tmpl := Must(New("test").Funcs(fm).Parse(`upper "tlang"`))
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+	assert.Equal(t, "TLANG", sb.String())
+
+	assert.Panics(t, func() {
+		FromTextFuncMap(template.FuncMap{"bad": "not a func"})
+	})
+	assert.Panics(t, func() {
+		FromTextFuncMap(template.FuncMap{"bad": func() (int, int) { return 0, 0 }})
+	})
+}
+
+func TestFuncMap_TextFuncMap(t *testing.T) {
+	tfm := FuncMap{
+		"upper": strings.ToUpper,
+		"join": func(env Env, sep string, s ...string) string {
+			return env.CurrentLine() + strings.Join(s, sep)
+		},
+	}.TextFuncMap()
+	for name, fn := range TimeFuncs().TextFuncMap() {
+		tfm[name] = fn
+	}
+
+	var sb strings.Builder
+	tmpl := template.Must(template.New("test").Funcs(tfm).Parse(`{{upper "tlang"}} {{join "," "a" "b"}} {{gt unixTime 0}}`))
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+	assert.Equal(t, "TLANG a,b true", sb.String())
+}
+
+func TestTypeCheck(t *testing.T) {
+	type user struct {
+		Name  string
+		Age   int
+		Tags  []string
+		Items map[string]int
+	}
+
+	funcs := FuncMap{
+		"repeat": strings.Repeat,
+		"double": func(n int) int { return n * 2 },
+		"join":   func(env Env, sep string, s ...string) string { return strings.Join(s, sep) },
+		"any":    func(v any) any { return v },
+	}
+
+	for _, test := range []struct {
+		text string
+		err  string
+	}{
+		{`repeat .Name .Age`, ""},
+		{`.Age | double | double`, ""},
+		{`double 2; join "," "a" .Name; join ","`, ""},
+		{`range .Tags; repeat . 2; end`, ""},
+		{`range $k, $v := .Items; double $v; end`, ""},
+		{`with .Items; double .x; end`, ""},
+		{`double (any .Name); double .Unknown`, ""},
+		{`define "x"; double .Name; end`, ""},
+		{`.Name | double`, `template: test:1: wrong type for piped argument of double: expected int; got string`},
+		{`$x := 1` + "\n" + `double $.Name`, `template: test:2: wrong type for argument 1 of double: expected int; got string`},
+		{`repeat .Age 2`, `template: test:1: wrong type for argument 1 of repeat: expected string; got int`},
+		{`double "2"`, `template: test:1: wrong type for argument 1 of double: expected int; got string`},
+		{`double 1 2`, `template: test:1: wrong number of args for double: want 1 got 2`},
+		{`join`, `template: test:1: wrong number of args for join: want at least 1 got 0`},
+		{`join "," .Age`, `template: test:1: wrong type for argument 2 of join: expected string; got int`},
+		{`range .Tags; double .; end`, `template: test:1: wrong type for argument 1 of double: expected int; got string`},
+		{`repeat (double 1) 1`, `template: test:1: wrong type for argument 1 of repeat: expected string; got int`},
+		{`.Age.X`, `template: test:1: can't evaluate field X in type int`},
+		{`repeat .Tags[0] .Items["a"]`, ""},
+		{`double .Tags[0]`, `template: test:1: wrong type for argument 1 of double: expected int; got string`},
+		{`.Age[0]`, `template: test:1: can't index item of type int`},
+	} {
+		t.Run(test.text, func(t *testing.T) {
+			_, err := New("test").Funcs(funcs).DeclareDataType(user{}).Parse(test.text)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	_, err := New("test").Funcs(funcs).Parse(`.Name | double`)
+	assert.NoError(t, err, "not checked without data type")
+}
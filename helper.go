@@ -12,6 +12,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 )
 
 // Functions and methods to parse templates.
@@ -27,6 +28,66 @@ func Must(t *Template, err error) *Template {
 	return t
 }
 
+// MustParse creates a new Template with the given name and parses text as
+// its body, it panics if the text cannot be parsed.
+func MustParse(name, text string) *Template {
+	return Must(New(name).Parse(text))
+}
+
+// MustParseFS is like ParseFS but panics if any of the files cannot be read or
+// parsed. Unlike ParseFS, it does not stop at the first error, the panic value
+// is a *MultiError reporting every failed file by name, so that all mistakes
+// in embedded templates show up at init time at once.
+func MustParseFS(fsys fs.FS, patterns ...string) *Template {
+	var (
+		t    *Template
+		errs MultiError
+	)
+
+	for _, pattern := range patterns {
+		list, err := fs.Glob(fsys, pattern)
+		if err == nil && len(list) == 0 {
+			err = fmt.Errorf("template: pattern matches no files: %#q", pattern)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, filename := range list {
+			t, err = parseFile(t, readFileFS(fsys), filename)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", filename, err))
+			}
+		}
+	}
+
+	if len(patterns) == 0 {
+		errs = append(errs, fmt.Errorf("template: no files named in call to ParseFS"))
+	}
+
+	if len(errs) != 0 {
+		panic(&errs)
+	}
+
+	return t
+}
+
+// MultiError is a list of errors reported together.
+type MultiError []error
+
+// Error returns all error messages, one per line.
+func (me *MultiError) Error() string {
+	var sb strings.Builder
+	for i, err := range *me {
+		if i != 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
 // ParseFiles creates a new Template and parses the template definitions from
 // the named files. The returned template's name will have the base name and
 // parsed contents of the first file. There must be at least one file.
@@ -50,7 +111,8 @@ func ParseFiles(filenames ...string) (*Template, error) {
 // case use t.ExecuteTemplate to execute a valid template.
 //
 // When parsing multiple files with the same name in different directories,
-// the last one mentioned will be the one that results.
+// the last one mentioned will be the one that results, unless templates are
+// named by paths with the templatenames option.
 func (t *Template) ParseFiles(filenames ...string) (*Template, error) {
 	t.init()
 	return parseFiles(t, readFileOS, filenames...)
@@ -64,27 +126,8 @@ func parseFiles(t *Template, readFile func(string) (string, []byte, error), file
 		return nil, fmt.Errorf("template: no files named in call to ParseFiles")
 	}
 	for _, filename := range filenames {
-		name, b, err := readFile(filename)
-		if err != nil {
-			return nil, err
-		}
-		s := string(b)
-		// First template becomes return value if not already defined,
-		// and we use that one for subsequent New calls to associate
-		// all the templates together. Also, if this file has the same name
-		// as t, this file becomes the contents of t, so
-		//  t, err := New(name).Funcs(xxx).ParseFiles(name)
-		// works. Otherwise we create a new template associated with t.
-		var tmpl *Template
-		if t == nil {
-			t = New(name)
-		}
-		if name == t.Name() {
-			tmpl = t
-		} else {
-			tmpl = t.New(name)
-		}
-		_, err = tmpl.Parse(s)
+		var err error
+		t, err = parseFile(t, readFile, filename)
 		if err != nil {
 			return nil, err
 		}
@@ -92,6 +135,38 @@ func parseFiles(t *Template, readFile func(string) (string, []byte, error), file
 	return t, nil
 }
 
+// parseFile parses a single file and associates the result with t, if t is
+// nil, it is created from the file.
+func parseFile(t *Template, readFile func(string) (string, []byte, error), filename string) (*Template, error) {
+	name, b, err := readFile(filename)
+	if err != nil {
+		return t, err
+	}
+	if t != nil {
+		if opt, _ := t.config(); opt.pathNames {
+			name = path.Clean(filepath.ToSlash(filename))
+		}
+	}
+	s := string(b)
+	// First template becomes return value if not already defined,
+	// and we use that one for subsequent New calls to associate
+	// all the templates together. Also, if this file has the same name
+	// as t, this file becomes the contents of t, so
+	//  t, err := New(name).Funcs(xxx).ParseFiles(name)
+	// works. Otherwise we create a new template associated with t.
+	var tmpl *Template
+	if t == nil {
+		t = New(name)
+	}
+	if name == t.Name() {
+		tmpl = t
+	} else {
+		tmpl = t.New(name)
+	}
+	_, err = tmpl.parse(s, filename)
+	return t, err
+}
+
 // ParseGlob creates a new Template and parses the template definitions from
 // the files identified by the pattern. The files are matched according to the
 // semantics of filepath.Match, and the pattern must match at least one file.
@@ -142,6 +217,8 @@ func ParseFS(fsys fs.FS, patterns ...string) (*Template, error) {
 // instead of the host operating system's file system.
 // It accepts a list of glob patterns.
 // (Note that most file names serve as glob patterns matching only themselves.)
+// With the "templatenames=path" option, templates are named by their paths in
+// fsys.
 func (t *Template) ParseFS(fsys fs.FS, patterns ...string) (*Template, error) {
 	t.init()
 	return parseFS(t, fsys, patterns)
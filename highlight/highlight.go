@@ -0,0 +1,139 @@
+// Package highlight implements a syntax highlighting lexer for tlang on top
+// of parse.Tokenize.
+//
+// The API mirrors the lexers of chroma (github.com/alecthomas/chroma): token
+// types are named after chroma token types and Tokenise returns an iterator
+// yielding tokens until EOF, so a chroma based renderer only needs to look up
+// the token type by name to color tlang snippets.
+package highlight
+
+import (
+	"strings"
+
+	"arhat.dev/tlang/parse"
+)
+
+// TokenType is the type of a highlighted token, its value is the name of the
+// corresponding chroma token type.
+type TokenType string
+
+// Token types emitted by the lexer.
+const (
+	EOFType               TokenType = "EOFType"
+	Error                 TokenType = "Error"
+	TextWhitespace        TokenType = "TextWhitespace"
+	CommentSingle         TokenType = "CommentSingle"
+	Keyword               TokenType = "Keyword"
+	KeywordConstant       TokenType = "KeywordConstant"
+	NameBuiltinPseudo     TokenType = "NameBuiltinPseudo"
+	NameAttribute         TokenType = "NameAttribute"
+	NameVariable          TokenType = "NameVariable"
+	NameVariableGlobal    TokenType = "NameVariableGlobal"
+	NameFunction          TokenType = "NameFunction"
+	LiteralNumber         TokenType = "LiteralNumber"
+	LiteralStringDouble   TokenType = "LiteralStringDouble"
+	LiteralStringBacktick TokenType = "LiteralStringBacktick"
+	LiteralStringChar     TokenType = "LiteralStringChar"
+	Operator              TokenType = "Operator"
+	Punctuation           TokenType = "Punctuation"
+)
+
+// Token is a highlighted piece of source text.
+type Token struct {
+	Type  TokenType
+	Value string
+}
+
+// EOF is returned by an Iterator after the last token.
+var EOF = Token{Type: EOFType}
+
+// Iterator returns the next token, or EOF when there are no more tokens.
+type Iterator func() Token
+
+// Tokens consumes the iterator and returns all tokens before EOF.
+func (i Iterator) Tokens() []Token {
+	var out []Token
+	for t := i(); t != EOF; t = i() {
+		out = append(out, t)
+	}
+	return out
+}
+
+// Config describes the lexer for registration in a lexer registry.
+type Config struct {
+	Name      string
+	Aliases   []string
+	Filenames []string
+	MimeTypes []string
+}
+
+// Lexer is the tlang syntax highlighting lexer.
+type Lexer struct{}
+
+// Config returns the lexer config.
+func (Lexer) Config() *Config {
+	return &Config{
+		Name:      "tlang",
+		Aliases:   []string{"tlang", "tl"},
+		Filenames: []string{"*.tl"},
+		MimeTypes: []string{"text/x-tlang"},
+	}
+}
+
+// Tokenise returns an iterator over the tokens of text.
+//
+// Concatenating the values of all tokens reproduces text, malformed input
+// is not an error, the offending rest of text is yielded as an Error token.
+func (Lexer) Tokenise(text string) Iterator {
+	tokens, _ := parse.Tokenize("", text)
+
+	i := 0
+	return func() Token {
+		if i >= len(tokens) {
+			return EOF
+		}
+
+		t := tokens[i]
+		i++
+		return Token{Type: tokenType(t), Value: t.Val}
+	}
+}
+
+// tokenType maps parse tokens to chroma token types.
+func tokenType(t parse.Token) TokenType {
+	switch t.Type {
+	case parse.TokenSpace:
+		return TextWhitespace
+	case parse.TokenComment:
+		return CommentSingle
+	case parse.TokenKeyword:
+		return Keyword
+	case parse.TokenBool, parse.TokenNil:
+		return KeywordConstant
+	case parse.TokenDot:
+		return NameBuiltinPseudo
+	case parse.TokenNumber:
+		return LiteralNumber
+	case parse.TokenString:
+		return LiteralStringDouble
+	case parse.TokenRawString:
+		return LiteralStringBacktick
+	case parse.TokenChar:
+		return LiteralStringChar
+	case parse.TokenField:
+		return NameAttribute
+	case parse.TokenVariable:
+		if strings.HasPrefix(t.Val, "$$") {
+			return NameVariableGlobal
+		}
+		return NameVariable
+	case parse.TokenIdentifier:
+		return NameFunction
+	case parse.TokenOperator:
+		return Operator
+	case parse.TokenPunctuation:
+		return Punctuation
+	default:
+		return Error
+	}
+}
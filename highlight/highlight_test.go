@@ -0,0 +1,59 @@
+package highlight
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLexer(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []Token
+	}{
+		{"Empty", "", nil},
+		{
+			name: "Action",
+			text: "if .X; $$g | printf \"%d\" 1; end # done",
+			expected: []Token{
+				{Keyword, "if"},
+				{TextWhitespace, " "},
+				{NameAttribute, ".X"},
+				{Punctuation, ";"},
+				{TextWhitespace, " "},
+				{NameVariableGlobal, "$$g"},
+				{TextWhitespace, " "},
+				{Operator, "|"},
+				{TextWhitespace, " "},
+				{NameFunction, "printf"},
+				{TextWhitespace, " "},
+				{LiteralStringDouble, `"%d"`},
+				{TextWhitespace, " "},
+				{LiteralNumber, "1"},
+				{Punctuation, ";"},
+				{TextWhitespace, " "},
+				{Keyword, "end"},
+				{TextWhitespace, " "},
+				{CommentSingle, "# done"},
+			},
+		},
+		{
+			name: "Error",
+			text: "x := \"1\nend",
+			expected: []Token{
+				{NameFunction, "x"},
+				{TextWhitespace, " "},
+				{Operator, ":="},
+				{TextWhitespace, " "},
+				{Error, "\"1\nend"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Lexer{}.Tokenise(test.text).Tokens())
+		})
+	}
+}
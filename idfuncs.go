@@ -0,0 +1,128 @@
+package tlang
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SnowflakeEpoch is the epoch of snowflake ids, as in Twitter snowflake.
+var SnowflakeEpoch = time.UnixMilli(1288834974657)
+
+// IDFuncs returns functions generating unique identifiers from Env.Now and
+// Env.Rand, so that rendering is deterministic with fixed ExecOptions.Clock
+// and ExecOptions.Rand, or the reproducible option:
+//
+//	uuid
+//		Returns a random (version 4) UUID.
+//	uuidV7
+//		Returns a time ordered (version 7) UUID.
+//	ulid
+//		Returns a ULID (https://github.com/ulid/spec).
+//	snowflake node
+//		Returns a snowflake id of node (0 to 1023), ids generated in the
+//		same millisecond by the returned functions are numbered in sequence.
+func IDFuncs() FuncMap {
+	var (
+		mu       sync.Mutex
+		lastTime int64
+		sequence int64
+	)
+
+	return FuncMap{
+		"uuid": func(env Env) string {
+			var b [16]byte
+			_, _ = env.Rand().Read(b[:])
+			return formatUUID(b, 4)
+		},
+		"uuidV7": func(env Env) string {
+			var b [16]byte
+			putMillis(b[:6], env.Now())
+			_, _ = env.Rand().Read(b[6:])
+			return formatUUID(b, 7)
+		},
+		"ulid": func(env Env) string {
+			var b [16]byte
+			putMillis(b[:6], env.Now())
+			_, _ = env.Rand().Read(b[6:])
+			return encodeCrockford(b)
+		},
+		"snowflake": func(env Env, node int64) (int64, error) {
+			if node < 0 || node >= 1<<10 {
+				return 0, fmt.Errorf("invalid node %d", node)
+			}
+
+			ms := env.Now().Sub(SnowflakeEpoch).Milliseconds()
+			if ms < 0 || ms >= 1<<41 {
+				return 0, fmt.Errorf("time out of range of snowflake ids")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if ms == lastTime {
+				sequence++
+				if sequence >= 1<<12 {
+					return 0, fmt.Errorf("snowflake sequence exhausted")
+				}
+			} else {
+				lastTime, sequence = ms, 0
+			}
+
+			return ms<<22 | node<<12 | sequence, nil
+		},
+	}
+}
+
+// putMillis stores the unix time of t in milliseconds as 48-bit big endian.
+func putMillis(b []byte, t time.Time) {
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+// formatUUID formats b as UUID of RFC 4122 variant with the version.
+func formatUUID(b [16]byte, version byte) string {
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// encodeCrockford encodes the 128 bits of b in 26 characters of Crockford's
+// base32, the first character holds the two most significant bits.
+func encodeCrockford(b [16]byte) string {
+	var buf [26]byte
+	for i := 25; i >= 0; i-- {
+		// bits of the character, from the least significant end
+		shift := uint(25-i) * 5
+
+		var v byte
+		for j := uint(0); j < 5; j++ {
+			bit := shift + j
+			if bit >= 128 {
+				break
+			}
+			if b[15-bit/8]>>(bit%8)&1 != 0 {
+				v |= 1 << j
+			}
+		}
+		buf[i] = crockford[v]
+	}
+	return string(buf[:])
+}
@@ -0,0 +1,58 @@
+package tlang
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDFuncs(t *testing.T) {
+	clock := fixedClock(time.UnixMilli(1700000000123))
+
+	execute := func(t *testing.T, funcs FuncMap, input string, seed int64) string {
+		tmpl := Must(New("ids").Funcs(funcs).Parse(input))
+
+		var sb strings.Builder
+		assert.NoError(t, tmpl.ExecuteWithOptions(&sb, nil, &ExecOptions{
+			Clock: clock,
+			Rand:  rand.NewSource(seed),
+		}))
+		return sb.String()
+	}
+
+	t.Run("uuid", func(t *testing.T) {
+		id := execute(t, IDFuncs(), `uuid`, 1)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id)
+		assert.Equal(t, id, execute(t, IDFuncs(), `uuid`, 1))
+		assert.NotEqual(t, id, execute(t, IDFuncs(), `uuid`, 2))
+	})
+
+	t.Run("uuidV7", func(t *testing.T) {
+		id := execute(t, IDFuncs(), `uuidV7`, 1)
+		assert.Regexp(t, regexp.MustCompile(`^018bcfe5-687b-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id)
+	})
+
+	t.Run("ulid", func(t *testing.T) {
+		id := execute(t, IDFuncs(), `ulid`, 1)
+		assert.Len(t, id, 26)
+		assert.Equal(t, "01HF7YAT3V", id[:10])
+		assert.Equal(t, id, execute(t, IDFuncs(), `ulid`, 1))
+	})
+
+	t.Run("snowflake", func(t *testing.T) {
+		ms := time.UnixMilli(1700000000123).Sub(SnowflakeEpoch).Milliseconds()
+		funcs := IDFuncs()
+		assert.Equal(t,
+			strings.Join([]string{strconv.FormatInt(ms<<22|5<<12, 10), strconv.FormatInt(ms<<22|5<<12|1, 10)}, " "),
+			execute(t, funcs, `snowflake 5; " "; snowflake 5`, 1),
+		)
+
+		tmpl := Must(New("invalid").Funcs(funcs).Parse(`snowflake 1024`))
+		assert.ErrorContains(t, tmpl.Execute(&strings.Builder{}, nil), "invalid node 1024")
+	})
+}
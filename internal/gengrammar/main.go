@@ -0,0 +1,26 @@
+// Command gengrammar writes the TextMate grammar of tlang to the named file.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"arhat.dev/tlang/parse"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: gengrammar <output file>")
+		os.Exit(2)
+	}
+
+	b, err := parse.TextMateGrammar()
+	if err == nil {
+		err = os.WriteFile(os.Args[1], b, 0644)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
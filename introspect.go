@@ -0,0 +1,107 @@
+package tlang
+
+import (
+	"sort"
+	"strings"
+
+	"arhat.dev/tlang/parse"
+)
+
+// TemplateInfo describes a defined template.
+type TemplateInfo struct {
+	// Name is the name of the template.
+	Name string
+
+	// File is the file the template was parsed from, empty if it was not
+	// parsed from a file.
+	File string
+
+	// Line is the line of the definition in the parsed text.
+	Line int
+
+	// Params are the names of the parameters of the template with dollar
+	// signs, see parse.Tree.Params.
+	Params []string
+
+	// Funcs are names of functions called by the template.
+	Funcs []string
+
+	// Fields are field chains referenced by the template, e.g. "Spec.Name"
+	// for .Spec.Name, fields of variables and parenthesized values are not
+	// included.
+	Fields []string
+
+	// Templates are names of templates invoked by the template.
+	Templates []string
+}
+
+// Names returns the sorted names of the defined templates associated with t.
+func (t *Template) Names() []string {
+	if t.common == nil {
+		return nil
+	}
+
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+
+	var names []string
+	for name, tmpl := range t.tmpl {
+		if tmpl.Tree != nil && tmpl.Root != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Info describes the defined template associated with t by name, ok is false
+// if there is no such template.
+func (t *Template) Info(name string) (info TemplateInfo, ok bool) {
+	tmpl := t.Lookup(name)
+	if tmpl == nil || tmpl.Tree == nil || tmpl.Root == nil {
+		return
+	}
+
+	var (
+		funcs     = make(map[string]struct{})
+		fields    = make(map[string]struct{})
+		templates = make(map[string]struct{})
+	)
+
+	parse.Inspect(tmpl.Root, func(n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.IdentifierNode:
+			funcs[n.Ident] = struct{}{}
+		case *parse.FieldNode:
+			fields[strings.Join(n.Ident, ".")] = struct{}{}
+		case *parse.TemplateNode:
+			templates[n.Name] = struct{}{}
+		}
+		return true
+	})
+
+	return TemplateInfo{
+		Name:      name,
+		File:      tmpl.file,
+		Line:      tmpl.Tree.Line,
+		Params:    tmpl.Tree.Params,
+		Funcs:     sortedKeys(funcs),
+		Fields:    sortedKeys(fields),
+		Templates: sortedKeys(templates),
+	}, true
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	if len(m) == 0 {
+		return nil
+	}
+
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+
+	return ret
+}
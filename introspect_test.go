@@ -0,0 +1,61 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateInfo(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/main.tl": {Data: []byte(`"header"
+range .Items
+  template "item" .
+end
+`)},
+		"dir/item.tl": {Data: []byte(`# items
+
+define "item"
+  upper .Name | printf "%s"
+  if .Spec.Enabled; lower .Spec.Name; end
+  (template "suffix")
+end
+`)},
+	}
+
+	funcs := FuncMap{"upper": strings.ToUpper, "lower": strings.ToLower, "printf": func(string, ...any) string { return "" }}
+	tmpl := Must(New("main.tl").Funcs(funcs).ParseFS(fsys, "dir/main.tl", "dir/item.tl"))
+	Must(tmpl.Parse(`define "suffix"; "!"; end`))
+
+	assert.Equal(t, []string{"item", "item.tl", "main.tl", "suffix"}, tmpl.Names())
+
+	info, ok := tmpl.Info("item")
+	assert.True(t, ok)
+	assert.Equal(t, TemplateInfo{
+		Name:      "item",
+		File:      "dir/item.tl",
+		Line:      3,
+		Funcs:     []string{"lower", "printf", "upper"},
+		Fields:    []string{"Name", "Spec.Enabled", "Spec.Name"},
+		Templates: []string{"suffix"},
+	}, info)
+
+	info, ok = tmpl.Info("main.tl")
+	assert.True(t, ok)
+	assert.Equal(t, TemplateInfo{
+		Name:      "main.tl",
+		File:      "dir/main.tl",
+		Line:      1,
+		Fields:    []string{"Items"},
+		Templates: []string{"item"},
+	}, info)
+
+	info, ok = tmpl.Info("suffix")
+	assert.True(t, ok)
+	assert.Equal(t, "", info.File)
+
+	_, ok = tmpl.Info("missing")
+	assert.False(t, ok)
+}
@@ -0,0 +1,93 @@
+package tlang
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// IterFuncs returns functions producing values to range over:
+//
+//	zip a b
+//		Returns a *Zip iterating arrays or slices a and b in lockstep, up
+//		to the length of the shorter one. A range over it declaring two
+//		variables sets them to elements of a and b at the same position,
+//		dot is set to the element of b:
+//
+//		range $name, $value := zip .Names .Values
+//		  $name; "="; $value
+//		end
+func IterFuncs() FuncMap {
+	return FuncMap{
+		"zip": NewZip,
+	}
+}
+
+// Zip is a Cursor over elements of two arrays or slices in lockstep, see
+// IterFuncs.
+type Zip struct {
+	a, b reflect.Value
+	n, i int
+}
+
+// NewZip creates a Zip over a and b, which must be arrays, slices or nil.
+func NewZip(a, b any) (*Zip, error) {
+	va, err := zipOperand(a)
+	if err != nil {
+		return nil, err
+	}
+
+	vb, err := zipOperand(b)
+	if err != nil {
+		return nil, err
+	}
+
+	n := 0
+	if va.IsValid() && vb.IsValid() {
+		n = va.Len()
+		if vb.Len() < n {
+			n = vb.Len()
+		}
+	}
+
+	return &Zip{a: va, b: vb, n: n, i: -1}, nil
+}
+
+// zipOperand returns the array or slice in v, the invalid value if v is nil.
+func zipOperand(v any) (reflect.Value, error) {
+	val, isNil := indirect(reflect.ValueOf(v))
+	switch {
+	case isNil:
+		return reflect.Value{}, nil
+	case val.Kind() == reflect.Array, val.Kind() == reflect.Slice, !val.IsValid():
+		return val, nil
+	}
+	return reflect.Value{}, fmt.Errorf("zip: can't iterate over %T", v)
+}
+
+// Len returns the number of pairs.
+func (z *Zip) Len() int {
+	return z.n
+}
+
+// Next implements Cursor.
+func (z *Zip) Next() bool {
+	if z.i+1 >= z.n {
+		return false
+	}
+	z.i++
+	return true
+}
+
+// Value implements Cursor, it returns the element of the second operand.
+func (z *Zip) Value() (any, error) {
+	return z.b.Index(z.i).Interface(), nil
+}
+
+// Err implements Cursor.
+func (z *Zip) Err() error {
+	return nil
+}
+
+func (z *Zip) entry() (index, elem reflect.Value) {
+	return z.a.Index(z.i), z.b.Index(z.i)
+}
@@ -0,0 +1,47 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIterFuncs(t *testing.T) {
+	data := map[string]any{
+		"Names":  []string{"a", "b", "c"},
+		"Values": [2]int{1, 2},
+		"Nil":    []string(nil),
+		"Int":    1,
+	}
+
+	for _, test := range []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{`range $n, $v := zip .Names .Values; $n; "="; $v; ";"; end`, "a=1;b=2;", true},
+		{`range zip .Names .Names; .; end`, "abc", true},
+		{`range $n, $v := zip .Names .Values | filter (ne $n "a"); $n; $v; end`, "b2", true},
+		{`range sorted $n, $v := zip .Names .Names by $v; $n; end`, "abc", true},
+		{`range zip .Names .Nil; .; else; "empty"; end`, "empty", true},
+		{`range zip .Names .Missing; .; else; "empty"; end`, "empty", true},
+		{`(zip .Names .Values).Len`, "2", true},
+		{`range zip .Names .Int; end`, "", false},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			funcs := IterFuncs()
+			funcs["ne"] = func(a, b string) bool { return a != b }
+
+			var sb strings.Builder
+			err := Must(New("test").Funcs(funcs).Parse(test.input)).Execute(&sb, data)
+			if !test.ok {
+				assert.ErrorContains(t, err, "zip: can't iterate over int")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package tlang
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"arhat.dev/tlang/parse"
+)
+
+// Rules reported in findings of built-in lint rules.
+const (
+	RuleLongLine          = "long-line"
+	RuleDeepNesting       = "deep-nesting"
+	RuleMagicNumber       = "magic-number"
+	RuleDuplicatedLiteral = "duplicated-literal"
+	RuleRangeWithoutElse  = "range-without-else"
+)
+
+// LintRule is a check of the style of templates or of a policy on them, run
+// by Linter. Organizations can implement their own rules over the parse tree.
+type LintRule interface {
+	// Name is the rule reported in findings.
+	Name() string
+
+	// Lint checks the tree of a template and reports issues by calling
+	// report.
+	Lint(tree *parse.Tree, report LintReporter)
+}
+
+// LintReporter reports an issue found by a LintRule at pos in the text of
+// the tree being linted.
+type LintReporter func(pos parse.Pos, sev Severity, format string, args ...any)
+
+// DefaultLintRules returns the built-in rules with their default settings.
+func DefaultLintRules() []LintRule {
+	return []LintRule{
+		&LongLines{},
+		&DeepNesting{},
+		&MagicNumbers{},
+		&DuplicatedLiterals{},
+		&RangeWithoutElse{},
+	}
+}
+
+// Linter checks templates with a set of LintRules, it is intended for
+// keeping template sets maintainable, see Scanner for checking the risks of
+// executing them.
+type Linter struct {
+	// Rules are the rules run, defaults to DefaultLintRules() when nil.
+	Rules []LintRule
+
+	// Threshold is the lowest severity making Check fail.
+	Threshold Severity
+}
+
+// Lint returns findings of the rules in all templates associated with t,
+// sorted by template name and position.
+func (l *Linter) Lint(t *Template) []Finding {
+	rules := l.Rules
+	if rules == nil {
+		rules = DefaultLintRules()
+	}
+
+	var findings []Finding
+	for _, name := range t.Names() {
+		tmpl := t.Lookup(name)
+		if tmpl.Tree == nil {
+			continue
+		}
+
+		type posFinding struct {
+			pos parse.Pos
+			Finding
+		}
+		var found []posFinding
+		for _, rule := range rules {
+			rule.Lint(tmpl.Tree, func(pos parse.Pos, sev Severity, format string, args ...any) {
+				found = append(found, posFinding{pos, Finding{
+					Severity: sev,
+					Rule:     rule.Name(),
+					Template: name,
+					Location: tmpl.Tree.Location(pos),
+					Message:  fmt.Sprintf(format, args...),
+				}})
+			})
+		}
+
+		sort.SliceStable(found, func(i, j int) bool { return found[i].pos < found[j].pos })
+		for _, f := range found {
+			findings = append(findings, f.Finding)
+		}
+	}
+
+	return findings
+}
+
+// Check lints t and returns an error listing the findings at or above the
+// threshold, if any.
+func (l *Linter) Check(t *Template) error {
+	var errs MultiError
+	for _, f := range l.Lint(t) {
+		if f.Severity >= l.Threshold {
+			errs = append(errs, fmt.Errorf("%s", f))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &errs
+}
+
+// Defaults of built-in lint rules.
+const (
+	DefaultMaxLineLength   = 120
+	DefaultMaxNesting      = 4
+	DefaultMinDuplicates   = 3
+	DefaultMinDuplicateLen = 8
+)
+
+// LongLines reports lines longer than Max bytes as low findings. Lines are
+// checked once per parsed text, in the top-level template of the parse.
+type LongLines struct {
+	// Max is the maximum length of lines, defaults to DefaultMaxLineLength.
+	Max int
+}
+
+// Name implements LintRule.
+func (*LongLines) Name() string { return RuleLongLine }
+
+// Lint implements LintRule.
+func (r *LongLines) Lint(tree *parse.Tree, report LintReporter) {
+	if tree.Name != tree.ParseName {
+		return
+	}
+
+	max := r.Max
+	if max <= 0 {
+		max = DefaultMaxLineLength
+	}
+
+	pos := 0
+	for _, line := range strings.SplitAfter(tree.Text(), "\n") {
+		if n := len(strings.TrimRight(line, "\r\n")); n > max {
+			report(parse.Pos(pos), SeverityLow, "line of %d bytes exceeds %d", n, max)
+		}
+		pos += len(line)
+	}
+}
+
+// DeepNesting reports if, range and with blocks nested more than Max levels
+// deep as medium findings. An if or with being the only node of an else
+// branch does not nest further, as in else if chains.
+type DeepNesting struct {
+	// Max is the maximum depth of nesting, defaults to DefaultMaxNesting.
+	Max int
+}
+
+// Name implements LintRule.
+func (*DeepNesting) Name() string { return RuleDeepNesting }
+
+// Lint implements LintRule.
+func (r *DeepNesting) Lint(tree *parse.Tree, report LintReporter) {
+	max := r.Max
+	if max <= 0 {
+		max = DefaultMaxNesting
+	}
+
+	var walk func(n parse.Node, depth int)
+	walk = func(n parse.Node, depth int) {
+		var (
+			keyword string
+			b       *parse.BranchNode
+		)
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c, depth)
+			}
+			return
+		case *parse.IfNode:
+			keyword, b = "if", &n.BranchNode
+		case *parse.RangeNode:
+			keyword, b = "range", &n.BranchNode
+		case *parse.WithNode:
+			keyword, b = "with", &n.BranchNode
+		default:
+			return
+		}
+
+		depth++
+		if depth > max {
+			report(n.Position(), SeverityMedium, "%s nested %d levels deep", keyword, depth)
+		}
+
+		walk(b.List, depth)
+		if b.ElseList != nil && len(b.ElseList.Nodes) == 1 {
+			switch e := b.ElseList.Nodes[0].(type) {
+			case *parse.IfNode, *parse.WithNode:
+				walk(e, depth-1)
+				return
+			}
+		}
+		walk(b.ElseList, depth)
+	}
+
+	walk(tree.Root, 0)
+}
+
+// MagicNumbers reports number literals other than the Allowed ones as low
+// findings, suggesting constants declared in the vars block instead.
+// Character constants are not reported.
+type MagicNumbers struct {
+	// Allowed are the texts of allowed numbers, defaults to -1, 0, 1 and
+	// 2 when nil.
+	Allowed []string
+}
+
+// Name implements LintRule.
+func (*MagicNumbers) Name() string { return RuleMagicNumber }
+
+// Lint implements LintRule.
+func (r *MagicNumbers) Lint(tree *parse.Tree, report LintReporter) {
+	allowed := toSet(r.Allowed)
+	if r.Allowed == nil {
+		allowed = toSet([]string{"-1", "0", "1", "2"})
+	}
+
+	parse.Inspect(tree.Root, func(n parse.Node) bool {
+		if n, ok := n.(*parse.NumberNode); ok && n.Text[0] != '\'' {
+			if _, ok := allowed[n.Text]; !ok {
+				report(n.Position(), SeverityLow, "magic number %s", n.Text)
+			}
+		}
+		return true
+	})
+}
+
+// DuplicatedLiterals reports string literals of at least MinLength bytes
+// repeated at least MinCount times in a template as low findings, at their
+// first occurrences.
+type DuplicatedLiterals struct {
+	// MinCount is the number of occurrences reported, defaults to
+	// DefaultMinDuplicates.
+	MinCount int
+
+	// MinLength is the length of literals checked, defaults to
+	// DefaultMinDuplicateLen.
+	MinLength int
+}
+
+// Name implements LintRule.
+func (*DuplicatedLiterals) Name() string { return RuleDuplicatedLiteral }
+
+// Lint implements LintRule.
+func (r *DuplicatedLiterals) Lint(tree *parse.Tree, report LintReporter) {
+	minCount, minLen := r.MinCount, r.MinLength
+	if minCount <= 1 {
+		minCount = DefaultMinDuplicates
+	}
+	if minLen <= 0 {
+		minLen = DefaultMinDuplicateLen
+	}
+
+	var (
+		literals []*parse.StringNode
+		counts   = make(map[string]int)
+	)
+	parse.Inspect(tree.Root, func(n parse.Node) bool {
+		if n, ok := n.(*parse.StringNode); ok && len(n.Text) >= minLen {
+			if counts[n.Text] == 0 {
+				literals = append(literals, n)
+			}
+			counts[n.Text]++
+		}
+		return true
+	})
+
+	for _, n := range literals {
+		if c := counts[n.Text]; c >= minCount {
+			report(n.Position(), SeverityLow, "string literal %s repeated %d times", n.Quoted, c)
+		}
+	}
+}
+
+// RangeWithoutElse reports ranges without else branches as low findings, as
+// empty collections then silently render nothing.
+type RangeWithoutElse struct{}
+
+// Name implements LintRule.
+func (RangeWithoutElse) Name() string { return RuleRangeWithoutElse }
+
+// Lint implements LintRule.
+func (RangeWithoutElse) Lint(tree *parse.Tree, report LintReporter) {
+	parse.Inspect(tree.Root, func(n parse.Node) bool {
+		if n, ok := n.(*parse.RangeNode); ok && n.ElseList == nil {
+			report(n.Position(), SeverityLow, "range without else")
+		}
+		return true
+	})
+}
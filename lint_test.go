@@ -0,0 +1,57 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"arhat.dev/tlang/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+// templateData is a custom rule reporting template invocations without
+// data.
+type templateData struct{}
+
+func (templateData) Name() string { return "template-data" }
+
+func (templateData) Lint(tree *parse.Tree, report LintReporter) {
+	parse.Inspect(tree.Root, func(n parse.Node) bool {
+		if n, ok := n.(*parse.TemplateNode); ok && n.Pipe == nil {
+			report(n.Position(), SeverityHigh, "template %q invoked without data", n.Name)
+		}
+		return true
+	})
+}
+
+func TestLinter(t *testing.T) {
+	tmpl := Must(New("main").Parse(`range .A; if .B; with .C; if .D; with .E; .; end; end; end; end; end
+if .X; 1; else if .Y; 2; else if .Z; 3; end
+"a long literal"; "a long literal"; "a long literal"; "short"; "short"; "short"
+` + strings.Repeat(" ", 120) + `42
+define "d"; range .; .; else; 100; end; end
+`))
+
+	var got []string
+	for _, f := range (&Linter{}).Lint(tmpl) {
+		got = append(got, f.String())
+	}
+	assert.Equal(t, []string{
+		`main:5:30: [low] magic-number: magic number 100`,
+		`main:1:6: [low] range-without-else: range without else`,
+		`main:1:38: [medium] deep-nesting: with nested 5 levels deep`,
+		`main:2:37: [low] magic-number: magic number 3`,
+		`main:3:0: [low] duplicated-literal: string literal "a long literal" repeated 3 times`,
+		`main:4:0: [low] long-line: line of 122 bytes exceeds 120`,
+		`main:4:120: [low] magic-number: magic number 42`,
+	}, got)
+
+	l := &Linter{Rules: []LintRule{&DeepNesting{Max: 2}, templateData{}}, Threshold: SeverityHigh}
+	assert.NoError(t, l.Check(tmpl))
+
+	Must(tmpl.New("call").Parse(`template "d"`))
+	err := l.Check(tmpl)
+	if assert.Error(t, err) {
+		assert.Len(t, *err.(*MultiError), 1)
+		assert.EqualError(t, (*err.(*MultiError))[0], `call:1:9: [high] template-data: template "d" invoked without data`)
+	}
+}
@@ -0,0 +1,216 @@
+package tlang
+
+import (
+	"arhat.dev/tlang/parse"
+)
+
+// TemplateMetrics measures the complexity of a defined template.
+type TemplateMetrics struct {
+	// Name is the name of the template.
+	Name string
+
+	// Nodes is the number of nodes in the parse tree.
+	Nodes int
+
+	// MaxNesting is the deepest nesting of if, with and range blocks.
+	MaxNesting int
+
+	// Complexity is the cyclomatic complexity, one plus the number of if,
+	// with and range blocks, including else if chains.
+	Complexity int
+
+	// EstimatedOutput is the maximum size in bytes of the literal output,
+	// taking the longest branch of conditionals, counting loop bodies once
+	// and including invoked templates, it is -1 when the template invokes
+	// itself directly or indirectly.
+	EstimatedOutput int
+
+	// DynamicOutputs is the number of actions printing computed values,
+	// their sizes are not included in EstimatedOutput.
+	DynamicOutputs int
+}
+
+// Metrics returns metrics of all defined templates associated with t, sorted
+// by name.
+func (t *Template) Metrics() []TemplateMetrics {
+	var (
+		names = t.Names()
+		ret   = make([]TemplateMetrics, 0, len(names))
+		calls = make(map[string][]string)
+		sizes = make(map[string]int)
+	)
+
+	for _, name := range names {
+		for _, n := range calledTemplates(t.Lookup(name).Root) {
+			calls[name] = append(calls[name], n.Name)
+		}
+	}
+
+	var size func(name string) int
+	size = func(name string) int {
+		if n, ok := sizes[name]; ok {
+			return n
+		}
+
+		tmpl := t.Lookup(name)
+		if tmpl == nil || tmpl.Tree == nil || tmpl.Root == nil {
+			return 0
+		}
+
+		for _, next := range calls[name] {
+			if reaches(calls, next, name) {
+				sizes[name] = -1
+				return -1
+			}
+		}
+
+		n := outputSize(tmpl.Root, size)
+		sizes[name] = n
+		return n
+	}
+
+	for _, name := range names {
+		m := TemplateMetrics{Name: name, Complexity: 1}
+		m.measure(t.Lookup(name).Root, 0)
+		m.EstimatedOutput = size(name)
+
+		ret = append(ret, m)
+	}
+
+	return ret
+}
+
+// measure counts nodes, blocks and dynamic outputs in the tree rooted at
+// node, which is nested in depth blocks.
+func (m *TemplateMetrics) measure(node parse.Node, depth int) {
+	parse.Inspect(node, func(n parse.Node) bool {
+		m.Nodes++
+
+		var blocks []parse.Node
+		switch n := n.(type) {
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) == 0 && len(n.Pipe.Cmds) != 0 && literalSize(n.Pipe) < 0 {
+				m.DynamicOutputs++
+			}
+		case *parse.IfNode:
+			blocks = []parse.Node{n.Pipe, n.List, n.ElseList}
+		case *parse.WithNode:
+			blocks = []parse.Node{n.Pipe, n.List, n.ElseList}
+		case *parse.RangeNode:
+			blocks = []parse.Node{n.Pipe, n.SortBy, n.List, n.ElseList}
+			for _, stage := range n.Stages {
+				blocks = append(blocks, stage)
+			}
+		case *parse.ForNode:
+			blocks = []parse.Node{n.Init, n.Cond, n.Post, n.List}
+		case *parse.TryNode:
+			blocks = []parse.Node{n.List, n.Catch}
+		case *parse.SwitchNode:
+			blocks = []parse.Node{n.Pipe, n.Default}
+			for _, c := range n.Cases {
+				blocks = append(blocks, c.Pipe, c.List)
+			}
+		default:
+			return true
+		}
+
+		if blocks == nil {
+			return true
+		}
+
+		m.Complexity++
+		if depth+1 > m.MaxNesting {
+			m.MaxNesting = depth + 1
+		}
+		for _, b := range blocks {
+			m.measure(b, depth+1)
+		}
+		return false
+	})
+}
+
+// outputSize estimates the maximum literal output of node, size returns the
+// estimation of invoked templates.
+func outputSize(node parse.Node, size func(name string) int) (ret int) {
+	add := func(n int) {
+		if ret < 0 || n < 0 {
+			ret = -1
+		} else {
+			ret += n
+		}
+	}
+
+	branches := func(list, elseList *parse.ListNode) {
+		a, b := outputSize(list, size), outputSize(elseList, size)
+		switch {
+		case a < 0 || b < 0:
+			add(-1)
+		case a > b:
+			add(a)
+		default:
+			add(b)
+		}
+	}
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return 0
+		}
+		for _, c := range n.Nodes {
+			add(outputSize(c, size))
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			if l := literalSize(n.Pipe); l > 0 {
+				add(l)
+			}
+		}
+	case *parse.IfNode:
+		branches(n.List, n.ElseList)
+	case *parse.WithNode:
+		branches(n.List, n.ElseList)
+	case *parse.RangeNode:
+		branches(n.List, n.ElseList)
+	case *parse.ForNode:
+		add(outputSize(n.List, size))
+	case *parse.TryNode:
+		// output of the try list before an error is kept
+		add(outputSize(n.List, size))
+		add(outputSize(n.Catch, size))
+	case *parse.SwitchNode:
+		max := outputSize(n.Default, size)
+		for _, c := range n.Cases {
+			l := outputSize(c.List, size)
+			if l < 0 || max < 0 {
+				max = -1
+			} else if l > max {
+				max = l
+			}
+		}
+		add(max)
+	case *parse.TemplateNode:
+		add(size(n.Name))
+	}
+
+	return
+}
+
+// literalSize returns the size of the output of pipe if it is a single
+// literal, or -1.
+func literalSize(pipe *parse.PipeNode) int {
+	if len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return -1
+	}
+
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.StringNode:
+		return len(arg.Text)
+	case *parse.NumberNode:
+		return len(arg.Text)
+	case *parse.BoolNode:
+		return len(arg.String())
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,27 @@
+package tlang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	tmpl := Must(New("main").Parse(`"head"
+if .A
+  "yes"
+  range .B; .; "-"; end
+else if .C
+  "longer no"
+end
+template "foot"
+define "foot"; 42; end
+define "loop"; with .; template "loop" .; end; end
+`))
+
+	assert.Equal(t, []TemplateMetrics{
+		{Name: "foot", Nodes: 5, MaxNesting: 0, Complexity: 1, EstimatedOutput: 2},
+		{Name: "loop", Nodes: 10, MaxNesting: 1, Complexity: 2, EstimatedOutput: -1},
+		{Name: "main", Nodes: 38, MaxNesting: 2, Complexity: 4, EstimatedOutput: 4 + 9 + 2, DynamicOutputs: 1},
+	}, tmpl.Metrics())
+}
@@ -10,7 +10,11 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
 
 	"arhat.dev/tlang/parse"
 )
@@ -221,6 +225,53 @@ func TestParseGlobWithData(t *testing.T) {
 	testExecute(templateFileExecTests, template, t)
 }
 
+func TestTemplateNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pages/home.tl":      {Data: []byte("define \"./title\"; \"Home\"; end\ntemplate \"../partials/header.tl\" .; template \"./title\"")},
+		"info/about.tl":      {Data: []byte("define \"./title\"; \"About\"; end\ntemplate \"./title\"")},
+		"partials/header.tl": {Data: []byte("\"<\"; .; \">\"")},
+		"header.tl":          {Data: []byte("\"top\"")},
+	}
+
+	tmpl, err := New("root").Option("templatenames=path").ParseFS(fsys, "*.tl", "*/*.tl")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for name, expected := range map[string]string{
+		"pages/home.tl":      "<x>Home",
+		"info/about.tl":      "About",
+		"info/title":         "About",
+		"partials/header.tl": "<x>",
+		"header.tl":          "top",
+		"pages/title":        "Home",
+	} {
+		var sb strings.Builder
+		if assert.NoError(t, tmpl.ExecuteTemplate(&sb, name, "x"), name) {
+			assert.Equal(t, expected, sb.String(), name)
+		}
+	}
+	assert.Nil(t, tmpl.Lookup("./title"))
+
+	// names relative to base names resolve to base names
+	tmpl, err = New("root").ParseFS(fsys, "info/about.tl", "partials/header.tl")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotNil(t, tmpl.Lookup("about.tl"))
+	assert.NotNil(t, tmpl.Lookup("header.tl"))
+	assert.NotNil(t, tmpl.Lookup("title"))
+
+	// templates parsed from text resolve against their names
+	tmpl = Must(New("docs/index").Parse("define \"../shared/x\"; \"x\"; end\ntemplate \"../shared/x\""))
+	var sb strings.Builder
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+	assert.Equal(t, "x", sb.String())
+	assert.NotNil(t, tmpl.Lookup("shared/x"))
+
+	assert.Panics(t, func() { New("bad").Option("templatenames=full") })
+}
+
 const (
 	cloneText1 = `define "a"; template "b"; template "c"; end`
 	cloneText2 = `define "b"; "b"; end`
@@ -482,3 +533,31 @@ func TestIssue19294(t *testing.T) {
 // 	var tmpl Template
 // 	tmpl.AddParseTree("x", tree["c"])
 // }
+
+func TestMustParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.tl":    {Data: []byte(`"a"; template "b.tl"`)},
+		"b.tl":    {Data: []byte(`"b"`)},
+		"bad.tl":  {Data: []byte(`if`)},
+		"ugly.tl": {Data: []byte(`end`)},
+	}
+
+	tmpl := MustParseFS(fsys, "a.tl", "b.tl")
+	var sb strings.Builder
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+	assert.Equal(t, "ab", sb.String())
+
+	defer func() {
+		err, ok := recover().(*MultiError)
+		if !assert.True(t, ok) {
+			return
+		}
+
+		assert.Len(t, *err, 3)
+		assert.Contains(t, err.Error(), "bad.tl")
+		assert.Contains(t, err.Error(), "ugly.tl")
+		assert.Contains(t, err.Error(), "missing")
+	}()
+
+	MustParseFS(fsys, "*.tl", "missing")
+}
@@ -0,0 +1,42 @@
+package tlang
+
+import (
+	"path"
+	"strings"
+
+	"arhat.dev/tlang/parse"
+)
+
+// isRelativeName reports whether the template name is relative to the
+// directory of the template it is used in.
+func isRelativeName(name string) bool {
+	return strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../")
+}
+
+// resolveNames resolves relative names of templates defined and invoked in
+// trees against dir, trees are renamed in place.
+func resolveNames(trees map[string]*parse.Tree, dir string) {
+	var relative []string
+	for name, tree := range trees {
+		if isRelativeName(name) {
+			relative = append(relative, name)
+		}
+		if tree.Root == nil {
+			continue
+		}
+
+		parse.Inspect(tree.Root, func(n parse.Node) bool {
+			if n, ok := n.(*parse.TemplateNode); ok && isRelativeName(n.Name) {
+				n.Name = path.Join(dir, n.Name)
+			}
+			return true
+		})
+	}
+
+	for _, name := range relative {
+		tree := trees[name]
+		delete(trees, name)
+		tree.Name = path.Join(dir, name)
+		trees[tree.Name] = tree
+	}
+}
@@ -0,0 +1,396 @@
+package tlang
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// Numbers in templates come from number literals (int, float64), data of any
+// numeric kind, and function results. They are compared and computed with the
+// following rules, regardless of the concrete types:
+//
+//   - Integers (signed or unsigned) are compared by their mathematical value,
+//     e.g. int -1 is less than uint 3, and int 3 equals uint 3.
+//   - When a float is involved, both operands are compared exactly as real
+//     numbers, e.g. 2 equals 2.0; NaN is unordered and equals nothing.
+//   - Integer arithmetic is exact, the result is an int if it fits, an uint64
+//     if it is too large for int but still fits, otherwise an overflow error
+//     is returned.
+//   - Arithmetic with a float operand is done in float64.
+//   - Division by zero is an error.
+
+var (
+	errBadComparisonType = errors.New("invalid type for comparison")
+	errBadComparison     = errors.New("incompatible types for comparison")
+	errNoComparison      = errors.New("missing argument for comparison")
+	errDivisionByZero    = errors.New("division by zero")
+	errNumberOverflow    = errors.New("number overflow")
+)
+
+// numberKind classifies numeric values.
+type numberKind int
+
+const (
+	notNumber numberKind = iota
+	intNumber
+	uintNumber
+	floatNumber
+)
+
+// number is a numeric value widened to 64 bits.
+type number struct {
+	kind numberKind
+	i    int64
+	u    uint64
+	f    float64
+}
+
+// toNumber converts v to number, ok is false if v is not an integer or float.
+func toNumber(v reflect.Value) (n number, ok bool) {
+	v = indirectInterface(v)
+	if !v.IsValid() {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number{kind: intNumber, i: v.Int()}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return number{kind: uintNumber, u: v.Uint()}, true
+	case reflect.Float32, reflect.Float64:
+		return number{kind: floatNumber, f: v.Float()}, true
+	}
+
+	return
+}
+
+func (n number) float() float64 {
+	switch n.kind {
+	case intNumber:
+		return float64(n.i)
+	case uintNumber:
+		return float64(n.u)
+	default:
+		return n.f
+	}
+}
+
+func (n number) bigFloat() *big.Float {
+	switch n.kind {
+	case intNumber:
+		return new(big.Float).SetInt64(n.i)
+	case uintNumber:
+		return new(big.Float).SetUint64(n.u)
+	default:
+		return new(big.Float).SetFloat64(n.f)
+	}
+}
+
+func (n number) bigInt() *big.Int {
+	if n.kind == uintNumber {
+		return new(big.Int).SetUint64(n.u)
+	}
+
+	return big.NewInt(n.i)
+}
+
+// value returns n as a template value.
+func (n number) value() reflect.Value {
+	switch n.kind {
+	case intNumber:
+		if int64(int(n.i)) == n.i {
+			return reflect.ValueOf(int(n.i))
+		}
+		return reflect.ValueOf(n.i)
+	case uintNumber:
+		return reflect.ValueOf(n.u)
+	default:
+		return reflect.ValueOf(n.f)
+	}
+}
+
+// compareNumbers compares a and b, unordered is true when a or b is NaN.
+func compareNumbers(a, b number) (c int, unordered bool) {
+	switch {
+	case a.kind == floatNumber || b.kind == floatNumber:
+		if math.IsNaN(a.float()) || math.IsNaN(b.float()) {
+			return 0, true
+		}
+		return a.bigFloat().Cmp(b.bigFloat()), false
+	case a.kind == intNumber && b.kind == intNumber:
+		return compareOrdered(a.i, b.i), false
+	case a.kind == uintNumber && b.kind == uintNumber:
+		return compareOrdered(a.u, b.u), false
+	case a.kind == intNumber: // b is uint
+		if a.i < 0 {
+			return -1, false
+		}
+		return compareOrdered(uint64(a.i), b.u), false
+	default: // a is uint, b is int
+		if b.i < 0 {
+			return 1, false
+		}
+		return compareOrdered(a.u, uint64(b.i)), false
+	}
+}
+
+func compareOrdered[T int64 | uint64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// arith applies the arithmetic operator op (one of +-*/%) to a and b.
+func arith(op byte, a, b number) (number, error) {
+	if a.kind == floatNumber || b.kind == floatNumber {
+		x, y := a.float(), b.float()
+		switch op {
+		case '+':
+			return number{kind: floatNumber, f: x + y}, nil
+		case '-':
+			return number{kind: floatNumber, f: x - y}, nil
+		case '*':
+			return number{kind: floatNumber, f: x * y}, nil
+		case '/':
+			if y == 0 {
+				return number{}, errDivisionByZero
+			}
+			return number{kind: floatNumber, f: x / y}, nil
+		default:
+			return number{}, fmt.Errorf("operator %c not defined on float", op)
+		}
+	}
+
+	x, y := a.bigInt(), b.bigInt()
+	switch op {
+	case '+':
+		x.Add(x, y)
+	case '-':
+		x.Sub(x, y)
+	case '*':
+		x.Mul(x, y)
+	case '/', '%':
+		if y.Sign() == 0 {
+			return number{}, errDivisionByZero
+		}
+		// truncated division as in Go
+		if op == '/' {
+			x.Quo(x, y)
+		} else {
+			x.Rem(x, y)
+		}
+	}
+
+	switch {
+	case x.IsInt64():
+		return number{kind: intNumber, i: x.Int64()}, nil
+	case x.IsUint64():
+		return number{kind: uintNumber, u: x.Uint64()}, nil
+	default:
+		return number{}, errNumberOverflow
+	}
+}
+
+// isNilValue reports whether v is an untyped nil or a nil of nillable kind.
+func isNilValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+
+	switch v.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Pointer, reflect.Slice:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// equal evaluates the comparison a == b.
+func equal(a, b reflect.Value) (bool, error) {
+	a, b = indirectInterface(a), indirectInterface(b)
+	if !a.IsValid() || !b.IsValid() {
+		return isNilValue(a) && isNilValue(b), nil
+	}
+
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		if !ok {
+			return false, errBadComparison
+		}
+		c, unordered := compareNumbers(x, y)
+		return !unordered && c == 0, nil
+	}
+
+	switch {
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return a.String() == b.String(), nil
+	case a.Kind() == reflect.Bool && b.Kind() == reflect.Bool:
+		return a.Bool() == b.Bool(), nil
+	case isComplex(a) && isComplex(b):
+		return a.Complex() == b.Complex(), nil
+	case a.Type() != b.Type():
+		return false, errBadComparison
+	case !a.Type().Comparable():
+		return false, fmt.Errorf("uncomparable type %s: %v", a.Type(), a)
+	default:
+		return a.Interface() == b.Interface(), nil
+	}
+}
+
+func isComplex(v reflect.Value) bool {
+	return v.Kind() == reflect.Complex64 || v.Kind() == reflect.Complex128
+}
+
+// compare compares ordered values a and b, only numbers and strings are
+// ordered. The result is meaningless when unordered is true.
+func compare(a, b reflect.Value) (c int, unordered bool, err error) {
+	a, b = indirectInterface(a), indirectInterface(b)
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		if !ok {
+			return 0, false, errBadComparison
+		}
+		c, unordered = compareNumbers(x, y)
+		return c, unordered, nil
+	}
+
+	if !a.IsValid() || !b.IsValid() || a.Kind() != reflect.String {
+		return 0, false, errBadComparisonType
+	}
+
+	if b.Kind() != reflect.String {
+		return 0, false, errBadComparison
+	}
+
+	return compareOrdered(a.String(), b.String()), false, nil
+}
+
+// ComparisonFuncs returns functions comparing template values with consistent
+// numeric rules across int, uint and float types:
+//
+//	eq arg1 arg2...
+//		Returns the boolean truth of arg1 == arg2, with more than one
+//		arg2, it returns true if arg1 equals any of them.
+//	ne arg1 arg2
+//		Returns the boolean truth of arg1 != arg2
+//	lt arg1 arg2
+//		Returns the boolean truth of arg1 < arg2
+//	le arg1 arg2
+//		Returns the boolean truth of arg1 <= arg2
+//	gt arg1 arg2
+//		Returns the boolean truth of arg1 > arg2
+//	ge arg1 arg2
+//		Returns the boolean truth of arg1 >= arg2
+func ComparisonFuncs() FuncMap {
+	return FuncMap{
+		"eq": funcEq,
+		"ne": funcNe,
+		"lt": funcLt,
+		"le": funcLe,
+		"gt": funcGt,
+		"ge": funcGe,
+	}
+}
+
+func funcEq(arg1 reflect.Value, arg2 ...reflect.Value) (bool, error) {
+	if len(arg2) == 0 {
+		return false, errNoComparison
+	}
+
+	for _, arg := range arg2 {
+		ok, err := equal(arg1, arg)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+func funcNe(arg1, arg2 reflect.Value) (bool, error) {
+	ok, err := equal(arg1, arg2)
+	return !ok, err
+}
+
+func funcLt(arg1, arg2 reflect.Value) (bool, error) {
+	c, unordered, err := compare(arg1, arg2)
+	return !unordered && c < 0, err
+}
+
+func funcLe(arg1, arg2 reflect.Value) (bool, error) {
+	c, unordered, err := compare(arg1, arg2)
+	return !unordered && c <= 0, err
+}
+
+func funcGt(arg1, arg2 reflect.Value) (bool, error) {
+	c, unordered, err := compare(arg1, arg2)
+	return !unordered && c > 0, err
+}
+
+func funcGe(arg1, arg2 reflect.Value) (bool, error) {
+	c, unordered, err := compare(arg1, arg2)
+	return !unordered && c >= 0, err
+}
+
+// ArithmeticFuncs returns arithmetic functions following the numeric rules
+// of ComparisonFuncs, integer overflows and division by zero are errors:
+//
+//	add arg1 arg2...
+//		Returns the sum of all arguments.
+//	sub arg1 arg2
+//		Returns arg1 - arg2.
+//	mul arg1 arg2...
+//		Returns the product of all arguments.
+//	div arg1 arg2
+//		Returns arg1 / arg2, truncated for integers.
+//	mod arg1 arg2
+//		Returns the remainder of integer division arg1 / arg2.
+func ArithmeticFuncs() FuncMap {
+	return FuncMap{
+		"add": func(arg1 reflect.Value, args ...reflect.Value) (reflect.Value, error) {
+			return arithAll('+', arg1, args)
+		},
+		"sub": func(arg1, arg2 reflect.Value) (reflect.Value, error) {
+			return arithAll('-', arg1, []reflect.Value{arg2})
+		},
+		"mul": func(arg1 reflect.Value, args ...reflect.Value) (reflect.Value, error) {
+			return arithAll('*', arg1, args)
+		},
+		"div": func(arg1, arg2 reflect.Value) (reflect.Value, error) {
+			return arithAll('/', arg1, []reflect.Value{arg2})
+		},
+		"mod": func(arg1, arg2 reflect.Value) (reflect.Value, error) {
+			return arithAll('%', arg1, []reflect.Value{arg2})
+		},
+	}
+}
+
+func arithAll(op byte, arg1 reflect.Value, args []reflect.Value) (reflect.Value, error) {
+	ret, ok := toNumber(arg1)
+	if !ok {
+		return zero, fmt.Errorf("non-numeric operand %v", arg1)
+	}
+
+	for _, arg := range args {
+		n, ok := toNumber(arg)
+		if !ok {
+			return zero, fmt.Errorf("non-numeric operand %v", arg)
+		}
+
+		var err error
+		ret, err = arith(op, ret, n)
+		if err != nil {
+			return zero, err
+		}
+	}
+
+	return ret.value(), nil
+}
@@ -0,0 +1,114 @@
+package tlang
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNumericFuncs(t *testing.T) {
+	funcs := ComparisonFuncs()
+	for k, v := range ArithmeticFuncs() {
+		funcs[k] = v
+	}
+
+	data := map[string]any{
+		"I8":     int8(-1),
+		"U":      uint(3),
+		"U64":    uint64(math.MaxUint64),
+		"I64":    int64(math.MaxInt64),
+		"F32":    float32(0.5),
+		"F":      3.0,
+		"NaN":    math.NaN(),
+		"Big":    int64(1<<53 + 1),
+		"BigF":   float64(1 << 53),
+		"S":      "xy",
+		"Nil":    (*int)(nil),
+		"Map":    map[string]int{},
+		"Struct": struct{ A int }{1},
+	}
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		// comparison
+		{`eq .U 3`, "true", true},
+		{`eq .U .F`, "true", true},
+		{`eq 2 2.0`, "true", true},
+		{`eq .I8 .U 1 -1`, "true", true},
+		{`lt .I8 .U`, "true", true},
+		{`gt .U64 .I64`, "true", true},
+		{`lt .F32 1`, "true", true},
+		{`eq .Big .BigF`, "false", true},
+		{`gt .Big .BigF`, "true", true},
+		{`eq .NaN .NaN`, "false", true},
+		{`lt .NaN 1`, "false", true},
+		{`ge .NaN 1`, "false", true},
+		{`ne .U 4`, "true", true},
+		{`le "xy" .S`, "true", true},
+		{`lt "xa" .S`, "true", true},
+		{`eq .Nil nil`, "true", true},
+		{`eq .Nil 0`, "", false},
+		{`eq .Struct .Struct`, "true", true},
+		{`eq .S 1`, "", false},
+		{`lt true false`, "", false},
+		{`lt .S 1`, "", false},
+		{`eq .Map .Map`, "", false},
+		{`eq 1`, "", false},
+
+		// infix comparison
+		{`.U == 3`, "true", true},
+		{`.U==.F`, "true", true},
+		{`.I8 < .U`, "true", true},
+		{`.U64 > .I64`, "true", true},
+		{`.NaN >= 1`, "false", true},
+		{`.S != "xy"`, "false", true},
+		{`"xa" <= .S`, "true", true},
+		{`.Nil == nil`, "true", true},
+		{`add 1 2 == .U`, "true", true},
+		{`.U | add 1 >= 4`, "true", true},
+		{`(.U > 1) == (.F > 1)`, "true", true},
+		{`if .U != 3; "x"; else; "y"; end`, "y", true},
+		{`.S == 1`, "", false},
+		{`true < false`, "", false},
+		{`.Map == .Map`, "", false},
+
+		// arithmetic
+		{`add 1 2 .U`, "6", true},
+		{`add .I8 .U`, "2", true},
+		{`sub .I8 .U`, "-4", true},
+		{`add .I64 1`, "9223372036854775808", true},
+		{`add .U64 1`, "", false},
+		{`sub 0 .U64`, "", false},
+		{`mul .I64 .I64`, "", false},
+		{`add .F32 1`, "1.5", true},
+		{`div 7 2`, "3", true},
+		{`div -7 2`, "-3", true},
+		{`div 7.0 2`, "3.5", true},
+		{`mod -7 2`, "-1", true},
+		{`div 1 0`, "", false},
+		{`div 1.0 0`, "", false},
+		{`mod 1.5 1`, "", false},
+		{`add .S 1`, "", false},
+		{`typeOf (add 1 2)`, "int", true},
+		{`typeOf (add .I64 1)`, "uint64", true},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			funcs["typeOf"] = typeOf
+
+			var sb strings.Builder
+			err := Must(New("test").Funcs(funcs).Parse(test.input)).Execute(&sb, data)
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package tlang
+
+import (
+	"fmt"
+
+	"arhat.dev/tlang/parse"
+)
+
+// Optimize simplifies the templates associated with t with
+// parse.Tree.Optimize, and returns the number of nodes removed. Trees are
+// copied before being simplified, so clones of t are not affected.
+//
+// It is intended to reduce the work of executing templates parsed once and
+// executed many times, executions running concurrently use either the
+// original or the simplified trees. It fails with ErrFrozen if t is frozen.
+//
+// Logical operators are not folded unless the truthiness option is
+// "default", since the truth of their operands depends on it.
+func (t *Template) Optimize() (removed int, err error) {
+	if t.common == nil {
+		return 0, nil
+	}
+
+	t.muTmpl.Lock()
+	defer t.muTmpl.Unlock()
+	if t.frozen {
+		return 0, fmt.Errorf("template: %s: %w", t.name, ErrFrozen)
+	}
+
+	opt, _ := t.config()
+	for _, tmpl := range t.tmpl {
+		if tmpl.Tree == nil {
+			continue
+		}
+
+		tmpl.Tree = copyTree(tmpl.Tree)
+		if opt.truth != truthDefault {
+			tmpl.Tree.Mode |= parse.CustomTruth
+		}
+		removed += tmpl.Tree.Optimize()
+	}
+
+	return removed, nil
+}
+
+// Inline replaces invocations of templates associated with t having at most
+// maxNodes nodes, see TemplateMetrics.Nodes, with their bodies in the
+// templates invoking them, see parse.Tree.Inline for the templates that can
+// be inlined, and returns the number of invocations replaced. Templates
+// inlining others are copied first, so clones of t are not affected.
+//
+// Inlined templates are still defined, but redefining them later doesn't
+// affect the templates they were inlined into, and their executions are no
+// longer counted in ExecResult.Templates. Like Optimize, executions running
+// concurrently use either the original or the changed trees, and it fails
+// with ErrFrozen if t is frozen.
+func (t *Template) Inline(maxNodes int) (inlined int, err error) {
+	if t.common == nil {
+		return 0, nil
+	}
+
+	t.muTmpl.Lock()
+	defer t.muTmpl.Unlock()
+	if t.frozen {
+		return 0, fmt.Errorf("template: %s: %w", t.name, ErrFrozen)
+	}
+
+	copied := make(map[*Template]struct{})
+	for {
+		// inlining a template invoking no template, as required, never adds
+		// invocations, so this ends when no invocation is left to inline.
+		n := 0
+		for _, callee := range t.tmpl {
+			if callee.Tree == nil || countNodes(callee.Root) > maxNodes {
+				continue
+			}
+
+			for _, caller := range t.tmpl {
+				if caller == callee || caller.Tree == nil || !invokes(caller.Root, callee.name) {
+					continue
+				}
+
+				if _, ok := copied[caller]; !ok {
+					caller.Tree = copyTree(caller.Tree)
+					copied[caller] = struct{}{}
+				}
+				n += caller.Tree.Inline(callee.Tree)
+			}
+		}
+
+		if n == 0 {
+			return inlined, nil
+		}
+		inlined += n
+	}
+}
+
+// copyTree returns a deep copy of tree.
+func copyTree(tree *parse.Tree) *parse.Tree {
+	ret := tree.Copy()
+	ret.Mode = tree.Mode
+	return ret
+}
+
+func countNodes(root parse.Node) (n int) {
+	parse.Inspect(root, func(parse.Node) bool {
+		n++
+		return true
+	})
+	return
+}
+
+// invokes reports whether node invokes the template name.
+func invokes(node parse.Node, name string) bool {
+	for _, call := range calledTemplates(node) {
+		if call.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimize(t *testing.T) {
+	const text = `"<ul>";;
+range $i, $v := .Items
+  if $i > 0 && 1 < 2; ", "; end
+  "<li>"; $v; "</li>"
+end
+"</ul>";; template "footer" (1 == 1 || .X)
+define "footer"; !(false) && "<p>"; .; "</p>"; end
+`
+	data := map[string]any{"Items": []string{"a", "b"}}
+
+	tmpl := Must(New("page").Parse(text))
+	clone := Must(tmpl.Clone())
+
+	var expected strings.Builder
+	require.NoError(t, tmpl.Execute(&expected, data))
+	assert.Equal(t, "<ul><li>a</li>, <li>b</li></ul><p>true</p>", expected.String())
+
+	removed, err := tmpl.Optimize()
+	require.NoError(t, err)
+	assert.Equal(t, 25, removed)
+	assert.Equal(t, `{{"<ul>"}}{{range $i, $v := .Items}}{{if $i > 0 && true}}{{", "}}{{end}}{{"<li>"}}{{$v}}{{"</li>"}}{{end}}{{"</ul>"}}{{template "footer" true}}`,
+		tmpl.Root.String())
+	assert.Equal(t, `{{"<p>"}}{{.}}{{"</p>"}}`, tmpl.Lookup("footer").Root.String())
+
+	var sb strings.Builder
+	require.NoError(t, tmpl.Execute(&sb, data))
+	assert.Equal(t, expected.String(), sb.String())
+
+	assert.Contains(t, clone.Root.String(), `{{"<ul>"}}{{}}`, "clones are not affected")
+	sb.Reset()
+	require.NoError(t, clone.Execute(&sb, data))
+	assert.Equal(t, expected.String(), sb.String())
+
+	removed, err = tmpl.Optimize()
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+}
+
+func TestInline(t *testing.T) {
+	const text = `range .Items
+  template "item" .
+end
+template "footer"
+define "item"; $n := .Name; template "name" .; " ("; $n; ")"; end
+define "name"; "<b>"; .Name; "</b>"; end
+define "footer"; "<hr>"; template "big"; end
+define "big"; "1"; "2"; "3"; "4"; "5"; "6"; "7"; "8"; "9"; "0"; end
+`
+	data := map[string]any{"Items": []map[string]string{{"Name": "a"}, {"Name": "b"}}}
+
+	tmpl := Must(New("page").Parse(text))
+	clone := Must(tmpl.Clone())
+
+	var expected strings.Builder
+	require.NoError(t, tmpl.Execute(&expected, data))
+	assert.Equal(t, "<b>a</b> (a)<b>b</b> (b)<hr>1234567890", expected.String())
+
+	inlined, err := tmpl.Inline(40)
+	require.NoError(t, err)
+	assert.Equal(t, 2, inlined)
+	assert.Equal(t, `{{range .Items}}{{if true}}{{$n := .Name}}{{if true}}{{"<b>"}}{{.Name}}{{"</b>"}}{{end}}{{" ("}}{{$n}}{{")"}}{{end}}{{end}}`+
+		`{{template "footer"}}`, tmpl.Root.String())
+
+	var sb strings.Builder
+	require.NoError(t, tmpl.Execute(&sb, data))
+	assert.Equal(t, expected.String(), sb.String())
+
+	assert.Contains(t, clone.Root.String(), `{{template "item" .}}`, "clones are not affected")
+	inlined, err = tmpl.Inline(40)
+	require.NoError(t, err)
+	assert.Zero(t, inlined)
+}
@@ -6,7 +6,17 @@
 
 package tlang
 
-import "strings"
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"arhat.dev/tlang/parse"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
 
 // missingKeyAction defines how to respond to indexing a map with a key that is not present.
 type missingKeyAction int
@@ -17,8 +27,111 @@ const (
 	mapError                             // Error out
 )
 
+// String returns the value of the missingkey option for the action.
+func (a missingKeyAction) String() string {
+	switch a {
+	case mapZeroValue:
+		return "zero"
+	case mapError:
+		return "error"
+	default:
+		return "default"
+	}
+}
+
+// truthRule defines which values of if, with and for conditions and of
+// logical operands are true.
+type truthRule int
+
+const (
+	truthDefault truthRule = iota // Non-zero values, see IsTrue.
+	truthStrict                   // Only true bools, other types are errors.
+	truthDeep                     // Like default, but following pointers and comparing structs to zero.
+)
+
+// nilAction defines how to print nil pointers and interfaces, and invalid
+// values like missing map keys.
+type nilAction int
+
+const (
+	nilDefault nilAction = iota // Print as fmt does, invalid values as "<no value>".
+	nilEmpty                    // Print nothing.
+	nilNoValue                  // Print "<no value>".
+	nilError                    // Error out.
+)
+
 type option struct {
 	missingKey missingKeyAction
+	truth      truthRule
+
+	fieldTags []string // struct tag keys consulted when a field is not found by name.
+	foldCase  bool     // match field names case-insensitively.
+
+	getterPrefixes []string // prefixes of accessor methods used for inaccessible fields.
+
+	printMethods []printMethod // methods used to print values, in priority order.
+	strictStruct bool          // reject printing structs without print methods.
+	strictPrint  bool          // reject printing values without textual representations.
+	printNil     nilAction     // how to print nil and invalid values.
+
+	reproducible bool // use fixed clock and seeded random numbers in Env.
+
+	flags   FlagProvider   // provider of feature flags in Env.
+	ctxKeys map[string]any // context keys exposed to templates by name.
+
+	missingTemplate *string // output of invocations of undefined templates, nil to fail.
+
+	maxDepth  int   // maximum depth of nested template invocations.
+	maxOutput int64 // maximum size of the output, 0 for no limit.
+	maxSteps  int   // maximum number of executed nodes, 0 for no limit.
+
+	funcTimeout  time.Duration            // default timeout of function calls, 0 for none.
+	funcTimeouts map[string]time.Duration // timeouts of function calls by name.
+
+	denyCycles      bool           // reject executing templates with invocation cycles.
+	recursionLimits map[string]int // maximum nesting of templates allowed to recurse.
+
+	deniedFuncs []string // names of functions removed from function sets.
+
+	parseMode parse.Mode          // mode of parsing templates.
+	pathNames bool                // name templates parsed from files by their paths.
+	normalize func(string) string // normalizes identifiers and variable names.
+	limits    parse.Limits        // limits of token sizes when parsing.
+	cache     ParseCache          // cache of parse trees.
+	dataType  reflect.Type        // type of data to type check templates against.
+}
+
+// printMethod is a method values can be printed with.
+type printMethod int
+
+const (
+	printError    printMethod = iota // Error() string
+	printStringer                    // String() string
+	printText                        // MarshalText() ([]byte, error)
+)
+
+var defaultPrintMethods = []printMethod{printError, printStringer, printText}
+
+func (m printMethod) method() string {
+	switch m {
+	case printError:
+		return "Error"
+	case printStringer:
+		return "String"
+	default:
+		return "MarshalText"
+	}
+}
+
+func (m printMethod) iface() reflect.Type {
+	switch m {
+	case printError:
+		return errorType
+	case printStringer:
+		return fmtStringerType
+	default:
+		return textMarshalerType
+	}
 }
 
 // Option sets options for the template. Options are described by
@@ -39,12 +152,232 @@ type option struct {
 //	"missingkey=error"
 //		Execution stops immediately with an error.
 //
+// truthiness: Control which values of if, with and for conditions and of
+// operands of !, && and || are true.
+//	"truthiness=default"
+//		The default behavior: Values other than false, 0, nil pointers
+//		and interfaces, and empty arrays, maps, slices and strings are
+//		true, see IsTrue. Struct values are always true.
+//	"truthiness=strict"
+//		Conditions of if and operands of !, && and || must be bools,
+//		execution stops with an error otherwise. Conditions of with
+//		follow the default rule, as they set dot to values of any type.
+//	"truthiness=deep"
+//		Like the default, but pointers and interfaces are followed, so
+//		that a pointer to 0 or to an empty slice is false, and structs
+//		are true unless they are zero values.
+//
+// fieldtags: Comma separated struct tag keys, when a struct has no field
+// with the exact name, fields are matched against the name in these tags.
+//	"fieldtags=json,yaml"
+//		.apiVersion resolves field `json:"apiVersion"`.
+//	"fieldtags="
+//		The default behavior: Tags are not consulted.
+//
+// fieldcase: Control how field names of structs are matched.
+//	"fieldcase=sensitive"
+//		The default behavior: Field names must match exactly.
+//	"fieldcase=insensitive"
+//		Fall back to case-insensitive matching of field names (and names
+//		in tags listed in fieldtags).
+//
+// getters: Comma separated method name prefixes, when a field is unexported
+// or not found, the method named as the prefix followed by the field name
+// with its first letter upper-cased is called instead. An empty prefix
+// stands for the method with the capitalized field name itself.
+//	"getters=off"
+//		The default behavior: Accessor methods are not consulted.
+//	"getters=,Get"
+//		.name calls Name() or GetName(), in that order.
+//
+// printmethods: Comma separated methods preferred to print values, in
+// priority order, known methods are "error" (Error), "stringer" (String)
+// and "text" (MarshalText). Values implementing none of them are printed
+// by fmt.Fprint, which may still use Error and String methods.
+//	"printmethods=error,stringer,text"
+//		The default behavior.
+//	"printmethods=text,stringer"
+//		Prefer MarshalText, then String.
+//
+// printstruct: Control printing of structs without print methods.
+//	"printstruct=allow"
+//		The default behavior: Structs are printed as by fmt.Print.
+//	"printstruct=error"
+//		Execution stops with an error, to catch accidental dumps.
+//
+// printable: Control printing of values without textual representations,
+// which are funcs, channels, unsafe pointers and structs without print
+// methods, as final values of actions or in elements of arrays, slices and
+// maps.
+//	"printable=any"
+//		The default behavior: Funcs and channels as final values are
+//		errors, other values are printed as by fmt.Print, e.g. funcs in
+//		slices as addresses.
+//	"printable=strict"
+//		Execution stops with an error naming the type of the value.
+//
+// printnil: Control printing of nil pointers and interfaces, and invalid
+// values like missing map keys, whether they come from fields, variables or
+// function results.
+//	"printnil=default"
+//		The default behavior: Nil pointers are printed as by fmt.Print,
+//		e.g. "<nil>", and other nil values as "<no value>".
+//	"printnil=empty"
+//		Nothing is printed.
+//	"printnil=novalue"
+//		"<no value>" is printed.
+//	"printnil=error"
+//		Execution stops with an error.
+//
+// reproducible: Control the Env passed to functions, so that identical
+// inputs render byte-identical output.
+//	"reproducible=off"
+//		The default behavior: Env reports the wall clock and random
+//		numbers are seeded by it.
+//	"reproducible=on"
+//		Env reports the time in environment variable SOURCE_DATE_EPOCH
+//		(unix seconds, or the unix epoch if unset) and random numbers
+//		are generated with a fixed seed on each execution. Map elements
+//		are always ranged and printed in sorted key order.
+//
+// missingtemplate: Control invocations of templates which are not defined,
+// e.g. to keep pages up while a partial is being rolled out. Rendered
+// placeholders are recorded in ExecResult.Warnings.
+//	"missingtemplate=error"
+//		The default behavior: Execution stops with an error.
+//	"missingtemplate=empty"
+//		The invocation renders nothing.
+//	"missingtemplate=placeholder:TEXT"
+//		The invocation renders TEXT, in which "{name}" is replaced by the
+//		name of the template, e.g. "placeholder:<!-- {name} -->". The
+//		pipeline of the invocation is not evaluated.
+//
+// maxdepth: The maximum depth of nested template invocations, exceeding it
+// stops execution with an error naming the cycle of invoked templates.
+//	"maxdepth=1000"
+//		The default behavior.
+//	"maxdepth=50"
+//		Allow no more than 50 nested invocations.
+//
+// recursion: Control cycles of template invocations, including templates
+// invoking themselves. Cycles are reported by Template.Cycles.
+//	"recursion=allow"
+//		The default behavior: Cycles only fail at runtime when exceeding
+//		maxdepth.
+//	"recursion=deny"
+//		Executing a template reaching a cycle is an error naming the
+//		cycle, before executing anything.
+//	"recursion=tree:10,a:3"
+//		Like "deny", but the listed templates are allowed to be part of
+//		cycles, and invoking one of them while it is already nested as
+//		many times as its limit is an error naming the cycle.
+//
+// functimeout: The maximum time of function and method calls, as
+// comma-separated durations, a default one and ones of calls by name.
+// A call exceeding it stops the execution with an error wrapping
+// ErrFuncTimeout, which try does not catch, while the call keeps running in
+// the background. Functions taking Env should stop when Env.Context is
+// done, which happens at the timeout, they receive a copy of the Env of the
+// execution whose changes, like set results, apply only if they return in
+// time.
+//	"functimeout=0"
+//		The default behavior: Calls are not limited.
+//	"functimeout=2s,lookup:500ms,render:0"
+//		Calls are limited to 2 seconds, lookup to 500 milliseconds and
+//		render is not limited.
+//
+// maxoutput: The maximum size in bytes of the output of an execution, zero
+// means no limit. Exceeding it stops execution with ErrOutputLimit, after
+// writing the output up to the limit.
+//	"maxoutput=0"
+//		The default behavior.
+//	"maxoutput=1048576"
+//		Allow no more than 1MiB of output.
+//
+// maxsteps: The maximum number of nodes executed by an execution, including
+// every iteration of ranges, zero means no limit. Exceeding it stops
+// execution with an error, bounding the time spent on loops.
+//	"maxsteps=0"
+//		The default behavior.
+//	"maxsteps=100000"
+//		Allow no more than 100000 executed nodes.
+//
+// denyfuncs: Comma separated names of functions removed from function sets
+// set by Funcs, before or after setting it, so that calls to them fail
+// parsing as calls to undefined functions.
+//	"denyfuncs="
+//		The default behavior: No function is removed.
+//	"denyfuncs=env,readFile"
+//		Remove env and readFile.
+//
+// maxstring, maxrawstring, maxcomment: The maximum size in bytes of a quoted
+// string or character constant, a raw string and a comment when parsing
+// templates, zero means no limit. Exceeding it fails parsing with a
+// *parse.LimitError. They only affect templates parsed after setting them.
+//	"maxstring=0"
+//		The default behavior.
+//	"maxstring=4096"
+//		Reject quoted strings longer than 4KiB including quotes.
+//
+// strictvars: Control checks of variables when parsing templates, it only
+// affects templates parsed after setting it.
+//	"strictvars=off"
+//		The default behavior: Variables can be redeclared and left unused.
+//	"strictvars=on"
+//		Declaring a variable with a name already visible in scope, or
+//		declaring a variable never used is a parse error. Variables with
+//		names starting with "$_" may be left unused.
+//
+// blocks: Control how blocks of define, block, if, range, with and vars
+// are closed, it only affects templates parsed after setting it.
+//	"blocks=end"
+//		The default behavior: Blocks are closed by end.
+//	"blocks=indent"
+//		Blocks are also closed by the first following line indented no
+//		deeper than the line opening them, as if end was inserted
+//		before it, so that end can be omitted. else and end lines at the
+//		same indentation continue and close the block as usual. Tabs and
+//		spaces count as one column each, comment lines are ignored.
+//
+// redefine: Control templates defined more than once in the same text, and
+// with "first", in successive calls to Parse, it only affects templates
+// parsed after setting it. Redefinitions which are kept or dropped are
+// recorded in Template.Warnings.
+//	"redefine=error"
+//		The default behavior: Multiple definitions in the same text are a
+//		parse error, successive calls to Parse replace templates.
+//	"redefine=last"
+//		The last definition in the same text wins.
+//	"redefine=first"
+//		The first definition wins, also over definitions parsed later.
+//
+// templatenames: Control the names of templates parsed from files by
+// ParseFiles, ParseGlob and ParseFS.
+//	"templatenames=base"
+//		The default behavior: Templates are named by the base names of
+//		their files, e.g. "header.tl" for "partials/header.tl".
+//	"templatenames=path"
+//		Templates are named by the slash-separated paths of their files,
+//		e.g. "partials/header.tl", so that files with the same name in
+//		different directories don't collide.
+// In both cases, names of definitions and invocations starting with "./" or
+// "../" are relative to the directory of the name of the template parsed,
+// e.g. template "../partials/header.tl" in the file "pages/home.tl".
+//
+// identifiers: Control characters allowed in function names, it only
+// affects templates parsed after setting it.
+//	"identifiers=default"
+//		The default behavior: Letters, digits and underscores.
+//	"identifiers=hyphenated"
+//		Hyphens are also allowed between other characters, e.g. my-func,
+//		"a - b" and "a -1" still separate arguments.
+//
 func (t *Template) Option(opt ...string) *Template {
-	t.init()
-	for _, s := range opt {
-		t.setOption(s)
-	}
-	return t
+	return t.configure("Option", func() {
+		for _, s := range opt {
+			t.setOption(s)
+		}
+	})
 }
 
 func (t *Template) setOption(opt string) {
@@ -66,6 +399,261 @@ func (t *Template) setOption(opt string) {
 				t.option.missingKey = mapError
 				return
 			}
+		case "truthiness":
+			switch value {
+			case "default":
+				t.option.truth = truthDefault
+				return
+			case "strict":
+				t.option.truth = truthStrict
+				return
+			case "deep":
+				t.option.truth = truthDeep
+				return
+			}
+		case "fieldtags":
+			t.option.fieldTags = nil
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					t.option.fieldTags = append(t.option.fieldTags, tag)
+				}
+			}
+			return
+		case "getters":
+			t.option.getterPrefixes = nil
+			if value != "off" {
+				t.option.getterPrefixes = strings.Split(value, ",")
+			}
+			return
+		case "printmethods":
+			var methods []printMethod
+			for _, name := range strings.Split(value, ",") {
+				switch strings.TrimSpace(name) {
+				case "error":
+					methods = append(methods, printError)
+				case "stringer":
+					methods = append(methods, printStringer)
+				case "text":
+					methods = append(methods, printText)
+				case "":
+				default:
+					panic("unrecognized print method in option: " + opt)
+				}
+			}
+			t.option.printMethods = methods
+			return
+		case "printstruct":
+			switch value {
+			case "allow":
+				t.option.strictStruct = false
+				return
+			case "error":
+				t.option.strictStruct = true
+				return
+			}
+		case "printable":
+			switch value {
+			case "any":
+				t.option.strictPrint = false
+				return
+			case "strict":
+				t.option.strictPrint = true
+				return
+			}
+		case "printnil":
+			switch value {
+			case "default":
+				t.option.printNil = nilDefault
+				return
+			case "empty":
+				t.option.printNil = nilEmpty
+				return
+			case "novalue":
+				t.option.printNil = nilNoValue
+				return
+			case "error":
+				t.option.printNil = nilError
+				return
+			}
+		case "maxdepth":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				t.option.maxDepth = n
+				return
+			}
+		case "missingtemplate":
+			switch {
+			case value == "error":
+				t.option.missingTemplate = nil
+				return
+			case value == "empty":
+				t.option.missingTemplate = new(string)
+				return
+			case strings.HasPrefix(value, "placeholder:"):
+				placeholder := strings.TrimPrefix(value, "placeholder:")
+				t.option.missingTemplate = &placeholder
+				return
+			}
+		case "recursion":
+			switch value {
+			case "allow":
+				t.option.denyCycles = false
+				t.option.recursionLimits = nil
+				return
+			case "deny":
+				t.option.denyCycles = true
+				t.option.recursionLimits = nil
+				return
+			}
+
+			limits := make(map[string]int)
+			for _, entry := range strings.Split(value, ",") {
+				i := strings.LastIndexByte(entry, ':')
+				if i <= 0 {
+					limits = nil
+					break
+				}
+				n, err := strconv.Atoi(entry[i+1:])
+				if err != nil || n <= 0 {
+					limits = nil
+					break
+				}
+				limits[entry[:i]] = n
+			}
+			if limits != nil {
+				t.option.denyCycles = true
+				t.option.recursionLimits = limits
+				return
+			}
+		case "functimeout":
+			def, timeouts := t.option.funcTimeout, make(map[string]time.Duration)
+			for name, d := range t.option.funcTimeouts {
+				timeouts[name] = d
+			}
+
+			valid := true
+			for _, entry := range strings.Split(value, ",") {
+				name, d, ok := strings.Cut(entry, ":")
+				if !ok {
+					name, d = "", entry
+				}
+				timeout, err := time.ParseDuration(d)
+				if err != nil || timeout < 0 || (ok && name == "") {
+					valid = false
+					break
+				}
+				if name == "" {
+					def = timeout
+				} else {
+					timeouts[name] = timeout
+				}
+			}
+			if valid {
+				t.option.funcTimeout, t.option.funcTimeouts = def, timeouts
+				return
+			}
+		case "maxoutput", "maxsteps":
+			n, err := strconv.ParseInt(value, 10, 0)
+			if err != nil || n < 0 {
+				break
+			}
+
+			if key == "maxoutput" {
+				t.option.maxOutput = n
+			} else {
+				t.option.maxSteps = int(n)
+			}
+			return
+		case "denyfuncs":
+			t.option.deniedFuncs = nil
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					t.option.deniedFuncs = append(t.option.deniedFuncs, name)
+				}
+			}
+			t.denyFuncs()
+			return
+		case "maxstring", "maxrawstring", "maxcomment":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				break
+			}
+
+			switch key {
+			case "maxstring":
+				t.option.limits.String = n
+			case "maxrawstring":
+				t.option.limits.RawString = n
+			case "maxcomment":
+				t.option.limits.Comment = n
+			}
+			return
+		case "strictvars":
+			switch value {
+			case "off":
+				t.option.parseMode &^= parse.StrictVars
+				return
+			case "on":
+				t.option.parseMode |= parse.StrictVars
+				return
+			}
+		case "blocks":
+			switch value {
+			case "end":
+				t.option.parseMode &^= parse.IndentBlocks
+				return
+			case "indent":
+				t.option.parseMode |= parse.IndentBlocks
+				return
+			}
+		case "redefine":
+			mode := t.option.parseMode &^ (parse.KeepFirstDefinition | parse.KeepLastDefinition)
+			switch value {
+			case "error":
+				t.option.parseMode = mode
+				return
+			case "first":
+				t.option.parseMode = mode | parse.KeepFirstDefinition
+				return
+			case "last":
+				t.option.parseMode = mode | parse.KeepLastDefinition
+				return
+			}
+		case "templatenames":
+			switch value {
+			case "base":
+				t.option.pathNames = false
+				return
+			case "path":
+				t.option.pathNames = true
+				return
+			}
+		case "identifiers":
+			switch value {
+			case "default":
+				t.option.parseMode &^= parse.HyphenIdents
+				return
+			case "hyphenated":
+				t.option.parseMode |= parse.HyphenIdents
+				return
+			}
+		case "reproducible":
+			switch value {
+			case "off":
+				t.option.reproducible = false
+				return
+			case "on":
+				t.option.reproducible = true
+				return
+			}
+		case "fieldcase":
+			switch value {
+			case "sensitive":
+				t.option.foldCase = false
+				return
+			case "insensitive":
+				t.option.foldCase = true
+				return
+			}
 		}
 	}
 	panic("unrecognized option: " + opt)
@@ -0,0 +1,768 @@
+package tlang
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"arhat.dev/tlang/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldLookupOptions(t *testing.T) {
+	type Meta struct {
+		Name string `json:"name" yaml:"objName"`
+	}
+
+	type Object struct {
+		Meta       `json:"metadata"`
+		APIVersion string `json:"apiVersion,omitempty"`
+		Spec       struct {
+			Replicas int `yaml:"replicas"`
+		}
+	}
+
+	obj := &Object{APIVersion: "v1", Meta: Meta{Name: "foo"}}
+	obj.Spec.Replicas = 3
+
+	for _, test := range []struct {
+		name    string
+		options []string
+		input   string
+		output  string
+		ok      bool
+	}{
+		{"default exact", nil, `.APIVersion`, "v1", true},
+		{"default no tags", nil, `.apiVersion`, "", false},
+		{"json tag", []string{"fieldtags=json"}, `.apiVersion; .name`, "v1foo", true},
+		{"json tag embedded", []string{"fieldtags=json"}, `.metadata.name`, "foo", true},
+		{"yaml tag", []string{"fieldtags=json,yaml"}, `.Spec.replicas; .objName`, "3foo", true},
+		{"tag case", []string{"fieldtags=json"}, `.APIVERSION`, "", false},
+		{"fold case", []string{"fieldcase=insensitive"}, `.apiversion; .spec.REPLICAS`, "v13", true},
+		{"fold tag", []string{"fieldtags=yaml", "fieldcase=insensitive"}, `.OBJNAME`, "foo", true},
+		{"reset", []string{"fieldcase=insensitive", "fieldcase=sensitive"}, `.apiversion`, "", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var sb strings.Builder
+			err := Must(New(test.name).Option(test.options...).Parse(test.input)).Execute(&sb, obj)
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+
+	assert.Panics(t, func() { New("bad").Option("fieldcase=upper") })
+}
+
+type getterData struct {
+	name  string
+	count int
+}
+
+func (d *getterData) Name() string  { return d.name }
+func (d *getterData) GetCount() int { return d.count }
+func (d *getterData) IsEmpty() bool { return d.count == 0 }
+
+func TestGettersOption(t *testing.T) {
+	data := &getterData{name: "foo", count: 2}
+
+	for _, test := range []struct {
+		name    string
+		options []string
+		input   string
+		output  string
+		ok      bool
+	}{
+		{"default", nil, `.name`, "", false},
+		{"bare", []string{"getters="}, `.name`, "foo", true},
+		{"prefix", []string{"getters=Get"}, `.count`, "2", true},
+		{"prefix only", []string{"getters=Get"}, `.name`, "", false},
+		{"not a field", []string{"getters=,Get,Is"}, `.name; .count; .empty`, "foo2false", true},
+		{"off", []string{"getters=Get", "getters=off"}, `.count`, "", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var sb strings.Builder
+			err := Must(New(test.name).Option(test.options...).Parse(test.input)).Execute(&sb, data)
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
+
+type textOnly struct{ v string }
+
+func (t textOnly) MarshalText() ([]byte, error) {
+	if t.v == "" {
+		return nil, errors.New("empty")
+	}
+	return []byte("text:" + t.v), nil
+}
+
+type textAndString struct{}
+
+func (textAndString) MarshalText() ([]byte, error) { return []byte("text"), nil }
+func (textAndString) String() string               { return "string" }
+
+func TestPrintOptions(t *testing.T) {
+	data := map[string]any{
+		"Text":   textOnly{"a"},
+		"PText":  &textOnly{"b"},
+		"BadTxt": textOnly{},
+		"Both":   textAndString{},
+		"Struct": struct{ A int }{1},
+		"PStruc": &struct{ A int }{1},
+		"NilV":   (*V)(nil),
+	}
+
+	for _, test := range []struct {
+		name    string
+		options []string
+		input   string
+		output  string
+		ok      bool
+	}{
+		{"text", nil, `.Text; .PText`, "text:atext:b", true},
+		{"text error", nil, `.BadTxt`, "", false},
+		{"default order", nil, `.Both`, "string", true},
+		{"text first", []string{"printmethods=text,stringer"}, `.Both`, "text", true},
+		{"nil stringer", nil, `.NilV`, "nilV", true},
+		{"struct", nil, `.Struct`, "{1}", true},
+		{"strict struct", []string{"printstruct=error"}, `.Struct`, "", false},
+		{"strict struct pointer", []string{"printstruct=error"}, `.PStruc`, "", false},
+		{"strict struct with method", []string{"printstruct=error"}, `.Text`, "text:a", true},
+		{"strict struct field", []string{"printstruct=error"}, `.Struct.A`, "1", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var sb strings.Builder
+			err := Must(New(test.name).Option(test.options...).Parse(test.input)).Execute(&sb, data)
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+
+	assert.Panics(t, func() { New("bad").Option("printmethods=json") })
+}
+
+func TestPrintableOption(t *testing.T) {
+	data := map[string]any{
+		"Func":    strings.ToUpper,
+		"Funcs":   []any{1, strings.ToUpper},
+		"Chans":   map[string]chan int{"a": nil},
+		"Struct":  struct{ A int }{1},
+		"Structs": []struct{ A int }{{1}},
+		"Text":    []textOnly{{"a"}},
+		"Errs":    []error{errors.New("e")},
+		"Ints":    []int{1, 2},
+		"Nil":     []any{nil},
+	}
+
+	for _, test := range []struct {
+		input string
+		want  string
+		err   string
+	}{
+		{`.Func`, "", "value of type func(string) string has no textual representation"},
+		{`.Funcs`, "", "can't print {{.Funcs}}: value of type func(string) string"},
+		{`.Chans`, "", "value of type chan int"},
+		{`.Struct`, "", "value of type struct { A int }"},
+		{`.Structs`, "", "value of type struct { A int }"},
+		{`.Text`, "", "value of type tlang.textOnly"},
+		{`.Ints; .Nil; .Errs; .Struct.A; range .Text; .; end`, "[1 2][<nil>][e]1text:a", ""},
+	} {
+		var sb strings.Builder
+		err := Must(New("t").Option("printable=strict").Parse(test.input)).Execute(&sb, data)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, test.input)
+			continue
+		}
+		if assert.NoError(t, err, test.input) {
+			assert.Equal(t, test.want, sb.String(), test.input)
+		}
+	}
+
+	var sb strings.Builder
+	err := Must(New("t").Parse(`.Struct`)).Execute(&sb, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "{1}", sb.String())
+
+	assert.Panics(t, func() { New("bad").Option("printable=loose") })
+}
+
+func TestPrintNilOption(t *testing.T) {
+	type data struct {
+		P *int
+		I any
+		M map[string]int
+	}
+	funcs := FuncMap{"none": func() any { return nil }}
+	const text = `.P; "|"; .I; "|"; .M.missing; "|"; none; "|"; $x := .P; $x`
+
+	for _, test := range []struct {
+		option string
+		want   string
+		err    string
+	}{
+		{"printnil=default", "<nil>|<no value>|<no value>|<no value>|<nil>", ""},
+		{"printnil=empty", "||||", ""},
+		{"printnil=novalue", "<no value>|<no value>|<no value>|<no value>|<no value>", ""},
+		{"printnil=error", "", "can't print nil {{.P}} of type *int"},
+	} {
+		var sb strings.Builder
+		err := Must(New("t").Funcs(funcs).Option(test.option).Parse(text)).Execute(&sb, data{})
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, test.option)
+			continue
+		}
+		if assert.NoError(t, err, test.option) {
+			assert.Equal(t, test.want, sb.String(), test.option)
+		}
+	}
+
+	err := Must(New("t").Option("printnil=error").Parse(`.missing`)).Execute(io.Discard, map[string]int{})
+	assert.ErrorContains(t, err, "can't print {{.missing}}: no value")
+
+	assert.Panics(t, func() { New("bad").Option("printnil=skip") })
+}
+
+func TestMaxDepthOption(t *testing.T) {
+	const text = `define "a"; template "b"; end
+define "b"; template "a"; end
+define "count"; if .; "."; template "count" (slice .); end; end
+template "a"`
+
+	funcs := FuncMap{"slice": func(s string) string { return s[1:] }}
+
+	var sb strings.Builder
+	err := Must(New("main").Funcs(funcs).Parse(text)).Execute(&sb, nil)
+	assert.ErrorContains(t, err, `exceeded maximum template depth (1000) in cycle "a" -> "b" -> "a"`)
+	assert.ErrorAs(t, err, new(ExecError))
+
+	err = Must(New("main").Option("maxdepth=3").Parse(`template "main"`)).Execute(&sb, nil)
+	assert.ErrorContains(t, err, `exceeded maximum template depth (3) in cycle "main" -> "main"`)
+
+	tmpl := Must(New("main").Funcs(funcs).Parse(text))
+	for _, test := range []struct {
+		depth string
+		ok    bool
+	}{
+		{"maxdepth=3", true},
+		{"maxdepth=2", false},
+	} {
+		sb.Reset()
+		err = Must(tmpl.Clone()).Option(test.depth).ExecuteTemplate(&sb, "count", "abc")
+		if test.ok {
+			assert.NoError(t, err, test.depth)
+			assert.Equal(t, "...", sb.String())
+		} else {
+			assert.Error(t, err, test.depth)
+		}
+	}
+
+	assert.Panics(t, func() { New("bad").Option("maxdepth=0") })
+}
+
+func TestTruthinessOption(t *testing.T) {
+	type item struct{ N int }
+	zero, one := 0, 1
+	empty := []int{}
+
+	for _, test := range []struct {
+		option string
+		data   any
+		want   string
+		err    string
+	}{
+		{"truthiness=default", 1, "yes", ""},
+		{"truthiness=default", &zero, "yes", ""},
+		{"truthiness=default", item{}, "yes", ""},
+		{"truthiness=strict", true, "yes", ""},
+		{"truthiness=strict", false, "no", ""},
+		{"truthiness=strict", 1, "", "if requires a bool condition, got int"},
+		{"truthiness=strict", nil, "", "if requires a bool condition, got nil"},
+		{"truthiness=deep", &zero, "no", ""},
+		{"truthiness=deep", &one, "yes", ""},
+		{"truthiness=deep", &empty, "no", ""},
+		{"truthiness=deep", (*int)(nil), "no", ""},
+		{"truthiness=deep", item{}, "no", ""},
+		{"truthiness=deep", &item{N: 1}, "yes", ""},
+	} {
+		var sb strings.Builder
+		err := Must(New("t").Option(test.option).Parse(`if .; "yes"; else; "no"; end`)).Execute(&sb, test.data)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, test.option)
+			continue
+		}
+		if assert.NoError(t, err, test.option) {
+			assert.Equal(t, test.want, sb.String(), "%s %#v", test.option, test.data)
+		}
+	}
+
+	var sb strings.Builder
+	err := Must(New("t").Option("truthiness=strict").Parse(`with .; .; end`)).Execute(&sb, "x")
+	assert.NoError(t, err, "with is not strict")
+	assert.Equal(t, "x", sb.String())
+
+	for _, test := range []struct {
+		option string
+		text   string
+		data   any
+		want   string
+		err    string
+	}{
+		{"truthiness=deep", `if .; "yes"; else; "no"; end; if !.; "yes"; else; "no"; end`, &item{}, "noyes", ""},
+		{"truthiness=deep", `. && "yes" || "no"`, &item{}, "no", ""},
+		{"truthiness=strict", `!.`, false, "true", ""},
+		{"truthiness=strict", `!"x"`, nil, "", "! requires a bool condition, got string"},
+		{"truthiness=strict", `. && true`, 1, "", "&& requires a bool condition, got int"},
+		{"truthiness=strict", `false || .`, 1, "1", ""},
+	} {
+		tmpl := Must(New("t").Option(test.option).Parse(test.text))
+		for _, optimize := range []bool{false, true} {
+			if optimize {
+				_, err := tmpl.Optimize()
+				require.NoError(t, err)
+			}
+
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, test.data)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err, test.text)
+				continue
+			}
+			if assert.NoError(t, err, test.text) {
+				assert.Equal(t, test.want, sb.String(), "%s optimized: %v", test.text, optimize)
+			}
+		}
+	}
+
+	ok, err := Must(New("t").Option("truthiness=strict").Parse(`.`)).EvaluateBool(1)
+	assert.False(t, ok)
+	assert.EqualError(t, err, "template: t: verdict of type int has no truth value")
+
+	assert.Panics(t, func() { New("bad").Option("truthiness=loose") })
+}
+
+func TestStrictVarsOption(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"used", "$x := 1\n$x", ""},
+		{"assigned and used", "$x := 1\n$x = 2\n$x", ""},
+		{"range vars", "range $i, $v := .\n$i; $v\nend", ""},
+		{"blank", "range $_, $v := .\n$v\nend", ""},
+		{"used in define", "define \"a\"\n$x := .\n$x\nend", ""},
+		{"used in nested block", "$x := 1\nif .\n$x\nend", ""},
+		{"unused", "$x := 1", "variable $x declared at unused:1 is not used"},
+		{"only assigned", "$x := 1\n$x = 2", "variable $x declared at only assigned:1 is not used"},
+		{"unused in range", "range $i, $v := .\n$v\nend", "variable $i declared at unused in range:1 is not used"},
+		{"unused in define", "define \"a\"\n\n$x := .\nend", "variable $x declared at unused in define:3 is not used"},
+		{"redeclared", "$x := 1\n$x := 2\n$x", "variable $x redeclared, previous declaration at redeclared:1"},
+		{"shadowed", "$x := 1\nwith $x := .\n$x\nend\n$x", "variable $x redeclared, previous declaration at shadowed:1"},
+		{"shadowed in range", "$v := 1\n$v\nrange $v := .\n$v\nend", "variable $v redeclared, previous declaration at shadowed in range:1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.name).Option("strictvars=on").Parse(test.input)
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorContains(t, err, test.err)
+
+			_, err = New(test.name).Parse(test.input)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestIdentifiersOption(t *testing.T) {
+	funcs := FuncMap{
+		"my-func": func(args ...int) int { return len(args) },
+		"my":      func(args ...int) int { return -len(args) },
+	}
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"hyphenated", "my-func 1 2", "2"},
+		{"separate", "my -1", "-1"},
+		{"negative", "my-func -1", "1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := Must(New(test.name).Funcs(funcs).Option("identifiers=hyphenated").Parse(test.input))
+
+			var sb strings.Builder
+			assert.NoError(t, tmpl.Execute(&sb, nil))
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	_, err := New("default").Funcs(funcs).Parse("my-func 1")
+	assert.ErrorContains(t, err, "bad character U+002D '-'")
+}
+
+func TestBlocksOption(t *testing.T) {
+	data := map[string]any{
+		"Items": []map[string]any{
+			{"Name": "a", "Tags": []string{"x", "y"}},
+			{"Name": "b"},
+		},
+	}
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"nested", `range .Items
+  .Name
+  range .Tags
+    "-"; .
+  else
+    "-none"
+  ";"
+"!"`, "a-x-y;b-none;!"},
+		{"else if", `range .Items
+  if eq .Name "a"
+    "A"
+  else if eq .Name "b"
+    "B"
+  else
+    "?"`, "AB"},
+		{"defines", `define "item"
+  "<"; .; ">"
+# comment at any indentation
+define "list"
+  range .; template "item" .Name; end
+template "list" .Items`, "<a><b>"},
+		{"explicit end", `range .Items; .Name; end
+range .Items
+  .Name
+end
+with .Items; "w"`, "abab" + "w"},
+		{"one line", `if true; "a"
+"b"`, "ab"},
+		{"eof", `range .Items
+    range .Tags
+        .`, "xy"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			funcs := FuncMap{"eq": func(a, b string) bool { return a == b }}
+			tmpl, err := New(test.name).Funcs(funcs).Option("blocks=indent").Parse(test.input)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var sb strings.Builder
+			assert.NoError(t, tmpl.Execute(&sb, data))
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	_, err := New("default").Parse("range .\n  .")
+	assert.ErrorContains(t, err, "unexpected EOF")
+
+	_, err = New("extra end").Option("blocks=indent").Parse("if true\n  1\nend\nend")
+	assert.ErrorContains(t, err, "unexpected {{end}}")
+
+	assert.Panics(t, func() { New("bad").Option("blocks=python") })
+}
+
+func TestRedefineOption(t *testing.T) {
+	const text = "define `a`; \"first\"; end\ndefine `a`; \"second\"; end\ntemplate `a`"
+
+	for _, test := range []struct {
+		option   string
+		expected string
+		warning  string
+	}{
+		{"redefine=first", "first", `template: test:2: multiple definition of template "a", keeping the first one`},
+		{"redefine=last", "second", `template: test:2: multiple definition of template "a", keeping the last one`},
+	} {
+		t.Run(test.option, func(t *testing.T) {
+			tmpl, err := New("test").Option(test.option).Parse(text)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var sb strings.Builder
+			assert.NoError(t, tmpl.Execute(&sb, nil))
+			assert.Equal(t, test.expected, sb.String())
+			assert.Equal(t, []string{test.warning}, tmpl.Warnings())
+		})
+	}
+
+	_, err := New("test").Parse(text)
+	assert.ErrorContains(t, err, "multiple definition of template")
+
+	_, err = New("test").Option("redefine=last", "redefine=error").Parse(text)
+	assert.ErrorContains(t, err, "multiple definition of template")
+
+	// successive calls to Parse
+	tmpl := Must(New("test").Option("redefine=first").Parse("define `a`; \"base\"; end\ntemplate `a`"))
+	Must(tmpl.New("overlay").Parse("define `a`; \"overlay\"; end"))
+	var sb strings.Builder
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+	assert.Equal(t, "base", sb.String())
+	assert.Equal(t, []string{`template: overlay:1: multiple definition of template "a", keeping the first one`}, tmpl.Warnings())
+
+	tmpl = Must(New("test").Parse("define `a`; \"base\"; end\ntemplate `a`"))
+	Must(tmpl.New("overlay").Parse("define `a`; \"overlay\"; end"))
+	sb.Reset()
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+	assert.Equal(t, "overlay", sb.String())
+	assert.Empty(t, tmpl.Warnings())
+
+	assert.Panics(t, func() { New("bad").Option("redefine=never") })
+}
+
+func TestNormalize(t *testing.T) {
+	// composes "e" followed by a combining acute accent, like NFC
+	nfc := func(s string) string { return strings.ReplaceAll(s, "é", "é") }
+
+	tmpl := Must(New("main").
+		Funcs(FuncMap{"café": func() string { return "ok" }}).
+		Normalize(nfc).
+		Parse("$café := café\n$café"))
+
+	var sb strings.Builder
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+	assert.Equal(t, "ok", sb.String())
+
+	tmpl = Must(New("main").
+		Normalize(nfc).
+		Funcs(FuncMap{"café": func() string { return "ok" }}).
+		Parse("café"))
+
+	sb.Reset()
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+	assert.Equal(t, "ok", sb.String())
+}
+
+func TestTokenLimitOptions(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		option string
+		input  string
+		err    *parse.LimitError
+	}{
+		{"string", "maxstring=5", `"abc"` + "\n" + `"abcd"`, &parse.LimitError{Name: "string", Line: 2, Token: "string", Size: 6, Limit: 5}},
+		{"char", "maxstring=2", `'a'`, &parse.LimitError{Name: "char", Line: 1, Token: "string", Size: 3, Limit: 2}},
+		{"raw string", "maxrawstring=5", "`a\nb`\n`a\nbc`", &parse.LimitError{Name: "raw string", Line: 3, Token: "raw string", Size: 6, Limit: 5}},
+		{"comment", "maxcomment=3", "# a\n\n# abc\n", &parse.LimitError{Name: "comment", Line: 3, Token: "comment", Size: 5, Limit: 3}},
+		{"within limits", "maxstring=5", `"abc"`, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.name).Option(test.option).Parse(test.input)
+			if test.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var limitErr *parse.LimitError
+			if assert.ErrorAs(t, err, &limitErr) {
+				assert.Equal(t, test.err, limitErr)
+			}
+
+			_, err = New(test.name).Parse(test.input)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRecursionOption(t *testing.T) {
+	type node struct {
+		Value int
+		Next  *node
+	}
+	list := &node{1, &node{2, &node{3, nil}}}
+
+	const text = "define `list`; .Value; if .Next; template `list` .Next; end; end\n" +
+		"define `a`; template `b` .; end\ndefine `b`; if false; template `a` .; end; end\n" +
+		"define `c`; template `list` .; end\ndefine `d`; \"d\"; end\n" +
+		"template `list` ."
+
+	tmpl := Must(New("test").Parse(text))
+	assert.Equal(t, [][]string{{"a", "b", "a"}, {"list", "list"}}, tmpl.Cycles())
+
+	var sb strings.Builder
+	assert.NoError(t, tmpl.Execute(&sb, list))
+	assert.Equal(t, "123", sb.String())
+
+	tmpl = Must(New("test").Option("recursion=deny").Parse(text))
+	sb.Reset()
+	assert.EqualError(t, tmpl.Execute(&sb, list),
+		`template: test: template invocation cycle "list" -> "list" not allowed by the recursion option`)
+	assert.Empty(t, sb.String())
+
+	// unreachable cycles are not checked
+	sb.Reset()
+	assert.NoError(t, tmpl.ExecuteTemplate(&sb, "d", nil))
+	assert.Equal(t, "d", sb.String())
+
+	sb.Reset()
+	assert.EqualError(t, tmpl.ExecuteTemplate(&sb, "a", nil),
+		`template: a: template invocation cycle "a" -> "b" -> "a" not allowed by the recursion option`)
+
+	tmpl = Must(New("test").Option("recursion=list:3").Parse(text))
+	sb.Reset()
+	assert.NoError(t, tmpl.Execute(&sb, list))
+	assert.Equal(t, "123", sb.String())
+
+	tmpl = Must(New("test").Option("recursion=list:2").Parse(text))
+	sb.Reset()
+	assert.EqualError(t, tmpl.Execute(&sb, list),
+		`template: test:1:42: executing "list" at <{{template "list" .Next}}>: template "list" nested more than 2 times in cycle "list" -> "list"`)
+
+	assert.Panics(t, func() { New("test").Option("recursion=list") })
+	assert.Panics(t, func() { New("test").Option("recursion=list:0") })
+}
+
+func TestMissingTemplateOption(t *testing.T) {
+	const text = "define `page`; \"[\"; template `sidebar` .X; \"]\"; end\ntemplate `page` .\n$v := (template `footer`); $v"
+
+	for _, test := range []struct {
+		option   string
+		expected string
+	}{
+		{"missingtemplate=empty", "[]"},
+		{"missingtemplate=placeholder:<!-- {name} -->", "[<!-- sidebar -->]<!-- footer -->"},
+	} {
+		t.Run(test.option, func(t *testing.T) {
+			tmpl := Must(New("test").Option(test.option).Parse(text))
+
+			var sb strings.Builder
+			result, err := tmpl.ExecuteWithResult(&sb, map[string]int{}, nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, test.expected, sb.String())
+			assert.Equal(t, []string{
+				`test:1:29: template "sidebar" not defined, rendered placeholder`,
+				`test:3:7: template "footer" not defined, rendered placeholder`,
+			}, result.Warnings)
+		})
+	}
+
+	tmpl := Must(New("test").Option("missingtemplate=empty", "missingtemplate=error").Parse(text))
+	assert.ErrorContains(t, tmpl.Execute(&strings.Builder{}, nil), `template "sidebar" not defined`)
+
+	assert.Panics(t, func() { New("test").Option("missingtemplate=text") })
+}
+
+func TestFuncTimeoutOption(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	funcs := FuncMap{
+		"hang": func() string {
+			<-release
+			return "hang"
+		},
+		"slow": func() string {
+			time.Sleep(20 * time.Millisecond)
+			return "slow"
+		},
+		"polite": func(env Env) (string, error) {
+			<-env.Context().Done()
+			return "", env.Context().Err()
+		},
+		"fast": func() string { return "fast" },
+	}
+
+	for _, test := range []struct {
+		options []string
+		input   string
+		output  string
+		err     string
+	}{
+		{nil, `fast; slow`, "fastslow", ""},
+		{[]string{"functimeout=5ms"}, `fast; hang`, "fast", `error calling hang: template: function call timed out after 5ms`},
+		{[]string{"functimeout=5ms,slow:1s"}, `slow`, "slow", ""},
+		{[]string{"functimeout=1s,hang:5ms"}, `hang`, "", `error calling hang: template: function call timed out after 5ms`},
+		{[]string{"functimeout=5ms", "functimeout=slow:0"}, `slow`, "slow", ""},
+		{[]string{"functimeout=5ms"}, `polite`, "", "function call timed out"},
+	} {
+		t.Run(strings.Join(test.options, " ")+" "+test.input, func(t *testing.T) {
+			tmpl := Must(New("test").Funcs(funcs).Option(test.options...).Parse(test.input))
+
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, nil)
+			assert.Equal(t, test.output, sb.String())
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorContains(t, err, test.err)
+			assert.ErrorIs(t, err, ErrFuncTimeout)
+		})
+	}
+
+	// the context of the execution stops calls as well
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tmpl := Must(New("test").Funcs(funcs).Option("functimeout=1s").Parse(`hang`))
+	assert.ErrorIs(t, tmpl.ExecuteContext(ctx, &strings.Builder{}, nil), context.Canceled)
+
+	// timeouts are not caught by try
+	var sb strings.Builder
+	tmpl = Must(New("test").Funcs(funcs).Option("functimeout=5ms").Parse(`try; hang; catch; "caught"; end`))
+	assert.ErrorIs(t, tmpl.Execute(&sb, nil), ErrFuncTimeout)
+	assert.Empty(t, sb.String())
+
+	// calls get a copy of the Env, joined back only if they return in time
+	lingered := make(chan struct{})
+	envFuncs := FuncMap{
+		"set": func(env Env, key string) string {
+			env.SetResult(key, true)
+			env.Scratch().Set(key, true)
+			return ""
+		},
+		"linger": func(env Env) string {
+			<-env.Context().Done()
+			env.SetResult("late", true)
+			env.Scratch().Set("late", true)
+			close(lingered)
+			return ""
+		},
+		"scratch": func(env Env) *Scratch { return env.Scratch() },
+	}
+	tmpl = Must(New("test").Funcs(envFuncs).Option("functimeout=1s,linger:5ms").Parse(`set "k"; (scratch).Get "k"`))
+	result, err := tmpl.ExecuteWithResult(&sb, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "true", sb.String())
+	assert.Equal(t, map[string]any{"k": true}, result.Results)
+
+	tmpl = Must(New("test").Funcs(envFuncs).Option("functimeout=1s,linger:5ms").Parse(`set "k"; linger`))
+	result, err = tmpl.ExecuteWithResult(&sb, nil, nil)
+	assert.ErrorIs(t, err, ErrFuncTimeout)
+	<-lingered
+	assert.Equal(t, map[string]any{"k": true}, result.Results)
+
+	assert.Panics(t, func() { New("test").Option("functimeout=fast") })
+	assert.Panics(t, func() { New("test").Option("functimeout=:1s") })
+	assert.Panics(t, func() { New("test").Option("functimeout=-1s") })
+}
@@ -0,0 +1,160 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// EncodingVersion is the version of trees encoded by MarshalBinary, it MUST
+// be increased when node types or the trees produced by the parser change,
+// so that stale encodings are not used.
+const EncodingVersion = 11
+
+func init() {
+	for _, n := range []Node{
+		&ListNode{}, &TextNode{}, &CommentNode{}, &PipeNode{}, &ActionNode{},
+		&CommandNode{}, &IdentifierNode{}, &VariableNode{}, &DotNode{},
+		&NilNode{}, &FieldNode{}, &ChainNode{}, &BoolNode{}, &NumberNode{},
+		&StringNode{}, &IfNode{}, &BreakNode{}, &ContinueNode{},
+		&ReturnNode{}, &RangeNode{}, &WithNode{}, &TemplateNode{},
+		&ComparisonNode{}, &LogicalNode{}, &NotNode{}, &ForNode{},
+		&IndexNode{}, &TryNode{}, &SwitchNode{}, &CaseNode{},
+	} {
+		gob.Register(n)
+	}
+}
+
+// encodedTree is the encoded form of a Tree.
+type encodedTree struct {
+	Name      string
+	ParseName string
+	Root      *ListNode
+	Line      int
+	Mode      Mode
+	Vars      map[string]Node
+	Text      string
+	Params    []string
+	Warnings  []string
+}
+
+// MarshalBinary encodes the tree with the text it was parsed from, so that it
+// can be stored and restored by UnmarshalBinary without parsing again.
+func (t *Tree) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&encodedTree{
+		Name:      t.Name,
+		ParseName: t.ParseName,
+		Root:      t.Root,
+		Line:      t.Line,
+		Mode:      t.Mode,
+		Vars:      t.Vars,
+		Text:      t.text,
+		Params:    t.Params,
+		Warnings:  t.Warnings,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a tree encoded by MarshalBinary.
+func (t *Tree) UnmarshalBinary(data []byte) error {
+	var et encodedTree
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&et)
+	if err != nil {
+		return err
+	}
+
+	*t = Tree{
+		Name:      et.Name,
+		ParseName: et.ParseName,
+		Root:      et.Root,
+		Line:      et.Line,
+		Mode:      et.Mode,
+		Vars:      et.Vars,
+		Params:    et.Params,
+		Warnings:  et.Warnings,
+		text:      et.Text,
+	}
+	if t.Root == nil {
+		t.Root = t.newList(0)
+	}
+
+	Inspect(t.Root, func(n Node) bool {
+		setTree(n, t)
+		return true
+	})
+	for _, n := range t.Vars {
+		setTree(n, t)
+	}
+
+	return nil
+}
+
+// setTree sets the tree n belongs to.
+func setTree(n Node, t *Tree) {
+	switch n := n.(type) {
+	case *ListNode:
+		n.tr = t
+	case *TextNode:
+		n.tr = t
+	case *CommentNode:
+		n.tr = t
+	case *PipeNode:
+		n.tr = t
+	case *ActionNode:
+		n.tr = t
+	case *CommandNode:
+		n.tr = t
+	case *IdentifierNode:
+		n.tr = t
+	case *VariableNode:
+		n.tr = t
+	case *DotNode:
+		n.tr = t
+	case *NilNode:
+		n.tr = t
+	case *FieldNode:
+		n.tr = t
+	case *ChainNode:
+		n.tr = t
+	case *IndexNode:
+		n.tr = t
+	case *ComparisonNode:
+		n.tr = t
+	case *LogicalNode:
+		n.tr = t
+	case *NotNode:
+		n.tr = t
+	case *BoolNode:
+		n.tr = t
+	case *NumberNode:
+		n.tr = t
+	case *StringNode:
+		n.tr = t
+	case *IfNode:
+		n.tr = t
+	case *BreakNode:
+		n.tr = t
+	case *ContinueNode:
+		n.tr = t
+	case *ReturnNode:
+		n.tr = t
+	case *RangeNode:
+		n.tr = t
+	case *ForNode:
+		n.tr = t
+	case *TryNode:
+		n.tr = t
+	case *SwitchNode:
+		n.tr = t
+	case *CaseNode:
+		n.tr = t
+	case *WithNode:
+		n.tr = t
+	case *TemplateNode:
+		n.tr = t
+	}
+}
@@ -0,0 +1,37 @@
+package parse
+
+import (
+	"testing"
+)
+
+func TestEncodeTree(t *testing.T) {
+	textFormat = "%q"
+	defer func() { textFormat = "%s" }()
+	for _, test := range parseTests {
+		if !test.ok {
+			continue
+		}
+
+		tmpl, err := New(test.name, nil).Parse(test.input, make(map[string]*Tree), builtins)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.name, err)
+		}
+
+		data, err := tmpl.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%q: marshal: %v", test.name, err)
+		}
+
+		var decoded Tree
+		if err = decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%q: unmarshal: %v", test.name, err)
+		}
+
+		if got, want := decoded.Root.String(), tmpl.Root.String(); got != want {
+			t.Errorf("%q: got\n\t%v\nexpected\n\t%v", test.name, got, want)
+		}
+		if decoded.Root.tree() != &decoded || decoded.text != tmpl.text {
+			t.Errorf("%q: tree not restored", test.name)
+		}
+	}
+}
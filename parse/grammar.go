@@ -0,0 +1,120 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+//go:generate go run ../internal/gengrammar ../docs/tlang.tmLanguage.json
+
+// identChars is the regexp character class matching isAlphaNumeric.
+const identChars = `[\p{L}\p{Nd}_]`
+
+// tmRule is a single TextMate grammar rule.
+type tmRule struct {
+	Name     string   `json:"name,omitempty"`
+	Match    string   `json:"match,omitempty"`
+	Begin    string   `json:"begin,omitempty"`
+	End      string   `json:"end,omitempty"`
+	Patterns []tmRule `json:"patterns,omitempty"`
+}
+
+// tmGrammar is the top level of a TextMate grammar file.
+type tmGrammar struct {
+	Name      string   `json:"name"`
+	ScopeName string   `json:"scopeName"`
+	FileTypes []string `json:"fileTypes"`
+	Patterns  []tmRule `json:"patterns"`
+}
+
+// TextMateGrammar returns a TextMate grammar (JSON) for tlang source files.
+//
+// The grammar is derived from the token rules of the lexer, so keywords and
+// literal syntax stay in sync with the language; the copy shipped in docs/ is
+// regenerated with go generate.
+func TextMateGrammar() ([]byte, error) {
+	var keywords, constants []string
+	for k, typ := range key {
+		switch typ {
+		case itemDot:
+		case itemBool, itemNil:
+			constants = append(constants, k)
+		default:
+			keywords = append(keywords, k)
+		}
+	}
+	sort.Strings(keywords)
+	sort.Strings(constants)
+
+	var actionKeywords []string
+	for k := range actionKey {
+		actionKeywords = append(actionKeywords, k)
+	}
+	sort.Strings(actionKeywords)
+
+	g := tmGrammar{
+		Name:      "tlang",
+		ScopeName: "source.tlang",
+		FileTypes: []string{"tl"},
+		Patterns: []tmRule{
+			// comments start a line, or end an action after a space
+			{Name: "comment.line.number-sign.tlang", Match: `(?:^|(?<=\s))#.*$`},
+			{
+				Name:  "string.quoted.double.tlang",
+				Begin: `"`,
+				End:   `"|$`,
+				Patterns: []tmRule{
+					{Name: "constant.character.escape.tlang", Match: `\\.`},
+				},
+			},
+			{Name: "string.quoted.other.raw.tlang", Begin: "`", End: "`"},
+			{Name: "constant.character.tlang", Match: `'(?:\\.|[^'\\\n])+'`},
+			{
+				Name:  "keyword.control.tlang",
+				Match: `(?<![.$\w])(?:` + strings.Join(keywords, "|") + `)(?!` + identChars + `)`,
+			},
+			// keywords only as the first word of an action
+			{
+				Name:  "keyword.control.tlang",
+				Match: `(?:^|(?<=;))\s*(?:` + strings.Join(actionKeywords, "|") + `)(?!` + identChars + `)`,
+			},
+			{
+				Name:  "constant.language.tlang",
+				Match: `(?<![.$\w])(?:` + strings.Join(constants, "|") + `)(?!` + identChars + `)`,
+			},
+			{
+				Name: "constant.numeric.tlang",
+				Match: `(?<!` + identChars + `)[+-]?(?:` +
+					`0[xX][0-9a-fA-F_]*(?:\.[0-9a-fA-F_]*)?(?:[pP][+-]?[0-9_]+)?` +
+					`|0[oO][0-7_]+|0[bB][01_]+` +
+					`|(?:[0-9][0-9_]*(?:\.[0-9_]*)?|\.[0-9][0-9_]*)(?:[eE][+-]?[0-9_]+)?` +
+					`)i?`,
+			},
+			{Name: "variable.other.global.tlang", Match: `\$\$` + identChars + `+`},
+			{Name: "variable.other.tlang", Match: `\$` + identChars + `*`},
+			{Name: "variable.other.member.tlang", Match: `\.` + identChars + `+`},
+			{Name: "variable.language.dot.tlang", Match: `\.`},
+			{Name: "keyword.operator.comparison.tlang", Match: `==|!=|<=|>=|<|>`},
+			{Name: "keyword.operator.logical.tlang", Match: `&&|\|\||!`},
+			{Name: "keyword.operator.declare.tlang", Match: `:=`},
+			{Name: "keyword.operator.assign.tlang", Match: `=`},
+			{Name: "keyword.operator.pipe.tlang", Match: `\|`},
+			{Name: "punctuation.terminator.tlang", Match: `;`},
+			{Name: "punctuation.separator.continuation.tlang", Match: `\\\s*$`},
+			{Name: "punctuation.parenthesis.tlang", Match: `[()]`},
+			{Name: "entity.name.function.tlang", Match: identChars + `+`},
+		},
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // keep lookbehind assertions readable
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&g); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,64 @@
+package parse
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestTextMateGrammarInSync(t *testing.T) {
+	want, err := TextMateGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile("../docs/tlang.tmLanguage.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Error("docs/tlang.tmLanguage.json is out of date, run go generate ./parse")
+	}
+}
+
+func TestTextMateGrammarKeywords(t *testing.T) {
+	b, err := TextMateGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, typ := range key {
+		if typ == itemDot {
+			continue
+		}
+
+		items := collect(&lexTest{name: k, input: k})
+		if items[1].typ != typ {
+			t.Errorf("%s: lexed as %v, want %v", k, items[1].typ, typ)
+		}
+
+		if !regexp.MustCompile(`\b` + k + `\b`).Match(b) {
+			t.Errorf("keyword %q missing in grammar", k)
+		}
+	}
+}
+
+func TestTextMateGrammarActionKeywords(t *testing.T) {
+	b, err := TextMateGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, typ := range actionKey {
+		items := collect(&lexTest{name: k, input: "switch; " + k})
+		if items[4].typ != typ {
+			t.Errorf("%s: lexed as %v, want %v", k, items[4].typ, typ)
+		}
+
+		if !regexp.MustCompile(`\b` + k + `\b`).Match(b) {
+			t.Errorf("keyword %q missing in grammar", k)
+		}
+	}
+}
@@ -46,37 +46,87 @@ const (
 	itemComment                      // comment text
 	itemComplex                      // complex constant (1+2i); imaginary is just a number
 	itemAssign                       // equals ('=') introducing an assignment
+	itemCompare                      // comparison operator ('==', '!=', '<', '<=', '>' or '>=')
+	itemAnd                          // logical and ('&&')
+	itemOr                           // logical or ('||')
+	itemNot                          // logical not ('!')
 	itemDeclare                      // colon-equals (':=') introducing a declaration
 	itemEOF
-	itemField      // alphanumeric identifier starting with '.'
-	itemIdentifier // alphanumeric identifier not starting with '.'
-	itemLeftDelim  // left action delimiter
-	itemLeftParen  // '(' inside action
-	itemNumber     // simple number, including imaginary
-	itemPipe       // pipe symbol
-	itemRawString  // raw quoted string (includes quotes)
-	itemRightDelim // right action delimiter
-	itemRightParen // ')' inside action
-	itemSpace      // run of spaces separating arguments
-	itemString     // quoted string (includes quotes)
+	itemField        // alphanumeric identifier starting with '.'
+	itemIdentifier   // alphanumeric identifier not starting with '.'
+	itemLeftBracket  // '[' inside action
+	itemLeftDelim    // left action delimiter
+	itemLeftParen    // '(' inside action
+	itemNumber       // simple number, including imaginary
+	itemPipe         // pipe symbol
+	itemRawString    // raw quoted string (includes quotes)
+	itemRightBracket // ']' inside action
+	itemRightDelim   // right action delimiter
+	itemRightParen   // ')' inside action
+	itemSpace        // run of spaces separating arguments
+	itemString       // quoted string (includes quotes)
 	// itemText       // plain text
 	itemVariable // variable starting with '$', such as '$' or  '$1' or '$hello'
 	// Keywords appear after all the rest.
 	itemKeyword  // used only to delimit the keywords
 	itemBlock    // block keyword
 	itemBreak    // break keyword
+	itemCase     // case keyword
+	itemCatch    // catch keyword
 	itemContinue // continue keyword
 	itemDot      // the cursor, spelled '.'
+	itemDefault  // default keyword
 	itemDefine   // define keyword
 	itemElse     // else keyword
 	itemEnd      // end keyword
+	itemFor      // for keyword
 	itemIf       // if keyword
 	itemNil      // the untyped nil constant, easiest to treat as a keyword
 	itemRange    // range keyword
+	itemRecurse  // recurse keyword
+	itemReturn   // return keyword
+	itemSwitch   // switch keyword
 	itemTemplate // template keyword
+	itemTry      // try keyword
+	itemVars     // vars keyword
 	itemWith     // with keyword
 )
 
+// key maps the reserved words to their item types, it is the single source
+// of truth for keywords, also used to generate editor grammars.
+var key = map[string]itemType{
+	".":        itemDot,
+	"block":    itemBlock,
+	"break":    itemBreak,
+	"catch":    itemCatch,
+	"continue": itemContinue,
+	"define":   itemDefine,
+	"else":     itemElse,
+	"end":      itemEnd,
+	"for":      itemFor,
+	"if":       itemIf,
+	"nil":      itemNil,
+	"range":    itemRange,
+	"recurse":  itemRecurse,
+	"return":   itemReturn,
+	"template": itemTemplate,
+	"try":      itemTry,
+	"vars":     itemVars,
+	"with":     itemWith,
+	"true":     itemBool,
+	"false":    itemBool,
+}
+
+// actionKey maps the words that are keywords only as the first word of an
+// action to their item types, case and default only in the body of a
+// switch, they are identifiers elsewhere, e.g. the default function in
+// {{.A | default 1}}.
+var actionKey = map[string]itemType{
+	"case":    itemCase,
+	"default": itemDefault,
+	"switch":  itemSwitch,
+}
+
 const eof = -1
 
 // stateFn represents the state of the scanner as a function that returns the next state.
@@ -92,9 +142,21 @@ type lexer struct {
 	start       Pos  // start position of this item
 	width       Pos  // width of last rune read from input
 	parenDepth  int  // nesting depth of ( ) exprs
+	brackDepth  int  // nesting depth of [ ] subscripts
 	line        int  // 1+number of newlines seen
 	startLine   int  // start line of this item
 
+	hyphenIdents bool                // allow hyphens inside identifiers.
+	normalize    func(string) string // normalizes identifiers and variable names.
+	limits       Limits              // limits of token sizes.
+	limitErr     *LimitError         // error of the token exceeding limits.
+
+	indentBlocks bool        // close blocks by indentation, see IndentBlocks.
+	blocks       []openBlock // open blocks.
+	indent       int         // indentation of the current line.
+	actionStart  bool        // the next item is the first of an action.
+	pending      []item      // items queued before the next scanned item.
+
 	nextState stateFn
 }
 
@@ -164,37 +226,125 @@ func (l *lexer) errorf(format string, args ...any) item {
 // nextItem returns the next item from the input.
 // Called by the parser, not in the lexing goroutine.
 func (l *lexer) nextItem() (ret item) {
-	for l.nextState != nil {
-		ret, l.nextState = l.nextState(l)
+	for {
+		if len(l.pending) != 0 {
+			ret, l.pending = l.pending[0], l.pending[1:]
+			return l.trackBlocks(ret)
+		}
+
 		if l.nextState == nil {
+			// fake EOF
+			return l.emit(itemEOF)
+		}
+
+		ret, l.nextState = l.nextState(l)
+		if l.nextState == nil && len(l.pending) == 0 {
 			// is the last state, return unconditionally
-			return
+			return l.trackBlocks(ret)
 		}
 
 		if ret.notEmpty {
 			// got a meaningful item
-			return
+			return l.trackBlocks(ret)
 		}
 
 		// empty item, scan next
 	}
+}
+
+// openBlock is a block opened by the keyword typ at indentation indent.
+type openBlock struct {
+	typ    itemType
+	indent int
+}
+
+// trackBlocks records blocks opened and closed by it, for the keywords of
+// switch bodies and for closing blocks in indentBlocks mode.
+func (l *lexer) trackBlocks(it item) item {
+	if l.actionStart {
+		switch it.typ {
+		case itemBlock, itemDefine, itemFor, itemIf, itemRange, itemSwitch, itemTry, itemVars, itemWith:
+			l.blocks = append(l.blocks, openBlock{it.typ, l.indent})
+		case itemEnd:
+			if len(l.blocks) != 0 {
+				l.blocks = l.blocks[:len(l.blocks)-1]
+			}
+		}
+	}
+	l.actionStart = it.typ == itemLeftDelim
+	return it
+}
+
+// closeBlocks queues {{end}} for every block closed by the action at l.pos
+// in indentBlocks mode, which are blocks opened at the same or deeper
+// indentation if the action starts a line, or all blocks at EOF. Blocks
+// opened at the same indentation continue with else, catch and end, and
+// switches with case and default.
+func (l *lexer) closeBlocks(eof bool) {
+	n := len(l.blocks)
+	if !eof {
+		lineStart := strings.LastIndexByte(l.input[:l.pos], '\n') + 1
+		if strings.TrimLeft(l.input[lineStart:l.pos], " \t\r") != "" {
+			// not the first action of the line
+			return
+		}
+
+		l.indent = int(l.pos) - lineStart
+		rest := l.input[l.pos:]
+		continues := false
+		for _, kw := range []string{"else", "catch", "end"} {
+			continues = continues || hasKeyword(rest, kw)
+		}
+		continuesSwitch := hasKeyword(rest, "case") || hasKeyword(rest, "default")
+		for n = 0; n < len(l.blocks); n++ {
+			open := l.blocks[len(l.blocks)-1-n]
+			if open.indent < l.indent || open.indent == l.indent &&
+				(continues || continuesSwitch && open.typ == itemSwitch) {
+				break
+			}
+		}
+	}
+
+	for ; n > 0; n-- {
+		l.pending = append(l.pending,
+			item{itemLeftDelim, l.pos, "", l.line, true},
+			item{itemEnd, l.pos, "end", l.line, true},
+			item{itemRightDelim, l.pos, "", l.line, true},
+		)
+	}
+}
 
-	// fake EOF
-	return l.emit(itemEOF)
+// hasKeyword reports whether s starts with the keyword kw.
+func hasKeyword(s, kw string) bool {
+	if !strings.HasPrefix(s, kw) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(s[len(kw):])
+	return !isAlphaNumeric(r) && r != '.'
 }
 
 // lex creates a new scanner for the input string.
 func lex(name, input string, emitComment bool) *lexer {
-	l := &lexer{
+	l := &lexer{}
+	l.reset(name, input, emitComment)
+	return l
+}
+
+// reset prepares l to scan input as a new lexer would, keeping the memory
+// allocated for blocks and pending items.
+func (l *lexer) reset(name, input string, emitComment bool) {
+	*l = lexer{
 		name:        name,
 		input:       input,
 		emitComment: emitComment,
 		line:        1,
 		startLine:   1,
 
+		blocks:  l.blocks[:0],
+		pending: l.pending[:0],
+
 		nextState: lexWhitespace,
 	}
-	return l
 }
 
 // state functions
@@ -235,11 +385,24 @@ func lexWhitespace(l *lexer) (ret item, next stateFn) {
 	switch r {
 	case ' ', '\r', '\t', '\n', eof:
 		// when r end up being whitespace, we MUST have reached EOF
+		if l.indentBlocks && len(l.blocks) != 0 {
+			l.closeBlocks(true)
+			l.pending = append(l.pending, l.emit(itemEOF))
+			return item{}, nil
+		}
 		return l.emit(itemEOF), nil
 	case '#':
 		return lexComment(l)
 	}
 
+	if l.indentBlocks {
+		l.closeBlocks(false)
+		if len(l.pending) != 0 {
+			l.pending = append(l.pending, l.emit(itemLeftDelim))
+			return item{}, lexInsideAction
+		}
+	}
+
 	return l.emit(itemLeftDelim), lexInsideAction
 }
 
@@ -247,6 +410,14 @@ func lexWhitespace(l *lexer) (ret item, next stateFn) {
 func lexComment(l *lexer) (ret item, next stateFn) {
 	i := strings.IndexByte(l.input[l.pos:], '\n')
 
+	size := i
+	if i < 0 {
+		size = len(l.input) - int(l.pos)
+	}
+	if l.exceeds("comment", size, l.limits.Comment) {
+		return l.errorf("%s", l.limitErr), nil
+	}
+
 	if i < 0 {
 		l.pos = Pos(len(l.input))
 	} else {
@@ -280,6 +451,9 @@ func lexInsideAction(l *lexer) (ret item, next stateFn) {
 		if l.parenDepth > 0 {
 			return l.errorf("unclosed left paren"), nil
 		}
+		if l.brackDepth > 0 {
+			return l.errorf("unclosed left bracket"), nil
+		}
 
 		// schedule lexWhitespace as next to emit EOF
 		return l.emit(itemRightDelim), lexWhitespace
@@ -308,7 +482,7 @@ func lexInsideAction(l *lexer) (ret item, next stateFn) {
 			return l.emit(itemDot), lexInsideAction
 		}
 
-		if data[i+1] < '0' || data[i+1] > '9' {
+		if data[i+1] < '0' || data[i+1] > '9' || l.inChain() {
 			l.width = 1
 			l.pos += 1
 			return lexField(l)
@@ -318,12 +492,45 @@ func lexInsideAction(l *lexer) (ret item, next stateFn) {
 		return lexNumber(l)
 	case '|':
 		l.width = 1
+		if i < len(data)-1 && data[i+1] == '|' {
+			l.pos += 2
+			return l.emit(itemOr), lexInsideAction
+		}
+
 		l.pos += 1
 		return l.emit(itemPipe), lexInsideAction
+	case '&':
+		if i < len(data)-1 && data[i+1] == '&' {
+			l.width = 1
+			l.pos += 2
+			return l.emit(itemAnd), lexInsideAction
+		}
+
+		l.width = 1
+		l.pos += 1
+		return l.emit(itemChar), lexInActionSpace
 	case '=':
 		l.width = 1
+		if i < len(data)-1 && data[i+1] == '=' {
+			l.pos += 2
+			return l.emit(itemCompare), lexInsideAction
+		}
+
 		l.pos += 1
 		return l.emit(itemAssign), lexInsideAction
+	case '<', '>', '!':
+		if i < len(data)-1 && data[i+1] == '=' {
+			l.width = 1
+			l.pos += 2
+			return l.emit(itemCompare), lexInsideAction
+		}
+
+		l.width = 1
+		l.pos += 1
+		if r == '!' {
+			return l.emit(itemNot), lexInsideAction
+		}
+		return l.emit(itemCompare), lexInsideAction
 	case ':':
 		if i == len(data)-1 || data[i+1] != '=' {
 			return l.errorf("expected :="), nil
@@ -363,6 +570,22 @@ func lexInsideAction(l *lexer) (ret item, next stateFn) {
 			return l.errorf("unexpected right paren %#U", r), nil
 		}
 
+		return ret, lexInsideAction
+	case '[':
+		l.width = 1
+		l.pos += 1
+		ret = l.emit(itemLeftBracket)
+		l.brackDepth++
+		return ret, lexInsideAction
+	case ']':
+		l.width = 1
+		l.pos += 1
+		ret = l.emit(itemRightBracket)
+		l.brackDepth--
+		if l.brackDepth < 0 {
+			return l.errorf("unexpected right bracket %#U", r), nil
+		}
+
 		return ret, lexInsideAction
 	case '+', '-':
 		return lexNumber(l)
@@ -458,65 +681,66 @@ func lexInActionSpace(l *lexer) (ret item, next stateFn) {
 
 // lexIdentifier scans an alphanumeric.
 func lexIdentifier(l *lexer) (ret item, next stateFn) {
-	var (
-		i int
-		r rune
-	)
 	data := l.input[l.pos:]
+	i := l.scanIdent(data, l.hyphenIdents)
 
-	for i, r = range data {
-		if !isAlphaNumeric(r) {
-			break
-		}
+	_, sz := utf8.DecodeLastRuneInString(data[:i])
+	l.width = Pos(sz)
+	l.pos += Pos(i)
+	if !l.atTerminator() {
+		r, _ := utf8.DecodeRuneInString(data[i:])
+		return l.errorf("bad character %#U", r), nil
 	}
 
-	if isAlphaNumeric(r) { // r is the last rune
-		i = len(data)
-		l.width = Pos(utf8.RuneLen(r))
-	} else {
-		_, sz := utf8.DecodeLastRuneInString(data[:i])
-		l.width = Pos(sz)
+	if typ, ok := key[data[:i]]; ok {
+		return l.emit(typ), lexInsideAction
 	}
 
-	l.pos += Pos(i)
-	if !l.atTerminator() {
-		return l.errorf("bad character %#U", r), nil
+	if typ, ok := actionKey[data[:i]]; ok && l.actionStart &&
+		(typ == itemSwitch || len(l.blocks) != 0 && l.blocks[len(l.blocks)-1].typ == itemSwitch) {
+		return l.emit(typ), lexInsideAction
 	}
 
-	switch data[:i] {
-	case ".":
-		return l.emit(itemDot), lexInsideAction
-	case "block":
-		return l.emit(itemBlock), lexInsideAction
-	case "break":
-		return l.emit(itemBreak), lexInsideAction
-	case "continue":
-		return l.emit(itemContinue), lexInsideAction
-	case "define":
-		return l.emit(itemDefine), lexInsideAction
-	case "else":
-		return l.emit(itemElse), lexInsideAction
-	case "end":
-		return l.emit(itemEnd), lexInsideAction
-	case "if":
-		return l.emit(itemIf), lexInsideAction
-	case "range":
-		return l.emit(itemRange), lexInsideAction
-	case "nil":
-		return l.emit(itemNil), lexInsideAction
-	case "template":
-		return l.emit(itemTemplate), lexInsideAction
-	case "with":
-		return l.emit(itemWith), lexInsideAction
-	case "true", "false":
-		return l.emit(itemBool), lexInsideAction
-	default:
-		if data[0] == '.' {
-			return l.emit(itemField), lexInsideAction
+	if data[0] == '.' {
+		return l.emit(itemField), lexInsideAction
+	}
+
+	return l.normalized(l.emit(itemIdentifier)), lexInsideAction
+}
+
+// scanIdent returns the length of the alphanumeric name at the start of
+// data, hyphens between alphanumerics are included if allowed. Combining
+// marks are included when names are normalized, since they are composed
+// into letters by normalization.
+func (l *lexer) scanIdent(data string, hyphens bool) int {
+	for i, r := range data {
+		if isAlphaNumeric(r) {
+			continue
+		}
+
+		if l.normalize != nil && i > 0 && unicode.Is(unicode.M, r) {
+			continue
 		}
 
-		return l.emit(itemIdentifier), lexInsideAction
+		if r == '-' && hyphens && i > 0 {
+			if next, _ := utf8.DecodeRuneInString(data[i+1:]); isAlphaNumeric(next) {
+				continue
+			}
+		}
+
+		return i
+	}
+
+	return len(data)
+}
+
+// normalized applies the normalization of names to the identifier or
+// variable item.
+func (l *lexer) normalized(it item) item {
+	if l.normalize != nil {
+		it.val = l.normalize(it.val)
 	}
+	return it
 }
 
 // lexField scans a field: .Alphanumeric.
@@ -525,12 +749,16 @@ func lexField(l *lexer) (ret item, next stateFn) {
 	return lexFieldOrVariable(l, itemField)
 }
 
-// lexVariable scans a Variable: $Alphanumeric.
+// lexVariable scans a Variable: $Alphanumeric, or a global variable:
+// $$Alphanumeric.
 // The $ has been scanned.
 func lexVariable(l *lexer) (ret item, next stateFn) {
 	if l.atTerminator() { // Nothing interesting follows -> "$".
 		return l.emit(itemVariable), lexInsideAction
 	}
+	if l.accept("$") && l.atTerminator() {
+		return l.errorf("missing name of global variable"), nil
+	}
 	return lexFieldOrVariable(l, itemVariable)
 }
 
@@ -544,33 +772,23 @@ func lexFieldOrVariable(l *lexer, typ itemType) (ret item, next stateFn) {
 
 		return l.emit(itemDot), lexInsideAction
 	}
-	var (
-		i int
-		r rune
-	)
-
 	data := l.input[l.pos:]
-	for i, r = range data {
-		if !isAlphaNumeric(r) {
-			break
-		}
-	}
-
-	if isAlphaNumeric(r) { // r is the last rune in data
-		i = len(data)
-		l.width = Pos(utf8.RuneLen(r))
-	} else {
-		_, sz := utf8.DecodeLastRuneInString(data[:i])
-		l.width = Pos(sz)
-	}
+	i := l.scanIdent(data, false)
 
+	_, sz := utf8.DecodeLastRuneInString(data[:i])
+	l.width = Pos(sz)
 	l.pos += Pos(i)
 
 	if !l.atTerminator() {
+		r, _ := utf8.DecodeRuneInString(data[i:])
 		ret = l.errorf("bad character %#U", r)
 		return
 	}
 
+	if typ == itemVariable {
+		return l.normalized(l.emit(typ)), lexInsideAction
+	}
+
 	return l.emit(typ), lexInsideAction
 }
 
@@ -584,13 +802,26 @@ func (l *lexer) atTerminator() bool {
 	}
 
 	switch l.input[l.pos] {
-	case '.', ',', '|', ':', ')', '(', ' ', '\t', '\r', '\n', ';':
+	case '.', ',', '|', ':', ')', '(', ' ', '\t', '\r', '\n', ';',
+		'=', '!', '<', '>', '&', '[', ']':
 		return true
 	default:
 		return false
 	}
 }
 
+// inChain reports whether the input right before current position is part
+// of an operand, in which case a following '.' starts a field access (e.g.
+// .Map.1) rather than a number.
+func (l *lexer) inChain() bool {
+	if l.pos == 0 {
+		return false
+	}
+
+	r, _ := utf8.DecodeLastRuneInString(l.input[:l.pos])
+	return r == ')' || r == ']' || r == '$' || isAlphaNumeric(r)
+}
+
 // lexChar scans a character constant. The initial quote is already
 // scanned. Syntax checking is done by the parser.
 func lexChar(l *lexer) (ret item, next stateFn) {
@@ -628,6 +859,9 @@ Loop:
 	if hasEnd {
 		l.width = 1 // '\''
 		l.pos += Pos(i) + 1
+		if l.exceeds("string", int(l.pos-l.start), l.limits.String) {
+			return l.errorf("%s", l.limitErr), nil
+		}
 
 		return l.emit(itemCharConstant), lexInsideAction
 	}
@@ -728,6 +962,9 @@ Loop:
 	if hasEnd {
 		l.width = 1 // '"'
 		l.pos += Pos(i) + 1
+		if l.exceeds("string", int(l.pos-l.start), l.limits.String) {
+			return l.errorf("%s", l.limitErr), nil
+		}
 
 		return l.emit(itemString), lexInsideAction
 	}
@@ -762,6 +999,10 @@ Loop:
 
 	l.width = 1
 	l.pos += Pos(i) + 1
+	if l.exceeds("raw string", int(l.pos-l.start), l.limits.RawString) {
+		return l.errorf("%s", l.limitErr), nil
+	}
+
 	return l.emit(itemRawString), lexInsideAction
 }
 
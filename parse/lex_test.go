@@ -22,15 +22,17 @@ var itemName = map[itemType]string{
 	itemField:        "field",
 	itemIdentifier:   "identifier",
 	// itemLeftDelim:    "left delim",
-	itemLeftParen:  "(",
-	itemNumber:     "number",
-	itemPipe:       "pipe",
-	itemRawString:  "raw string",
-	itemRightDelim: "right delim",
-	itemRightParen: ")",
-	itemSpace:      "space",
-	itemString:     "string",
-	itemVariable:   "variable",
+	itemLeftBracket:  "[",
+	itemLeftParen:    "(",
+	itemNumber:       "number",
+	itemPipe:         "pipe",
+	itemRawString:    "raw string",
+	itemRightBracket: "]",
+	itemRightDelim:   "right delim",
+	itemRightParen:   ")",
+	itemSpace:        "space",
+	itemString:       "string",
+	itemVariable:     "variable",
 
 	// keywords
 	itemDot:      ".",
@@ -41,9 +43,12 @@ var itemName = map[itemType]string{
 	itemElse:     "else",
 	itemIf:       "if",
 	itemEnd:      "end",
+	itemFor:      "for",
 	itemNil:      "nil",
 	itemRange:    "range",
+	itemReturn:   "return",
 	itemTemplate: "template",
+	itemVars:     "vars",
 	itemWith:     "with",
 }
 
@@ -72,13 +77,15 @@ var (
 	tDot        = mkItem(itemDot, ".")
 	tBlock      = mkItem(itemBlock, "block")
 	tEOF        = mkItem(itemEOF, "")
-	tFor        = mkItem(itemIdentifier, "for")
+	tFor        = mkItem(itemFor, "for")
 	tLeft       = mkItem(itemLeftDelim, "")
+	tLbrk       = mkItem(itemLeftBracket, "[")
 	tLpar       = mkItem(itemLeftParen, "(")
 	tPipe       = mkItem(itemPipe, "|")
 	tQuote      = mkItem(itemString, `"abc \n\t\" "`)
 	tRange      = mkItem(itemRange, "range")
 	tRight      = mkItem(itemRightDelim, "")
+	tRbrk       = mkItem(itemRightBracket, "]")
 	tRpar       = mkItem(itemRightParen, ")")
 	tSpace      = mkItem(itemSpace, " ")
 	raw         = "`" + `abc\n\t\" ` + "`"
@@ -229,6 +236,20 @@ var lexTests = []lexTest{
 		tRight,
 		tEOF,
 	}},
+	{"numeric fields", ".x.1 $.2 $x.3.y", []item{
+		tLeft,
+		mkItem(itemField, ".x"),
+		mkItem(itemField, ".1"),
+		tSpace,
+		mkItem(itemVariable, "$"),
+		mkItem(itemField, ".2"),
+		tSpace,
+		mkItem(itemVariable, "$x"),
+		mkItem(itemField, ".3"),
+		mkItem(itemField, ".y"),
+		tRight,
+		tEOF,
+	}},
 	{"keywords", "range if else end with", []item{
 		tLeft,
 		mkItem(itemRange, "range"),
@@ -274,6 +295,17 @@ var lexTests = []lexTest{
 		tRight,
 		tEOF,
 	}},
+	{"global variables", "$$total = $$x.Field", []item{
+		tLeft,
+		mkItem(itemVariable, "$$total"),
+		tSpace,
+		mkItem(itemAssign, "="),
+		tSpace,
+		mkItem(itemVariable, "$$x"),
+		mkItem(itemField, ".Field"),
+		tRight,
+		tEOF,
+	}},
 	{"pipeline", `echo hi 1.2 |noargs|args 1 "hi"`, []item{
 		tLeft,
 		mkItem(itemIdentifier, "echo"),
@@ -293,6 +325,46 @@ var lexTests = []lexTest{
 		tRight,
 		tEOF,
 	}},
+	{"comparisons", "$x==3 != .Y<=4>=5 < 6>'a' !x", []item{
+		tLeft,
+		mkItem(itemVariable, "$x"),
+		mkItem(itemCompare, "=="),
+		mkItem(itemNumber, "3"),
+		tSpace,
+		mkItem(itemCompare, "!="),
+		tSpace,
+		mkItem(itemField, ".Y"),
+		mkItem(itemCompare, "<="),
+		mkItem(itemNumber, "4"),
+		mkItem(itemCompare, ">="),
+		mkItem(itemNumber, "5"),
+		tSpace,
+		mkItem(itemCompare, "<"),
+		tSpace,
+		mkItem(itemNumber, "6"),
+		mkItem(itemCompare, ">"),
+		mkItem(itemCharConstant, "'a'"),
+		tSpace,
+		mkItem(itemNot, "!"),
+		mkItem(itemIdentifier, "x"),
+		tRight,
+		tEOF,
+	}},
+	{"logical operators", ".A&&!.B || .C|x", []item{
+		tLeft,
+		mkItem(itemField, ".A"),
+		mkItem(itemAnd, "&&"),
+		mkItem(itemNot, "!"),
+		mkItem(itemField, ".B"),
+		tSpace,
+		mkItem(itemOr, "||"),
+		tSpace,
+		mkItem(itemField, ".C"),
+		tPipe,
+		mkItem(itemIdentifier, "x"),
+		tRight,
+		tEOF,
+	}},
 	{"declaration", "$v := 3", []item{
 		tLeft,
 		mkItem(itemVariable, "$v"),
@@ -317,6 +389,26 @@ var lexTests = []lexTest{
 		tRight,
 		tEOF,
 	}},
+	{"index", `.X[0][$y]["k"].Z.[.I]`, []item{
+		tLeft,
+		mkItem(itemField, ".X"),
+		tLbrk,
+		mkItem(itemNumber, "0"),
+		tRbrk,
+		tLbrk,
+		mkItem(itemVariable, "$y"),
+		tRbrk,
+		tLbrk,
+		mkItem(itemString, `"k"`),
+		tRbrk,
+		mkItem(itemField, ".Z"),
+		tDot,
+		tLbrk,
+		mkItem(itemField, ".I"),
+		tRbrk,
+		tRight,
+		tEOF,
+	}},
 	{"field of parenthesized expression", "(.X).Y", []item{
 		tLeft,
 		tLpar,
@@ -370,6 +462,10 @@ var lexTests = []lexTest{
 		tLeft,
 		mkItem(itemError, `bad number syntax: "3k"`),
 	}},
+	{"global variable without name", "$$ 1", []item{
+		tLeft,
+		mkItem(itemError, "missing name of global variable"),
+	}},
 	{"unclosed paren", "(3", []item{
 		tLeft,
 		tLpar,
@@ -386,12 +482,16 @@ var lexTests = []lexTest{
 	// Fixed bugs
 	// Many elements in an action blew the lookahead until
 	// we made lexInsideAction not loop.
-	{"long pipeline deadlock", "|||||", []item{
+	{"long pipeline deadlock", "| | | | |", []item{
 		tLeft,
 		tPipe,
+		tSpace,
 		tPipe,
+		tSpace,
 		tPipe,
+		tSpace,
 		tPipe,
+		tSpace,
 		tPipe,
 		tRight,
 		tEOF,
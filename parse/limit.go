@@ -0,0 +1,41 @@
+package parse
+
+import "fmt"
+
+// Limits bounds the size of single tokens, protecting against pathological
+// input, a zero field means no limit.
+type Limits struct {
+	String    int // bytes of a quoted string or character constant, including quotes.
+	RawString int // bytes of a raw string, including quotes.
+	Comment   int // bytes of a comment, including the leading '#'.
+}
+
+// LimitError is the error returned by Parse when a token exceeds Limits.
+type LimitError struct {
+	Name  string // name of the template being parsed.
+	Line  int    // line of the token.
+	Token string // kind of the token: "string", "raw string" or "comment".
+	Size  int    // size of the token in bytes.
+	Limit int    // the exceeded limit.
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("template: %s:%d: %s of %d bytes exceeds limit of %d bytes", e.Name, e.Line, e.Token, e.Size, e.Limit)
+}
+
+// exceeds reports whether the size of the current token of the kind exceeds
+// limit, in which case the error is recorded for the parser.
+func (l *lexer) exceeds(kind string, size, limit int) bool {
+	if limit <= 0 || size <= limit {
+		return false
+	}
+
+	l.limitErr = &LimitError{
+		Name:  l.name,
+		Line:  l.startLine,
+		Token: kind,
+		Size:  size,
+		Limit: limit,
+	}
+	return true
+}
@@ -73,6 +73,17 @@ const (
 	NodeComment                    // A comment.
 	NodeBreak                      // A break action.
 	NodeContinue                   // A continue action.
+	NodeReturn                     // A return action.
+	NodeComparison                 // A comparison with an infix operator.
+	NodeLogical                    // A logical && or || operation.
+	NodeNot                        // A logical ! operation.
+	NodeFor                        // A for action.
+	NodeIndex                      // An operand indexed by a subscript.
+	NodeTry                        // A try action.
+	nodeCatch                      // A catch action. Not added to tree.
+	NodeSwitch                     // A switch action.
+	NodeCase                       // A case of a switch action.
+	nodeDefault                    // A default action. Not added to tree.
 )
 
 // Nodes.
@@ -217,7 +228,11 @@ func (p *PipeNode) writeTo(sb *strings.Builder) {
 			}
 			v.writeTo(sb)
 		}
-		sb.WriteString(" := ")
+		if p.IsAssign {
+			sb.WriteString(" = ")
+		} else {
+			sb.WriteString(" := ")
+		}
 	}
 	for i, c := range p.Cmds {
 		if i > 0 {
@@ -314,12 +329,21 @@ func (c *CommandNode) writeTo(sb *strings.Builder) {
 		if i > 0 {
 			sb.WriteByte(' ')
 		}
-		if arg, ok := arg.(*PipeNode); ok {
-			sb.WriteByte('(')
-			arg.writeTo(sb)
-			sb.WriteByte(')')
-			continue
-		}
+		writeOperand(sb, arg)
+	}
+}
+
+// writeOperand writes the operand arg of a command.
+func writeOperand(sb *strings.Builder, arg Node) {
+	switch arg := arg.(type) {
+	case *PipeNode:
+		sb.WriteByte('(')
+		arg.writeTo(sb)
+		sb.WriteByte(')')
+	case *TemplateNode:
+		// template invocation as a value, parenthesized by its pipeline
+		arg.writeInvocation(sb)
+	default:
 		arg.writeTo(sb)
 	}
 }
@@ -339,6 +363,122 @@ func (c *CommandNode) Copy() Node {
 	return n
 }
 
+// ComparisonNode holds a comparison of two commands with an infix operator,
+// such as `len .Items > 3`. It is the only argument of its CommandNode, a
+// value piped to the command is the final argument of Left.
+type ComparisonNode struct {
+	NodeType
+	Pos
+	tr       *Tree
+	Operator string       // One of "==", "!=", "<", "<=", ">" or ">=".
+	Left     *CommandNode // The left operand.
+	Right    *CommandNode // The right operand.
+}
+
+func (t *Tree) newComparison(pos Pos, operator string, left, right *CommandNode) *ComparisonNode {
+	return &ComparisonNode{tr: t, NodeType: NodeComparison, Pos: pos, Operator: operator, Left: left, Right: right}
+}
+
+func (c *ComparisonNode) String() string {
+	var sb strings.Builder
+	c.writeTo(&sb)
+	return sb.String()
+}
+
+func (c *ComparisonNode) writeTo(sb *strings.Builder) {
+	c.Left.writeTo(sb)
+	sb.WriteByte(' ')
+	sb.WriteString(c.Operator)
+	sb.WriteByte(' ')
+	c.Right.writeTo(sb)
+}
+
+func (c *ComparisonNode) tree() *Tree {
+	return c.tr
+}
+
+func (c *ComparisonNode) Copy() Node {
+	return c.tr.newComparison(c.Pos, c.Operator, c.Left.Copy().(*CommandNode), c.Right.Copy().(*CommandNode))
+}
+
+// LogicalNode holds a short-circuit logical operation of two commands, like
+// `.A && .B`. It is the only argument of its CommandNode, a value piped to
+// the command is the final argument of Left.
+type LogicalNode struct {
+	NodeType
+	Pos
+	tr       *Tree
+	Operator string       // "&&" or "||".
+	Left     *CommandNode // The left operand.
+	Right    *CommandNode // The right operand.
+}
+
+func (t *Tree) newLogical(pos Pos, operator string, left, right *CommandNode) *LogicalNode {
+	return &LogicalNode{tr: t, NodeType: NodeLogical, Pos: pos, Operator: operator, Left: left, Right: right}
+}
+
+func (l *LogicalNode) String() string {
+	var sb strings.Builder
+	l.writeTo(&sb)
+	return sb.String()
+}
+
+func (l *LogicalNode) writeTo(sb *strings.Builder) {
+	l.Left.writeTo(sb)
+	sb.WriteByte(' ')
+	sb.WriteString(l.Operator)
+	sb.WriteByte(' ')
+	l.Right.writeTo(sb)
+}
+
+func (l *LogicalNode) tree() *Tree {
+	return l.tr
+}
+
+func (l *LogicalNode) Copy() Node {
+	return l.tr.newLogical(l.Pos, l.Operator, l.Left.Copy().(*CommandNode), l.Right.Copy().(*CommandNode))
+}
+
+// NotNode holds the logical negation of an operand, like `!.A`.
+type NotNode struct {
+	NodeType
+	Pos
+	tr      *Tree
+	Operand Node // The negated operand.
+}
+
+func (t *Tree) newNot(pos Pos, operand Node) *NotNode {
+	return &NotNode{tr: t, NodeType: NodeNot, Pos: pos, Operand: operand}
+}
+
+func (n *NotNode) String() string {
+	var sb strings.Builder
+	n.writeTo(&sb)
+	return sb.String()
+}
+
+func (n *NotNode) writeTo(sb *strings.Builder) {
+	sb.WriteByte('!')
+	switch arg := n.Operand.(type) {
+	case *PipeNode:
+		sb.WriteByte('(')
+		arg.writeTo(sb)
+		sb.WriteByte(')')
+	case *TemplateNode:
+		arg.writeInvocation(sb)
+	default:
+		arg.writeTo(sb)
+	}
+}
+
+func (n *NotNode) tree() *Tree {
+	return n.tr
+}
+
+func (n *NotNode) Copy() Node {
+	return n.tr.newNot(n.Pos, n.Operand.Copy())
+}
+
 // IdentifierNode holds an identifier.
 type IdentifierNode struct {
 	NodeType
@@ -393,6 +533,12 @@ type VariableNode struct {
 	Ident []string // Variable name and fields in lexical order.
 }
 
+// IsGlobalVar reports whether the variable name (e.g. "$$x") names a global
+// variable, which is shared by all templates in an execution.
+func IsGlobalVar(name string) bool {
+	return strings.HasPrefix(name, "$$")
+}
+
 func (t *Tree) newVariable(pos Pos, ident string) *VariableNode {
 	return &VariableNode{tr: t, NodeType: NodeVariable, Pos: pos, Ident: strings.Split(ident, ".")}
 }
@@ -578,6 +724,47 @@ func (c *ChainNode) Copy() Node {
 	return &ChainNode{tr: c.tr, NodeType: NodeChain, Pos: c.Pos, Node: c.Node, Field: append([]string{}, c.Field...)}
 }
 
+// IndexNode holds an operand indexed by a subscript, like `.Items[0]` or
+// `$labels["app"]`.
+type IndexNode struct {
+	NodeType
+	Pos
+	tr    *Tree
+	Node  Node      // The indexed operand.
+	Index *PipeNode // The subscript inside the brackets.
+}
+
+func (t *Tree) newIndex(pos Pos, node Node, index *PipeNode) *IndexNode {
+	return &IndexNode{tr: t, NodeType: NodeIndex, Pos: pos, Node: node, Index: index}
+}
+
+func (i *IndexNode) String() string {
+	var sb strings.Builder
+	i.writeTo(&sb)
+	return sb.String()
+}
+
+func (i *IndexNode) writeTo(sb *strings.Builder) {
+	if _, ok := i.Node.(*PipeNode); ok {
+		sb.WriteByte('(')
+		i.Node.writeTo(sb)
+		sb.WriteByte(')')
+	} else {
+		i.Node.writeTo(sb)
+	}
+	sb.WriteByte('[')
+	i.Index.writeTo(sb)
+	sb.WriteByte(']')
+}
+
+func (i *IndexNode) tree() *Tree {
+	return i.tr
+}
+
+func (i *IndexNode) Copy() Node {
+	return i.tr.newIndex(i.Pos, i.Node.Copy(), i.Index.CopyPipe())
+}
+
 // BoolNode holds a boolean constant.
 type BoolNode struct {
 	NodeType
@@ -810,7 +997,8 @@ type elseNode struct {
 	NodeType
 	Pos
 	tr   *Tree
-	Line int // The line number in the input. Deprecated: Kept for compatibility.
+	Line int  // The line number in the input. Deprecated: Kept for compatibility.
+	v    item // The variable of {{else $var}}, if any.
 }
 
 func (t *Tree) newElse(pos Pos, line int) *elseNode {
@@ -837,6 +1025,62 @@ func (e *elseNode) Copy() Node {
 	return e.tr.newElse(e.Pos, e.Line)
 }
 
+// catchNode represents a {{catch}} action. Does not appear in the final tree.
+type catchNode struct {
+	NodeType
+	Pos
+	tr *Tree
+	v  item // The variable of {{catch $var}}, if any.
+}
+
+func (t *Tree) newCatch(pos Pos) *catchNode {
+	return &catchNode{tr: t, NodeType: nodeCatch, Pos: pos}
+}
+
+func (c *catchNode) String() string {
+	return "{{catch}}"
+}
+
+func (c *catchNode) writeTo(sb *strings.Builder) {
+	sb.WriteString(c.String())
+}
+
+func (c *catchNode) tree() *Tree {
+	return c.tr
+}
+
+func (c *catchNode) Copy() Node {
+	return c.tr.newCatch(c.Pos)
+}
+
+// defaultNode represents a {{default}} action. Does not appear in the final
+// tree.
+type defaultNode struct {
+	NodeType
+	Pos
+	tr *Tree
+}
+
+func (t *Tree) newDefault(pos Pos) *defaultNode {
+	return &defaultNode{tr: t, NodeType: nodeDefault, Pos: pos}
+}
+
+func (d *defaultNode) String() string {
+	return "{{default}}"
+}
+
+func (d *defaultNode) writeTo(sb *strings.Builder) {
+	sb.WriteString(d.String())
+}
+
+func (d *defaultNode) tree() *Tree {
+	return d.tr
+}
+
+func (d *defaultNode) Copy() Node {
+	return d.tr.newDefault(d.Pos)
+}
+
 // BranchNode is the common representation of if, range, and with.
 type BranchNode struct {
 	NodeType
@@ -914,14 +1158,15 @@ type BreakNode struct {
 	tr *Tree
 	NodeType
 	Pos
-	Line int
+	Line     int
+	LoopLine int // The line of the enclosing {{range}} or {{for}}.
 }
 
-func (t *Tree) newBreak(pos Pos, line int) *BreakNode {
-	return &BreakNode{tr: t, NodeType: NodeBreak, Pos: pos, Line: line}
+func (t *Tree) newBreak(pos Pos, line, loopLine int) *BreakNode {
+	return &BreakNode{tr: t, NodeType: NodeBreak, Pos: pos, Line: line, LoopLine: loopLine}
 }
 
-func (b *BreakNode) Copy() Node                  { return b.tr.newBreak(b.Pos, b.Line) }
+func (b *BreakNode) Copy() Node                  { return b.tr.newBreak(b.Pos, b.Line, b.LoopLine) }
 func (b *BreakNode) String() string              { return "{{break}}" }
 func (b *BreakNode) tree() *Tree                 { return b.tr }
 func (b *BreakNode) writeTo(sb *strings.Builder) { sb.WriteString("{{break}}") }
@@ -931,29 +1176,304 @@ type ContinueNode struct {
 	tr *Tree
 	NodeType
 	Pos
-	Line int
+	Line     int
+	LoopLine int // The line of the enclosing {{range}} or {{for}}.
 }
 
-func (t *Tree) newContinue(pos Pos, line int) *ContinueNode {
-	return &ContinueNode{tr: t, NodeType: NodeContinue, Pos: pos, Line: line}
+func (t *Tree) newContinue(pos Pos, line, loopLine int) *ContinueNode {
+	return &ContinueNode{tr: t, NodeType: NodeContinue, Pos: pos, Line: line, LoopLine: loopLine}
 }
 
-func (c *ContinueNode) Copy() Node                  { return c.tr.newContinue(c.Pos, c.Line) }
+func (c *ContinueNode) Copy() Node                  { return c.tr.newContinue(c.Pos, c.Line, c.LoopLine) }
 func (c *ContinueNode) String() string              { return "{{continue}}" }
 func (c *ContinueNode) tree() *Tree                 { return c.tr }
 func (c *ContinueNode) writeTo(sb *strings.Builder) { sb.WriteString("{{continue}}") }
 
+// ReturnNode represents a {{return}} action.
+type ReturnNode struct {
+	tr *Tree
+	NodeType
+	Pos
+	Line int
+	Pipe *PipeNode // The value to return (nil if absent).
+}
+
+func (t *Tree) newReturn(pos Pos, line int, pipe *PipeNode) *ReturnNode {
+	return &ReturnNode{tr: t, NodeType: NodeReturn, Pos: pos, Line: line, Pipe: pipe}
+}
+
+func (r *ReturnNode) String() string {
+	var sb strings.Builder
+	r.writeTo(&sb)
+	return sb.String()
+}
+
+func (r *ReturnNode) writeTo(sb *strings.Builder) {
+	sb.WriteString("{{return")
+	if r.Pipe != nil {
+		sb.WriteByte(' ')
+		r.Pipe.writeTo(sb)
+	}
+	sb.WriteString("}}")
+}
+
+func (r *ReturnNode) tree() *Tree {
+	return r.tr
+}
+
+func (r *ReturnNode) Copy() Node {
+	return r.tr.newReturn(r.Pos, r.Line, r.Pipe.CopyPipe())
+}
+
 // RangeNode represents a {{range}} action and its commands.
 type RangeNode struct {
 	BranchNode
+	Sorted  bool           // Elements are iterated in sorted order.
+	SortBy  *PipeNode      // Sort key evaluated with each element as dot (nil if absent).
+	ElseVar *VariableNode  // Variable bound to the reason the else branch runs (nil if absent).
+	Stages  []*CommandNode // Stages applied to elements lazily, like "filter .Enabled".
 }
 
 func (t *Tree) newRange(pos Pos, line int, pipe *PipeNode, list, elseList *ListNode) *RangeNode {
-	return &RangeNode{BranchNode{tr: t, NodeType: NodeRange, Pos: pos, Line: line, Pipe: pipe, List: list, ElseList: elseList}}
+	return &RangeNode{BranchNode: BranchNode{tr: t, NodeType: NodeRange, Pos: pos, Line: line, Pipe: pipe, List: list, ElseList: elseList}}
+}
+
+func (r *RangeNode) String() string {
+	var sb strings.Builder
+	r.writeTo(&sb)
+	return sb.String()
+}
+
+func (r *RangeNode) writeTo(sb *strings.Builder) {
+	if !r.Sorted && r.ElseVar == nil && len(r.Stages) == 0 {
+		r.BranchNode.writeTo(sb)
+		return
+	}
+
+	sb.WriteString("{{range ")
+	if r.Sorted {
+		sb.WriteString("sorted ")
+	}
+	r.Pipe.writeTo(sb)
+	for _, stage := range r.Stages {
+		sb.WriteString(" | ")
+		stage.writeTo(sb)
+	}
+	if r.SortBy != nil {
+		sb.WriteString(" by ")
+		r.SortBy.writeTo(sb)
+	}
+	sb.WriteString("}}")
+	r.List.writeTo(sb)
+	if r.ElseList != nil {
+		sb.WriteString("{{else")
+		if r.ElseVar != nil {
+			sb.WriteByte(' ')
+			r.ElseVar.writeTo(sb)
+		}
+		sb.WriteString("}}")
+		r.ElseList.writeTo(sb)
+	}
+	sb.WriteString("{{end}}")
 }
 
 func (r *RangeNode) Copy() Node {
-	return r.tr.newRange(r.Pos, r.Line, r.Pipe.CopyPipe(), r.List.CopyList(), r.ElseList.CopyList())
+	n := r.tr.newRange(r.Pos, r.Line, r.Pipe.CopyPipe(), r.List.CopyList(), r.ElseList.CopyList())
+	n.Sorted = r.Sorted
+	n.SortBy = r.SortBy.CopyPipe()
+	if r.ElseVar != nil {
+		n.ElseVar = r.ElseVar.Copy().(*VariableNode)
+	}
+	for _, stage := range r.Stages {
+		n.Stages = append(n.Stages, stage.Copy().(*CommandNode))
+	}
+	return n
+}
+
+// ForNode represents a {{for init; condition; post}} action.
+type ForNode struct {
+	tr *Tree
+	NodeType
+	Pos
+	Line int
+	Init *PipeNode // Evaluated once before the loop, declaring or assigning variables (nil if absent).
+	Cond *PipeNode // Evaluated before every iteration, the loop ends when it's false (nil if absent).
+	Post *PipeNode // Evaluated after every iteration, declaring or assigning variables (nil if absent).
+	List *ListNode // What to execute for every iteration.
+}
+
+func (t *Tree) newFor(pos Pos, line int, init, cond, post *PipeNode, list *ListNode) *ForNode {
+	return &ForNode{tr: t, NodeType: NodeFor, Pos: pos, Line: line, Init: init, Cond: cond, Post: post, List: list}
+}
+
+func (f *ForNode) String() string {
+	var sb strings.Builder
+	f.writeTo(&sb)
+	return sb.String()
+}
+
+func (f *ForNode) writeTo(sb *strings.Builder) {
+	sb.WriteString("{{for")
+	for i, p := range []*PipeNode{f.Init, f.Cond, f.Post} {
+		if i > 0 {
+			sb.WriteString(";")
+		}
+		if p != nil {
+			sb.WriteByte(' ')
+			p.writeTo(sb)
+		}
+	}
+	sb.WriteString("}}")
+	f.List.writeTo(sb)
+	sb.WriteString("{{end}}")
+}
+
+func (f *ForNode) tree() *Tree {
+	return f.tr
+}
+
+func (f *ForNode) Copy() Node {
+	return f.tr.newFor(f.Pos, f.Line, f.Init.CopyPipe(), f.Cond.CopyPipe(), f.Post.CopyPipe(), f.List.CopyList())
+}
+
+// TryNode represents a {{try}} action, errors of executing List are caught
+// and Catch is executed instead.
+type TryNode struct {
+	tr *Tree
+	NodeType
+	Pos
+	Line   int
+	List   *ListNode     // What to execute.
+	ErrVar *VariableNode // Variable bound to the caught error (nil if absent).
+	Catch  *ListNode     // What to execute if List fails (nil if absent).
+}
+
+func (t *Tree) newTry(pos Pos, line int, list *ListNode, errVar *VariableNode, catch *ListNode) *TryNode {
+	return &TryNode{tr: t, NodeType: NodeTry, Pos: pos, Line: line, List: list, ErrVar: errVar, Catch: catch}
+}
+
+func (t *TryNode) String() string {
+	var sb strings.Builder
+	t.writeTo(&sb)
+	return sb.String()
+}
+
+func (t *TryNode) writeTo(sb *strings.Builder) {
+	sb.WriteString("{{try}}")
+	t.List.writeTo(sb)
+	if t.Catch != nil {
+		sb.WriteString("{{catch")
+		if t.ErrVar != nil {
+			sb.WriteByte(' ')
+			t.ErrVar.writeTo(sb)
+		}
+		sb.WriteString("}}")
+		t.Catch.writeTo(sb)
+	}
+	sb.WriteString("{{end}}")
+}
+
+func (t *TryNode) tree() *Tree {
+	return t.tr
+}
+
+func (t *TryNode) Copy() Node {
+	n := t.tr.newTry(t.Pos, t.Line, t.List.CopyList(), nil, t.Catch.CopyList())
+	if t.ErrVar != nil {
+		n.ErrVar = t.ErrVar.Copy().(*VariableNode)
+	}
+	return n
+}
+
+// SwitchNode represents a {{switch}} action, the list of the first case
+// matching its value is executed, or else Default.
+type SwitchNode struct {
+	tr *Tree
+	NodeType
+	Pos
+	Line    int
+	Pipe    *PipeNode   // The value compared with cases (nil if absent, cases are then conditions).
+	Cases   []*CaseNode // The cases in order.
+	Default *ListNode   // What to execute if no case matches (nil if absent).
+}
+
+func (t *Tree) newSwitch(pos Pos, line int, pipe *PipeNode) *SwitchNode {
+	return &SwitchNode{tr: t, NodeType: NodeSwitch, Pos: pos, Line: line, Pipe: pipe}
+}
+
+func (s *SwitchNode) String() string {
+	var sb strings.Builder
+	s.writeTo(&sb)
+	return sb.String()
+}
+
+func (s *SwitchNode) writeTo(sb *strings.Builder) {
+	sb.WriteString("{{switch")
+	if s.Pipe != nil {
+		sb.WriteByte(' ')
+		s.Pipe.writeTo(sb)
+	}
+	sb.WriteString("}}")
+	for _, c := range s.Cases {
+		c.writeTo(sb)
+	}
+	if s.Default != nil {
+		sb.WriteString("{{default}}")
+		s.Default.writeTo(sb)
+	}
+	sb.WriteString("{{end}}")
+}
+
+func (s *SwitchNode) tree() *Tree {
+	return s.tr
+}
+
+func (s *SwitchNode) Copy() Node {
+	n := s.tr.newSwitch(s.Pos, s.Line, s.Pipe.CopyPipe())
+	for _, c := range s.Cases {
+		n.Cases = append(n.Cases, c.Copy().(*CaseNode))
+	}
+	n.Default = s.Default.CopyList()
+	return n
+}
+
+// CaseNode represents a {{case}} of a switch action.
+type CaseNode struct {
+	tr *Tree
+	NodeType
+	Pos
+	Line int
+	Pipe *PipeNode // The value or the condition of the case.
+	List *ListNode // What to execute if the case matches.
+}
+
+func (t *Tree) newCase(pos Pos, line int, pipe *PipeNode) *CaseNode {
+	return &CaseNode{tr: t, NodeType: NodeCase, Pos: pos, Line: line, Pipe: pipe}
+}
+
+func (c *CaseNode) String() string {
+	var sb strings.Builder
+	c.writeTo(&sb)
+	return sb.String()
+}
+
+func (c *CaseNode) writeTo(sb *strings.Builder) {
+	sb.WriteString("{{case ")
+	c.Pipe.writeTo(sb)
+	sb.WriteString("}}")
+	if c.List != nil {
+		c.List.writeTo(sb)
+	}
+}
+
+func (c *CaseNode) tree() *Tree {
+	return c.tr
+}
+
+func (c *CaseNode) Copy() Node {
+	n := c.tr.newCase(c.Pos, c.Line, c.Pipe.CopyPipe())
+	n.List = c.List.CopyList()
+	return n
 }
 
 // WithNode represents a {{with}} action and its commands.
@@ -977,12 +1497,32 @@ type TemplateNode struct {
 	Line int       // The line number in the input. Deprecated: Kept for compatibility.
 	Name string    // The name of the template (unquoted).
 	Pipe *PipeNode // The command to evaluate as dot for the template.
+
+	// Recurse is true for {{recurse pipeline}}, invoking the template it
+	// is in, which is Name.
+	Recurse bool
+
+	// Named are the named arguments of {{template "name" a=1 b=2}}, bound
+	// to parameters of the template by name, Pipe is nil if present.
+	Named []NamedArg
+}
+
+// NamedArg is a named argument of a template invocation, name=value.
+type NamedArg struct {
+	Name  string // name of the parameter without dollar sign.
+	Value Node   // operand giving the value.
 }
 
 func (t *Tree) newTemplate(pos Pos, line int, name string, pipe *PipeNode) *TemplateNode {
 	return &TemplateNode{tr: t, NodeType: NodeTemplate, Pos: pos, Line: line, Name: name, Pipe: pipe}
 }
 
+func (t *Tree) newRecurse(pos Pos, line int, pipe *PipeNode) *TemplateNode {
+	n := t.newTemplate(pos, line, t.Name, pipe)
+	n.Recurse = true
+	return n
+}
+
 func (t *TemplateNode) String() string {
 	var sb strings.Builder
 	t.writeTo(&sb)
@@ -990,13 +1530,29 @@ func (t *TemplateNode) String() string {
 }
 
 func (t *TemplateNode) writeTo(sb *strings.Builder) {
-	sb.WriteString("{{template ")
+	sb.WriteString("{{")
+	t.writeInvocation(sb)
+	sb.WriteString("}}")
+}
+
+func (t *TemplateNode) writeInvocation(sb *strings.Builder) {
+	if t.Recurse {
+		sb.WriteString("recurse ")
+		t.Pipe.writeTo(sb)
+		return
+	}
+	sb.WriteString("template ")
 	sb.WriteString(strconv.Quote(t.Name))
 	if t.Pipe != nil {
 		sb.WriteByte(' ')
 		t.Pipe.writeTo(sb)
 	}
-	sb.WriteString("}}")
+	for _, arg := range t.Named {
+		sb.WriteByte(' ')
+		sb.WriteString(arg.Name)
+		sb.WriteByte('=')
+		writeOperand(sb, arg.Value)
+	}
 }
 
 func (t *TemplateNode) tree() *Tree {
@@ -1004,5 +1560,10 @@ func (t *TemplateNode) tree() *Tree {
 }
 
 func (t *TemplateNode) Copy() Node {
-	return t.tr.newTemplate(t.Pos, t.Line, t.Name, t.Pipe.CopyPipe())
+	n := t.tr.newTemplate(t.Pos, t.Line, t.Name, t.Pipe.CopyPipe())
+	n.Recurse = t.Recurse
+	for _, arg := range t.Named {
+		n.Named = append(n.Named, NamedArg{arg.Name, arg.Value.Copy()})
+	}
+	return n
 }
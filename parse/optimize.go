@@ -0,0 +1,377 @@
+package parse
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Optimize simplifies the tree in place without changing its output, and
+// returns the number of nodes removed:
+//
+//   - operators and parenthesized pipelines with literal operands are
+//     folded, e.g. (1 < 2 && "a") becomes "a" and !(true) becomes false,
+//     except !, && and || in CustomTruth mode,
+//   - adjacent actions printing string literals are merged into one,
+//   - empty actions, like the ones between ";;", and actions printing empty
+//     strings are removed.
+//
+// Function calls are never folded, since functions are not known to be pure.
+// Merged actions keep the position of the first one.
+func (t *Tree) Optimize() (removed int) {
+	if t.Root == nil {
+		return 0
+	}
+
+	before := countNodes(t.Root)
+
+	Inspect(t.Root, func(n Node) bool {
+		if pipe, ok := n.(*PipeNode); ok {
+			t.foldPipe(pipe)
+			return false
+		}
+		return true
+	})
+
+	Inspect(t.Root, func(n Node) bool {
+		if list, ok := n.(*ListNode); ok {
+			list.Nodes = t.mergeOutputs(list.Nodes)
+		}
+		return true
+	})
+
+	return before - countNodes(t.Root)
+}
+
+func countNodes(root Node) (n int) {
+	Inspect(root, func(Node) bool {
+		n++
+		return true
+	})
+	return
+}
+
+func (t *Tree) foldPipe(pipe *PipeNode) {
+	for i, cmd := range pipe.Cmds {
+		t.foldCommand(cmd, i > 0)
+	}
+}
+
+// foldCommand folds the arguments of cmd, piped reports whether cmd receives
+// the value of the previous command of its pipeline.
+func (t *Tree) foldCommand(cmd *CommandNode, piped bool) {
+	for i, arg := range cmd.Args {
+		cmd.Args[i] = t.foldArg(arg)
+	}
+
+	if len(cmd.Args) != 1 {
+		return
+	}
+
+	switch n := cmd.Args[0].(type) {
+	case *ComparisonNode:
+		t.foldCommand(n.Left, piped)
+		t.foldCommand(n.Right, false)
+		if piped {
+			// the piped value is passed to the left operand
+			return
+		}
+
+		if ret, ok := compareLiterals(n.Operator, soleLiteral(n.Left), soleLiteral(n.Right)); ok {
+			cmd.Args[0] = t.newBool(n.Pos, ret)
+		}
+	case *LogicalNode:
+		t.foldCommand(n.Left, piped)
+		t.foldCommand(n.Right, false)
+		if piped {
+			return
+		}
+
+		left := soleLiteral(n.Left)
+		truth, ok := t.literalTruth(left)
+		switch {
+		case !ok:
+		case truth == (n.Operator == "||"):
+			// a sole nil is only valid as an operand
+			if _, isNil := left.(*NilNode); !isNil {
+				cmd.Args = n.Left.Args
+			}
+		default:
+			if _, isNil := soleLiteral(n.Right).(*NilNode); !isNil {
+				cmd.Args = n.Right.Args
+			}
+		}
+	}
+}
+
+// foldArg returns the folded form of the argument n.
+func (t *Tree) foldArg(n Node) Node {
+	switch n := n.(type) {
+	case *PipeNode:
+		t.foldPipe(n)
+		if len(n.Decl) != 0 || len(n.Cmds) != 1 {
+			return n
+		}
+
+		switch arg := soleLiteral(n.Cmds[0]).(type) {
+		case *BoolNode, *NumberNode, *StringNode:
+			return arg
+		}
+	case *ChainNode:
+		n.Node = t.foldArg(n.Node)
+	case *IndexNode:
+		n.Node = t.foldArg(n.Node)
+		t.foldPipe(n.Index)
+	case *NotNode:
+		n.Operand = t.foldArg(n.Operand)
+		if truth, ok := t.literalTruth(n.Operand); ok {
+			return t.newBool(n.Pos, !truth)
+		}
+	}
+
+	return n
+}
+
+// soleLiteral returns the sole argument of cmd if it is a literal, or nil.
+func soleLiteral(cmd *CommandNode) Node {
+	if len(cmd.Args) != 1 {
+		return nil
+	}
+
+	switch arg := cmd.Args[0].(type) {
+	case *BoolNode, *NilNode, *NumberNode, *StringNode:
+		return arg
+	}
+	return nil
+}
+
+// literalTruth returns the truth of the literal n like the truth of its value
+// in execution, ok is false if n is not a literal with a known value or the
+// truth is decided otherwise in CustomTruth mode.
+func (t *Tree) literalTruth(n Node) (truth, ok bool) {
+	if t.Mode&CustomTruth != 0 {
+		return false, false
+	}
+
+	switch n := n.(type) {
+	case *BoolNode:
+		return n.True, true
+	case *NilNode:
+		return false, true
+	case *StringNode:
+		return len(n.Text) != 0, true
+	case *NumberNode:
+		if n.IsComplex {
+			return n.Complex128 != 0, true
+		}
+		if f, i, isFloat, ok := numberValue(n); ok {
+			if isFloat {
+				return f != 0, true
+			}
+			return i != 0, true
+		}
+	}
+	return false, false
+}
+
+// numberValue returns the value of n as evaluated without a known type, which
+// is a float64 or an int, ok is false for complex numbers and overflows.
+func numberValue(n *NumberNode) (f float64, i int64, isFloat, ok bool) {
+	switch {
+	case n.IsComplex:
+	case n.IsFloat && !isHexInt(n.Text) && n.Text[0] != '\'' &&
+		strings.ContainsAny(n.Text, ".eEpP"):
+		return n.Float64, 0, true, true
+	case n.IsInt:
+		return 0, n.Int64, false, int64(int(n.Int64)) == n.Int64
+	}
+	return 0, 0, false, false
+}
+
+func isHexInt(s string) bool {
+	return len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') && !strings.ContainsAny(s, "pP")
+}
+
+// compareLiterals compares literals x and y with operator op, ok is false if
+// they can't be compared before execution.
+func compareLiterals(op string, x, y Node) (ret, ok bool) {
+	var c int
+	switch x := x.(type) {
+	case *BoolNode:
+		y, isBool := y.(*BoolNode)
+		if !isBool || (op != "==" && op != "!=") {
+			return false, false
+		}
+		return (x.True == y.True) == (op == "=="), true
+	case *StringNode:
+		y, isString := y.(*StringNode)
+		if !isString {
+			return false, false
+		}
+		c = strings.Compare(x.Text, y.Text)
+	case *NumberNode:
+		y, isNumber := y.(*NumberNode)
+		if !isNumber {
+			return false, false
+		}
+		xf, xi, xFloat, xok := numberValue(x)
+		yf, yi, yFloat, yok := numberValue(y)
+		switch {
+		case !xok || !yok || xFloat != yFloat:
+			return false, false
+		case xFloat:
+			c = compareOrdered(xf, yf)
+		default:
+			c = compareOrdered(xi, yi)
+		}
+	default:
+		return false, false
+	}
+
+	switch op {
+	case "==":
+		return c == 0, true
+	case "!=":
+		return c != 0, true
+	case "<":
+		return c < 0, true
+	case "<=":
+		return c <= 0, true
+	case ">":
+		return c > 0, true
+	case ">=":
+		return c >= 0, true
+	}
+	return false, false
+}
+
+func compareOrdered[T int64 | float64](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// mergeOutputs merges adjacent actions printing string literals in nodes,
+// and removes the ones printing nothing.
+func (t *Tree) mergeOutputs(nodes []Node) []Node {
+	ret := nodes[:0]
+	for _, n := range nodes {
+		action, ok := n.(*ActionNode)
+		if !ok || len(action.Pipe.Decl) != 0 {
+			ret = append(ret, n)
+			continue
+		}
+
+		if len(action.Pipe.Cmds) == 0 {
+			continue
+		}
+
+		str, ok := soleLiteral(action.Pipe.Cmds[0]).(*StringNode)
+		if !ok || len(action.Pipe.Cmds) != 1 {
+			ret = append(ret, n)
+			continue
+		}
+
+		if str.Text == "" {
+			continue
+		}
+
+		if len(ret) != 0 {
+			if prev, ok := ret[len(ret)-1].(*ActionNode); ok && len(prev.Pipe.Decl) == 0 && len(prev.Pipe.Cmds) == 1 {
+				if s, ok := soleLiteral(prev.Pipe.Cmds[0]).(*StringNode); ok {
+					text := s.Text + str.Text
+					prev.Pipe.Cmds[0].Args[0] = t.newString(s.Pos, strconv.Quote(text), text)
+					continue
+				}
+			}
+		}
+
+		ret = append(ret, n)
+	}
+
+	// clear removed nodes
+	for i := len(ret); i < len(nodes); i++ {
+		nodes[i] = nil
+	}
+
+	return ret
+}
+
+// Inline replaces invocations of the template defined by callee in the tree,
+// {{template "name"}} and {{template "name" .}}, with copies of the body of
+// callee, and returns the number of invocations replaced. Copies are wrapped
+// in {{if true}}, so that variables declared by them stay local.
+//
+// Only templates without parameters, invoking no template, without
+// {{return}} and not referring to $ are inlined, since their dot is the one
+// of the caller. Bodies of templates invoked without a pipeline must not
+// refer to dot either.
+func (t *Tree) Inline(callee *Tree) (inlined int) {
+	if t.Root == nil || callee.Root == nil || callee.Name == t.Name {
+		return 0
+	}
+
+	usesDot, ok := inlinable(callee.Root)
+	if !ok || len(callee.Params) != 0 {
+		return 0
+	}
+
+	Inspect(t.Root, func(n Node) bool {
+		list, ok := n.(*ListNode)
+		if !ok {
+			return true
+		}
+
+		for i, c := range list.Nodes {
+			call, ok := c.(*TemplateNode)
+			if !ok || call.Recurse || call.Name != callee.Name || len(call.Named) != 0 {
+				continue
+			}
+
+			switch {
+			case call.Pipe == nil:
+				if usesDot {
+					continue
+				}
+			case len(call.Pipe.Decl) != 0 || len(call.Pipe.Cmds) != 1 || len(call.Pipe.Cmds[0].Args) != 1:
+				continue
+			default:
+				if _, isDot := call.Pipe.Cmds[0].Args[0].(*DotNode); !isDot {
+					continue
+				}
+			}
+
+			cond := t.newPipeline(call.Pos, call.Line, nil)
+			cond.append(t.newCommand(call.Pos))
+			cond.Cmds[0].append(t.newBool(call.Pos, true))
+			list.Nodes[i] = t.newIf(call.Pos, call.Line, cond, callee.Root.CopyList(), nil)
+			inlined++
+		}
+		return true
+	})
+
+	return inlined
+}
+
+// inlinable reports whether the body root can be inlined, and whether it
+// refers to dot.
+func inlinable(root *ListNode) (usesDot, ok bool) {
+	ok = true
+	Inspect(root, func(n Node) bool {
+		switch n := n.(type) {
+		case *TemplateNode, *ReturnNode:
+			ok = false
+		case *VariableNode:
+			if n.Ident[0] == "$" {
+				ok = false
+			}
+		case *DotNode, *FieldNode:
+			usesDot = true
+		}
+		return ok
+	})
+	return
+}
@@ -0,0 +1,158 @@
+package parse
+
+import (
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string // tree after optimization
+		removed  int
+	}{
+		{
+			"EmptyActions",
+			`"a";;;"b"; ""; $x := ""; $x`,
+			`{{"ab"}}{{$x := ""}}{{$x}}`,
+			12,
+		},
+		{
+			"MergeAcrossLines",
+			"`a`\n\"b\"\nprintf\n\"c\"\n# comment\n\"d\"",
+			`{{"ab"}}{{printf}}{{"cd"}}`,
+			8,
+		},
+		{
+			"NestedLists",
+			`if .; "a"; "b"; else; "c";; end; range .; "d"; "e"; end`,
+			`{{if .}}{{"ab"}}{{else}}{{"c"}}{{end}}{{range .}}{{"de"}}{{end}}`,
+			10,
+		},
+		{
+			"Comparisons",
+			`1 < 2; "a" >= "b"; 1.5 == 1.50; true != false; 1 < 1.5; true < false; nil == nil; . == 1`,
+			`{{true}}{{false}}{{true}}{{true}}{{1 < 1.5}}{{true < false}}{{nil == nil}}{{. == 1}}`,
+			16,
+		},
+		{
+			"Logical",
+			`1 < 2 && "a"; 0 || .X; "" && .X; !true; !(1 > 2); true && nil; nil && .X; .X || 1`,
+			`{{"a"}}{{.X}}{{false}}{{true}}{{true && nil}}{{nil && .X}}{{.X || 1}}`,
+			28,
+		},
+		{
+			"Piped",
+			`. | printf "%v" == 1; . | 1 < 2 && printf`,
+			`{{. | printf "%v" == 1}}{{. | 1 < 2 && printf}}`,
+			0,
+		},
+		{
+			"Parentheses",
+			`printf "%v %v" (1) ("a" | printf) (.X); if (1 == 1); end; with $x := (3); end`,
+			`{{printf "%v %v" 1 ("a" | printf) (.X)}}{{if true}}{{end}}{{with $x := 3}}{{end}}`,
+			10,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree, err := New("test", nil).Parse(test.input, make(map[string]*Tree), builtins)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			removed := tree.Optimize()
+			if got := tree.Root.String(); got != test.expected {
+				t.Errorf("got\n\t%s\nexpected\n\t%s", got, test.expected)
+			}
+			if removed != test.removed {
+				t.Errorf("removed %d nodes, expected %d", removed, test.removed)
+			}
+		})
+	}
+
+	t.Run("CustomTruth", func(t *testing.T) {
+		tree := New("test", nil)
+		tree.Mode = CustomTruth
+		if _, err := tree.Parse(`1 < 2 && "a"; !(1 > 2); "" || .X`, make(map[string]*Tree), builtins); err != nil {
+			t.Fatal(err)
+		}
+
+		tree.Optimize()
+		const expected = `{{true && "a"}}{{!false}}{{"" || .X}}`
+		if got := tree.Root.String(); got != expected {
+			t.Errorf("got\n\t%s\nexpected\n\t%s", got, expected)
+		}
+	})
+}
+
+func TestInline(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string // tree after inlining "x"
+		inlined  int
+	}{
+		{
+			"Dot",
+			`define "x"; $v := .A; $v; end; template "x" .; with .B; template "x" .; end`,
+			`{{if true}}{{$v := .A}}{{$v}}{{end}}{{with .B}}{{if true}}{{$v := .A}}{{$v}}{{end}}{{end}}`,
+			2,
+		},
+		{
+			"NoDot",
+			`define "x"; "a"; end; template "x"; template "x" .; template "x" .B`,
+			`{{if true}}{{"a"}}{{end}}{{if true}}{{"a"}}{{end}}{{template "x" .B}}`,
+			2,
+		},
+		{
+			"DotWithoutPipeline",
+			`define "x"; .; end; template "x"`,
+			`{{template "x"}}`,
+			0,
+		},
+		{
+			"Root",
+			`define "x"; $.A; end; template "x" .`,
+			`{{template "x" .}}`,
+			0,
+		},
+		{
+			"Return",
+			`define "x"; return 1; end; template "x" .`,
+			`{{template "x" .}}`,
+			0,
+		},
+		{
+			"Invocation",
+			`define "x"; template "y"; end; define "y"; end; template "x" .`,
+			`{{template "x" .}}`,
+			0,
+		},
+		{
+			"Value",
+			`define "x"; "a"; end; $v := (template "x" .)`,
+			`{{$v := (template "x" .)}}`,
+			0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trees := make(map[string]*Tree)
+			tree, err := New("test", nil).Parse(test.input, trees, builtins)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			inlined := tree.Inline(trees["x"])
+			if got := tree.Root.String(); got != test.expected {
+				t.Errorf("got\n\t%s\nexpected\n\t%s", got, test.expected)
+			}
+			if inlined != test.inlined {
+				t.Errorf("inlined %d invocations, expected %d", inlined, test.inlined)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ package parse
 import (
 	"bytes"
 	"fmt"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
@@ -21,27 +22,81 @@ type Tree struct {
 	Name      string    // name of the template represented by the tree.
 	ParseName string    // name of the top-level template during parsing, for error messages.
 	Root      *ListNode // top-level root of the tree.
+	Line      int       // line of the definition in the parsed text.
 	Mode      Mode      // parsing mode.
 	text      string    // text parsed to create the template (or its parent)
+
+	// Normalize, if set, normalizes identifiers and variable names while
+	// parsing, e.g. norm.NFC.String so that visually identical names match.
+	Normalize func(string) string
+
+	// Limits bounds the size of tokens, a *LimitError is returned when
+	// exceeded.
+	Limits Limits
+
+	// Vars holds the constants declared in the vars block at the top of the
+	// template, by global variable name (e.g. "$$title"), values are
+	// StringNode, NumberNode, BoolNode or NilNode.
+	Vars map[string]Node
+
+	// DataType, if set, is the type of the data the template is executed
+	// with, pipelines of the template and definitions in it are type checked
+	// when parsing, with signatures of functions provided by TypedFuncs.
+	DataType reflect.Type
+
+	// Params are the names of the parameters of a definition, with dollar
+	// signs, e.g. ["$name", "$greeting"] for define "greet" $name $greeting,
+	// arguments of invocations are bound to them in order.
+	Params []string
+
+	// Warnings holds problems found when parsing which did not stop it, like
+	// templates defined more than once with KeepFirstDefinition or
+	// KeepLastDefinition modes, recorded in the tree kept.
+	Warnings []string
+
 	// Parsing only; cleared after parse.
-	funcs      TemplateFuncs
-	lex        *lexer
-	token      [3]item // three-token lookahead for parser.
-	peekCount  int
-	vars       []string // variables defined at the moment.
-	treeSet    map[string]*Tree
-	actionLine int // line of left delim starting action
-	rangeDepth int
+	funcs       TemplateFuncs
+	lex         *lexer
+	token       [3]item // three-token lookahead for parser.
+	peekCount   int
+	vars        []string  // variables defined at the moment.
+	varDecls    []varDecl // declarations of vars, only in StrictVars mode.
+	failed      bool      // parsing stopped by an error.
+	treeSet     map[string]*Tree
+	actionLine  int   // line of left delim starting action
+	loops       []int // lines of enclosing range actions, innermost last.
+	rangeElse   int   // line of the range whose else branch is being parsed.
+	stopAtBy    bool  // "by" ends the pipeline of a sorted range.
+	stopAtStage bool  // range stages end the pipeline of a range.
+	parenDepth  int   // nesting depth of parenthesized pipelines.
+	checkTypes  bool  // type check the definition, see DataType.
+
+	// Kept for the next parse after Reset.
+	reuse bool   // keep parsing buffers when parsing stops.
+	spare *lexer // lexer of the previous parse.
 }
 
 // A mode value is a set of flags (or 0). Modes control parser behavior.
 type Mode uint
 
 const (
-	ParseComments Mode = 1 << iota // parse comments and add them to AST
-	SkipFuncCheck                  // do not check that functions are defined
+	ParseComments       Mode = 1 << iota // parse comments and add them to AST
+	SkipFuncCheck                        // do not check that functions are defined
+	StrictVars                           // reject redeclared and unused variables
+	HyphenIdents                         // allow hyphens inside identifiers, e.g. my-func
+	IndentBlocks                         // close blocks by indentation, without end
+	KeepFirstDefinition                  // keep the first of multiple definitions of a template, with a warning
+	KeepLastDefinition                   // keep the last of multiple definitions of a template, with a warning
+	CustomTruth                          // truth of values differs from IsTrue, Optimize does not fold !, && and ||
 )
 
+// varDecl records the declaration of a variable for StrictVars mode, line
+// is zero for "$" and assignments.
+type varDecl struct {
+	line int
+	used bool
+}
+
 // Copy returns a copy of the Tree. Any parsing state is discarded.
 func (t *Tree) Copy() *Tree {
 	if t == nil {
@@ -51,6 +106,11 @@ func (t *Tree) Copy() *Tree {
 		Name:      t.Name,
 		ParseName: t.ParseName,
 		Root:      t.Root.CopyList(),
+		Line:      t.Line,
+		Vars:      t.Vars,
+		DataType:  t.DataType,
+		Params:    t.Params,
+		Warnings:  t.Warnings,
 		text:      t.text,
 	}
 }
@@ -135,31 +195,68 @@ func New(name string, funcs TemplateFuncs) *Tree {
 	}
 }
 
+// Reset prepares t to parse another template named name, so that a pool of
+// trees can parse many small templates without reallocating the parsing state
+// every time. The parse result is cleared, while Mode, Normalize, Limits and
+// DataType are kept. Trees created by previous parses, including t itself as
+// added to their tree sets, must no longer be used once t is reset.
+func (t *Tree) Reset(name string) {
+	t.Name = name
+	t.ParseName = ""
+	t.Root = nil
+	t.Line = 0
+	t.Vars = nil
+	t.Params = nil
+	t.Warnings = nil
+	t.text = ""
+
+	t.peekCount = 0
+	t.failed = false
+	t.actionLine = 0
+	t.loops = t.loops[:0]
+	t.rangeElse = 0
+	t.stopAtBy = false
+	t.stopAtStage = false
+	t.parenDepth = 0
+	t.reuse = true
+}
+
 // ErrorContext returns a textual representation of the location of the node in the input text.
 // The receiver is only used when the node does not have a pointer to the tree inside,
 // which can occur in old code.
 func (t *Tree) ErrorContext(n Node) (location, context string) {
-	pos := int(n.Position())
 	tree := n.tree()
 	if tree == nil {
 		tree = t
 	}
-	text := tree.text[:pos]
+	return tree.Location(n.Position()), n.String()
+}
+
+// Location returns the position pos in the text of the tree as
+// name:line:col, where col is the byte offset in the line.
+func (t *Tree) Location(pos Pos) string {
+	text := t.text[:pos]
 	byteNum := strings.LastIndex(text, "\n")
 	if byteNum == -1 {
-		byteNum = pos // On first line.
+		byteNum = int(pos) // On first line.
 	} else {
 		byteNum++ // After the newline.
-		byteNum = pos - byteNum
+		byteNum = int(pos) - byteNum
 	}
 	lineNum := 1 + strings.Count(text, "\n")
-	context = n.String()
-	return fmt.Sprintf("%s:%d:%d", tree.ParseName, lineNum, byteNum), context
+	return fmt.Sprintf("%s:%d:%d", t.ParseName, lineNum, byteNum)
+}
+
+// Text returns the text parsed to create the tree, which is the text of the
+// whole parse for templates defined in it.
+func (t *Tree) Text() string {
+	return t.text
 }
 
 // errorf formats the error and terminates processing.
 func (t *Tree) errorf(format string, args ...any) {
 	t.Root = nil
+	t.failed = true
 	format = fmt.Sprintf("template: %s:%d: %s", t.ParseName, t.token[0].line, format)
 	panic(fmt.Errorf(format, args...))
 }
@@ -189,6 +286,11 @@ func (t *Tree) expectOneOf(expected1, expected2 itemType, context string) item {
 
 // unexpected complains about the token and terminates processing.
 func (t *Tree) unexpected(token item, context string) {
+	if token.typ == itemError && t.lex.limitErr != nil {
+		t.Root = nil
+		t.failed = true
+		panic(t.lex.limitErr)
+	}
 	if token.typ == itemError {
 		extra := ""
 		if t.actionLine != 0 && t.actionLine != token.line {
@@ -220,15 +322,25 @@ func (t *Tree) recover(errp *error) {
 func (t *Tree) startParse(funcs TemplateFuncs, lex *lexer, treeSet map[string]*Tree) {
 	t.Root = nil
 	t.lex = lex
-	t.vars = []string{"$"}
+	t.vars = append(t.vars[:0], "$")
+	t.varDecls = append(t.varDecls[:0], varDecl{used: true})
+	t.failed = false
 	t.funcs = funcs
 	t.treeSet = treeSet
 }
 
 // stopParse terminates parsing.
 func (t *Tree) stopParse() {
+	if t.reuse && t.lex != nil {
+		t.spare = t.lex
+		t.spare.input = ""
+		t.vars = t.vars[:0]
+		t.varDecls = t.varDecls[:0]
+	} else {
+		t.vars = nil
+		t.varDecls = nil
+	}
 	t.lex = nil
-	t.vars = nil
 	t.funcs = nil
 	t.treeSet = nil
 }
@@ -240,10 +352,27 @@ func (t *Tree) stopParse() {
 func (t *Tree) Parse(text string, treeSet map[string]*Tree, funcs TemplateFuncs) (tree *Tree, err error) {
 	defer t.recover(&err)
 	t.ParseName = t.Name
+	t.Line = 1
 	emitComment := t.Mode&ParseComments != 0
-	t.startParse(funcs, lex(t.Name, text, emitComment), treeSet)
+	l := t.spare
+	if l != nil {
+		t.spare = nil
+		l.reset(t.Name, text, emitComment)
+	} else {
+		l = lex(t.Name, text, emitComment)
+	}
+	l.hyphenIdents = t.Mode&HyphenIdents != 0
+	l.indentBlocks = t.Mode&IndentBlocks != 0
+	l.normalize = t.Normalize
+	l.limits = t.Limits
+	t.startParse(funcs, l, treeSet)
 	t.text = text
+	t.checkTypes = t.DataType != nil
 	t.parse()
+	t.popVars(1)
+	if t.checkTypes {
+		t.typeCheck(t.DataType)
+	}
 	t.add()
 	t.stopParse()
 	return t, nil
@@ -256,7 +385,18 @@ func (t *Tree) add() {
 		t.treeSet[t.Name] = t
 		return
 	}
-	if !IsEmptyTree(t.Root) {
+	if IsEmptyTree(t.Root) {
+		return
+	}
+
+	warning := fmt.Sprintf("template: %s:%d: multiple definition of template %q", t.ParseName, t.Line, t.Name)
+	switch {
+	case t.Mode&KeepFirstDefinition != 0:
+		tree.Warnings = append(tree.Warnings, warning+", keeping the first one")
+	case t.Mode&KeepLastDefinition != 0:
+		t.Warnings = append(append(tree.Warnings, t.Warnings...), warning+", keeping the last one")
+		t.treeSet[t.Name] = t
+	default:
 		t.errorf("template: multiple definition of template %q", t.Name)
 	}
 }
@@ -269,7 +409,10 @@ func IsEmptyTree(n Node) bool {
 	case *ActionNode:
 	case *CommentNode:
 		return true
+	case *ForNode:
 	case *IfNode:
+	case *SwitchNode:
+	case *TryNode:
 	case *ListNode:
 		for _, node := range n.Nodes {
 			if !IsEmptyTree(node) {
@@ -296,19 +439,26 @@ func (t *Tree) parse() {
 	for t.peek().typ != itemEOF {
 		if t.peek().typ == itemLeftDelim {
 			delim := t.next()
-			if t.nextNonSpace().typ == itemDefine {
+			switch t.nextNonSpace().typ {
+			case itemDefine:
 				newT := New("definition", nil) // name will be updated once we know it.
 				newT.text = t.text
 				newT.Mode = t.Mode
 				newT.ParseName = t.ParseName
+				newT.checkTypes = t.checkTypes
 				newT.startParse(t.funcs, t.lex, t.treeSet)
 				newT.parseDefinition()
 				continue
+			case itemVars:
+				if t.Vars == nil && IsEmptyTree(t.Root) {
+					t.parseVars()
+					continue
+				}
 			}
 			t.backup2(delim)
 		}
 		switch n := t.textOrAction(); n.Type() {
-		case nodeEnd, nodeElse:
+		case nodeEnd, nodeElse, nodeCatch, NodeCase, nodeDefault:
 			t.errorf("unexpected %s", n)
 		default:
 			t.Root.append(n)
@@ -327,25 +477,102 @@ func (t *Tree) parseDefinition() {
 	if err != nil {
 		t.error(err)
 	}
-	t.expect(itemRightDelim, context)
+	t.Line = name.line
+	t.parseParams(context)
 	var end Node
 	t.Root, end = t.itemList()
 	if end.Type() != nodeEnd {
 		t.errorf("unexpected %s in %s", end, context)
 	}
+	t.popVars(1)
+	if t.checkTypes {
+		// dot of definitions is unknown
+		t.typeCheck(nil)
+	}
 	t.add()
 	t.stopParse()
 }
 
+// parseParams parses the parameters of a definition up to the end of the
+// define action, and declares them as variables of its body.
+func (t *Tree) parseParams(context string) {
+	for {
+		token := t.nextNonSpace()
+		switch token.typ {
+		case itemRightDelim:
+			return
+		case itemVariable:
+		default:
+			t.unexpected(token, context)
+		}
+
+		name := token.val
+		if name == "$" || IsGlobalVar(name) {
+			t.errorf("invalid parameter %s in %s", name, context)
+		}
+		for _, p := range t.Params {
+			if p == name {
+				t.errorf("duplicate parameter %s in %s", name, context)
+			}
+		}
+		t.Params = append(t.Params, name)
+		t.declareVar(token, false)
+	}
+}
+
+// parseVars parses a {{vars}} ... {{end}} block of constant declarations at
+// the top of a template, the "vars" keyword has already been scanned.
+func (t *Tree) parseVars() {
+	const context = "vars block"
+	t.expect(itemRightDelim, context)
+	t.Vars = make(map[string]Node)
+	for {
+		switch token := t.nextNonSpace(); token.typ {
+		case itemComment:
+			continue
+		case itemLeftDelim:
+		default:
+			t.unexpected(token, context)
+		}
+
+		if t.peekNonSpace().typ == itemEnd {
+			t.nextNonSpace()
+			t.expect(itemRightDelim, context)
+			return
+		}
+
+		v := t.nextNonSpace()
+		if v.typ != itemVariable || !IsGlobalVar(v.val) || t.nextNonSpace().typ != itemDeclare {
+			t.errorf("%s can only declare global variables", context)
+		}
+		if _, ok := t.Vars[v.val]; ok {
+			t.errorf("constant %s redeclared", v.val)
+		}
+
+		var value Node
+		switch t.peekNonSpace().typ {
+		case itemBool, itemCharConstant, itemComplex, itemNil, itemNumber, itemRawString, itemString:
+			value = t.term()
+		}
+		if value == nil || t.nextNonSpace().typ != itemRightDelim {
+			t.errorf("value of constant %s is not a literal", v.val)
+		}
+		t.Vars[v.val] = value
+	}
+}
+
 // itemList:
+//
 //	textOrAction*
-// Terminates at {{end}} or {{else}}, returned separately.
+//
+// Terminates at {{end}}, {{else}}, {{catch}}, {{case}} or {{default}},
+// returned separately.
 func (t *Tree) itemList() (list *ListNode, next Node) {
 	list = t.newList(t.peekNonSpace().pos)
 	for t.peekNonSpace().typ != itemEOF {
 		n := t.textOrAction()
 		switch n.Type() {
-		case nodeEnd, nodeElse:
+		case nodeEnd, nodeElse, nodeCatch, NodeCase, nodeDefault:
 			return list, n
 		}
 		list.append(n)
@@ -355,6 +582,7 @@ func (t *Tree) itemList() (list *ListNode, next Node) {
 }
 
 // textOrAction:
+//
 //	text | comment | action
 func (t *Tree) textOrAction() (ret Node) {
 	switch token := t.nextNonSpace(); token.typ {
@@ -376,8 +604,10 @@ func (t *Tree) clearActionLine() {
 }
 
 // Action:
+//
 //	control
 //	command ("|" command)*
+//
 // Left delim is past. Now get actions.
 // First word could be a keyword such as range.
 func (t *Tree) action() (n Node) {
@@ -386,54 +616,104 @@ func (t *Tree) action() (n Node) {
 		return t.blockControl()
 	case itemBreak:
 		return t.breakControl(token.pos, token.line)
+	case itemCase:
+		return t.caseControl(token.pos, token.line)
+	case itemCatch:
+		return t.catchControl()
 	case itemContinue:
 		return t.continueControl(token.pos, token.line)
+	case itemDefault:
+		return t.defaultControl()
 	case itemElse:
 		return t.elseControl()
 	case itemEnd:
 		return t.endControl()
+	case itemFor:
+		return t.forControl(token.pos, token.line)
 	case itemIf:
 		return t.ifControl()
 	case itemRange:
 		return t.rangeControl()
+	case itemRecurse:
+		return t.recurseControl(token)
+	case itemReturn:
+		return t.returnControl(token.pos, token.line)
+	case itemSwitch:
+		return t.switchControl(token.pos, token.line)
 	case itemTemplate:
 		return t.templateControl()
+	case itemTry:
+		return t.tryControl(token.pos, token.line)
+	case itemVars:
+		t.errorf("vars block must be at the top of the template")
 	case itemWith:
 		return t.withControl()
 	}
 	t.backup()
 	token := t.peek()
+	if token.typ == itemRightDelim {
+		// empty action, like the ones between ";;", see Tree.Optimize
+		t.next()
+		return t.newAction(token.pos, token.line, t.newPipeline(token.pos, token.line, nil))
+	}
 	// Do not pop variables; they persist until "end".
 	return t.newAction(token.pos, token.line, t.pipeline("command", itemRightDelim))
 }
 
 // Break:
+//
 //	{{break}}
+//
 // Break keyword is past.
 func (t *Tree) breakControl(pos Pos, line int) Node {
 	if token := t.next(); token.typ != itemRightDelim {
 		t.unexpected(token, "in {{break}}")
 	}
-	if t.rangeDepth == 0 {
-		t.errorf("{{break}} outside {{range}}")
+	return t.newBreak(pos, line, t.enclosingLoop("break"))
+}
+
+// enclosingLoop returns the line of the innermost range or for enclosing
+// the keyword, which may be nested in if and with actions.
+func (t *Tree) enclosingLoop(keyword string) int {
+	if len(t.loops) != 0 {
+		return t.loops[len(t.loops)-1]
+	}
+	if t.rangeElse != 0 {
+		t.errorf("{{%s}} in {{else}} of {{range}} at %s:%d is outside the loop", keyword, t.ParseName, t.rangeElse)
 	}
-	return t.newBreak(pos, line)
+	t.errorf("{{%s}} outside {{range}} or {{for}}", keyword)
+	return 0
 }
 
 // Continue:
+//
 //	{{continue}}
+//
 // Continue keyword is past.
 func (t *Tree) continueControl(pos Pos, line int) Node {
 	if token := t.next(); token.typ != itemRightDelim {
 		t.unexpected(token, "in {{continue}}")
 	}
-	if t.rangeDepth == 0 {
-		t.errorf("{{continue}} outside {{range}}")
+	return t.newContinue(pos, line, t.enclosingLoop("continue"))
+}
+
+// Return:
+//
+//	{{return}}
+//	{{return pipeline}}
+//
+// Return keyword is past.
+func (t *Tree) returnControl(pos Pos, line int) Node {
+	var pipe *PipeNode
+	if t.nextNonSpace().typ != itemRightDelim {
+		t.backup()
+		pipe = t.pipeline("return", itemRightDelim)
 	}
-	return t.newContinue(pos, line)
+	return t.newReturn(pos, line, pipe)
 }
 
 // Pipeline:
+//
 //	declarations? command ('|' command)*
 func (t *Tree) pipeline(context string, end itemType) (pipe *PipeNode) {
 	token := t.peekNonSpace()
@@ -450,14 +730,20 @@ decls:
 		next := t.peekNonSpace()
 		switch {
 		case next.typ == itemAssign, next.typ == itemDeclare:
+			if context == "range" && IsGlobalVar(v.val) {
+				t.errorf("range cannot declare global variable %s", v.val)
+			}
 			pipe.IsAssign = next.typ == itemAssign
 			t.nextNonSpace()
 			pipe.Decl = append(pipe.Decl, t.newVariable(v.pos, v.val))
-			t.vars = append(t.vars, v.val)
+			t.declareVar(v, pipe.IsAssign)
 		case next.typ == itemChar && next.val == ",":
+			if IsGlobalVar(v.val) {
+				t.errorf("range cannot declare global variable %s", v.val)
+			}
 			t.nextNonSpace()
 			pipe.Decl = append(pipe.Decl, t.newVariable(v.pos, v.val))
-			t.vars = append(t.vars, v.val)
+			t.declareVar(v, false)
 			if context == "range" && len(pipe.Decl) < 2 {
 				switch t.peekNonSpace().typ {
 				case itemVariable, itemRightDelim, itemRightParen:
@@ -480,8 +766,19 @@ decls:
 			// At this point, the pipeline is complete
 			t.checkPipeline(pipe, context)
 			return
-		case itemBool, itemCharConstant, itemComplex, itemDot, itemField, itemIdentifier,
-			itemNumber, itemNil, itemRawString, itemString, itemVariable, itemLeftParen:
+		case itemIdentifier:
+			if t.isBy(token) || t.isRangeStage(token) {
+				// sort key of {{range sorted pipeline by pipeline}}, or
+				// stages of {{range pipeline | stage}} follow
+				t.backup()
+				t.checkPipeline(pipe, context)
+				return
+			}
+			t.backup()
+			pipe.append(t.command())
+		case itemBool, itemCharConstant, itemComplex, itemDot, itemField,
+			itemNumber, itemNil, itemRawString, itemString, itemVariable, itemLeftParen,
+			itemTemplate, itemRecurse, itemNot:
 			t.backup()
 			pipe.append(t.command())
 		default:
@@ -508,16 +805,28 @@ func (t *Tree) checkPipeline(pipe *PipeNode, context string) {
 func (t *Tree) parseControl(allowElseIf bool, context string) (pos Pos, line int, pipe *PipeNode, list, elseList *ListNode) {
 	defer t.popVars(len(t.vars))
 	pipe = t.pipeline(context, itemRightDelim)
+	list, elseList, _ = t.parseControlBody(allowElseIf, context, pipe.Line)
+	return pipe.Position(), pipe.Line, pipe, list, elseList
+}
+
+// parseControlBody parses the body of a control structure started at line
+// after its pipeline, up to and including the matching {{end}}. elseVar is
+// the variable bound by {{else $var}}, only allowed in range.
+func (t *Tree) parseControlBody(allowElseIf bool, context string, line int) (list, elseList *ListNode, elseVar *VariableNode) {
 	if context == "range" {
-		t.rangeDepth++
+		t.loops = append(t.loops, line)
 	}
 	var next Node
 	list, next = t.itemList()
 	if context == "range" {
-		t.rangeDepth--
+		t.loops = t.loops[:len(t.loops)-1]
+		defer func(rangeElse int) { t.rangeElse = rangeElse }(t.rangeElse)
+		t.rangeElse = line
 	}
 	switch next.Type() {
 	case nodeEnd: //done
+	case nodeCatch, NodeCase, nodeDefault:
+		t.errorf("unexpected %s in %s", next, context)
 	case nodeElse:
 		if allowElseIf {
 			// Special case for "else if". If the "else" is followed immediately by an "if",
@@ -536,48 +845,302 @@ func (t *Tree) parseControl(allowElseIf bool, context string) (pos Pos, line int
 				break
 			}
 		}
+		if v := next.(*elseNode).v; v.typ == itemVariable {
+			if context != "range" {
+				t.errorf("unexpected variable %s after else in %s", v.val, context)
+			}
+			if v.val == "$" || IsGlobalVar(v.val) {
+				t.errorf("can't bind %s in range else", v.val)
+			}
+			defer t.popVars(len(t.vars))
+			t.declareVar(v, false)
+			elseVar = t.newVariable(v.pos, v.val)
+		}
 		elseList, next = t.itemList()
 		if next.Type() != nodeEnd {
 			t.errorf("expected end; found %s", next)
 		}
 	}
-	return pipe.Position(), pipe.Line, pipe, list, elseList
+	return list, elseList, elseVar
 }
 
 // If:
+//
 //	{{if pipeline}} itemList {{end}}
 //	{{if pipeline}} itemList {{else}} itemList {{end}}
+//
 // If keyword is past.
 func (t *Tree) ifControl() Node {
 	return t.newIf(t.parseControl(true, "if"))
 }
 
+// For:
+//
+//	{{for pipeline; pipeline; pipeline}} itemList {{end}}
+//
+// For keyword is past. The pipelines are the init, condition and post
+// statements, separated like actions, variables declared by init are
+// scoped to the loop. Each of them may be empty, init and post must
+// declare or assign variables, and the condition must not.
+func (t *Tree) forControl(pos Pos, line int) Node {
+	defer t.popVars(len(t.vars))
+
+	init := t.forClause("for init")
+	if init != nil && len(init.Decl) == 0 {
+		t.errorf("for init must be a declaration or an assignment")
+	}
+	t.expect(itemLeftDelim, "for")
+	cond := t.forClause("for condition")
+	if cond != nil && len(cond.Decl) != 0 {
+		t.errorf("for condition cannot declare or assign variables")
+	}
+	t.expect(itemLeftDelim, "for")
+	post := t.forClause("for post")
+	if post != nil && len(post.Decl) == 0 {
+		t.errorf("for post must be a declaration or an assignment")
+	}
+
+	t.loops = append(t.loops, line)
+	list, next := t.itemList()
+	t.loops = t.loops[:len(t.loops)-1]
+	if next.Type() != nodeEnd {
+		t.errorf("expected end; found %s", next)
+	}
+	return t.newFor(pos, line, init, cond, post, list)
+}
+
+// forClause parses a pipeline of the for action, which is nil if empty.
+func (t *Tree) forClause(context string) *PipeNode {
+	if t.peekNonSpace().typ == itemRightDelim {
+		t.nextNonSpace()
+		return nil
+	}
+	return t.pipeline(context, itemRightDelim)
+}
+
+// Try:
+//
+//	{{try}} itemList {{end}}
+//	{{try}} itemList {{catch}} itemList {{end}}
+//	{{try}} itemList {{catch $var}} itemList {{end}}
+//
+// Try keyword is past. Variables declared in the try list are not visible
+// in the catch list, which runs instead of the rest of the try list.
+func (t *Tree) tryControl(pos Pos, line int) Node {
+	mark := len(t.vars)
+	defer t.popVars(mark)
+
+	t.expect(itemRightDelim, "try")
+	list, next := t.itemList()
+
+	var (
+		errVar *VariableNode
+		catch  *ListNode
+	)
+	if next.Type() == nodeCatch {
+		t.popVars(mark)
+		if v := next.(*catchNode).v; v.typ == itemVariable {
+			if v.val == "$" || IsGlobalVar(v.val) {
+				t.errorf("can't bind %s in catch", v.val)
+			}
+			t.declareVar(v, false)
+			errVar = t.newVariable(v.pos, v.val)
+		}
+		catch, next = t.itemList()
+	}
+	if next.Type() != nodeEnd {
+		t.errorf("expected end; found %s", next)
+	}
+	return t.newTry(pos, line, list, errVar, catch)
+}
+
+// Switch:
+//
+//	{{switch pipeline}} ({{case pipeline}} itemList)* {{end}}
+//	{{switch pipeline}} ({{case pipeline}} itemList)* {{default}} itemList {{end}}
+//	{{switch}} ({{case pipeline}} itemList)* {{end}}
+//
+// Switch keyword is past. Without a pipeline, the pipelines of cases are
+// conditions. Variables declared by the pipeline are scoped to the switch,
+// the ones declared in a case to its list.
+func (t *Tree) switchControl(pos Pos, line int) Node {
+	defer t.popVars(len(t.vars))
+
+	var pipe *PipeNode
+	if t.peekNonSpace().typ == itemRightDelim {
+		t.nextNonSpace()
+	} else {
+		pipe = t.pipeline("switch", itemRightDelim)
+	}
+	n := t.newSwitch(pos, line, pipe)
+
+	list, next := t.itemList()
+	for _, n := range list.Nodes {
+		if !IsEmptyTree(n) {
+			t.errorf("unexpected %s before first case in switch", n)
+		}
+	}
+	mark := len(t.vars)
+	for {
+		switch next.Type() {
+		case NodeCase:
+			if n.Default != nil {
+				t.errorf("unexpected %s after default in switch", next)
+			}
+			c := next.(*CaseNode)
+			c.List, next = t.itemList()
+			n.Cases = append(n.Cases, c)
+		case nodeDefault:
+			if n.Default != nil {
+				t.errorf("multiple defaults in switch")
+			}
+			n.Default, next = t.itemList()
+		case nodeEnd:
+			return n
+		default:
+			t.errorf("unexpected %s in switch", next)
+		}
+		t.popVars(mark)
+	}
+}
+
+// Case:
+//
+//	{{case pipeline}}
+//
+// Case keyword is past. The list of the case is parsed by switchControl.
+func (t *Tree) caseControl(pos Pos, line int) Node {
+	pipe := t.pipeline("case", itemRightDelim)
+	if len(pipe.Decl) > 0 {
+		t.errorf("case cannot declare variables")
+	}
+	return t.newCase(pos, line, pipe)
+}
+
+// Default:
+//
+//	{{default}}
+//
+// Default keyword is past.
+func (t *Tree) defaultControl() Node {
+	return t.newDefault(t.expect(itemRightDelim, "default").pos)
+}
+
 // Range:
+//
 //	{{range pipeline}} itemList {{end}}
 //	{{range pipeline}} itemList {{else}} itemList {{end}}
+//	{{range sorted pipeline}} itemList {{end}}
+//	{{range sorted pipeline by pipeline}} itemList {{end}}
+//	{{range pipeline}} itemList {{else $var}} itemList {{end}}
+//	{{range pipeline | stage | ...}} itemList {{end}}
+//
 // Range keyword is past.
 func (t *Tree) rangeControl() Node {
-	r := t.newRange(t.parseControl(false, "range"))
+	defer t.popVars(len(t.vars))
+
+	sorted := false
+	if token := t.peekNonSpace(); token.typ == itemIdentifier && token.val == "sorted" {
+		t.nextNonSpace()
+		sorted = true
+	}
+
+	t.stopAtBy = sorted
+	t.stopAtStage = true
+	pipe := t.pipeline("range", itemRightDelim)
+
+	var stages []*CommandNode
+	for piped := true; piped; {
+		token := t.peekNonSpace()
+		if !t.isRangeStage(token) {
+			break
+		}
+		var stage *CommandNode
+		stage, piped = t.rangeStage()
+		stages = append(stages, stage)
+		if piped && !t.isRangeStage(t.peekNonSpace()) {
+			t.errorf("expected range stage after %s stage", token.val)
+		}
+	}
+	t.stopAtBy = false
+	t.stopAtStage = false
+
+	var sortBy *PipeNode
+	if sorted {
+		if token := t.peekNonSpace(); token.typ == itemIdentifier && token.val == "by" {
+			t.nextNonSpace()
+			sortBy = t.pipeline("range sort key", itemRightDelim)
+		}
+	}
+	if len(stages) != 0 && sortBy == nil {
+		t.expect(itemRightDelim, "range")
+	}
+
+	list, elseList, elseVar := t.parseControlBody(false, "range", pipe.Line)
+	r := t.newRange(pipe.Position(), pipe.Line, pipe, list, elseList)
+	r.Sorted = sorted
+	r.SortBy = sortBy
+	r.ElseVar = elseVar
+	r.Stages = stages
 	return r
 }
 
+// rangeStageArgs are the numbers of arguments of range stages, -1 for any.
+var rangeStageArgs = map[string]int{
+	"filter": 1,
+	"limit":  1,
+	"sortBy": -1,
+	"chunk":  1,
+	"window": 1,
+}
+
+// isRangeStage reports whether token is the keyword of a stage ending the
+// pipeline of {{range pipeline | stage}}.
+func (t *Tree) isRangeStage(token item) bool {
+	if !t.stopAtStage || token.typ != itemIdentifier || t.parenDepth != 0 {
+		return false
+	}
+	_, ok := rangeStageArgs[token.val]
+	return ok
+}
+
+// rangeStage parses a stage of a range pipeline, piped reports whether
+// another stage follows.
+func (t *Tree) rangeStage() (stage *CommandNode, piped bool) {
+	token := t.nextNonSpace()
+	stage = t.newCommand(token.pos)
+	stage.append(NewIdentifier(token.val).SetTree(t).SetPos(token.pos))
+	piped = t.operands(stage)
+	if n := rangeStageArgs[token.val]; n >= 0 && len(stage.Args)-1 != n {
+		t.errorf("wrong number of args for range stage %s: want %d got %d", token.val, n, len(stage.Args)-1)
+	}
+	return stage, piped
+}
+
 // With:
+//
 //	{{with pipeline}} itemList {{end}}
 //	{{with pipeline}} itemList {{else}} itemList {{end}}
+//
 // If keyword is past.
 func (t *Tree) withControl() Node {
 	return t.newWith(t.parseControl(false, "with"))
 }
 
 // End:
+//
 //	{{end}}
+//
 // End keyword is past.
 func (t *Tree) endControl() Node {
 	return t.newEnd(t.expect(itemRightDelim, "end").pos)
 }
 
 // Else:
+//
 //	{{else}}
+//	{{else $var}}
+//
 // Else keyword is past.
 func (t *Tree) elseControl() Node {
 	// Special case for "else if".
@@ -586,12 +1149,37 @@ func (t *Tree) elseControl() Node {
 		// We see "{{else if ... " but in effect rewrite it to {{else}}{{if ... ".
 		return t.newElse(peek.pos, peek.line)
 	}
+	var v item
+	if peek.typ == itemVariable {
+		v = t.nextNonSpace()
+	}
 	token := t.expect(itemRightDelim, "else")
-	return t.newElse(token.pos, token.line)
+	e := t.newElse(token.pos, token.line)
+	e.v = v
+	return e
+}
+
+// Catch:
+//
+//	{{catch}}
+//	{{catch $var}}
+//
+// Catch keyword is past.
+func (t *Tree) catchControl() Node {
+	var v item
+	if t.peekNonSpace().typ == itemVariable {
+		v = t.nextNonSpace()
+	}
+	token := t.expect(itemRightDelim, "catch")
+	c := t.newCatch(token.pos)
+	c.v = v
+	return c
 }
 
 // Block:
+//
 //	{{block stringValue pipeline}}
+//
 // Block keyword is past.
 // The name must be something that can evaluate to a string.
 // The pipeline is mandatory.
@@ -619,13 +1207,21 @@ func (t *Tree) blockControl() Node {
 }
 
 // Template:
+//
 //	{{template stringValue pipeline}}
+//
 // Template keyword is past. The name must be something that can evaluate
 // to a string.
 func (t *Tree) templateControl() Node {
 	const context = "template clause"
 	token := t.nextNonSpace()
 	name := t.parseTemplateName(token, context)
+	if t.namedArgsAhead() {
+		n := t.newTemplate(token.pos, token.line, name, nil)
+		n.Named = t.namedArgs(context, itemRightDelim)
+		t.nextNonSpace()
+		return n
+	}
 	var pipe *PipeNode
 	if t.nextNonSpace().typ != itemRightDelim {
 		t.backup()
@@ -635,6 +1231,102 @@ func (t *Tree) templateControl() Node {
 	return t.newTemplate(token.pos, token.line, name, pipe)
 }
 
+// namedArgsAhead reports whether the next tokens start named arguments of a
+// template invocation, i.e. an identifier immediately followed by "=".
+func (t *Tree) namedArgsAhead() bool {
+	first := t.nextNonSpace()
+	if first.typ != itemIdentifier {
+		t.backup()
+		return false
+	}
+	second := t.next()
+	t.backup2(first)
+	return second.typ == itemAssign
+}
+
+// Named arguments:
+//
+//	name=operand name=operand...
+//
+// The arguments extend to end, which is left to the caller.
+func (t *Tree) namedArgs(context string, end itemType) (args []NamedArg) {
+	for {
+		token := t.nextNonSpace()
+		switch token.typ {
+		case end:
+			t.backup()
+			return
+		case itemIdentifier:
+		default:
+			t.unexpected(token, context)
+		}
+		if t.next().typ != itemAssign {
+			t.errorf("missing = after argument %s in %s", token.val, context)
+		}
+		for _, arg := range args {
+			if arg.Name == token.val {
+				t.errorf("duplicate argument %s in %s", token.val, context)
+			}
+		}
+
+		value := t.operand()
+		if value == nil {
+			t.errorf("missing value for argument %s in %s", token.val, context)
+		}
+		args = append(args, NamedArg{Name: token.val, Value: value})
+	}
+}
+
+// Template invocation as a value:
+//
+//	(template "name" pipeline?)
+//
+// Template keyword is past, the pipeline extends to the right paren.
+func (t *Tree) templateExpr(keyword item) Node {
+	const context = "template invocation"
+	if t.parenDepth == 0 {
+		t.errorf("template invocation used as a value must be parenthesized")
+	}
+	token := t.nextNonSpace()
+	name := t.parseTemplateName(token, context)
+	if t.namedArgsAhead() {
+		n := t.newTemplate(keyword.pos, keyword.line, name, nil)
+		n.Named = t.namedArgs(context, itemRightParen)
+		return n
+	}
+	var pipe *PipeNode
+	if t.peekNonSpace().typ != itemRightParen {
+		pipe = t.pipeline(context, itemRightParen)
+		t.backup() // leave the right paren to the parenthesized pipeline.
+	}
+	return t.newTemplate(keyword.pos, keyword.line, name, pipe)
+}
+
+// Recurse:
+//
+//	{{recurse pipeline}}
+//
+// Recurse keyword is past. It invokes the template being parsed, e.g. the
+// innermost define, with the value of the pipeline as dot.
+func (t *Tree) recurseControl(keyword item) Node {
+	pipe := t.pipeline("recurse clause", itemRightDelim)
+	return t.newRecurse(keyword.pos, keyword.line, pipe)
+}
+
+// Recursion as a value:
+//
+//	(recurse pipeline)
+//
+// Recurse keyword is past, the pipeline extends to the right paren.
+func (t *Tree) recurseExpr(keyword item) Node {
+	if t.parenDepth == 0 {
+		t.errorf("recursion used as a value must be parenthesized")
+	}
+	pipe := t.pipeline("recursion", itemRightParen)
+	t.backup() // leave the right paren to the parenthesized pipeline.
+	return t.newRecurse(keyword.pos, keyword.line, pipe)
+}
+
 func (t *Tree) parseTemplateName(token item, context string) (name string) {
 	switch token.typ {
 	case itemString, itemRawString:
@@ -650,11 +1342,92 @@ func (t *Tree) parseTemplateName(token item, context string) (name string) {
 }
 
 // command:
-//	operand (space operand)*
+//
+//	and ('||' and)*
+//
+// and:
+//
+//	comparison ('&&' comparison)*
+//
+// comparison:
+//
+//	operand (space operand)* (op operand (space operand)*)?
+//
 // space-separated arguments up to a pipeline character or right delimiter.
 // we consume the pipe character but leave the right delim to terminate the action.
 func (t *Tree) command() *CommandNode {
-	cmd := t.newCommand(t.peekNonSpace().pos)
+	cmd, _ := t.orCommand()
+	return cmd
+}
+
+// orCommand parses a command of || operations, piped reports whether the
+// command is followed by "|".
+func (t *Tree) orCommand() (cmd *CommandNode, piped bool) {
+	cmd, piped = t.andCommand("")
+	for !piped && t.peekNonSpace().typ == itemOr {
+		op := t.nextNonSpace()
+		var right *CommandNode
+		right, piped = t.andCommand(op.val)
+		cmd = t.soleCommand(cmd.Pos, t.newLogical(op.pos, op.val, cmd, right))
+	}
+	return
+}
+
+// andCommand parses a command of && operations after the operator after,
+// if any.
+func (t *Tree) andCommand(after string) (cmd *CommandNode, piped bool) {
+	cmd, piped = t.compareCommand(after)
+	for !piped && t.peekNonSpace().typ == itemAnd {
+		op := t.nextNonSpace()
+		var right *CommandNode
+		right, piped = t.compareCommand(op.val)
+		cmd = t.soleCommand(cmd.Pos, t.newLogical(op.pos, op.val, cmd, right))
+	}
+	return
+}
+
+// compareCommand parses a command, or a comparison of commands, after the
+// operator after, if any.
+func (t *Tree) compareCommand(after string) (cmd *CommandNode, piped bool) {
+	cmd = t.newCommand(t.peekNonSpace().pos)
+	piped = t.operands(cmd)
+	if len(cmd.Args) == 0 {
+		switch next := t.peekNonSpace(); {
+		case after != "":
+			t.errorf("missing right operand of %s", after)
+		case next.typ == itemCompare, next.typ == itemAnd, next.typ == itemOr:
+			t.errorf("missing left operand of %s", next.val)
+		default:
+			t.errorf("empty command")
+		}
+	}
+	if piped || t.peekNonSpace().typ != itemCompare {
+		return cmd, piped
+	}
+
+	op := t.nextNonSpace()
+	right := t.newCommand(t.peekNonSpace().pos)
+	piped = t.operands(right)
+	if len(right.Args) == 0 {
+		t.errorf("missing right operand of %s", op.val)
+	}
+	if !piped && t.peekNonSpace().typ == itemCompare {
+		t.errorf("comparisons can't be chained, use parentheses")
+	}
+
+	return t.soleCommand(cmd.Pos, t.newComparison(op.pos, op.val, cmd, right)), piped
+}
+
+// soleCommand returns a command at pos with n as its only argument.
+func (t *Tree) soleCommand(pos Pos, n Node) *CommandNode {
+	cmd := t.newCommand(pos)
+	cmd.append(n)
+	return cmd
+}
+
+// operands parses operands of cmd up to the end of the command, piped
+// reports whether the command is followed by "|".
+func (t *Tree) operands(cmd *CommandNode) (piped bool) {
 	for {
 		t.peekNonSpace() // skip leading spaces.
 		operand := t.operand()
@@ -664,72 +1437,121 @@ func (t *Tree) command() *CommandNode {
 		switch token := t.next(); token.typ {
 		case itemSpace:
 			continue
-		case itemRightDelim, itemRightParen:
+		case itemRightDelim, itemRightParen, itemRightBracket:
+			t.backup()
+		case itemIdentifier:
+			if !t.isBy(token) {
+				t.unexpected(token, "operand")
+			}
 			t.backup()
 		case itemPipe:
 			// nothing here; break loop below
+			piped = true
+		case itemCompare, itemAnd, itemOr:
+			t.backup()
 		default:
 			t.unexpected(token, "operand")
 		}
-		break
-	}
-	if len(cmd.Args) == 0 {
-		t.errorf("empty command")
+		return
 	}
-	return cmd
 }
 
 // operand:
-//	term .Field*
+//
+//	term (.Field | '[' pipeline ']')*
+//
 // An operand is a space-separated component of a command,
-// a term possibly followed by field accesses.
+// a term possibly followed by field accesses and subscripts.
 // A nil return means the next item is not an operand.
 func (t *Tree) operand() Node {
 	node := t.term()
 	if node == nil {
 		return nil
 	}
-	if t.peek().typ == itemField {
-		chain := t.newChain(t.peek().pos, node)
-		for t.peek().typ == itemField {
-			chain.Add(t.next().val)
-		}
-		// Compatibility with original API: If the term is of type NodeField
-		// or NodeVariable, just put more fields on the original.
-		// Otherwise, keep the Chain node.
-		// Obvious parsing errors involving literal values are detected here.
-		// More complex error cases will have to be handled at execution time.
-		switch node.Type() {
-		case NodeField:
-			node = t.newField(chain.Position(), chain.String())
-		case NodeVariable:
-			node = t.newVariable(chain.Position(), chain.String())
-		case NodeBool, NodeString, NodeNumber, NodeNil, NodeDot:
-			t.errorf("unexpected . after term %q", node.String())
+	for {
+		switch t.peek().typ {
+		case itemField:
+			node = t.fields(node)
+		case itemLeftBracket:
+			node = t.index(node)
 		default:
-			node = chain
+			return node
 		}
 	}
-	return node
+}
+
+// fields parses the field accesses following node.
+func (t *Tree) fields(node Node) Node {
+	chain := t.newChain(t.peek().pos, node)
+	for t.peek().typ == itemField {
+		chain.Add(t.next().val)
+	}
+	// Compatibility with original API: If the term is of type NodeField
+	// or NodeVariable, just put more fields on the original.
+	// Otherwise, keep the Chain node.
+	// Obvious parsing errors involving literal values are detected here.
+	// More complex error cases will have to be handled at execution time.
+	switch node.Type() {
+	case NodeField:
+		return t.newField(chain.Position(), chain.String())
+	case NodeVariable:
+		return t.newVariable(chain.Position(), chain.String())
+	case NodeBool, NodeString, NodeNumber, NodeNil, NodeDot:
+		t.errorf("unexpected . after term %q", node.String())
+	}
+	return chain
+}
+
+// index parses the subscript following node:
+//
+//	'[' pipeline ']'
+func (t *Tree) index(node Node) Node {
+	switch node.Type() {
+	case NodeBool, NodeString, NodeNumber, NodeNil:
+		t.errorf("unexpected [ after term %q", node.String())
+	}
+	pos := t.next().pos
+	t.parenDepth++
+	defer func() { t.parenDepth-- }()
+	pipe := t.pipeline("index", itemRightBracket)
+	if len(pipe.Decl) != 0 {
+		t.errorf("declaration in index %s", pipe)
+	}
+	return t.newIndex(pos, node, pipe)
 }
 
 // term:
+//
 //	literal (number, string, nil, boolean)
 //	function (identifier)
 //	.
 //	.Field
 //	$
 //	'(' pipeline ')'
+//
 // A term is a simple "expression".
 // A nil return means the next item is not a term.
 func (t *Tree) term() Node {
 	switch token := t.nextNonSpace(); token.typ {
 	case itemIdentifier:
+		if t.isBy(token) {
+			break
+		}
 		checkFunc := t.Mode&SkipFuncCheck == 0
 		if checkFunc && !t.hasFunction(token.val) {
 			t.errorf("function %q not defined", token.val)
 		}
 		return NewIdentifier(token.val).SetTree(t).SetPos(token.pos)
+	case itemTemplate:
+		return t.templateExpr(token)
+	case itemRecurse:
+		return t.recurseExpr(token)
+	case itemNot:
+		operand := t.operand()
+		if operand == nil {
+			t.errorf("missing operand of !")
+		}
+		return t.newNot(token.pos, operand)
 	case itemDot:
 		return t.newDot(token.pos)
 	case itemNil:
@@ -747,6 +1569,8 @@ func (t *Tree) term() Node {
 		}
 		return number
 	case itemLeftParen:
+		t.parenDepth++
+		defer func() { t.parenDepth-- }()
 		return t.pipeline("parenthesized pipeline", itemRightParen)
 	case itemString, itemRawString:
 		s, err := strconv.Unquote(token.val)
@@ -759,6 +1583,12 @@ func (t *Tree) term() Node {
 	return nil
 }
 
+// isBy reports whether token is the "by" keyword ending the pipeline of
+// {{range sorted pipeline by pipeline}}.
+func (t *Tree) isBy(token item) bool {
+	return t.stopAtBy && token.typ == itemIdentifier && token.val == "by" && t.parenDepth == 0
+}
+
 // hasFunction reports if a function name exists in the Tree's maps.
 func (t *Tree) hasFunction(name string) bool {
 	if t.funcs == nil {
@@ -768,8 +1598,43 @@ func (t *Tree) hasFunction(name string) bool {
 	return t.funcs.Has(name)
 }
 
+// declareVar adds the variable token v to the variable list, assign is true
+// when v is assigned rather than declared. Global variables are not scoped
+// and never added.
+func (t *Tree) declareVar(v item, assign bool) {
+	if IsGlobalVar(v.val) {
+		return
+	}
+	if t.Mode&StrictVars != 0 {
+		if !assign {
+			for i := len(t.vars) - 1; i >= 0; i-- {
+				if t.vars[i] == v.val && t.varDecls[i].line != 0 {
+					t.errorf("variable %s redeclared, previous declaration at %s:%d", v.val, t.ParseName, t.varDecls[i].line)
+				}
+			}
+		}
+		decl := varDecl{line: v.line}
+		if assign {
+			// an assignment neither declares nor uses a variable
+			decl = varDecl{used: true}
+		}
+		t.varDecls = append(t.varDecls, decl)
+	}
+	t.vars = append(t.vars, v.val)
+}
+
 // popVars trims the variable list to the specified length
 func (t *Tree) popVars(n int) {
+	if t.Mode&StrictVars != 0 {
+		if !t.failed {
+			for i := n; i < len(t.vars); i++ {
+				if !t.varDecls[i].used && !strings.HasPrefix(t.vars[i], "$_") {
+					t.errorf("variable %s declared at %s:%d is not used", t.vars[i], t.ParseName, t.varDecls[i].line)
+				}
+			}
+		}
+		t.varDecls = t.varDecls[:n]
+	}
 	t.vars = t.vars[:n]
 }
 
@@ -777,11 +1642,28 @@ func (t *Tree) popVars(n int) {
 // variable is not defined.
 func (t *Tree) useVar(pos Pos, name string) Node {
 	v := t.newVariable(pos, name)
-	for _, varName := range t.vars {
-		if varName == v.Ident[0] {
+	if IsGlobalVar(v.Ident[0]) {
+		// globals may be set by other templates
+		return v
+	}
+	for i := len(t.vars) - 1; i >= 0; i-- {
+		if t.vars[i] == v.Ident[0] {
+			if t.Mode&StrictVars != 0 {
+				t.markUsed(v.Ident[0])
+			}
 			return v
 		}
 	}
 	t.errorf("undefined variable %q", v.Ident[0])
 	return nil
 }
+
+// markUsed marks the visible declaration of the variable name as used.
+func (t *Tree) markUsed(name string) {
+	for i := len(t.vars) - 1; i >= 0; i-- {
+		if t.vars[i] == name && t.varDecls[i].line != 0 {
+			t.varDecls[i].used = true
+			return
+		}
+	}
+}
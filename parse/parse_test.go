@@ -199,16 +199,48 @@ var parseTests = []parseTest{
 		`{{.X | .Y}}`},
 	{"pipeline with decl", "$x := .X|.Y", noError,
 		`{{$x := .X | .Y}}`},
+	{"comparison", "if .X==3\nprintf\nend", noError,
+		"{{if .X == 3}}{{printf}}{{end}}"},
+	{"comparison of commands", "$x := 1\nprintf `%d` .X >= ($x | printf `%d`) | printf `%v`", noError,
+		"{{$x := 1}}{{printf `%d` .X >= ($x | printf `%d`) | printf `%v`}}"},
+	{"piped comparison", ".X | printf `%d` != `3`", noError,
+		"{{.X | printf `%d` != `3`}}"},
+	{"logical operators", "if .A&&(!.B || .C)\nprintf\nend", noError,
+		"{{if .A && (!.B || .C)}}{{printf}}{{end}}"},
+	{"logical precedence", ".A || .B && .C == 1 || !printf", noError,
+		"{{.A || .B && .C == 1 || !printf}}"},
+	{"negated operands", "printf `%v` !.X.Y !(.Z) !$", noError,
+		"{{printf `%v` !.X.Y !(.Z) !$}}"},
 	{"nested pipeline", ".X (.Y .Z) (.A | .B .C) (.E)", noError,
 		`{{.X (.Y .Z) (.A | .B .C) (.E)}}`},
 	{"field applied to parentheses", "(.Y .Z).Field", noError,
 		`{{(.Y .Z).Field}}`},
+	{"index", `.X[0].Y[ $ ]["k"] (.Z)[printf "%d" 1] .[.I]`, noError,
+		`{{.X[0].Y[$]["k"] (.Z)[printf "%d" 1] .[.I]}}`},
 	{"simple if", "if .X\nprintf\nend", noError,
 		"{{if .X}}{{printf}}{{end}}"},
 	{"if with else", "if .X\ntrue\nelse\nfalse\nend", noError,
 		`{{if .X}}{{true}}{{else}}{{false}}{{end}}`},
 	{"if with else if", "if .X\ntrue\nelse if .Y\nfalse\nend", noError,
 		`{{if .X}}{{true}}{{else}}{{if .Y}}{{false}}{{end}}{{end}}`},
+	{"for", "for $i := 0; $i < 3; $i = printf `%d` $i\n$i\nif $i\nbreak\nend\ncontinue\nend", noError,
+		"{{for $i := 0; $i < 3; $i = printf `%d` $i}}{{$i}}{{if $i}}{{break}}{{end}}{{continue}}{{end}}"},
+	{"for empty clauses", "for ; ; ;\nbreak\nend", noError, "{{for;;}}{{break}}{{end}}"},
+	{"for without init and post", "for ; .X; ;\nbreak\nend", noError, "{{for; .X;}}{{break}}{{end}}"},
+	{"try", "try\n.X\nend", noError, `{{try}}{{.X}}{{end}}`},
+	{"try catch", "try; .X; catch; `-`; end", noError, "{{try}}{{.X}}{{catch}}{{`-`}}{{end}}"},
+	{"try catch variable", "try\n$x := .X\n$x\ncatch $err\n$err\nend", noError,
+		`{{try}}{{$x := .X}}{{$x}}{{catch $err}}{{$err}}{{end}}`},
+	{"switch", "switch .X\ncase 1\n`a`\ncase 2\ndefault\n`b`\nend", noError,
+		"{{switch .X}}{{case 1}}{{`a`}}{{case 2}}{{default}}{{`b`}}{{end}}"},
+	{"switch without value", "switch; case .X; `a`; case .Y; `b`; end", noError,
+		"{{switch}}{{case .X}}{{`a`}}{{case .Y}}{{`b`}}{{end}}"},
+	{"switch variable", "switch $x := .X; case 1; $x; default; $x; end", noError,
+		"{{switch $x := .X}}{{case 1}}{{$x}}{{default}}{{$x}}{{end}}"},
+	{"default function", ".X | default 1; default 1 .X", noError,
+		"{{.X | default 1}}{{default 1 .X}}"},
+	{"default function in switch", "switch .X; case .Y | default 1; if .Z; default 1 .Z; end; default; .Y | default 2; end", noError,
+		"{{switch .X}}{{case .Y | default 1}}{{if .Z}}{{default 1 .Z}}{{end}}{{default}}{{.Y | default 2}}{{end}}"},
 	// 	{"if else chain", "+{{if .X}}X{{else if .Y}}Y{{else if .Z}}Z{{end}}+", noError,
 	// 		`"+"{{if .X}}"X"{{else\nif .Y}}"Y"{{else\nif .Z}}"Z"{{end\nend\nend"+"`},
 	// 	{"simple range", "range .X}}hello{{end}}", noError,
@@ -283,8 +315,41 @@ printf`, noError, `{{"x" | printf}}`},
 	// {"extra end after if", "{{if .X}}a{{else if .Y}}b{{end\nend", hasError, ""},
 	{"break outside range", "range .\nend\n break", hasError, ""},
 	{"continue outside range", "range .\nend continue", hasError, ""},
+	{"for without post", "for $i := 0; $i < 3\nend", hasError, ""},
+	{"for condition as init", "for $i < 3; $i; $i = printf `%d` $i; end", hasError, ""},
+	{"for init without declaration", "for .X; .Y; $i = 1\nend", hasError, ""},
+	{"for post without assignment", "for $i := 0; $i < 3; printf `%d` $i\nend", hasError, ""},
+	{"for condition declaration", "for $i := 0; $x := .X; $i = 1\nend", hasError, ""},
+	{"for with else", "for $i := 0; $i < 3; $i = 1\nelse\nend", hasError, ""},
+	{"for variable outside loop", "for $i := 0; $i < 3; $i = 1\nend\n$i", hasError, ""},
+	{"break outside for", "for $i := 0; $i < 3; $i = 1\nend\nbreak", hasError, ""},
 	{"break in range else", "range .\nelse\nbreak\nend", hasError, ""},
+	{"try with else", "try\nelse\nend", hasError, ""},
+	{"catch outside try", "if .X\ncatch\nend", hasError, ""},
+	{"try variable in catch", "try\n$x := 1\ncatch\n$x\nend", hasError, ""},
+	{"catch variable outside try", "try\ncatch $err\nend\n$err", hasError, ""},
+	{"catch global variable", "try\ncatch $$err\nend", hasError, ""},
+	{"unclosed try", "try\n.X", hasError, ""},
+	{"case outside switch", "if .X\ncase 1\nend", hasError, ""},
+	{"switch action before case", "switch .X\n.Y\ncase 1\nend", hasError, ""},
+	{"case after default", "switch .X\ndefault\ncase 1\nend", hasError, ""},
+	{"multiple defaults", "switch .X\ndefault\ndefault\nend", hasError, ""},
+	{"case declaration", "switch .X\ncase $x := 1\nend", hasError, ""},
+	{"case variable in next case", "switch .X\ncase 1\n$x := 1\ncase 2\n$x\nend", hasError, ""},
+	{"unclosed switch", "switch .X\ncase 1", hasError, ""},
 	{"continue in range else", "range .\nelse\ncontinue\nend", hasError, ""},
+	{"template value", `$r := (template "x" . | printf "%s")`, noError, `{{$r := (template "x" . | printf "%s")}}`},
+	{"template value without parens", `$r := template "x" .`, hasError, ""},
+	{"template named args", `template "x" name="bob" count=3 user=.User.Name tags=(printf "%s" .)`, noError,
+		`{{template "x" name="bob" count=3 user=.User.Name tags=(printf "%s" .)}}`},
+	{"template named args value", `$x := .; $r := (template "x" a=$x[0] b=true)`, noError,
+		`{{$x := .}}{{$r := (template "x" a=$x[0] b=true)}}`},
+	{"template named args duplicate", `template "x" a=1 a=2`, hasError, ""},
+	{"template named args missing value", `template "x" a=`, hasError, ""},
+	{"template named args positional", `template "x" a=1 .`, hasError, ""},
+	{"template function call", `template "x" printf "%s" .`, noError, `{{template "x" printf "%s" .}}`},
+	{"return", "return", noError, "{{return}}"},
+	{"return value", "return .X", noError, "{{return .X}}"},
 	// Other kinds of assignments and operators aren't available yet.
 	{"bug0a", "$x := 0\n$x", noError, "{{$x := 0}}{{$x}}"},
 	{"bug0b", "$x += 1\n$x", hasError, ""},
@@ -329,6 +394,7 @@ func (tf TestTemplateFuncs) GetByName(name string) reflect.Value {
 var builtins = TestTemplateFuncs{
 	"printf":   fmt.Sprintf,
 	"contains": strings.Contains,
+	"default":  func(d, v any) any { return v },
 }
 
 func testParse(doCopy bool, t *testing.T) {
@@ -531,6 +597,30 @@ var errorTests = []parseTest{
 		// Declare $x so it's defined, to avoid that error, and then check we don't parse a declaration.
 		"$x := 23\nwith $x.y := 3\n$x 23\nend",
 		hasError, `unexpected ":="`},
+	{"index literal",
+		`"abc"[0]`,
+		hasError, `unexpected [ after term`},
+	{"unclosed index",
+		`.X[0`,
+		hasError, `unclosed left bracket`},
+	{"empty index",
+		`.X[]`,
+		hasError, `missing value for index`},
+	{"index declaration",
+		`.X[$y := 0]`,
+		hasError, `declaration in index`},
+	{"chainedcomparison",
+		".X < .Y < .Z",
+		hasError, `comparisons can't be chained`},
+	{"comparisonoperand",
+		".X <= | .Y",
+		hasError, `missing right operand of <=`},
+	{"logicaloperand",
+		".X && | .Y",
+		hasError, `missing right operand of &&`},
+	{"notoperand",
+		".X !",
+		hasError, `missing operand of !`},
 	{"multidecl",
 		"$a,$b,$c := 23",
 		hasError, `too many declarations`},
@@ -567,6 +657,51 @@ var errorTests = []parseTest{
 	{"rangenotvariable2",
 		"range $k, 123 := .\nend",
 		hasError, `range can only initialize variables`},
+	{"breakoutside",
+		"with .\nbreak\nend",
+		hasError, `{{break}} outside {{range}} or {{for}}`},
+	{"breakinelse",
+		"range .\nelse\n  if .\n    break\n  end\nend",
+		hasError, `{{break}} in {{else}} of {{range}} at breakinelse:1 is outside the loop`},
+	{"continueinelse",
+		"\nrange .\nelse\ncontinue\nend",
+		hasError, `{{continue}} in {{else}} of {{range}} at continueinelse:2 is outside the loop`},
+	// Check line numbers after continuations and multi-line raw strings.
+	{"continuationline",
+		"with . \\\n  $undefined\nend",
+		hasError, `continuationline:2: undefined variable "$undefined"`},
+	{"rawstringline",
+		"with `a\nb` \\\n  1x\nend",
+		hasError, `rawstringline:3: bad number syntax: "1x" in action started at rawstringline:1`},
+	// Check vars blocks.
+	{"varsnottop",
+		"1\nvars\nend",
+		hasError, `varsnottop:2: vars block must be at the top of the template`},
+	{"varslocal",
+		"vars\n$x := 1\nend",
+		hasError, `varslocal:2: vars block can only declare global variables`},
+	{"varsnotliteral",
+		"vars\n$$x := len .\nend",
+		hasError, `varsnotliteral:2: value of constant $$x is not a literal`},
+	{"varsredeclared",
+		"vars\n$$x := 1\n$$x := 2\nend",
+		hasError, `varsredeclared:3: constant $$x redeclared`},
+	{"varsunclosed",
+		"vars\n$$x := 1\n",
+		hasError, `varsunclosed:3: unexpected EOF in vars block`},
+	// Check parameters of definitions.
+	{"paramglobal",
+		"define `a` $$x\nend",
+		hasError, `paramglobal:1: invalid parameter $$x in define clause`},
+	{"paramduplicate",
+		"define `a` $x $x\nend",
+		hasError, `paramduplicate:1: duplicate parameter $x in define clause`},
+	{"paramnotvariable",
+		"define `a` x\nend",
+		hasError, `paramnotvariable:1: unexpected "x" in define clause`},
+	{"paramscope",
+		"define `a` $x\nend\n$x",
+		hasError, `paramscope:3: undefined variable "$x"`},
 }
 
 func TestErrors(t *testing.T) {
@@ -583,6 +718,47 @@ func TestErrors(t *testing.T) {
 	}
 }
 
+func TestBreakInNestedBlocks(t *testing.T) {
+	const input = `range .
+  with .X
+    if .Y
+      break
+    end
+  end
+  range .
+    if .
+      continue
+    end
+  else
+    with .
+      break
+    end
+  end
+end`
+
+	trees, err := Parse("loops", input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines [][2]int
+	Inspect(trees["loops"].Root, func(n Node) bool {
+		switch n := n.(type) {
+		case *BreakNode:
+			lines = append(lines, [2]int{n.Line, n.LoopLine})
+		case *ContinueNode:
+			lines = append(lines, [2]int{n.Line, n.LoopLine})
+		}
+		return true
+	})
+
+	// break in else of the inner range ends the outer range
+	want := [][2]int{{4, 1}, {9, 7}, {13, 1}}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got (line, loop line) %v, want %v", lines, want)
+	}
+}
+
 func TestBlock(t *testing.T) {
 	const (
 		input = `"a"
@@ -653,6 +829,114 @@ func BenchmarkParseLarge(b *testing.B) {
 	}
 }
 
+func TestMultipleDefinitionModes(t *testing.T) {
+	const text = "define `a`\n\"first\"\nend\ndefine `a`\n\"second\"\nend\ndefine `a`\nend"
+
+	for _, test := range []struct {
+		mode     Mode
+		expected string
+		warning  string
+	}{
+		{KeepFirstDefinition, `{{"first"}}`, `template: test:4: multiple definition of template "a", keeping the first one`},
+		{KeepLastDefinition, `{{"second"}}`, `template: test:4: multiple definition of template "a", keeping the last one`},
+	} {
+		tree := New("test", nil)
+		tree.Mode = test.mode
+		treeSet := make(map[string]*Tree)
+		if _, err := tree.Parse(text, treeSet, builtins); err != nil {
+			t.Errorf("mode %d: unexpected error: %v", test.mode, err)
+			continue
+		}
+
+		a := treeSet["a"]
+		if got := a.Root.String(); got != test.expected {
+			t.Errorf("mode %d: got %s, expected %s", test.mode, got, test.expected)
+		}
+		if len(a.Warnings) != 1 || a.Warnings[0] != test.warning {
+			t.Errorf("mode %d: got warnings %q, expected %q", test.mode, a.Warnings, test.warning)
+		}
+	}
+}
+
+func TestDefinitionParams(t *testing.T) {
+	treeSet := make(map[string]*Tree)
+	_, err := New("test", nil).Parse("define `greet` $name $greeting\n$greeting; \", \"; $name\nend\ndefine `none`\nend", treeSet, builtins)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, expected := fmt.Sprint(treeSet["greet"].Params), "[$name $greeting]"; got != expected {
+		t.Errorf("got params %s, expected %s", got, expected)
+	}
+	if got := treeSet["greet"].Copy().Params; len(got) != 2 {
+		t.Errorf("got params %q after copy", got)
+	}
+	if got := treeSet["none"].Params; got != nil {
+		t.Errorf("got params %q, expected none", got)
+	}
+
+	// unused parameters are reported in StrictVars mode
+	tree := New("test", nil)
+	tree.Mode = StrictVars
+	_, err = tree.Parse("define `a` $x $_y\nend", make(map[string]*Tree), builtins)
+	if err == nil || !strings.Contains(err.Error(), "variable $x declared at test:1 is not used") {
+		t.Errorf("got error %v, expected unused $x", err)
+	}
+}
+
+func TestTreeReset(t *testing.T) {
+	texts := []string{
+		"$x := 1\nrange $i, $e := .\n$e; break\nend",
+		"if (1\nend", // fails with pending tokens and open loops
+		`define "foo"; .X; end; template "foo" .`,
+		"with .A\n.B\nelse\n$x := 3\n$x\nend",
+	}
+
+	tree := New("", nil)
+	for i := 0; i < 2; i++ {
+		for _, text := range texts {
+			want, wantErr := New("reset", nil).Parse(text, make(map[string]*Tree), builtins)
+
+			tree.Reset("reset")
+			got, err := tree.Parse(text, make(map[string]*Tree), builtins)
+			switch {
+			case (err != nil) != (wantErr != nil):
+				t.Errorf("%q: got error %v, expected %v", text, err, wantErr)
+			case err != nil:
+				if err.Error() != wantErr.Error() {
+					t.Errorf("%q: got error %q, expected %q", text, err, wantErr)
+				}
+			case got.Root.String() != want.Root.String():
+				t.Errorf("%q: got %s, expected %s", text, got.Root, want.Root)
+			}
+		}
+	}
+}
+
+func BenchmarkParseReset(b *testing.B) {
+	text := "if .A\n.B | printf \"%s\"\nelse\nrange $i, $e := .C\n$i; $e\nend\nend"
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := New("bench", nil).Parse(text, make(map[string]*Tree), builtins)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("reset", func(b *testing.B) {
+		b.ReportAllocs()
+		tree := New("bench", nil)
+		for i := 0; i < b.N; i++ {
+			tree.Reset("bench")
+			_, err := tree.Parse(text, make(map[string]*Tree), builtins)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
 var sinkv, sinkl string
 
 func BenchmarkVariableString(b *testing.B) {
@@ -701,3 +985,24 @@ end
 		b.Fatal("Benchmark was not run")
 	}
 }
+
+func TestVarsBlock(t *testing.T) {
+	trees, err := New("root", nil).Parse("# config\nvars\n  $$title := \"Home\" # comment\n  $$count := 3\n  $$draft := false\n  $$none := nil\nend\n$$title", make(map[string]*Tree), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{`$$title`: `"Home"`, `$$count`: `3`, `$$draft`: `false`, `$$none`: `nil`}
+	if len(trees.Vars) != len(want) {
+		t.Fatalf("got %d vars, want %d", len(trees.Vars), len(want))
+	}
+	for name, value := range want {
+		if n := trees.Vars[name]; n == nil || n.String() != value {
+			t.Errorf("%s: got %v, want %s", name, n, value)
+		}
+	}
+
+	if got := trees.Root.String(); got != "{{$$title}}" {
+		t.Errorf("root: got %q", got)
+	}
+}
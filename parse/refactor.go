@@ -0,0 +1,388 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// varScope resolves local variable references in a tree to the nodes
+// declaring them, following the scoping rules of the parser.
+type varScope struct {
+	visible []*VariableNode // declarations in scope, innermost last.
+
+	// decls maps every local variable node, declaration or reference, to its
+	// declaration, nil for "$".
+	decls map[*VariableNode]*VariableNode
+
+	// scopes records the declarations visible at every variable node.
+	scopes map[*VariableNode][]*VariableNode
+}
+
+func resolveVars(root *ListNode) *varScope {
+	s := &varScope{
+		decls:  make(map[*VariableNode]*VariableNode),
+		scopes: make(map[*VariableNode][]*VariableNode),
+	}
+	s.walk(root)
+	return s
+}
+
+// lookup returns the visible declaration of name, nil if there is none or
+// it is "$", ok is false if the name is not declared.
+func lookup(visible []*VariableNode, name string) (decl *VariableNode, ok bool) {
+	for i := len(visible) - 1; i >= 0; i-- {
+		if visible[i].Ident[0] == name {
+			return visible[i], true
+		}
+	}
+	return nil, name == "$"
+}
+
+func (s *varScope) ref(v *VariableNode) {
+	if IsGlobalVar(v.Ident[0]) {
+		return
+	}
+
+	s.scopes[v] = s.visible
+	s.decls[v], _ = lookup(s.visible, v.Ident[0])
+}
+
+func (s *varScope) walk(node Node) {
+	switch n := node.(type) {
+	case *ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			s.walk(c)
+		}
+	case *ActionNode:
+		s.walk(n.Pipe)
+	case *PipeNode:
+		if n == nil {
+			return
+		}
+		for _, v := range n.Decl {
+			if n.IsAssign || IsGlobalVar(v.Ident[0]) {
+				s.ref(v)
+				continue
+			}
+
+			// copy on write, recorded scopes share the backing array
+			s.visible = append(s.visible[:len(s.visible):len(s.visible)], v)
+			s.ref(v)
+		}
+		for _, c := range n.Cmds {
+			s.walk(c)
+		}
+	case *CommandNode:
+		for _, arg := range n.Args {
+			s.walk(arg)
+		}
+	case *ChainNode:
+		s.walk(n.Node)
+	case *IndexNode:
+		s.walk(n.Node)
+		s.walk(n.Index)
+	case *ComparisonNode:
+		s.walk(n.Left)
+		s.walk(n.Right)
+	case *LogicalNode:
+		s.walk(n.Left)
+		s.walk(n.Right)
+	case *NotNode:
+		s.walk(n.Operand)
+	case *VariableNode:
+		s.ref(n)
+	case *IfNode:
+		s.walkBranch(&n.BranchNode)
+	case *WithNode:
+		s.walkBranch(&n.BranchNode)
+	case *RangeNode:
+		defer func(visible []*VariableNode) { s.visible = visible }(s.visible)
+		s.walk(n.Pipe)
+		for _, stage := range n.Stages {
+			s.walk(stage)
+		}
+		s.walk(n.SortBy)
+		s.walk(n.List)
+		if v := n.ElseVar; v != nil {
+			s.visible = append(s.visible[:len(s.visible):len(s.visible)], v)
+			s.ref(v)
+		}
+		s.walk(n.ElseList)
+	case *ForNode:
+		defer func(visible []*VariableNode) { s.visible = visible }(s.visible)
+		s.walk(n.Init)
+		s.walk(n.Cond)
+		scope := s.visible
+		s.walk(n.List)
+		// variables declared in the body are not visible to post
+		s.visible = scope
+		s.walk(n.Post)
+	case *TryNode:
+		defer func(visible []*VariableNode) { s.visible = visible }(s.visible)
+		scope := s.visible
+		s.walk(n.List)
+		// variables declared in the try list are not visible to catch
+		s.visible = scope
+		if v := n.ErrVar; v != nil {
+			s.visible = append(s.visible[:len(s.visible):len(s.visible)], v)
+			s.ref(v)
+		}
+		s.walk(n.Catch)
+	case *SwitchNode:
+		defer func(visible []*VariableNode) { s.visible = visible }(s.visible)
+		s.walk(n.Pipe)
+		// variables declared in a case are only visible to its list
+		scope := s.visible
+		for _, c := range n.Cases {
+			s.walk(c.Pipe)
+			s.walk(c.List)
+			s.visible = scope
+		}
+		s.walk(n.Default)
+	case *TemplateNode:
+		s.walk(n.Pipe)
+		for _, arg := range n.Named {
+			s.walk(arg.Value)
+		}
+	case *ReturnNode:
+		s.walk(n.Pipe)
+	}
+}
+
+func (s *varScope) walkBranch(b *BranchNode) {
+	defer func(visible []*VariableNode) { s.visible = visible }(s.visible)
+	s.walk(b.Pipe)
+	s.walk(b.List)
+	s.walk(b.ElseList)
+}
+
+// isVarName reports whether name is a valid name of a local variable.
+func isVarName(name string) bool {
+	if len(name) < 2 || name[0] != '$' || IsGlobalVar(name) {
+		return false
+	}
+
+	for _, r := range name[1:] {
+		if !isAlphaNumeric(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// RenameVar renames the local variable declared or referenced by the
+// variable node at pos, and all other references to the same declaration.
+//
+// It fails without changing the tree if the new name would change the
+// meaning of the template, i.e. when a renamed reference would resolve to
+// another variable, or another reference would resolve to the renamed one.
+func (t *Tree) RenameVar(pos Pos, newName string) error {
+	if !isVarName(newName) {
+		return fmt.Errorf("template: %s: invalid variable name %q", t.Name, newName)
+	}
+
+	s := resolveVars(t.Root)
+
+	var target *VariableNode
+	for v := range s.decls {
+		if v.Pos == pos {
+			target = v
+			break
+		}
+	}
+
+	if target == nil {
+		return fmt.Errorf("template: %s: no local variable at %d", t.Name, pos)
+	}
+
+	decl := s.decls[target]
+	if decl == nil {
+		return fmt.Errorf("template: %s: cannot rename %s", t.Name, target.Ident[0])
+	}
+
+	var nodes []*VariableNode
+	for v, d := range s.decls {
+		loc, _ := t.ErrorContext(v)
+		switch {
+		case d == decl:
+			if !isVisible(s.scopes[v], decl, newName) {
+				return fmt.Errorf("template: %s: %s would refer to another %s", loc, decl.Ident[0], newName)
+			}
+			nodes = append(nodes, v)
+		case v.Ident[0] == newName && isVisible(s.scopes[v], decl, newName):
+			return fmt.Errorf("template: %s: %s would refer to the renamed %s", loc, newName, decl.Ident[0])
+		}
+	}
+
+	for _, v := range nodes {
+		v.Ident[0] = newName
+	}
+
+	return nil
+}
+
+// isVisible reports whether decl is declared in visible after the
+// declaration currently named name, in which case decl would shadow it once
+// renamed to name.
+func isVisible(visible []*VariableNode, decl *VariableNode, name string) bool {
+	for i := len(visible) - 1; i >= 0; i-- {
+		if visible[i] == decl {
+			return true
+		}
+		if visible[i].Ident[0] == name {
+			return false
+		}
+	}
+	return false
+}
+
+// Extract moves the consecutive nodes of a list in t, from the node
+// positioned at start (see Node.Position) up to the last node positioned
+// before end, into a new tree named name, and replaces them with an
+// invocation of the new tree with the current dot. t is changed in place,
+// trees shared with executions must be copied first.
+//
+// It fails without changing t when the extracted nodes would behave
+// differently in a separate template: referencing local variables declared
+// outside them, declaring variables used after them, or containing break,
+// continue or return for enclosing blocks.
+func (t *Tree) Extract(start, end Pos, name string) (*Tree, error) {
+	var (
+		list     *ListNode
+		from, to int
+	)
+
+	Inspect(t.Root, func(n Node) bool {
+		l, ok := n.(*ListNode)
+		if !ok || list != nil {
+			return list == nil
+		}
+
+		for i, c := range l.Nodes {
+			if c.Position() != start {
+				continue
+			}
+
+			list, from, to = l, i, i+1
+			for to < len(l.Nodes) && l.Nodes[to].Position() < end {
+				to++
+			}
+			return false
+		}
+		return true
+	})
+
+	if list == nil {
+		return nil, fmt.Errorf("template: %s: no node to extract at %d", t.Name, start)
+	}
+
+	var (
+		nodes    = list.Nodes[from:to]
+		s        = resolveVars(t.Root)
+		selected = make(map[*VariableNode]struct{})
+		recurses []*TemplateNode
+		loops    int
+		err      error
+	)
+
+	fail := func(n Node, format string, args ...any) {
+		if err == nil {
+			loc, _ := t.ErrorContext(n)
+			err = fmt.Errorf("template: %s: "+format, append([]any{loc}, args...)...)
+		}
+	}
+
+	var check func(n Node) bool
+	check = func(n Node) bool {
+		switch n := n.(type) {
+		case *VariableNode:
+			if _, ok := s.decls[n]; ok {
+				selected[n] = struct{}{}
+			}
+		case *RangeNode:
+			loops++
+			Inspect(n.List, check)
+			loops--
+			Inspect(n.Pipe, check)
+			for _, stage := range n.Stages {
+				Inspect(stage, check)
+			}
+			Inspect(n.SortBy, check)
+			Inspect(n.ElseVar, check)
+			Inspect(n.ElseList, check)
+			return false
+		case *ForNode:
+			loops++
+			Inspect(n.List, check)
+			loops--
+			Inspect(n.Init, check)
+			Inspect(n.Cond, check)
+			Inspect(n.Post, check)
+			return false
+		case *BreakNode:
+			if loops == 0 {
+				fail(n, "cannot extract break of enclosing loop")
+			}
+		case *ContinueNode:
+			if loops == 0 {
+				fail(n, "cannot extract continue of enclosing loop")
+			}
+		case *ReturnNode:
+			fail(n, "cannot extract return")
+		case *TemplateNode:
+			if n.Recurse {
+				recurses = append(recurses, n)
+			}
+		}
+		return true
+	}
+
+	for _, n := range nodes {
+		Inspect(n, check)
+	}
+
+	for v, decl := range s.decls {
+		_, in := selected[v]
+		_, declIn := selected[decl]
+		switch {
+		case in && decl == nil && list != t.Root:
+			fail(v, "cannot extract reference to $ in nested block")
+		case in && decl != nil && !declIn:
+			fail(v, "cannot extract reference to %s declared outside", v.Ident[0])
+		case !in && declIn:
+			fail(v, "cannot extract declaration of %s used after it", v.Ident[0])
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range recurses {
+		// still invoking t by name from the new template
+		n.Recurse = false
+	}
+
+	tree := &Tree{
+		Name:      name,
+		ParseName: t.ParseName,
+		Root:      t.newList(nodes[0].Position()),
+		Line:      1 + strings.Count(t.text[:start], "\n"),
+		Mode:      t.Mode,
+		text:      t.text,
+	}
+	tree.Root.Nodes = append(tree.Root.Nodes, nodes...)
+
+	cmd := t.newCommand(start)
+	cmd.append(t.newDot(start))
+	pipe := t.newPipeline(start, tree.Line, nil)
+	pipe.append(cmd)
+
+	rest := append([]Node{t.newTemplate(start, tree.Line, name, pipe)}, list.Nodes[to:]...)
+	list.Nodes = append(list.Nodes[:from], rest...)
+
+	return tree, nil
+}
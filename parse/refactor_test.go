@@ -0,0 +1,152 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenameVar(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		at       string // the variable to rename is at the first occurrence
+		newName  string
+		expected string // tree after renaming, or error
+	}{
+		{
+			"Declaration",
+			"$x := 1; $x; with $x; $x := 2; $x; end; $x",
+			"$x", "$y",
+			`{{$y := 1}}{{$y}}{{with $y}}{{$x := 2}}{{$x}}{{end}}{{$y}}`,
+		},
+		{
+			"Reference",
+			"range $i, $v := .; $v; end; $v := 1; $v",
+			"$v;", "$e",
+			`{{range $i, $e := .}}{{$e}}{{end}}{{$v := 1}}{{$v}}`,
+		},
+		{
+			"Assignment",
+			"$x := 1; if .; $x = 2; end; $x",
+			"$x", "$y",
+			`{{$y := 1}}{{if .}}{{$y = 2}}{{end}}{{$y}}`,
+		},
+		{
+			"Shadowed",
+			"$x := 1; $y := 2; $x",
+			"$x", "$y",
+			`template: test:1:18: $x would refer to another $y`,
+		},
+		{
+			"Capture",
+			"$y := 1; with .; $x := 2; $y; end",
+			"$x :=", "$y",
+			`template: test:1:26: $y would refer to the renamed $x`,
+		},
+		{
+			"Dollar",
+			"$",
+			"$", "$y",
+			`template: test: cannot rename $`,
+		},
+		{
+			"InvalidName",
+			"$x := 1",
+			"$x", "$$x",
+			`template: test: invalid variable name "$$x"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree, err := New("test", nil).Parse(test.input, make(map[string]*Tree), builtins)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got string
+			err = tree.RenameVar(Pos(strings.Index(test.input, test.at)), test.newName)
+			if err != nil {
+				got = err.Error()
+			} else {
+				got = tree.Root.String()
+			}
+
+			if got != test.expected {
+				t.Errorf("got\n\t%s\nexpected\n\t%s", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		from, to string // selection starts at from, ends before to
+		expected string // trees after extraction, or error
+	}{
+		{
+			"Root",
+			`"a"; $x := 1; $x; $; "b"`,
+			"$x :=", `"b"`,
+			`{{"a"}}{{template "new" .}}{{"b"}} | {{$x := 1}}{{$x}}{{$}}`,
+		},
+		{
+			"Nested",
+			`range .X; if .; break; end; range .Y; break; end; "c"; end`,
+			".Y", `"c"`,
+			`{{range .X}}{{if .}}{{break}}{{end}}{{template "new" .}}{{"c"}}{{end}} | {{range .Y}}{{break}}{{end}}`,
+		},
+		{
+			"OutsideVar",
+			`$x := 1; printf $x`,
+			"printf", "",
+			`template: test:1:16: cannot extract reference to $x declared outside`,
+		},
+		{
+			"UsedAfter",
+			`$x := 1; $x`,
+			"$x :=", "$x;",
+			`template: test:1:9: cannot extract declaration of $x used after it`,
+		},
+		{
+			"Break",
+			`range .; "a"; break; end`,
+			`"a"`, "",
+			`template: test:1:14: cannot extract break of enclosing loop`,
+		},
+		{
+			"NestedDollar",
+			`with .X; $.Y; end`,
+			"$.Y", "",
+			`template: test:1:10: cannot extract reference to $ in nested block`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree, err := New("test", nil).Parse(test.input, make(map[string]*Tree), builtins)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			end := Pos(len(test.input))
+			if test.to != "" {
+				end = Pos(strings.Index(test.input, test.to))
+			}
+
+			var got string
+			extracted, err := tree.Extract(Pos(strings.Index(test.input, test.from)), end, "new")
+			if err != nil {
+				got = err.Error()
+			} else {
+				got = tree.Root.String() + " | " + extracted.Root.String()
+			}
+
+			if got != test.expected {
+				t.Errorf("got\n\t%s\nexpected\n\t%s", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TokenType identifies the type of a Token.
+type TokenType int
+
+const (
+	TokenError       TokenType = iota // unlexable rest of the input
+	TokenSpace                        // whitespace, including line continuations
+	TokenComment                      // comment, including the leading '#'
+	TokenKeyword                      // keyword such as if, range or define
+	TokenBool                         // true or false
+	TokenNil                          // the untyped nil constant
+	TokenDot                          // the cursor, spelled '.'
+	TokenNumber                       // number, including complex constants
+	TokenString                       // quoted string (includes quotes)
+	TokenRawString                    // raw quoted string (includes quotes)
+	TokenChar                         // character constant (includes quotes)
+	TokenField                        // field access such as .Name
+	TokenVariable                     // variable such as $x or $$x
+	TokenIdentifier                   // function name
+	TokenOperator                     // '|', '=', ':=', comparison or logical operators
+	TokenPunctuation                  // parentheses, ';' and other ASCII punctuations
+)
+
+var tokenNames = [...]string{
+	TokenError:       "error",
+	TokenSpace:       "space",
+	TokenComment:     "comment",
+	TokenKeyword:     "keyword",
+	TokenBool:        "bool",
+	TokenNil:         "nil",
+	TokenDot:         "dot",
+	TokenNumber:      "number",
+	TokenString:      "string",
+	TokenRawString:   "raw string",
+	TokenChar:        "char",
+	TokenField:       "field",
+	TokenVariable:    "variable",
+	TokenIdentifier:  "identifier",
+	TokenOperator:    "operator",
+	TokenPunctuation: "punctuation",
+}
+
+func (t TokenType) String() string {
+	if t < 0 || int(t) >= len(tokenNames) {
+		return fmt.Sprintf("TokenType(%d)", int(t))
+	}
+	return tokenNames[t]
+}
+
+// Token is a lexical token of template source.
+//
+// Line and Col are the physical position of the token in the input, while
+// ActionLine is its logical line: the line starting the action containing
+// the token, which differs from Line after backslash continuations and
+// multi-line raw strings.
+type Token struct {
+	Type       TokenType
+	Pos        Pos    // byte offset of the token in the input
+	Val        string // source text of the token
+	Line       int    // line number at the start of the token
+	Col        int    // byte offset of the token in its line
+	ActionLine int    // line of the action containing the token, 0 if outside actions
+}
+
+// Tokenize splits the template source into tokens using the same rules as
+// the parser.
+//
+// The tokenization is lossless: concatenating the Val of all returned tokens
+// reproduces input exactly, whitespace and comments included, which makes it
+// suitable for syntax highlighting and formatting tools.
+//
+// When the input cannot be lexed, the rest of the input is returned as a
+// single TokenError and the error describes the problem.
+func Tokenize(name, input string) (tokens []Token, err error) {
+	var (
+		l          = lex(name, input, true)
+		end        Pos
+		line       = 1
+		lineStart  Pos
+		actionLine int
+	)
+
+	add := func(typ TokenType, val string) {
+		tokens = append(tokens, Token{
+			Type:       typ,
+			Pos:        end,
+			Val:        val,
+			Line:       line,
+			Col:        int(end - lineStart),
+			ActionLine: actionLine,
+		})
+		end += Pos(len(val))
+		if n := strings.Count(val, "\n"); n != 0 {
+			line += n
+			lineStart = end - Pos(len(val)-strings.LastIndexByte(val, '\n')-1)
+		}
+	}
+
+	// gap emits the text skipped by the lexer before pos, which is only
+	// whitespace and action separators.
+	gap := func(pos Pos) {
+		for end < pos {
+			s := input[end:pos]
+			if s[0] == ';' {
+				add(TokenPunctuation, ";")
+				continue
+			}
+
+			n := strings.IndexByte(s, ';')
+			if n < 0 {
+				n = len(s)
+			}
+			add(TokenSpace, s[:n])
+		}
+	}
+
+	for {
+		it := l.nextItem()
+		switch it.typ {
+		case itemEOF:
+			gap(Pos(len(input)))
+			return
+		case itemError:
+			if end < Pos(len(input)) {
+				add(TokenError, input[end:])
+			}
+			return tokens, fmt.Errorf("%s:%d: %s", name, it.line, it.val)
+		case itemLeftDelim:
+			gap(it.pos)
+			actionLine = it.line
+		case itemRightDelim:
+			gap(it.pos)
+			actionLine = 0
+		case itemComment:
+			// the lexer strips the leading '#'
+			it.pos--
+			it.val = input[it.pos : int(it.pos)+1+len(it.val)]
+		}
+
+		if len(it.val) == 0 {
+			continue
+		}
+
+		gap(it.pos)
+		add(tokenType(it.typ), it.val)
+	}
+}
+
+// tokenType maps lexer item types to token types.
+func tokenType(typ itemType) TokenType {
+	switch typ {
+	case itemSpace:
+		return TokenSpace
+	case itemComment:
+		return TokenComment
+	case itemBool:
+		return TokenBool
+	case itemNil:
+		return TokenNil
+	case itemDot:
+		return TokenDot
+	case itemNumber, itemComplex:
+		return TokenNumber
+	case itemString:
+		return TokenString
+	case itemRawString:
+		return TokenRawString
+	case itemCharConstant:
+		return TokenChar
+	case itemField:
+		return TokenField
+	case itemVariable:
+		return TokenVariable
+	case itemIdentifier:
+		return TokenIdentifier
+	case itemPipe, itemAssign, itemDeclare, itemCompare, itemAnd, itemOr, itemNot:
+		return TokenOperator
+	case itemLeftParen, itemRightParen, itemLeftBracket, itemRightBracket, itemChar:
+		return TokenPunctuation
+	}
+
+	if typ > itemKeyword {
+		return TokenKeyword
+	}
+
+	return TokenError
+}
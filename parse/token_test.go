@@ -0,0 +1,72 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	const input = "a  # c\n  if .X | f \\\n  $y; \"s\" 'c' `r`\nend\n# tail"
+
+	tokens, err := Tokenize("test", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		sb    strings.Builder
+		types []string
+	)
+	for _, tk := range tokens {
+		if input[tk.Pos:int(tk.Pos)+len(tk.Val)] != tk.Val {
+			t.Errorf("token %v at %d does not match input", tk.Val, tk.Pos)
+		}
+		sb.WriteString(tk.Val)
+		if tk.Type != TokenSpace {
+			types = append(types, tk.Type.String()+":"+tk.Val)
+		}
+	}
+
+	if sb.String() != input {
+		t.Errorf("tokens do not reproduce input, got %q", sb.String())
+	}
+
+	expected := []string{
+		"identifier:a", "comment:# c\n", "keyword:if", "field:.X", "operator:|",
+		"identifier:f", "variable:$y", "punctuation:;", "string:\"s\"", "char:'c'",
+		"raw string:`r`", "keyword:end", "comment:# tail",
+	}
+	if strings.Join(types, " ") != strings.Join(expected, " ") {
+		t.Errorf("got\n\t%v\nexpected\n\t%v", types, expected)
+	}
+
+	if last := tokens[len(tokens)-1]; last.Line != 5 {
+		t.Errorf("last token at line %d, expected 5", last.Line)
+	}
+
+	// $y follows a continuation
+	for _, tk := range tokens {
+		if tk.Val == "$y" && (tk.Line != 3 || tk.Col != 2 || tk.ActionLine != 2) {
+			t.Errorf("$y at %d:%d in action at %d, expected 3:2 in action at 2", tk.Line, tk.Col, tk.ActionLine)
+		}
+	}
+}
+
+func TestTokenizeLossless(t *testing.T) {
+	for _, test := range lexTests {
+		tokens, err := Tokenize(test.name, test.input)
+		var sb strings.Builder
+		for _, tk := range tokens {
+			sb.WriteString(tk.Val)
+		}
+
+		if sb.String() != test.input {
+			t.Errorf("%s: got %q, expected %q", test.name, sb.String(), test.input)
+		}
+
+		hasError := test.items[len(test.items)-1].typ == itemError
+		if hasError != (err != nil) {
+			t.Errorf("%s: unexpected error state %v", test.name, err)
+		}
+	}
+}
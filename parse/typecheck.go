@@ -0,0 +1,388 @@
+package parse
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FuncSignature is the signature of a function for type checking, nil
+// types are unknown and match any type.
+type FuncSignature struct {
+	Params   []reflect.Type // types of parameters filled by arguments.
+	Variadic bool           // the last parameter is variadic.
+	Result   reflect.Type   // type of the result.
+}
+
+// TypedFuncs is implemented by TemplateFuncs knowing signatures of their
+// functions, calls of them are type checked when Tree.DataType is set.
+type TypedFuncs interface {
+	TemplateFuncs
+
+	// Signature returns the signature of the function name, ok is false
+	// if the signature is unknown.
+	Signature(name string) (sig FuncSignature, ok bool)
+}
+
+// literal is the kind of a constant argument, whose value converts to
+// parameters of any type of the kind.
+type literal int
+
+const (
+	notLiteral literal = iota
+	stringLiteral
+	boolLiteral
+	numberLiteral
+	nilLiteral
+)
+
+// typeCheck checks types of pipelines in the tree with dot of the type dot,
+// nil if unknown. Only definite mismatches are reported: values of unknown
+// types, interfaces and fields not found by name (which may be resolved by
+// struct tags at execution) are accepted.
+func (t *Tree) typeCheck(dot reflect.Type) {
+	t.checkNode(t.Root, dot, dot)
+}
+
+// typeErrorf reports a type error at node n.
+func (t *Tree) typeErrorf(n Node, format string, args ...any) {
+	t.token[0].line = 1 + strings.Count(t.text[:n.Position()], "\n")
+	t.errorf(format, args...)
+}
+
+// checkNode checks pipelines in n, root is the type of $.
+func (t *Tree) checkNode(n Node, dot, root reflect.Type) {
+	switch n := n.(type) {
+	case *ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			t.checkNode(c, dot, root)
+		}
+	case *ActionNode:
+		t.pipeType(n.Pipe, dot, root)
+	case *IfNode:
+		t.pipeType(n.Pipe, dot, root)
+		t.checkNode(n.List, dot, root)
+		t.checkNode(n.ElseList, dot, root)
+	case *WithNode:
+		typ := t.pipeType(n.Pipe, dot, root)
+		t.checkNode(n.List, typ, root)
+		t.checkNode(n.ElseList, dot, root)
+	case *RangeNode:
+		var elem reflect.Type
+		if typ := indirectType(t.pipeType(n.Pipe, dot, root)); typ != nil {
+			switch typ.Kind() {
+			case reflect.Array, reflect.Slice, reflect.Map, reflect.Chan:
+				elem = typ.Elem()
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				elem = typ
+			}
+		}
+		for _, stage := range n.Stages {
+			if stage.Args[0].(*IdentifierNode).Ident == "filter" {
+				t.argType(stage.Args[1], elem, root)
+				continue
+			}
+			for _, arg := range stage.Args[1:] {
+				t.argType(arg, dot, root)
+			}
+		}
+		if n.SortBy != nil {
+			t.pipeType(n.SortBy, elem, root)
+		}
+		t.checkNode(n.List, elem, root)
+		t.checkNode(n.ElseList, dot, root)
+	case *ForNode:
+		for _, p := range []*PipeNode{n.Init, n.Cond} {
+			if p != nil {
+				t.pipeType(p, dot, root)
+			}
+		}
+		t.checkNode(n.List, dot, root)
+		if n.Post != nil {
+			t.pipeType(n.Post, dot, root)
+		}
+	case *TryNode:
+		t.checkNode(n.List, dot, root)
+		t.checkNode(n.Catch, dot, root)
+	case *SwitchNode:
+		if n.Pipe != nil {
+			t.pipeType(n.Pipe, dot, root)
+		}
+		for _, c := range n.Cases {
+			t.pipeType(c.Pipe, dot, root)
+			t.checkNode(c.List, dot, root)
+		}
+		t.checkNode(n.Default, dot, root)
+	case *TemplateNode:
+		if n.Pipe != nil {
+			t.pipeType(n.Pipe, dot, root)
+		}
+		for _, arg := range n.Named {
+			t.argType(arg.Value, dot, root)
+		}
+	case *ReturnNode:
+		if n.Pipe != nil {
+			t.pipeType(n.Pipe, dot, root)
+		}
+	}
+}
+
+// pipeType checks pipe and returns the type of its value.
+func (t *Tree) pipeType(pipe *PipeNode, dot, root reflect.Type) (typ reflect.Type) {
+	for i, cmd := range pipe.Cmds {
+		typ = t.cmdType(cmd, dot, root, typ, i > 0)
+	}
+	return typ
+}
+
+// cmdType checks cmd and returns the type of its value, piped is the type of
+// the value of the previous command if hasPiped.
+func (t *Tree) cmdType(cmd *CommandNode, dot, root, piped reflect.Type, hasPiped bool) reflect.Type {
+	switch arg := cmd.Args[0].(type) {
+	case *IdentifierNode:
+		return t.callType(arg, cmd.Args[1:], dot, root, piped, hasPiped)
+	case *ComparisonNode:
+		t.cmdType(arg.Left, dot, root, piped, hasPiped)
+		t.cmdType(arg.Right, dot, root, nil, false)
+		return reflect.TypeOf(false)
+	case *LogicalNode:
+		left := t.cmdType(arg.Left, dot, root, piped, hasPiped)
+		if right := t.cmdType(arg.Right, dot, root, nil, false); left != right {
+			// the result is either operand
+			return nil
+		}
+		return left
+	}
+
+	// arguments of methods are not checked, but may contain calls
+	for _, arg := range cmd.Args[1:] {
+		t.argType(arg, dot, root)
+	}
+
+	typ, _ := t.argType(cmd.Args[0], dot, root)
+	return typ
+}
+
+// callType checks the call of the function id and returns the type of its
+// result.
+func (t *Tree) callType(id *IdentifierNode, args []Node, dot, root, piped reflect.Type, hasPiped bool) reflect.Type {
+	typed, ok := t.funcs.(TypedFuncs)
+	if !ok {
+		for _, arg := range args {
+			t.argType(arg, dot, root)
+		}
+		return nil
+	}
+
+	sig, ok := typed.Signature(id.Ident)
+	if !ok {
+		for _, arg := range args {
+			t.argType(arg, dot, root)
+		}
+		return nil
+	}
+
+	n := len(args)
+	if hasPiped {
+		n++
+	}
+	switch {
+	case sig.Variadic && n < len(sig.Params)-1:
+		t.typeErrorf(id, "wrong number of args for %s: want at least %d got %d", id.Ident, len(sig.Params)-1, n)
+	case !sig.Variadic && n != len(sig.Params):
+		t.typeErrorf(id, "wrong number of args for %s: want %d got %d", id.Ident, len(sig.Params), n)
+	}
+
+	param := func(i int) reflect.Type {
+		if sig.Variadic && i >= len(sig.Params)-1 {
+			if p := sig.Params[len(sig.Params)-1]; p != nil {
+				return p.Elem()
+			}
+			return nil
+		}
+		return sig.Params[i]
+	}
+
+	for i, arg := range args {
+		typ, lit := t.argType(arg, dot, root)
+		if p := param(i); !assignable(typ, lit, p) {
+			t.typeErrorf(arg, "wrong type for argument %d of %s: expected %s; got %s", i+1, id.Ident, p, describe(typ, lit))
+		}
+	}
+	if hasPiped {
+		if p := param(len(args)); !assignable(piped, notLiteral, p) {
+			t.typeErrorf(id, "wrong type for piped argument of %s: expected %s; got %s", id.Ident, p, piped)
+		}
+	}
+
+	return sig.Result
+}
+
+// argType checks arg and returns its type, lit is the kind of constants.
+func (t *Tree) argType(arg Node, dot, root reflect.Type) (typ reflect.Type, lit literal) {
+	switch arg := arg.(type) {
+	case *StringNode:
+		return reflect.TypeOf(""), stringLiteral
+	case *BoolNode:
+		return reflect.TypeOf(false), boolLiteral
+	case *NumberNode:
+		return nil, numberLiteral
+	case *NilNode:
+		return nil, nilLiteral
+	case *DotNode:
+		return dot, notLiteral
+	case *FieldNode:
+		return t.fieldsType(arg, dot, arg.Ident), notLiteral
+	case *VariableNode:
+		if arg.Ident[0] != "$" {
+			// types of other variables are not tracked
+			return nil, notLiteral
+		}
+		return t.fieldsType(arg, root, arg.Ident[1:]), notLiteral
+	case *ChainNode:
+		typ, _ = t.argType(arg.Node, dot, root)
+		return t.fieldsType(arg, typ, arg.Field), notLiteral
+	case *IndexNode:
+		typ, _ = t.argType(arg.Node, dot, root)
+		t.pipeType(arg.Index, dot, root)
+		return t.elemType(arg, typ), notLiteral
+	case *PipeNode:
+		return t.pipeType(arg, dot, root), notLiteral
+	case *NotNode:
+		t.argType(arg.Operand, dot, root)
+		return reflect.TypeOf(false), notLiteral
+	case *IdentifierNode:
+		return t.callType(arg, nil, dot, root, nil, false), notLiteral
+	}
+
+	return nil, notLiteral
+}
+
+// fieldsType returns the type of the chain of fields of a value of type typ.
+func (t *Tree) fieldsType(n Node, typ reflect.Type, fields []string) reflect.Type {
+	for _, name := range fields {
+		if typ == nil {
+			return nil
+		}
+
+		methods := typ
+		if typ.Kind() != reflect.Pointer && typ.Kind() != reflect.Interface {
+			methods = reflect.PointerTo(typ)
+		}
+
+		if _, ok := methods.MethodByName("Resolve"); ok {
+			// resolves fields by itself
+			return nil
+		}
+
+		if m, ok := methods.MethodByName(name); ok {
+			if m.Type.NumOut() == 0 {
+				return nil
+			}
+			typ = m.Type.Out(0)
+			continue
+		}
+
+		typ = indirectType(typ)
+		switch typ.Kind() {
+		case reflect.Struct:
+			f, ok := typ.FieldByName(name)
+			if !ok {
+				// may be matched by struct tags or accessor methods
+				return nil
+			}
+			typ = f.Type
+		case reflect.Map:
+			if typ.Key().Kind() != reflect.String {
+				return nil
+			}
+			typ = typ.Elem()
+		case reflect.Interface:
+			return nil
+		default:
+			t.typeErrorf(n, "can't evaluate field %s in type %s", name, typ)
+		}
+	}
+
+	return typ
+}
+
+// elemType returns the type of elements of a value of type typ indexed by n.
+func (t *Tree) elemType(n *IndexNode, typ reflect.Type) reflect.Type {
+	typ = indirectType(typ)
+	if typ == nil {
+		return nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map:
+		return typ.Elem()
+	case reflect.String:
+		return reflect.TypeOf(byte(0))
+	case reflect.Interface:
+		return nil
+	}
+
+	t.typeErrorf(n, "can't index item of type %s", typ)
+	return nil
+}
+
+// indirectType returns the type pointed to by typ, through all pointers.
+func indirectType(typ reflect.Type) reflect.Type {
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// assignable reports whether a value of type typ, or a constant of the kind
+// lit, may be passed as a parameter of type param.
+func assignable(typ reflect.Type, lit literal, param reflect.Type) bool {
+	if param == nil || param.Kind() == reflect.Interface && param.NumMethod() == 0 {
+		return true
+	}
+
+	switch lit {
+	case stringLiteral:
+		return param.Kind() == reflect.String
+	case boolLiteral:
+		return param.Kind() == reflect.Bool
+	case numberLiteral:
+		switch param.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+			return true
+		}
+		return false
+	case nilLiteral:
+		switch param.Kind() {
+		case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Pointer, reflect.Slice:
+			return true
+		}
+		return false
+	}
+
+	if typ == nil || typ.Kind() == reflect.Interface {
+		return true
+	}
+
+	return typ.AssignableTo(param) ||
+		typ.Kind() == reflect.Pointer && typ.Elem().AssignableTo(param) ||
+		reflect.PointerTo(typ).AssignableTo(param)
+}
+
+// describe returns the description of the type of an argument in errors.
+func describe(typ reflect.Type, lit literal) string {
+	switch lit {
+	case numberLiteral:
+		return "number constant"
+	case nilLiteral:
+		return "nil"
+	}
+	return fmt.Sprint(typ)
+}
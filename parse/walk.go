@@ -0,0 +1,103 @@
+package parse
+
+// Inspect traverses the parse tree rooted at node in depth-first order,
+// it calls f(node) for each node, if f returns true, Inspect continues
+// with the children of node.
+//
+// Nil nodes are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || isNilNode(node) || !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *ListNode:
+		for _, c := range n.Nodes {
+			Inspect(c, f)
+		}
+	case *ActionNode:
+		Inspect(n.Pipe, f)
+	case *PipeNode:
+		for _, v := range n.Decl {
+			Inspect(v, f)
+		}
+		for _, c := range n.Cmds {
+			Inspect(c, f)
+		}
+	case *CommandNode:
+		for _, arg := range n.Args {
+			Inspect(arg, f)
+		}
+	case *ChainNode:
+		Inspect(n.Node, f)
+	case *IndexNode:
+		Inspect(n.Node, f)
+		Inspect(n.Index, f)
+	case *ComparisonNode:
+		Inspect(n.Left, f)
+		Inspect(n.Right, f)
+	case *LogicalNode:
+		Inspect(n.Left, f)
+		Inspect(n.Right, f)
+	case *NotNode:
+		Inspect(n.Operand, f)
+	case *IfNode:
+		inspectBranch(&n.BranchNode, f)
+	case *RangeNode:
+		Inspect(n.Pipe, f)
+		for _, stage := range n.Stages {
+			Inspect(stage, f)
+		}
+		Inspect(n.SortBy, f)
+		Inspect(n.List, f)
+		Inspect(n.ElseVar, f)
+		Inspect(n.ElseList, f)
+	case *ForNode:
+		Inspect(n.Init, f)
+		Inspect(n.Cond, f)
+		Inspect(n.List, f)
+		Inspect(n.Post, f)
+	case *WithNode:
+		inspectBranch(&n.BranchNode, f)
+	case *TryNode:
+		Inspect(n.List, f)
+		Inspect(n.ErrVar, f)
+		Inspect(n.Catch, f)
+	case *SwitchNode:
+		Inspect(n.Pipe, f)
+		for _, c := range n.Cases {
+			Inspect(c, f)
+		}
+		Inspect(n.Default, f)
+	case *CaseNode:
+		Inspect(n.Pipe, f)
+		Inspect(n.List, f)
+	case *TemplateNode:
+		Inspect(n.Pipe, f)
+		for _, arg := range n.Named {
+			Inspect(arg.Value, f)
+		}
+	case *ReturnNode:
+		Inspect(n.Pipe, f)
+	}
+}
+
+func inspectBranch(b *BranchNode, f func(Node) bool) {
+	Inspect(b.Pipe, f)
+	Inspect(b.List, f)
+	Inspect(b.ElseList, f)
+}
+
+// isNilNode reports whether node is a typed nil pointer stored in the
+// Node interface, which happens with optional fields like ElseList.
+func isNilNode(node Node) bool {
+	switch n := node.(type) {
+	case *ListNode:
+		return n == nil
+	case *PipeNode:
+		return n == nil
+	case *VariableNode:
+		return n == nil
+	}
+	return false
+}
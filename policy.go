@@ -0,0 +1,210 @@
+package tlang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by calls of functions failing fast while their
+// circuit breaker is open, see CallPolicy.
+var ErrCircuitOpen = errors.New("template: circuit open")
+
+// CallPolicy configures how calls of a flaky function, e.g. one fetching
+// remote data, are retried, stopped when failing repeatedly and degraded to
+// a fallback value, see WithPolicies.
+type CallPolicy struct {
+	// Retries is the number of attempts made after a failed call.
+	Retries int
+
+	// Backoff is the delay before the first retry, doubled before every
+	// following one up to MaxBackoff if set. Functions taking Env stop
+	// waiting when Env.Context is done.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// FailureThreshold, if positive, is the number of successive failed
+	// calls, including their retries, opening the circuit breaker of the
+	// function: calls then fail fast with ErrCircuitOpen for OpenDuration,
+	// after which a single trial call closes the circuit if it succeeds,
+	// or opens it again.
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	// Fallback, if not nil, is returned instead of the errors of failed
+	// calls and calls failing fast, so that renders degrade instead of
+	// failing. It must be assignable to the result of the function.
+	Fallback any
+}
+
+// WithPolicies returns a copy of funcs with the functions named in policies
+// wrapped to follow their CallPolicy, the state of circuit breakers is
+// shared by all executions using the returned functions.
+//
+// It panics if a function in policies is not in funcs, does not return an
+// error, or has a result the fallback is not assignable to.
+func WithPolicies(funcs FuncMap, policies map[string]CallPolicy) FuncMap {
+	ret := make(FuncMap, len(funcs))
+	for name, fn := range funcs {
+		ret[name] = fn
+	}
+
+	for name, policy := range policies {
+		fn := reflect.ValueOf(funcs[name])
+		if fn.Kind() != reflect.Func {
+			panic(fmt.Sprintf("no function %q for call policy", name))
+		}
+		typ := fn.Type()
+		if typ.NumOut() != 2 || typ.Out(1) != errorType {
+			panic(fmt.Sprintf("function %q with call policy must return an error", name))
+		}
+
+		p := &policyCall{fn: fn, policy: policy}
+		if policy.Fallback != nil {
+			fallback := reflect.ValueOf(policy.Fallback)
+			if !fallback.Type().AssignableTo(typ.Out(0)) {
+				panic(fmt.Sprintf("fallback of function %q: %s is not assignable to %s", name, fallback.Type(), typ.Out(0)))
+			}
+			p.fallback = reflect.New(typ.Out(0)).Elem()
+			p.fallback.Set(fallback)
+		}
+
+		ret[name] = reflect.MakeFunc(typ, p.call).Interface()
+	}
+
+	return ret
+}
+
+// policyCall calls fn following policy.
+type policyCall struct {
+	fn       reflect.Value
+	policy   CallPolicy
+	fallback reflect.Value // invalid if there is no fallback.
+
+	mu        sync.Mutex
+	failures  int       // successive failed calls.
+	openUntil time.Time // end of the open state of the circuit.
+	trial     bool      // a trial call of the half-open circuit is running.
+}
+
+func (p *policyCall) call(args []reflect.Value) []reflect.Value {
+	trial, open := p.admit()
+	if open {
+		return p.fail(ErrCircuitOpen)
+	}
+
+	var ctx context.Context
+	if takesEnv(p.fn.Type()) {
+		ctx = args[0].Interface().(Env).Context()
+	}
+	if p.fn.Type().IsVariadic() {
+		// variadic arguments are passed as a slice, see reflect.MakeFunc
+		last := args[len(args)-1]
+		args = args[: len(args)-1 : len(args)-1]
+		for i := 0; i < last.Len(); i++ {
+			args = append(args, last.Index(i))
+		}
+	}
+
+	backoff := p.policy.Backoff
+	for attempt := 0; ; attempt++ {
+		ret, err := safeCall(p.fn, args)
+		if err == nil {
+			p.done(trial, true)
+			return []reflect.Value{ret, reflect.Zero(errorType)}
+		}
+
+		if attempt == p.policy.Retries {
+			p.done(trial, false)
+			if attempt != 0 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt+1)
+			}
+			return p.fail(err)
+		}
+
+		if err := wait(ctx, backoff); err != nil {
+			p.done(trial, false)
+			return p.fail(err)
+		}
+		if backoff *= 2; p.policy.MaxBackoff > 0 && backoff > p.policy.MaxBackoff {
+			backoff = p.policy.MaxBackoff
+		}
+	}
+}
+
+// admit reports whether a call is allowed by the circuit breaker, and
+// whether it is the trial call of the half-open circuit.
+func (p *policyCall) admit() (trial, open bool) {
+	if p.policy.FailureThreshold <= 0 {
+		return false, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failures < p.policy.FailureThreshold {
+		return false, false
+	}
+	if p.trial || time.Now().Before(p.openUntil) {
+		return false, true
+	}
+
+	p.trial = true
+	return true, false
+}
+
+// done records the outcome of a call admitted by admit.
+func (p *policyCall) done(trial, ok bool) {
+	if p.policy.FailureThreshold <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if trial {
+		p.trial = false
+	}
+	if ok {
+		p.failures = 0
+		return
+	}
+
+	p.failures++
+	if p.failures >= p.policy.FailureThreshold {
+		p.openUntil = time.Now().Add(p.policy.OpenDuration)
+	}
+}
+
+// fail returns the results of a call failing with err, the fallback value if
+// set.
+func (p *policyCall) fail(err error) []reflect.Value {
+	if p.fallback.IsValid() {
+		return []reflect.Value{p.fallback, reflect.Zero(errorType)}
+	}
+	return []reflect.Value{reflect.Zero(p.fn.Type().Out(0)), reflect.ValueOf(&err).Elem()}
+}
+
+// wait waits for d, or until ctx is done if not nil.
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	select {
+	case <-timer.C:
+		return nil
+	case <-done:
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,79 @@
+package tlang
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPolicies(t *testing.T) {
+	var calls, failUntil int
+	funcs := FuncMap{
+		"fetch": func(key string, rest ...string) (string, error) {
+			calls++
+			if calls <= failUntil {
+				return "", errors.New("unavailable")
+			}
+			return key + strings.Join(rest, ""), nil
+		},
+	}
+
+	run := func(funcs FuncMap) (string, error) {
+		var sb strings.Builder
+		err := Must(New("test").Funcs(funcs).Parse(`fetch "a" "b" "c"`)).Execute(&sb, nil)
+		return sb.String(), err
+	}
+
+	// retries
+	retried := WithPolicies(funcs, map[string]CallPolicy{
+		"fetch": {Retries: 2, Backoff: time.Millisecond},
+	})
+	calls, failUntil = 0, 2
+	out, err := run(retried)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", out)
+	assert.Equal(t, 3, calls)
+
+	calls, failUntil = 0, 3
+	_, err = run(retried)
+	assert.ErrorContains(t, err, "unavailable (after 3 attempts)")
+	assert.Equal(t, 3, calls)
+
+	// fallback
+	calls, failUntil = 0, 1
+	out, err = run(WithPolicies(funcs, map[string]CallPolicy{
+		"fetch": {Fallback: "default"},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "default", out)
+
+	// circuit breaker
+	breaker := WithPolicies(funcs, map[string]CallPolicy{
+		"fetch": {FailureThreshold: 2, OpenDuration: 50 * time.Millisecond},
+	})
+	calls, failUntil = 0, 100
+	for i := 0; i < 2; i++ {
+		_, err = run(breaker)
+		assert.ErrorContains(t, err, "unavailable")
+	}
+	_, err = run(breaker)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, calls)
+
+	// half-open trial call closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	failUntil = 0
+	out, err = run(breaker)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", out)
+	assert.Equal(t, 3, calls)
+
+	assert.Panics(t, func() { WithPolicies(funcs, map[string]CallPolicy{"missing": {}}) })
+	assert.Panics(t, func() {
+		WithPolicies(FuncMap{"f": func() string { return "" }}, map[string]CallPolicy{"f": {}})
+	})
+	assert.Panics(t, func() { WithPolicies(funcs, map[string]CallPolicy{"fetch": {Fallback: 1}}) })
+}
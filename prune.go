@@ -0,0 +1,62 @@
+package tlang
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Prune removes the templates associated with t which are not reachable from
+// the entry templates by template invocations, and returns their sorted
+// names. Templates reachable from entries are kept even if undefined yet.
+//
+// It is intended to shrink large shared template libraries to what is
+// actually used after parsing. It fails with ErrFrozen if t is frozen.
+func (t *Template) Prune(entries ...string) (removed []string, err error) {
+	if t.common == nil {
+		return nil, nil
+	}
+
+	t.muTmpl.Lock()
+	defer t.muTmpl.Unlock()
+	if t.frozen {
+		return nil, fmt.Errorf("template: %s: %w", t.name, ErrFrozen)
+	}
+
+	var (
+		reachable = make(map[string]struct{})
+		visit     func(name string)
+	)
+
+	visit = func(name string) {
+		if _, ok := reachable[name]; ok {
+			return
+		}
+		reachable[name] = struct{}{}
+
+		tmpl := t.tmpl[name]
+		if tmpl == nil || tmpl.Tree == nil {
+			return
+		}
+
+		for _, n := range calledTemplates(tmpl.Root) {
+			visit(n.Name)
+		}
+	}
+
+	for _, name := range entries {
+		if _, ok := t.tmpl[name]; !ok {
+			return nil, fmt.Errorf("template: no template %q associated with template %q", name, t.name)
+		}
+		visit(name)
+	}
+
+	for name := range t.tmpl {
+		if _, ok := reachable[name]; !ok {
+			removed = append(removed, name)
+			delete(t.tmpl, name)
+		}
+	}
+	sort.Strings(removed)
+
+	return removed, nil
+}
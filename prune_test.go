@@ -0,0 +1,25 @@
+package tlang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrune(t *testing.T) {
+	tmpl := Must(New("main").Parse(`template "a" .
+define "a"; (template "b"); end
+define "b"; "B"; end
+define "c"; template "d"; end
+define "d"; "D"; end
+`))
+	Must(tmpl.New("other").Parse(`template "d"`))
+
+	removed, err := tmpl.Prune("main")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "d", "other"}, removed)
+	assert.Equal(t, []string{"a", "b", "main"}, tmpl.Names())
+
+	_, err = tmpl.Prune("c")
+	assert.EqualError(t, err, `template: no template "c" associated with template "main"`)
+}
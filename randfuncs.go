@@ -0,0 +1,50 @@
+package tlang
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+const alphaNum = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// RandomFuncs returns functions generating random values from Env.Rand, so
+// that rendering is deterministic with a fixed ExecOptions.Rand or the
+// reproducible option. The values are not suitable for secrets:
+//
+//	randInt n
+//		Returns a random int in [0, n).
+//	randAlphaNum n
+//		Returns a random string of n letters and digits.
+//	randHex n
+//		Returns n random bytes encoded in hex.
+func RandomFuncs() FuncMap {
+	return FuncMap{
+		"randInt": func(env Env, n int) (int, error) {
+			if n <= 0 {
+				return 0, fmt.Errorf("invalid range %d", n)
+			}
+			return env.Rand().Intn(n), nil
+		},
+		"randAlphaNum": func(env Env, n int) (string, error) {
+			if n < 0 {
+				return "", fmt.Errorf("invalid length %d", n)
+			}
+
+			r := env.Rand()
+			buf := make([]byte, n)
+			for i := range buf {
+				buf[i] = alphaNum[r.Intn(len(alphaNum))]
+			}
+			return string(buf), nil
+		},
+		"randHex": func(env Env, n int) (string, error) {
+			if n < 0 {
+				return "", fmt.Errorf("invalid length %d", n)
+			}
+
+			buf := make([]byte, n)
+			_, _ = env.Rand().Read(buf)
+			return hex.EncodeToString(buf), nil
+		},
+	}
+}
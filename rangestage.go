@@ -0,0 +1,356 @@
+package tlang
+
+import (
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"arhat.dev/tlang/internal/fmtsort"
+	"arhat.dev/tlang/parse"
+)
+
+// rangeIter returns the next index and element of a range, ok is false at
+// the end.
+type rangeIter func() (index, elem reflect.Value, ok bool)
+
+// stageCursor is the Cursor ranged over by {{range pipeline | stage}},
+// elements of the value of the pipeline are pulled through the stages one at
+// a time, so that stages are only applied to elements needed, e.g. channels
+// and cursors are not drained past a limit.
+type stageCursor struct {
+	next        rangeIter
+	index, elem reflect.Value
+	source      io.Closer // closer of the source cursor, if any.
+}
+
+func (c *stageCursor) Next() (ok bool) {
+	c.index, c.elem, ok = c.next()
+	return
+}
+
+func (c *stageCursor) Value() (any, error) {
+	if !c.elem.IsValid() || !c.elem.CanInterface() {
+		return nil, nil
+	}
+	return c.elem.Interface(), nil
+}
+
+func (c *stageCursor) Err() error { return nil }
+
+func (c *stageCursor) Close() error {
+	if c.source == nil {
+		return nil
+	}
+	return c.source.Close()
+}
+
+// entry returns the index and element of the current element, indices are
+// those of the value of the pipeline rather than positions after stages.
+func (c *stageCursor) entry() (index, elem reflect.Value) {
+	return c.index, c.elem
+}
+
+// rangeStages returns the cursor over elements of pipe passed through the
+// stages of r. setVars sets variables declared by r for filters, which are
+// popped to mark after each evaluation.
+func (s *state) rangeStages(dot, pipe reflect.Value, r *parse.RangeNode, setVars func(index, elem reflect.Value), mark int) *stageCursor {
+	c := new(stageCursor)
+	c.next, c.source = s.rangeSource(pipe)
+	for _, stage := range r.Stages {
+		switch name := stage.Args[0].(*parse.IdentifierNode).Ident; name {
+		case "filter":
+			c.next = s.filterStage(c.next, stage.Args[1], setVars, mark)
+		case "limit":
+			c.next = limitStage(c.next, s.evalArg(dot, reflect.TypeOf(0), stage.Args[1]).Int())
+		case "sortBy":
+			keys := make([]string, len(stage.Args)-1)
+			for i, arg := range stage.Args[1:] {
+				keys[i] = s.evalArg(dot, reflect.TypeOf(""), arg).String()
+			}
+			c.next = s.sortStage(c.next, stage, keys)
+		case "chunk", "window":
+			n := s.evalArg(dot, reflect.TypeOf(0), stage.Args[1]).Int()
+			if n <= 0 {
+				s.errorf("range %s: size %d is not positive", name, n)
+			}
+			if name == "chunk" {
+				c.next = chunkStage(c.next, int(n))
+			} else {
+				c.next = windowStage(c.next, int(n))
+			}
+		default:
+			s.errorf("unknown range stage %s", name)
+		}
+	}
+	return c
+}
+
+// rangeSource returns the iterator over elements of pipe, and the closer of
+// pipe if it is a Cursor.
+func (s *state) rangeSource(pipe reflect.Value) (rangeIter, io.Closer) {
+	if cursor, ok := asCursor(pipe); ok {
+		closer, _ := cursor.(io.Closer)
+		ec, isEntries := cursor.(entryCursor)
+		i := 0
+		return func() (index, elem reflect.Value, ok bool) {
+			if !cursor.Next() {
+				if err := cursor.Err(); err != nil {
+					s.errorf("range: %w", err)
+				}
+				return
+			}
+			if isEntries {
+				index, elem = ec.entry()
+				return index, elem, true
+			}
+			v, err := cursor.Value()
+			if err != nil {
+				s.errorf("range: reading element %d: %w", i, err)
+			}
+			i++
+			return reflect.ValueOf(i - 1), reflect.ValueOf(v), true
+		}, closer
+	}
+
+	val, _ := indirect(pipe)
+	var indices, elems []reflect.Value
+	switch val.Kind() {
+	case reflect.Array, reflect.Slice:
+		i := 0
+		return func() (index, elem reflect.Value, ok bool) {
+			if i >= val.Len() {
+				return
+			}
+			i++
+			return reflect.ValueOf(i - 1), val.Index(i - 1), true
+		}, nil
+	case reflect.Map:
+		om := fmtsort.Sort(val)
+		indices, elems = om.Key, om.Value
+	case reflect.Chan:
+		if val.IsNil() {
+			break
+		}
+		if val.Type().ChanDir() == reflect.SendDir {
+			s.errorf("range over send-only channel %v", val)
+		}
+		i := 0
+		return func() (index, elem reflect.Value, ok bool) {
+			elem, ok = val.Recv()
+			if !ok {
+				return
+			}
+			i++
+			return reflect.ValueOf(i - 1), elem, true
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, i := countLen(val), 0
+		return func() (index, elem reflect.Value, ok bool) {
+			if i >= n {
+				return
+			}
+			i++
+			return reflect.ValueOf(i - 1), countElem(val, i-1), true
+		}, nil
+	case reflect.Invalid:
+		// nil map, etc. acts like an empty map.
+	default:
+		s.errorf("range can't iterate over %v", val)
+	}
+
+	return entriesIter(indices, elems), nil
+}
+
+// entriesIter returns the iterator over collected indices and elements.
+func entriesIter(indices, elems []reflect.Value) rangeIter {
+	i := 0
+	return func() (index, elem reflect.Value, ok bool) {
+		if i >= len(elems) {
+			return
+		}
+		i++
+		return indices[i-1], elems[i-1], true
+	}
+}
+
+// filterStage returns the iterator over elements of next for which pred,
+// evaluated with the element as dot, is true.
+func (s *state) filterStage(next rangeIter, pred parse.Node, setVars func(index, elem reflect.Value), mark int) rangeIter {
+	return func() (index, elem reflect.Value, ok bool) {
+		for {
+			index, elem, ok = next()
+			if !ok {
+				return
+			}
+
+			setVars(index, elem)
+			v := s.evalArg(elem, reflectValueType, pred).Interface().(reflect.Value)
+			s.pop(mark)
+
+			truth, valid := s.opt.truth.isTrue(indirectInterface(v))
+			if !valid {
+				s.at(pred)
+				s.errorf("range filter can't use %v", v)
+			}
+			if truth {
+				return
+			}
+		}
+	}
+}
+
+// limitStage returns the iterator over at most n first elements of next.
+func limitStage(next rangeIter, n int64) rangeIter {
+	return func() (index, elem reflect.Value, ok bool) {
+		if n <= 0 {
+			return
+		}
+		n--
+		return next()
+	}
+}
+
+// sortStage returns the iterator over elements of next in ascending order of
+// the fields or map keys named by keys, or of elements if there is no key.
+// A key prefixed with "-" sorts in descending order. Elements are collected
+// when the first one is pulled.
+func (s *state) sortStage(next rangeIter, stage *parse.CommandNode, keys []string) rangeIter {
+	var sorted rangeIter
+	return func() (index, elem reflect.Value, ok bool) {
+		if sorted != nil {
+			return sorted()
+		}
+
+		var indices, elems []reflect.Value
+		for {
+			index, elem, ok := next()
+			if !ok {
+				break
+			}
+			indices = append(indices, index)
+			elems = append(elems, elem)
+		}
+
+		fields := make([][]reflect.Value, len(keys))
+		for k, key := range keys {
+			if strings.TrimPrefix(key, "-") == "" {
+				s.at(stage)
+				s.errorf("range sortBy: empty key")
+			}
+			fields[k] = make([]reflect.Value, len(elems))
+			for i, elem := range elems {
+				fields[k][i] = s.evalField(elem, strings.TrimPrefix(key, "-"), stage, nil, missingVal, elem)
+			}
+		}
+
+		order := make([]int, len(elems))
+		for i := range order {
+			order[i] = i
+		}
+		s.at(stage)
+		sort.SliceStable(order, func(i, j int) bool {
+			a, b := order[i], order[j]
+			if len(keys) == 0 {
+				return s.less(elems[a], elems[b])
+			}
+			for k, key := range keys {
+				x, y := fields[k][a], fields[k][b]
+				if key[0] == '-' {
+					x, y = y, x
+				}
+				if s.less(x, y) {
+					return true
+				}
+				if s.less(y, x) {
+					return false
+				}
+			}
+			return false
+		})
+
+		sortedIndices := make([]reflect.Value, len(order))
+		sortedElems := make([]reflect.Value, len(order))
+		for i, o := range order {
+			sortedIndices[i], sortedElems[i] = indices[o], elems[o]
+		}
+		sorted = entriesIter(sortedIndices, sortedElems)
+		return sorted()
+	}
+}
+
+// chunkStage returns the iterator over slices of n consecutive elements of
+// next, the last one may be shorter, indices are numbers of chunks.
+func chunkStage(next rangeIter, n int) rangeIter {
+	i := 0
+	return func() (index, elem reflect.Value, ok bool) {
+		elems := make([]reflect.Value, 0, n)
+		for len(elems) < n {
+			_, elem, ok := next()
+			if !ok {
+				break
+			}
+			elems = append(elems, elem)
+		}
+		if len(elems) == 0 {
+			return
+		}
+
+		i++
+		return reflect.ValueOf(i - 1), sliceOf(elems), true
+	}
+}
+
+// windowStage returns the iterator over slices of every n consecutive
+// elements of next, indices are positions of their first elements. There is
+// no window if next has less than n elements.
+func windowStage(next rangeIter, n int) rangeIter {
+	var elems []reflect.Value
+	i := 0
+	return func() (index, elem reflect.Value, ok bool) {
+		if len(elems) == n {
+			elems = elems[1:]
+		}
+		for len(elems) < n {
+			_, elem, ok := next()
+			if !ok {
+				return index, elem, false
+			}
+			elems = append(elems, elem)
+		}
+
+		i++
+		return reflect.ValueOf(i - 1), sliceOf(elems), true
+	}
+}
+
+// sliceOf returns a new slice of elems, its element type is the type of
+// elems if they are all of the same type, or else any.
+func sliceOf(elems []reflect.Value) reflect.Value {
+	var typ reflect.Type
+	for _, elem := range elems {
+		if !elem.IsValid() || typ != nil && elem.Type() != typ {
+			typ = reflect.TypeOf((*any)(nil)).Elem()
+			break
+		}
+		typ = elem.Type()
+	}
+
+	ret := reflect.MakeSlice(reflect.SliceOf(typ), len(elems), len(elems))
+	for i, elem := range elems {
+		if elem.IsValid() {
+			ret.Index(i).Set(elem)
+		}
+	}
+	return ret
+}
+
+// less reports whether a sorts before b in range sorting.
+func (s *state) less(a, b reflect.Value) bool {
+	c, unordered, err := compare(a, b)
+	if err != nil {
+		s.errorf("range sortBy: %v", err)
+	}
+	return !unordered && c < 0
+}
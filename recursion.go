@@ -0,0 +1,208 @@
+package tlang
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cycles returns cycles of template invocations among the templates
+// associated with t, one for every group of mutually recursive templates,
+// including templates invoking themselves with template or recurse. A cycle
+// is the path of names from its least template back to it, e.g.
+// ["a", "b", "a"], the shortest one for the group. Cycles are sorted by their
+// first names.
+func (t *Template) Cycles() [][]string {
+	return findCycles(t.invocations(""), nil)
+}
+
+// invocations returns the names of templates invoked by every template
+// associated with t, only the ones reachable from the template named from if
+// it is not empty.
+func (t *Template) invocations(from string) map[string][]string {
+	calls := make(map[string][]string)
+	if t.common == nil {
+		return calls
+	}
+	t.muTmpl.RLock()
+	for name, tmpl := range t.tmpl {
+		if tmpl.Tree == nil || tmpl.Root == nil {
+			continue
+		}
+		for _, n := range calledTemplates(tmpl.Root) {
+			calls[name] = append(calls[name], n.Name)
+		}
+	}
+	t.muTmpl.RUnlock()
+
+	if from == "" {
+		return calls
+	}
+
+	reachable := make(map[string][]string)
+	var visit func(name string)
+	visit = func(name string) {
+		if _, ok := reachable[name]; ok {
+			return
+		}
+		reachable[name] = calls[name]
+		for _, next := range calls[name] {
+			visit(next)
+		}
+	}
+	visit(from)
+	return reachable
+}
+
+// findCycles returns a cycle for every strongly connected component of the
+// graph calls with cycles, not going through templates in exclude.
+func findCycles(calls map[string][]string, exclude map[string]int) (cycles [][]string) {
+	names := make([]string, 0, len(calls))
+	for name := range calls {
+		if _, ok := exclude[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// Tarjan's algorithm
+	var (
+		index   = make(map[string]int)
+		low     = make(map[string]int)
+		onStack = make(map[string]bool)
+		stack   []string
+		comp    = make(map[string]int) // component of every visited name.
+		ncomp   int
+	)
+
+	var connect func(name string)
+	connect = func(name string) {
+		index[name] = len(index)
+		low[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+
+		for _, next := range calls[name] {
+			if _, ok := exclude[next]; ok {
+				continue
+			}
+			if _, ok := index[next]; !ok {
+				connect(next)
+				if low[next] < low[name] {
+					low[name] = low[next]
+				}
+			} else if onStack[next] && index[next] < low[name] {
+				low[name] = index[next]
+			}
+		}
+
+		if low[name] != index[name] {
+			return
+		}
+		for {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[n] = false
+			comp[n] = ncomp
+			if n == name {
+				break
+			}
+		}
+		ncomp++
+	}
+
+	for _, name := range names {
+		if _, ok := index[name]; !ok {
+			connect(name)
+		}
+	}
+
+	done := make(map[int]bool)
+	for _, name := range names {
+		c, ok := comp[name]
+		if !ok || done[c] {
+			continue
+		}
+
+		// names are sorted, name is the least of its component
+		if cycle := shortestCycle(calls, comp, name); cycle != nil {
+			done[c] = true
+			cycles = append(cycles, cycle)
+		}
+	}
+
+	return
+}
+
+// shortestCycle returns the shortest path from start back to itself within
+// its component, nil if there is none.
+func shortestCycle(calls map[string][]string, comp map[string]int, start string) []string {
+	prev := make(map[string]string)
+	queue := []string{start}
+	for len(queue) != 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		for _, next := range calls[name] {
+			c, ok := comp[next]
+			if !ok || c != comp[start] {
+				continue
+			}
+
+			if next == start {
+				cycle := []string{start}
+				for n := name; n != start; n = prev[n] {
+					cycle = append(cycle, n)
+				}
+				for i, j := 1, len(cycle)-1; i < j; i, j = i+1, j-1 {
+					cycle[i], cycle[j] = cycle[j], cycle[i]
+				}
+				return append(cycle, start)
+			}
+
+			if _, seen := prev[next]; !seen {
+				prev[next] = name
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return nil
+}
+
+// formatCycle formats the path of template names cycle for errors.
+func formatCycle(cycle []string) string {
+	quoted := make([]string, len(cycle))
+	for i, name := range cycle {
+		quoted[i] = strconv.Quote(name)
+	}
+	return strings.Join(quoted, " -> ")
+}
+
+// checkRecursion fails the execution of t if templates it invokes form cycles
+// not allowed by the recursion option.
+func (s *state) checkRecursion(t *Template) {
+	cycles := findCycles(t.invocations(t.Name()), s.opt.recursionLimits)
+	if len(cycles) != 0 {
+		s.errorf("template invocation cycle %s not allowed by the recursion option", formatCycle(cycles[0]))
+	}
+}
+
+// checkNesting fails the invocation of the template named name if it is
+// already nested as many times as allowed by the recursion option.
+func (s *state) checkNesting(name string) {
+	limit, ok := s.opt.recursionLimits[name]
+	if !ok {
+		return
+	}
+
+	nested := 0
+	for _, n := range s.stack {
+		if n == name {
+			nested++
+		}
+	}
+	if nested >= limit {
+		s.fatalf("template %q nested more than %d times%s", name, limit, s.cycle(name))
+	}
+}
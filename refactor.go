@@ -0,0 +1,100 @@
+package tlang
+
+import (
+	"fmt"
+
+	"arhat.dev/tlang/parse"
+)
+
+// RenameTemplate renames the defined template oldName associated with t to
+// newName, and updates all invocations of it in the associated templates.
+// Like Optimize, trees are copied before being changed, so clones of t and
+// executions running concurrently are not affected, but templates are
+// looked up when invoked, so executions running concurrently may fail to
+// invoke the template by its old name. It fails with ErrFrozen if t is
+// frozen.
+//
+// Variables are renamed with parse.Tree.RenameVar.
+func (t *Template) RenameTemplate(oldName, newName string) error {
+	if t.common == nil {
+		return fmt.Errorf("template: no template %q associated with template %q", oldName, t.name)
+	}
+
+	t.muTmpl.Lock()
+	defer t.muTmpl.Unlock()
+	if t.frozen {
+		return fmt.Errorf("template: %s: %w", t.name, ErrFrozen)
+	}
+
+	tmpl := t.tmpl[oldName]
+	if tmpl == nil || tmpl.Tree == nil {
+		return fmt.Errorf("template: no template %q associated with template %q", oldName, t.name)
+	}
+	if _, ok := t.tmpl[newName]; ok {
+		return fmt.Errorf("template: template %q already exists", newName)
+	}
+
+	copied := make(map[*Template]struct{})
+	for _, other := range t.tmpl {
+		if other.Tree == nil || !invokes(other.Root, oldName) {
+			continue
+		}
+
+		other.Tree = copyTree(other.Tree)
+		copied[other] = struct{}{}
+		for _, n := range calledTemplates(other.Root) {
+			if n.Name == oldName {
+				n.Name = newName
+			}
+		}
+	}
+
+	delete(t.tmpl, oldName)
+	tmpl.name = newName
+	if _, ok := copied[tmpl]; !ok {
+		tmpl.Tree = copyTree(tmpl.Tree)
+	}
+	tmpl.Tree.Name = newName
+	t.tmpl[newName] = tmpl
+
+	return nil
+}
+
+// ExtractTemplate moves the nodes of the template name, starting at start
+// up to the last node before end, into a new template newName invoked in
+// their place with the current dot, see parse.Tree.Extract for conditions.
+// Like RenameTemplate, the tree of name is copied before being changed, and
+// it fails with ErrFrozen if t is frozen.
+func (t *Template) ExtractTemplate(name string, start, end parse.Pos, newName string) (*Template, error) {
+	if t.common == nil {
+		return nil, fmt.Errorf("template: no template %q associated with template %q", name, t.name)
+	}
+
+	opt, _ := t.config()
+	t.muTmpl.Lock()
+	defer t.muTmpl.Unlock()
+	if t.frozen {
+		return nil, fmt.Errorf("template: %s: %w", t.name, ErrFrozen)
+	}
+
+	tmpl := t.tmpl[name]
+	if tmpl == nil || tmpl.Tree == nil {
+		return nil, fmt.Errorf("template: no template %q associated with template %q", name, t.name)
+	}
+	if _, ok := t.tmpl[newName]; ok {
+		return nil, fmt.Errorf("template: template %q already exists", newName)
+	}
+
+	tree := copyTree(tmpl.Tree)
+	extracted, err := tree.Extract(start, end, newName)
+	if err != nil {
+		return nil, err
+	}
+
+	nt, err := t.addParseTree(newName, extracted, &opt)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Tree = tree
+	return nt, nil
+}
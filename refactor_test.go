@@ -0,0 +1,119 @@
+package tlang
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"arhat.dev/tlang/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenameTemplate(t *testing.T) {
+	tmpl := Must(New("main").Parse(`template "a" .
+define "a"; "A"; (template "b"); end
+define "b"; "B"; end
+`))
+
+	assert.NoError(t, tmpl.RenameTemplate("b", "c"))
+	assert.Nil(t, tmpl.Lookup("b"))
+	assert.Equal(t, "c", tmpl.Lookup("c").Name())
+	assert.Equal(t, "c", tmpl.Lookup("c").Tree.Name)
+
+	var buf bytes.Buffer
+	assert.NoError(t, tmpl.Execute(&buf, nil))
+	assert.Equal(t, "AB", buf.String())
+
+	assert.EqualError(t, tmpl.RenameTemplate("b", "d"), `template: no template "b" associated with template "main"`)
+	assert.EqualError(t, tmpl.RenameTemplate("a", "c"), `template: template "c" already exists`)
+
+	// trees are shared with clones
+	clone, err := tmpl.Clone()
+	assert.NoError(t, err)
+	assert.NoError(t, clone.RenameTemplate("c", "d"))
+	buf.Reset()
+	assert.NoError(t, tmpl.Execute(&buf, nil))
+	assert.Equal(t, "AB", buf.String())
+	assert.Equal(t, "c", tmpl.Lookup("c").Tree.Name)
+	buf.Reset()
+	assert.NoError(t, clone.Execute(&buf, nil))
+	assert.Equal(t, "AB", buf.String())
+}
+
+func TestRefactorConcurrentExecution(t *testing.T) {
+	const text = `range .; "<"; template "a" .; ">"; end
+define "a"; .; end`
+	tmpl := Must(New("main").Parse(text))
+
+	var wg sync.WaitGroup
+	started, done := make(chan struct{}), make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			// executions started before a rename may still invoke the
+			// template by its old name
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, []int{1, 2}); err != nil {
+				assert.ErrorContains(t, err, "not defined")
+			} else {
+				assert.Equal(t, "<1><2>", buf.String())
+			}
+
+			if i == 0 {
+				close(started)
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+
+	<-started
+	for i := 0; i < 500; i++ {
+		from, to := fmt.Sprint("a", i), fmt.Sprint("a", i+1)
+		if i == 0 {
+			from = "a"
+		}
+		assert.NoError(t, tmpl.RenameTemplate(from, to))
+	}
+	start := parse.Pos(strings.Index(text, `"<"`))
+	end := parse.Pos(strings.Index(text, "end"))
+	_, err := tmpl.ExtractTemplate("main", start, end, "item")
+	assert.NoError(t, err)
+	close(done)
+	wg.Wait()
+}
+
+func TestExtractTemplate(t *testing.T) {
+	const text = `range .; "<"; .; ">"; end`
+	tmpl := Must(New("main").Parse(text))
+
+	start := parse.Pos(strings.Index(text, `"<"`))
+	end := parse.Pos(strings.Index(text, "end"))
+	_, err := tmpl.ExtractTemplate("main", start, end, "item")
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{{range .}}{{template "item" .}}{{end}}`, tmpl.Tree.Root.String())
+
+	var buf bytes.Buffer
+	assert.NoError(t, tmpl.Execute(&buf, []int{1, 2}))
+	assert.Equal(t, "<1><2>", buf.String())
+
+	_, err = tmpl.ExtractTemplate("main", start, end, "item")
+	assert.EqualError(t, err, `template: template "item" already exists`)
+
+	// trees are shared with clones
+	tmpl = Must(New("main").Parse(text))
+	clone := Must(tmpl.Clone())
+	_, err = clone.ExtractTemplate("main", start, end, "item")
+	assert.NoError(t, err)
+	assert.Equal(t, `{{range .}}{{"<"}}{{.}}{{">"}}{{end}}`, tmpl.Tree.Root.String())
+	buf.Reset()
+	assert.NoError(t, clone.Execute(&buf, []int{1}))
+	assert.Equal(t, "<1>", buf.String())
+}
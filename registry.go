@@ -0,0 +1,380 @@
+package tlang
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Media types of bundles stored in OCI registries, following the ORAS
+// conventions for artifacts, so that bundles can also be pushed and pulled
+// with the oras CLI.
+const (
+	BundleArtifactType = "application/vnd.tlang.bundle.v1"
+	BundleMediaType    = "application/vnd.tlang.bundle.v1+zip"
+
+	ociManifestType   = "application/vnd.oci.image.manifest.v1+json"
+	ociEmptyConfig    = "application/vnd.oci.empty.v1+json"
+	ociTitle          = "org.opencontainers.image.title"
+	bundleLayerTitle  = "bundle.zip"
+	maxManifestLength = 4 << 20
+)
+
+// Registry pushes and pulls bundles, see PackBundle, to and from OCI
+// registries over the distribution API, so that template sets are versioned
+// and distributed like images.
+//
+// References are "host/repository:tag" or "host/repository@sha256:...",
+// pulling by digest pins the exact manifest pushed, the digest of which is
+// returned by PushBundle.
+type Registry struct {
+	// Client sends requests, defaults to http.DefaultClient.
+	Client *http.Client
+
+	// PlainHTTP uses http instead of https, e.g. for local registries.
+	PlainHTTP bool
+
+	// Username and Password are credentials for basic authentication, or
+	// for getting tokens for bearer authentication, anonymous if empty.
+	Username, Password string
+
+	mu    sync.Mutex
+	token map[string]string // bearer tokens by scope.
+}
+
+// ociDescriptor describes content in OCI manifests.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	ArtifactType  string          `json:"artifactType,omitempty"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// ociRef is a parsed reference.
+type ociRef struct {
+	host, repo, tag, digest string
+}
+
+func parseOCIRef(ref string) (ociRef, error) {
+	host, rest, ok := strings.Cut(ref, "/")
+	if !ok || host == "" || rest == "" {
+		return ociRef{}, fmt.Errorf("template: invalid reference %q", ref)
+	}
+
+	r := ociRef{host: host, repo: rest, tag: "latest"}
+	if repo, digest, ok := strings.Cut(rest, "@"); ok {
+		if !strings.HasPrefix(digest, "sha256:") {
+			return ociRef{}, fmt.Errorf("template: unsupported digest in reference %q", ref)
+		}
+		r.repo, r.tag, r.digest = repo, "", digest
+	} else if i := strings.LastIndexByte(rest, ':'); i > strings.LastIndexByte(rest, '/') {
+		r.repo, r.tag = rest[:i], rest[i+1:]
+	}
+	if r.repo == "" || r.digest == "" && r.tag == "" {
+		return ociRef{}, fmt.Errorf("template: invalid reference %q", ref)
+	}
+	return r, nil
+}
+
+// reference returns the tag or digest of r.
+func (r ociRef) reference() string {
+	if r.digest != "" {
+		return r.digest
+	}
+	return r.tag
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// PushBundle pushes the bundle data to ref, which must have a tag, and
+// returns the digest of the pushed manifest.
+func (r *Registry) PushBundle(ctx context.Context, ref string, data []byte) (string, error) {
+	or, err := parseOCIRef(ref)
+	if err != nil {
+		return "", err
+	}
+	if or.digest != "" {
+		return "", fmt.Errorf("template: can't push to digest reference %q", ref)
+	}
+
+	config := []byte("{}")
+	m := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestType,
+		ArtifactType:  BundleArtifactType,
+		Config:        ociDescriptor{MediaType: ociEmptyConfig, Digest: digestOf(config), Size: int64(len(config))},
+		Layers: []ociDescriptor{{
+			MediaType:   BundleMediaType,
+			Digest:      digestOf(data),
+			Size:        int64(len(data)),
+			Annotations: map[string]string{ociTitle: bundleLayerTitle},
+		}},
+	}
+
+	for _, blob := range [][]byte{config, data} {
+		if err := r.pushBlob(ctx, or, blob); err != nil {
+			return "", err
+		}
+	}
+
+	manifest, err := json.Marshal(&m)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := r.do(ctx, or, http.MethodPut, r.url(or, "manifests/"+or.tag), http.Header{"Content-Type": {ociManifestType}}, manifest)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("template: pushing manifest to %s: %s", ref, resp.Status)
+	}
+
+	return digestOf(manifest), nil
+}
+
+// pushBlob uploads data to the repository of or unless it exists.
+func (r *Registry) pushBlob(ctx context.Context, or ociRef, data []byte) error {
+	digest := digestOf(data)
+	resp, err := r.do(ctx, or, http.MethodHead, r.url(or, "blobs/"+digest), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = r.do(ctx, or, http.MethodPost, r.url(or, "blobs/uploads/"), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("template: starting upload of %s: %s", digest, resp.Status)
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("template: invalid upload location: %w", err)
+	}
+	q := location.Query()
+	q.Set("digest", digest)
+	location.RawQuery = q.Encode()
+
+	resp, err = r.do(ctx, or, http.MethodPut, location.String(), http.Header{"Content-Type": {"application/octet-stream"}}, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("template: uploading %s: %s", digest, resp.Status)
+	}
+	return nil
+}
+
+// PullBundle pulls the bundle at ref and returns its data and the digest of
+// its manifest, digests of the manifest, when ref has one, and of the bundle
+// are verified.
+func (r *Registry) PullBundle(ctx context.Context, ref string) (data []byte, digest string, err error) {
+	or, err := parseOCIRef(ref)
+	if err != nil {
+		return nil, "", err
+	}
+
+	manifest, err := r.fetch(ctx, or, "manifests/"+or.reference(), http.Header{"Accept": {ociManifestType}}, maxManifestLength)
+	if err != nil {
+		return nil, "", err
+	}
+	digest = digestOf(manifest)
+	if or.digest != "" && or.digest != digest {
+		return nil, "", fmt.Errorf("template: manifest of %s has digest %s", ref, digest)
+	}
+
+	var m ociManifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, "", fmt.Errorf("template: decoding manifest of %s: %w", ref, err)
+	}
+
+	for _, layer := range m.Layers {
+		if layer.MediaType != BundleMediaType {
+			continue
+		}
+
+		data, err = r.fetch(ctx, or, "blobs/"+layer.Digest, nil, layer.Size)
+		if err != nil {
+			return nil, "", err
+		}
+		if digestOf(data) != layer.Digest {
+			return nil, "", fmt.Errorf("template: bundle of %s does not match digest %s", ref, layer.Digest)
+		}
+		return data, digest, nil
+	}
+
+	return nil, "", fmt.Errorf("template: %s is not a template bundle", ref)
+}
+
+// fetch gets the content at path in the repository of or, of at most max
+// bytes.
+func (r *Registry) fetch(ctx context.Context, or ociRef, path string, header http.Header, max int64) ([]byte, error) {
+	resp, err := r.do(ctx, or, http.MethodGet, r.url(or, path), header, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("template: fetching %s of %s/%s: %s", path, or.host, or.repo, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("template: %s of %s/%s exceeds %d bytes", path, or.host, or.repo, max)
+	}
+	return data, nil
+}
+
+func (r *Registry) url(or ociRef, path string) string {
+	scheme := "https"
+	if r.PlainHTTP {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, or.host, or.repo, path)
+}
+
+// do sends a request, authenticating as challenged by the registry.
+func (r *Registry) do(ctx context.Context, or ociRef, method, u string, header http.Header, body []byte) (*http.Response, error) {
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	scope := "repository:" + or.repo + ":pull"
+	if method != http.MethodGet && method != http.MethodHead {
+		scope += ",push"
+	}
+
+	send := func(auth string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return client.Do(req)
+	}
+
+	r.mu.Lock()
+	token := r.token[scope]
+	r.mu.Unlock()
+
+	auth := ""
+	if token != "" {
+		auth = "Bearer " + token
+	}
+	resp, err := send(auth)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	switch scheme, params, _ := strings.Cut(challenge, " "); strings.ToLower(scheme) {
+	case "basic":
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		req.SetBasicAuth(r.Username, r.Password)
+		auth = req.Header.Get("Authorization")
+	case "bearer":
+		token, err := r.fetchToken(ctx, client, params, scope)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		if r.token == nil {
+			r.token = make(map[string]string)
+		}
+		r.token[scope] = token
+		r.mu.Unlock()
+		auth = "Bearer " + token
+	default:
+		return nil, fmt.Errorf("template: unsupported authentication challenge %q", challenge)
+	}
+
+	return send(auth)
+}
+
+// fetchToken gets a bearer token for scope from the realm in the challenge
+// params.
+func (r *Registry) fetchToken(ctx context.Context, client *http.Client, params, scope string) (string, error) {
+	values := make(map[string]string)
+	for _, p := range strings.Split(params, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		values[k] = strings.Trim(v, `"`)
+	}
+
+	realm, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return "", fmt.Errorf("template: invalid token realm %q", values["realm"])
+	}
+	q := realm.Query()
+	if values["service"] != "" {
+		q.Set("service", values["service"])
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.Username != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("template: getting token from %s: %s", realm.Host, resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("template: decoding token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return token.Token, nil
+}
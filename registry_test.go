@@ -0,0 +1,132 @@
+package tlang
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRegistry is a minimal OCI registry requiring bearer tokens.
+type testRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+}
+
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		if r.URL.Query().Get("service") != "registry" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = io.WriteString(w, `{"token":"t0ken"}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer t0ken" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+r.Host+`/token",service="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/team/templates/")
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPost && path == "blobs/uploads/":
+		w.Header().Set("Location", "/v2/team/templates/blobs/uploads/1?state=x")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && path == "blobs/uploads/1":
+		reg.blobs[r.URL.Query().Get("digest")] = body
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "blobs/"):
+		blob, ok := reg.blobs[strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(blob)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "manifests/"):
+		reg.manifests[strings.TrimPrefix(path, "manifests/")] = body
+		reg.manifests[digestOf(body)] = body
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "manifests/"):
+		m, ok := reg.manifests[strings.TrimPrefix(path, "manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(m)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	reg := &testRegistry{blobs: make(map[string][]byte), manifests: make(map[string][]byte)}
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	r := &Registry{PlainHTTP: true}
+	ctx := context.Background()
+
+	bundle := []byte("zip data")
+	digest, err := r.PushBundle(ctx, host+"/team/templates:v1", bundle)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(digest, "sha256:"))
+	assert.Contains(t, string(reg.manifests["v1"]), `"artifactType":"application/vnd.tlang.bundle.v1"`)
+
+	data, pulled, err := r.PullBundle(ctx, host+"/team/templates:v1")
+	require.NoError(t, err)
+	assert.Equal(t, bundle, data)
+	assert.Equal(t, digest, pulled)
+
+	data, _, err = r.PullBundle(ctx, host+"/team/templates@"+digest)
+	require.NoError(t, err)
+	assert.Equal(t, bundle, data)
+
+	reg.manifests[digestOf([]byte("other"))] = reg.manifests["v1"]
+	_, _, err = r.PullBundle(ctx, host+"/team/templates@"+digestOf([]byte("other")))
+	assert.ErrorContains(t, err, "has digest "+digest)
+
+	for d := range reg.blobs {
+		if bytes.Equal(reg.blobs[d], bundle) {
+			reg.blobs[d] = []byte("tampered")
+		}
+	}
+	_, _, err = r.PullBundle(ctx, host+"/team/templates:v1")
+	assert.ErrorContains(t, err, "does not match digest")
+
+	_, err = r.PushBundle(ctx, host+"/team/templates@"+digest, bundle)
+	assert.Error(t, err)
+	_, _, err = r.PullBundle(ctx, "templates")
+	assert.Error(t, err)
+}
+
+func TestParseOCIRef(t *testing.T) {
+	for ref, want := range map[string]ociRef{
+		"ghcr.io/org/repo":               {host: "ghcr.io", repo: "org/repo", tag: "latest"},
+		"localhost:5000/repo:v1":         {host: "localhost:5000", repo: "repo", tag: "v1"},
+		"ghcr.io/org/repo@sha256:abc":    {host: "ghcr.io", repo: "org/repo", digest: "sha256:abc"},
+		"registry:5000/a/b/c:1.2.3-beta": {host: "registry:5000", repo: "a/b/c", tag: "1.2.3-beta"},
+	} {
+		got, err := parseOCIRef(ref)
+		assert.NoError(t, err, ref)
+		assert.Equal(t, want, got, ref)
+	}
+
+	for _, ref := range []string{"repo", "ghcr.io/", "ghcr.io/repo@md5:abc", "ghcr.io/repo:"} {
+		_, err := parseOCIRef(ref)
+		assert.Error(t, err, ref)
+	}
+}
@@ -0,0 +1,222 @@
+package tlang
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrIntegrity is reported when the content of a remote template file does
+// not match its pinned digest.
+var ErrIntegrity = errors.New("template: integrity check failed")
+
+// RemoteFS is a read-only fs.FS serving template files fetched over HTTPS,
+// so that shared partials hosted centrally can be parsed with ParseFS like
+// local files, e.g.
+//
+//	fsys := &tlang.RemoteFS{
+//		BaseURL: "https://templates.example.com/shared/",
+//		Pins: map[string]string{
+//			"header.tl": "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+//		},
+//	}
+//	t, err := tlang.New("page").ParseFS(fsys, "header.tl")
+//
+// Every file must be pinned to the sha256 digest of its content, unpinned
+// files are not fetched and content not matching its digest is rejected
+// with ErrIntegrity. Responses are cached in memory and revalidated with
+// their ETags.
+//
+// Glob patterns only match themselves, since directories can't be listed.
+type RemoteFS struct {
+	// BaseURL is the https URL file names are resolved against, it should
+	// end with a slash.
+	BaseURL string
+
+	// Pins are the digests of files by name, as "sha256:" followed by the
+	// hex encoded digest.
+	Pins map[string]string
+
+	// Client sends requests, defaults to http.DefaultClient.
+	Client *http.Client
+
+	// Timeout is the timeout of every attempt to fetch a file, defaults to
+	// 10 seconds.
+	Timeout time.Duration
+
+	// Retries is the number of times fetching a file is retried after
+	// network errors and responses with status 429 or 5xx.
+	Retries int
+
+	// RetryDelay is the delay before the first retry, doubled for every
+	// following one, defaults to 200 milliseconds.
+	RetryDelay time.Duration
+
+	mu    sync.Mutex
+	cache map[string]remoteEntry // verified responses by URL.
+}
+
+type remoteEntry struct {
+	etag string
+	data []byte
+}
+
+// Open implements fs.FS.
+func (r *RemoteFS) Open(name string) (fs.File, error) {
+	data, err := r.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteFile{
+		Reader: bytes.NewReader(data),
+		info:   remoteFileInfo{name: name[strings.LastIndexByte(name, '/')+1:], size: int64(len(data))},
+	}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (r *RemoteFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	pin, ok := r.Pins[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("template: remote file is not pinned: %w", fs.ErrPermission)}
+	}
+	if !strings.HasPrefix(pin, "sha256:") {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("template: unsupported digest %q", pin)}
+	}
+
+	base, err := url.Parse(r.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("template: invalid base url: %w", err)
+	}
+	u, err := base.Parse(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if u.Scheme != "https" {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("template: refusing to fetch %s without https", u.Redacted())}
+	}
+
+	data, err := r.fetch(u.String(), pin)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// fetch gets the content at rawURL with retries, verifying it against pin.
+func (r *RemoteFS) fetch(rawURL, pin string) ([]byte, error) {
+	delay := r.RetryDelay
+	if delay <= 0 {
+		delay = 200 * time.Millisecond
+	}
+
+	for attempt := 0; ; attempt++ {
+		data, retry, err := r.get(rawURL)
+		if err == nil {
+			if sum := sha256.Sum256(data); "sha256:"+hex.EncodeToString(sum[:]) != pin {
+				return nil, fmt.Errorf("%w: %s does not match %s", ErrIntegrity, rawURL, pin)
+			}
+			return data, nil
+		}
+		if !retry || attempt >= r.Retries {
+			return nil, err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// get sends a conditional request for rawURL, retry reports whether a failed
+// request may succeed when retried.
+func (r *RemoteFS) get(rawURL string) (data []byte, retry bool, err error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.mu.Lock()
+	cached, ok := r.cache[rawURL]
+	r.mu.Unlock()
+	if ok {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("template: fetching %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && ok:
+		return cached.data, false, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, false, fs.ErrNotExist
+	case resp.StatusCode != http.StatusOK:
+		retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("template: fetching %s: %s", rawURL, resp.Status)
+	}
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("template: fetching %s: %w", rawURL, err)
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		r.mu.Lock()
+		if r.cache == nil {
+			r.cache = make(map[string]remoteEntry)
+		}
+		r.cache[rawURL] = remoteEntry{etag: etag, data: data}
+		r.mu.Unlock()
+	}
+
+	return data, false, nil
+}
+
+// remoteFile is a file opened from RemoteFS.
+type remoteFile struct {
+	*bytes.Reader
+	info remoteFileInfo
+}
+
+func (f *remoteFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *remoteFile) Close() error               { return nil }
+
+type remoteFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi remoteFileInfo) Name() string       { return fi.name }
+func (fi remoteFileInfo) Size() int64        { return fi.size }
+func (fi remoteFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (fi remoteFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi remoteFileInfo) IsDir() bool        { return false }
+func (fi remoteFileInfo) Sys() any           { return nil }
@@ -0,0 +1,98 @@
+package tlang
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteFS(t *testing.T) {
+	const header = `define "header"; "# "; .; end`
+	sum := sha256.Sum256([]byte(header))
+	pin := "sha256:" + hex.EncodeToString(sum[:])
+
+	var requests, revalidated, failures int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/shared/header.tl":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&revalidated, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte(header))
+		case "/shared/flaky.tl":
+			if atomic.AddInt32(&failures, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(header))
+		case "/shared/tampered.tl":
+			_, _ = w.Write([]byte(header + "; evil"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	fsys := &RemoteFS{
+		BaseURL: srv.URL + "/shared/",
+		Pins: map[string]string{
+			"header.tl":   pin,
+			"flaky.tl":    pin,
+			"tampered.tl": pin,
+			"missing.tl":  pin,
+		},
+		Client:     srv.Client(),
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+	}
+
+	for i := 0; i < 2; i++ {
+		tmpl, err := New("page").ParseFS(fsys, "header.tl")
+		require.NoError(t, err)
+
+		var sb strings.Builder
+		require.NoError(t, tmpl.ExecuteTemplate(&sb, "header", "Title"))
+		assert.Equal(t, "# Title", sb.String())
+	}
+	// ParseFS stats and reads every file, all but the first fetch are
+	// revalidated
+	assert.EqualValues(t, 3, revalidated)
+
+	_, err := fs.ReadFile(fsys, "flaky.tl")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, failures)
+
+	fsys.Retries = 0
+	atomic.StoreInt32(&failures, 0)
+	_, err = fs.ReadFile(fsys, "flaky.tl")
+	assert.ErrorContains(t, err, "503 Service Unavailable")
+
+	_, err = fs.ReadFile(fsys, "tampered.tl")
+	assert.True(t, errors.Is(err, ErrIntegrity))
+
+	_, err = fs.ReadFile(fsys, "missing.tl")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	n := atomic.LoadInt32(&requests)
+	_, err = fs.ReadFile(fsys, "unpinned.tl")
+	assert.True(t, errors.Is(err, fs.ErrPermission))
+	assert.Equal(t, n, atomic.LoadInt32(&requests))
+
+	fsys.BaseURL = strings.Replace(srv.URL, "https:", "http:", 1) + "/shared/"
+	_, err = fs.ReadFile(fsys, "header.tl")
+	assert.ErrorContains(t, err, "without https")
+}
@@ -0,0 +1,71 @@
+package tlang
+
+import (
+	"reflect"
+	"strings"
+
+	"arhat.dev/tlang/parse"
+)
+
+// Resolver is implemented by data values serving field lookups by themselves.
+//
+// When the receiver of a field chain like .A.B.C implements Resolver, Resolve
+// is called with the remaining path (e.g. ["A", "B", "C"]) instead of walking
+// the value with reflection, so dynamic backends like JSON documents, database
+// rows and feature-flag services can serve dot access directly.
+//
+// A nil value with nil error is treated as a missing map key.
+type Resolver interface {
+	Resolve(path []string) (any, error)
+}
+
+var resolverType = reflect.TypeOf((*Resolver)(nil)).Elem()
+
+// asResolver returns v as a Resolver if v implements it.
+func asResolver(v reflect.Value) (reflect.Value, bool) {
+	v = indirectInterface(v)
+	if !v.IsValid() {
+		return zero, false
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return zero, false
+		}
+	}
+
+	if v.Type().Implements(resolverType) {
+		return v, true
+	}
+
+	if v.CanAddr() && reflect.PointerTo(v.Type()).Implements(resolverType) {
+		return v.Addr(), true
+	}
+
+	return zero, false
+}
+
+// evalResolver resolves path using the Resolver r.
+func (s *state) evalResolver(r reflect.Value, node parse.Node, path []string, args []parse.Node, final reflect.Value) reflect.Value {
+	name := strings.Join(path, ".")
+	if len(args) > 1 || final != missingVal {
+		s.errorf("%s is resolved by %s but has arguments", name, r.Type())
+	}
+
+	// path is part of the tree shared by executions, the resolver may change
+	// its copy
+	path = append([]string(nil), path...)
+	ret, err := safeCall(r.MethodByName("Resolve"), []reflect.Value{reflect.ValueOf(path)})
+	if err != nil {
+		s.at(node)
+		s.errorf("error resolving %s: %w", name, err)
+	}
+
+	ret = indirectInterface(ret)
+	if !ret.IsValid() && s.opt.missingKey == mapError {
+		s.errorf("%s has no entry for key %q", r.Type(), name)
+	}
+
+	return ret
+}
@@ -0,0 +1,75 @@
+package tlang
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testResolver map[string]any
+
+func (r testResolver) Resolve(path []string) (any, error) {
+	key := strings.Join(path, ".")
+	if key == "fail" {
+		return nil, errors.New("resolve failed")
+	}
+
+	return r[key], nil
+}
+
+// mutatingResolver resolves path to itself, then changes it.
+type mutatingResolver struct{}
+
+func (mutatingResolver) Resolve(path []string) (any, error) {
+	key := strings.Join(path, ".")
+	for i := range path {
+		path[i] = "changed"
+	}
+	return key, nil
+}
+
+func TestResolver(t *testing.T) {
+	data := map[string]any{
+		"R": testResolver{"a.b": "ab", "c": 1},
+	}
+
+	for _, test := range []struct {
+		name   string
+		input  string
+		output string
+		ok     bool
+	}{
+		{"full path", `.R.a.b`, "ab", true},
+		{"single", `.R.c`, "1", true},
+		{"variable", `$r := .R; $r.a.b`, "ab", true},
+		{"missing", `.R.x`, "<no value>", true},
+		{"error", `.R.fail`, "", false},
+		{"args", `.R.c 1`, "", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var sb strings.Builder
+			err := Must(New(test.name).Parse(test.input)).Execute(&sb, data)
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+
+	// resolvers may change the path they get without affecting the tree
+	tmpl := Must(New("mutating").Parse(`.R.a.b`))
+	for i := 0; i < 2; i++ {
+		var sb strings.Builder
+		assert.NoError(t, tmpl.Execute(&sb, map[string]any{"R": mutatingResolver{}}))
+		assert.Equal(t, "a.b", sb.String())
+	}
+
+	var sb strings.Builder
+	err := Must(New("missingkey").Option("missingkey=error").Parse(`.x`)).Execute(&sb, testResolver{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package tlang
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrOutputLimit is returned when the output of an execution exceeds the
+// limit set by the maxoutput option.
+var ErrOutputLimit = errors.New("template: output limit exceeded")
+
+// Restricted allocates a new, undefined template like New, with a vetted
+// profile of options for services executing templates from untrusted
+// sources, so that they don't have to assemble the options themselves:
+//
+//	maxdepth=100
+//		Bound nested template invocations.
+//	maxstring=65536, maxrawstring=65536, maxcomment=65536
+//		Bound literals and comments when parsing.
+//	maxoutput=4194304
+//		Bound the output of an execution to 4MiB.
+//	maxsteps=1000000
+//		Bound the number of executed nodes, and so the time spent on
+//		loops.
+//	denyfuncs=env,getenv,expandenv,readFile,readDir,glob,exec,shell,dnsLookup
+//		Remove functions accessing the environment, files, processes or
+//		network of the host from function sets.
+//
+// Options can be changed after with Option. Templates may additionally be
+// admitted by a Scanner before being executed.
+func Restricted(name string) *Template {
+	return New(name).Option(restrictedOptions...)
+}
+
+// restrictedOptions are the options of the Restricted profile.
+var restrictedOptions = []string{
+	"maxdepth=100",
+	"maxstring=65536",
+	"maxrawstring=65536",
+	"maxcomment=65536",
+	"maxoutput=4194304",
+	"maxsteps=1000000",
+	"denyfuncs=" + strings.Join(defaultSensitiveFuncs, ","),
+}
+
+// limitWriter fails writes exceeding n bytes, after writing up to n bytes.
+type limitWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= lw.n {
+		n, err := lw.w.Write(p)
+		lw.n -= int64(n)
+		return n, err
+	}
+
+	n, err := lw.w.Write(p[:lw.n])
+	lw.n -= int64(n)
+	if err == nil {
+		err = ErrOutputLimit
+	}
+	return n, err
+}
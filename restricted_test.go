@@ -0,0 +1,60 @@
+package tlang
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestricted(t *testing.T) {
+	funcs := FuncMap{
+		"env":   func(string) string { return "secret" },
+		"upper": strings.ToUpper,
+	}
+
+	_, err := Restricted("env").Funcs(funcs).Parse(`env "HOME"`)
+	assert.ErrorContains(t, err, `function "env" not defined`)
+
+	_, err = Restricted("big").Parse(`"` + strings.Repeat("x", 1<<17) + `"`)
+	assert.Error(t, err)
+
+	tmpl := Must(Restricted("main").Funcs(funcs).Parse(`upper .`))
+	var sb strings.Builder
+	assert.NoError(t, tmpl.Execute(&sb, "ok"))
+	assert.Equal(t, "OK", sb.String())
+
+	err = Must(Restricted("loop").Parse(`range .; end`)).Execute(io.Discard, make([]int, 2000000))
+	assert.ErrorContains(t, err, "exceeded maximum number of executed nodes (1000000)")
+
+	err = Must(Restricted("output").Parse(`.`)).Execute(io.Discard, strings.Repeat("x", 5<<20))
+	assert.ErrorIs(t, err, ErrOutputLimit)
+
+	err = Must(Restricted("depth").Parse(`define "a"; template "a"; end; template "a"`)).Execute(io.Discard, nil)
+	assert.ErrorContains(t, err, "exceeded maximum template depth (100)")
+}
+
+func TestLimitOptions(t *testing.T) {
+	sb := new(strings.Builder)
+	err := Must(New("t").Option("maxoutput=5").Parse(`"abc"; "def"`)).Execute(sb, nil)
+	assert.ErrorIs(t, err, ErrOutputLimit)
+	assert.Equal(t, "abcde", sb.String())
+
+	err = Must(New("t").Option("maxsteps=3").Parse(`range .; .; end`)).Execute(io.Discard, []int{1, 2})
+	assert.ErrorContains(t, err, "exceeded maximum number of executed nodes (3)")
+
+	funcs := FuncMap{"a": func() string { return "a" }, "b": func() string { return "b" }}
+	tmpl := New("t").Option("denyfuncs=a").Funcs(funcs)
+	_, err = tmpl.Parse(`a`)
+	assert.Error(t, err)
+	sb.Reset()
+	assert.NoError(t, Must(tmpl.Parse(`b`)).Execute(sb, nil))
+	assert.Equal(t, "b", sb.String())
+
+	tmpl = New("t").Funcs(funcs).Option("denyfuncs=a, b")
+	_, err = tmpl.Parse(`b`)
+	assert.Error(t, err)
+
+	assert.Panics(t, func() { New("bad").Option("maxoutput=-1") })
+}
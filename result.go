@@ -0,0 +1,211 @@
+package tlang
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"arhat.dev/tlang/parse"
+)
+
+// ExecResult describes an execution of a template.
+type ExecResult struct {
+	// BytesWritten is the size of the output written to the writer.
+	BytesWritten int64
+
+	// Templates counts template executions by name, including the one
+	// executed at first.
+	Templates map[string]int
+
+	// Funcs counts function calls by name.
+	Funcs map[string]int
+
+	// Duration is the time taken by the execution.
+	Duration time.Duration
+
+	// Warnings are problems not stopping the execution, like printing
+	// missing values as "<no value>".
+	Warnings []string
+
+	// SourceMap lists the parts of the output in order with the actions
+	// producing them, only recorded when ExecOptions.SourceMap is set.
+	SourceMap []SourceSpan
+
+	// Value is the value returned by a return action at the top level of
+	// the executed template, nil if nothing is returned.
+	Value any
+
+	// Results are named results set by the template, see ResultFuncs.
+	Results map[string]any
+
+	// Flags are the feature flags evaluated in the execution, see
+	// Env.Feature.
+	Flags map[string]bool
+
+	// Digest is the SHA-256 hash of the output written to the writer, only
+	// computed when ExecOptions.Digest is set, e.g. to detect renders not
+	// changing the output without buffering it.
+	Digest []byte
+
+	returned  bool          // whether the executed template returned.
+	evaluated bool          // whether an action was evaluated at the top level.
+	last      reflect.Value // value of the last action at the top level.
+}
+
+// ResultStatus is the name of the result set by setStatus.
+const ResultStatus = "status"
+
+// ResultFuncs returns functions setting named results of the execution,
+// reported in ExecResult.Results, so that decision templates communicate
+// outcomes without their text output being parsed:
+//
+//	setResult name value
+//		Sets the result name to value.
+//	setStatus code
+//		Sets the result "status" to the integer code, see ExecResult.Status.
+//
+// Both return an empty string, so that they can be called from actions
+// without printing anything.
+func ResultFuncs() FuncMap {
+	return FuncMap{
+		"setResult": func(env Env, name string, value any) string {
+			env.SetResult(name, value)
+			return ""
+		},
+		"setStatus": func(env Env, code int) string {
+			env.SetResult(ResultStatus, code)
+			return ""
+		},
+	}
+}
+
+// Status returns the status code set by setStatus, 0 if not set.
+func (r *ExecResult) Status() int {
+	code, _ := r.Results[ResultStatus].(int)
+	return code
+}
+
+// SourceSpan is a part of the output produced by a single action.
+type SourceSpan struct {
+	// Start and End are byte offsets of the part in the output, End is
+	// exclusive.
+	Start, End int64
+
+	// Template is the name of the template executing the action.
+	Template string
+
+	// Location is the position of the action as name:line:col.
+	Location string
+}
+
+// SourceAt returns the span containing the byte at offset of the output.
+func (r *ExecResult) SourceAt(offset int64) (SourceSpan, bool) {
+	i := sort.Search(len(r.SourceMap), func(i int) bool {
+		return r.SourceMap[i].End > offset
+	})
+	if i == len(r.SourceMap) || r.SourceMap[i].Start > offset {
+		return SourceSpan{}, false
+	}
+	return r.SourceMap[i], true
+}
+
+// ExecuteWithResult is like ExecuteWithOptions, it also reports what the
+// execution did, the result is valid even if execution failed.
+func (t *Template) ExecuteWithResult(wr io.Writer, data any, opts *ExecOptions) (*ExecResult, error) {
+	tmpl, snap := t.snapshot()
+	return snap.executeWithResult(tmpl, wr, data, opts)
+}
+
+// executeWithResult is ExecuteWithResult with the options, functions and
+// templates of snap.
+func (snap *execSnapshot) executeWithResult(t *Template, wr io.Writer, data any, opts *ExecOptions) (*ExecResult, error) {
+	result := &ExecResult{
+		Templates: make(map[string]int),
+		Funcs:     make(map[string]int),
+	}
+
+	start := time.Now()
+	cw := &countingWriter{w: wr}
+	if opts != nil && opts.Digest {
+		cw.h = sha256.New()
+	}
+	err := snap.execute(t, cw, data, opts, result)
+	result.BytesWritten = cw.n
+	result.Duration = time.Since(start)
+	if cw.h != nil {
+		result.Digest = cw.h.Sum(nil)
+	}
+
+	return result, err
+}
+
+// warnf records a warning about the current node if the result is collected.
+func (s *state) warnf(format string, args ...any) {
+	if s.result == nil {
+		return
+	}
+
+	location := s.tmpl.Name()
+	if s.node != nil {
+		location, _ = s.tmpl.ErrorContext(s.node)
+	}
+	s.result.Warnings = append(s.result.Warnings, fmt.Sprintf("%s: %s", location, fmt.Sprintf(format, args...)))
+}
+
+// warnMissing records a warning when v is printed as "<no value>".
+func (s *state) warnMissing(n parse.Node, v reflect.Value) {
+	if s.result == nil {
+		return
+	}
+
+	if v.Kind() == reflect.Pointer {
+		v, _ = indirect(v)
+	}
+	if !v.IsValid() {
+		s.warnf("%s has no value", n)
+	}
+}
+
+// offset returns the size of the output if the source map is recorded.
+func (s *state) offset() int64 {
+	if s.out == nil {
+		return 0
+	}
+	return s.out.n
+}
+
+// mapSource records the output written since start as produced by node,
+// output to buffers of template invocations used as values is not mapped.
+func (s *state) mapSource(node parse.Node, start int64) {
+	if s.out == nil || s.env.out.w != io.Writer(s.out) || s.out.n == start {
+		return
+	}
+
+	location, _ := s.tmpl.ErrorContext(node)
+	s.result.SourceMap = append(s.result.SourceMap, SourceSpan{
+		Start:    start,
+		End:      s.out.n,
+		Template: s.tmpl.Name(),
+		Location: location,
+	})
+}
+
+// countingWriter counts bytes written to w, and hashes them if h is set.
+type countingWriter struct {
+	w io.Writer
+	n int64
+	h hash.Hash
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	if cw.h != nil {
+		cw.h.Write(p[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,116 @@
+package tlang
+
+import (
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteWithResult(t *testing.T) {
+	funcs := FuncMap{"upper": strings.ToUpper, "fail": func() (string, error) { return "", assert.AnError }}
+	tmpl := Must(New("main").Funcs(funcs).Parse(`define "item"; upper .; ","; end
+range .Items; template "item" .; end
+.Missing
+`))
+
+	var sb strings.Builder
+	result, err := tmpl.ExecuteWithResult(&sb, map[string]any{"Items": []string{"a", "b"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "A,B,<no value>", sb.String())
+	assert.EqualValues(t, sb.Len(), result.BytesWritten)
+	assert.Equal(t, map[string]int{"main": 1, "item": 2}, result.Templates)
+	assert.Equal(t, map[string]int{"upper": 2}, result.Funcs)
+	assert.Equal(t, []string{"main:3:0: {{.Missing}} has no value"}, result.Warnings)
+	assert.Greater(t, int64(result.Duration), int64(0))
+
+	sb.Reset()
+	result, err = Must(New("fail").Funcs(funcs).Parse(`"ok"; fail`)).ExecuteWithResult(&sb, nil, nil)
+	assert.Error(t, err)
+	assert.EqualValues(t, 2, result.BytesWritten)
+	assert.Equal(t, map[string]int{"fail": 1}, result.Funcs)
+}
+
+func TestSourceMap(t *testing.T) {
+	tmpl := Must(New("main").Parse(`define "item"
+  "- "; .
+  "\n"
+end
+"items:\n"
+range .; template "item" .; end
+$x := (template "item" "v")
+`))
+
+	var sb strings.Builder
+	result, err := tmpl.ExecuteWithResult(&sb, []string{"a"}, &ExecOptions{SourceMap: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "items:\n- a\n", sb.String())
+	assert.Equal(t, []SourceSpan{
+		{Start: 0, End: 7, Template: "main", Location: "main:5:0"},
+		{Start: 7, End: 9, Template: "item", Location: "main:2:2"},
+		{Start: 9, End: 10, Template: "item", Location: "main:2:8"},
+		{Start: 10, End: 11, Template: "item", Location: "main:3:2"},
+	}, result.SourceMap)
+
+	span, ok := result.SourceAt(9)
+	assert.True(t, ok)
+	assert.Equal(t, "main:2:8", span.Location)
+
+	_, ok = result.SourceAt(11)
+	assert.False(t, ok)
+
+	result, err = tmpl.ExecuteWithResult(&sb, []string{"a"}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, result.SourceMap)
+}
+
+func TestExecResultDigest(t *testing.T) {
+	tmpl := Must(New("main").Parse(`range .; .; "\n"; end`))
+
+	var sb strings.Builder
+	result, err := tmpl.ExecuteWithResult(&sb, []string{"a", "b"}, &ExecOptions{Digest: true})
+	assert.NoError(t, err)
+	sum := sha256.Sum256([]byte(sb.String()))
+	assert.Equal(t, sum[:], result.Digest)
+
+	again, err := tmpl.ExecuteWithResult(io.Discard, []string{"a", "b"}, &ExecOptions{Digest: true})
+	assert.NoError(t, err)
+	assert.Equal(t, result.Digest, again.Digest)
+
+	changed, err := tmpl.ExecuteWithResult(io.Discard, []string{"a", "c"}, &ExecOptions{Digest: true})
+	assert.NoError(t, err)
+	assert.NotEqual(t, result.Digest, changed.Digest)
+
+	result, err = tmpl.ExecuteWithResult(io.Discard, nil, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, result.Digest)
+}
+
+func TestExecResultValue(t *testing.T) {
+	tmpl := Must(New("policy").Funcs(ResultFuncs()).Parse(`define "deny"; setResult "reason" .; setStatus 3; end
+if .Admin
+  return "allow"
+end
+template "deny" "not admin"
+"denied"
+`))
+
+	var sb strings.Builder
+	result, err := tmpl.ExecuteWithResult(&sb, map[string]bool{"Admin": true}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "allow", result.Value)
+	assert.Nil(t, result.Results)
+	assert.Equal(t, 0, result.Status())
+
+	result, err = tmpl.ExecuteWithResult(&sb, map[string]bool{}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, result.Value)
+	assert.Equal(t, map[string]any{"reason": "not admin", "status": 3}, result.Results)
+	assert.Equal(t, 3, result.Status())
+	assert.Equal(t, "denied", sb.String())
+
+	// results are ignored when not collected
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+}
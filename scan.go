@@ -0,0 +1,256 @@
+package tlang
+
+import (
+	"fmt"
+
+	"arhat.dev/tlang/parse"
+)
+
+// Severity is the level of risk of a Finding.
+type Severity int
+
+// Severity levels in increasing order.
+const (
+	SeverityLow Severity = iota
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityLow:
+		return "low"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Rules reported in findings.
+const (
+	RuleDeniedFunc    = "denied-func"
+	RuleSensitiveFunc = "sensitive-func"
+	RuleRecursion     = "recursion"
+	RuleLargeLiteral  = "large-literal"
+	RuleNestedRange   = "nested-range"
+)
+
+// Finding is a risky construct found by Scanner.
+type Finding struct {
+	Severity Severity
+
+	// Rule is the check reporting the finding, one of Rule* constants.
+	Rule string
+
+	// Template is the name of the template containing the construct.
+	Template string
+
+	// Location is the position of the construct as name:line:col.
+	Location string
+
+	// Message describes the finding.
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: [%s] %s: %s", f.Location, f.Severity, f.Rule, f.Message)
+}
+
+// Defaults of Scanner limits.
+const (
+	DefaultMaxLiteralSize  = 64 << 10
+	DefaultMaxRangeNesting = 3
+)
+
+// Scanner checks a template set for risky constructs before executing it,
+// it is intended for admission of templates from untrusted sources.
+//
+// The zero Scanner reports calls to commonly sensitive functions, recursive
+// template invocations, large literals and deeply nested ranges.
+type Scanner struct {
+	// DeniedFuncs are functions not allowed to be called, calls to them
+	// are critical findings.
+	DeniedFuncs []string
+
+	// SensitiveFuncs are functions accessing the environment, files,
+	// processes or network of the host, calls to them are high findings.
+	//
+	// Defaults to env, getenv, expandenv, readFile, readDir, glob, exec,
+	// shell and dnsLookup when nil.
+	SensitiveFuncs []string
+
+	// MaxLiteralSize is the size in bytes above which a string literal is a
+	// medium finding, defaults to DefaultMaxLiteralSize.
+	MaxLiteralSize int
+
+	// MaxRangeNesting is the depth above which nested ranges are a low
+	// finding, as every level multiplies the output, defaults to
+	// DefaultMaxRangeNesting.
+	MaxRangeNesting int
+
+	// Threshold is the lowest severity making Check fail.
+	Threshold Severity
+}
+
+var defaultSensitiveFuncs = []string{
+	"env", "getenv", "expandenv", "readFile", "readDir", "glob", "exec", "shell", "dnsLookup",
+}
+
+// Scan returns findings in all templates associated with t, sorted by
+// template name and position.
+func (s *Scanner) Scan(t *Template) []Finding {
+	var (
+		denied    = toSet(s.DeniedFuncs)
+		sensitive = toSet(s.SensitiveFuncs)
+
+		maxLiteral = s.MaxLiteralSize
+		maxNesting = s.MaxRangeNesting
+	)
+
+	if s.SensitiveFuncs == nil {
+		sensitive = toSet(defaultSensitiveFuncs)
+	}
+	if maxLiteral <= 0 {
+		maxLiteral = DefaultMaxLiteralSize
+	}
+	if maxNesting <= 0 {
+		maxNesting = DefaultMaxRangeNesting
+	}
+
+	var (
+		names    = t.Names()
+		calls    = make(map[string][]string)
+		findings []Finding
+	)
+
+	for _, name := range names {
+		tmpl := t.Lookup(name)
+		for _, n := range calledTemplates(tmpl.Root) {
+			calls[name] = append(calls[name], n.Name)
+		}
+	}
+
+	for _, name := range names {
+		tmpl := t.Lookup(name)
+
+		report := func(n parse.Node, sev Severity, rule, format string, args ...any) {
+			location, _ := tmpl.ErrorContext(n)
+			findings = append(findings, Finding{
+				Severity: sev,
+				Rule:     rule,
+				Template: name,
+				Location: location,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		var inspect func(node parse.Node, ranges int)
+		inspect = func(node parse.Node, ranges int) {
+			parse.Inspect(node, func(n parse.Node) bool {
+				switch n := n.(type) {
+				case *parse.IdentifierNode:
+					if _, ok := denied[n.Ident]; ok {
+						report(n, SeverityCritical, RuleDeniedFunc, "call to denied function %q", n.Ident)
+					} else if _, ok := sensitive[n.Ident]; ok {
+						report(n, SeverityHigh, RuleSensitiveFunc, "call to sensitive function %q", n.Ident)
+					}
+				case *parse.StringNode:
+					if len(n.Text) > maxLiteral {
+						report(n, SeverityMedium, RuleLargeLiteral, "string literal of %d bytes", len(n.Text))
+					}
+				case *parse.TemplateNode:
+					if !n.Recurse && reaches(calls, n.Name, name) {
+						report(n, SeverityMedium, RuleRecursion, "template %q invokes %q recursively", name, n.Name)
+					}
+				case *parse.RangeNode:
+					if ranges+1 > maxNesting {
+						report(n, SeverityLow, RuleNestedRange, "range nested %d levels deep", ranges+1)
+					}
+
+					inspect(n.Pipe, ranges)
+					for _, stage := range n.Stages {
+						inspect(stage, ranges)
+					}
+					inspect(n.SortBy, ranges)
+					inspect(n.List, ranges+1)
+					inspect(n.ElseList, ranges)
+					return false
+				}
+
+				return true
+			})
+		}
+
+		inspect(tmpl.Root, 0)
+	}
+
+	return findings
+}
+
+// Check scans t and returns an error listing the findings at or above the
+// threshold, if any.
+func (s *Scanner) Check(t *Template) error {
+	var errs MultiError
+	for _, f := range s.Scan(t) {
+		if f.Severity >= s.Threshold {
+			errs = append(errs, fmt.Errorf("%s", f))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &errs
+}
+
+// calledTemplates returns template invocations in the tree rooted at node.
+func calledTemplates(node parse.Node) (ret []*parse.TemplateNode) {
+	parse.Inspect(node, func(n parse.Node) bool {
+		if n, ok := n.(*parse.TemplateNode); ok {
+			ret = append(ret, n)
+		}
+		return true
+	})
+	return
+}
+
+// reaches reports whether template from invokes template to directly or
+// indirectly, or from is to.
+func reaches(calls map[string][]string, from, to string) bool {
+	seen := make(map[string]struct{})
+
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		if name == to {
+			return true
+		}
+		if _, ok := seen[name]; ok {
+			return false
+		}
+		seen[name] = struct{}{}
+
+		for _, next := range calls[name] {
+			if visit(next) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return visit(from)
+}
+
+func toSet(names []string) map[string]struct{} {
+	ret := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		ret[n] = struct{}{}
+	}
+	return ret
+}
@@ -0,0 +1,55 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanner(t *testing.T) {
+	funcs := FuncMap{
+		"env":  func(string) string { return "" },
+		"exec": func(string) string { return "" },
+		"f":    func(...any) string { return "" },
+	}
+
+	tmpl := Must(New("main").Funcs(funcs).Parse(`env "HOME"
+exec "ls"
+template "a" .
+range .A; range .B; range .C; range .D; f .; end; end; end; end
+define "a"; template "b" .; end
+define "b"; template "a" .; end
+define "c"; template "b" .; end
+`))
+	Must(tmpl.New("big").Parse(`"` + strings.Repeat("x", 100) + `"`))
+
+	s := &Scanner{
+		DeniedFuncs:    []string{"exec"},
+		MaxLiteralSize: 64,
+	}
+
+	var got []string
+	for _, f := range s.Scan(tmpl) {
+		got = append(got, f.String())
+	}
+
+	assert.Equal(t, []string{
+		`main:5:21: [medium] recursion: template "a" invokes "b" recursively`,
+		`main:6:21: [medium] recursion: template "b" invokes "a" recursively`,
+		`big:1:0: [medium] large-literal: string literal of 100 bytes`,
+		`main:1:0: [high] sensitive-func: call to sensitive function "env"`,
+		`main:2:0: [critical] denied-func: call to denied function "exec"`,
+		`main:4:36: [low] nested-range: range nested 4 levels deep`,
+	}, got)
+
+	s.Threshold = SeverityHigh
+	err := s.Check(tmpl)
+	if assert.Error(t, err) {
+		assert.Len(t, *err.(*MultiError), 2)
+	}
+
+	s.Threshold = SeverityCritical
+	s.DeniedFuncs = nil
+	assert.NoError(t, s.Check(tmpl))
+}
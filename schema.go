@@ -0,0 +1,180 @@
+package tlang
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaError is returned by Execute when the data violates the schema of
+// the template, see Template.Schema, nothing is written then.
+type SchemaError struct {
+	// Template is the name of the executed template.
+	Template string
+
+	// Violations are the violations of the schema.
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	list := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		list[i] = v.Field + ": " + v.Msg
+	}
+	return fmt.Sprintf("template: data of %q violates its schema: %s", e.Template, strings.Join(list, "; "))
+}
+
+// SchemaViolation is a violation of a schema.
+type SchemaViolation struct {
+	// Field is the name of the invalid value as written in templates, like
+	// .Items[0].Name, with Go names of struct fields, or "." for the data
+	// itself.
+	Field string
+
+	// Pointer is the JSON pointer of the invalid value in the JSON form of
+	// the data.
+	Pointer string
+
+	// Msg describes the violation.
+	Msg string
+}
+
+// Schema sets the JSON Schema data t is executed with is validated against,
+// so that bad inputs are rejected with a *SchemaError before any output is
+// written, the keywords supported are those of validateSchema in
+// ValidationFuncs. schema is JSON text as a string or []byte, or a decoded
+// value, a nil schema disables validation. Data is validated in its JSON
+// form, violations are reported with names of fields in templates.
+//
+// It panics if schema can't be decoded. The return value is the template,
+// so calls can be chained.
+func (t *Template) Schema(schema any) *Template {
+	switch text := schema.(type) {
+	case string:
+		schema = []byte(text)
+	case json.RawMessage:
+		schema = []byte(text)
+	}
+	if text, ok := schema.([]byte); ok {
+		schema = nil
+		if err := json.Unmarshal(text, &schema); err != nil {
+			panic(fmt.Sprintf("invalid schema: %v", err))
+		}
+	}
+
+	if schema != nil {
+		var err error
+		schema, err = toJSONValue(schema)
+		if err != nil {
+			panic(fmt.Sprintf("invalid schema: %v", err))
+		}
+	}
+
+	t.init()
+	t.muTmpl.Lock()
+	defer t.muTmpl.Unlock()
+	if t.frozen {
+		panic(fmt.Sprintf("template: %s: Schema called after Freeze", t.name))
+	}
+	t.schema = schema
+	return t
+}
+
+// checkSchema validates data against the schema of t.
+func (t *Template) checkSchema(data reflect.Value) error {
+	var v any
+	if data.IsValid() && data.CanInterface() {
+		v = data.Interface()
+	}
+
+	doc, err := toJSONValue(v)
+	if err != nil {
+		return fmt.Errorf("template: can't validate data of %q: %w", t.Name(), err)
+	}
+
+	var violations []SchemaViolation
+	validateSchema(t.schema, doc, "", &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	for i := range violations {
+		violations[i].Field = fieldPath(data, violations[i].Pointer)
+		violations[i].Pointer = pointer(violations[i].Pointer)
+	}
+	return &SchemaError{Template: t.Name(), Violations: violations}
+}
+
+// fieldPath converts the JSON pointer ptr in the JSON form of v to the path
+// of the value in templates.
+func fieldPath(v reflect.Value, ptr string) string {
+	if ptr == "" {
+		return "."
+	}
+
+	var sb strings.Builder
+	for _, tok := range strings.Split(ptr[1:], "/") {
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+
+		v, _ = indirect(v)
+		switch v.Kind() {
+		case reflect.Struct:
+			if f, ok := jsonField(v.Type(), tok); ok {
+				sb.WriteString("." + f.Name)
+				v, _ = v.FieldByIndexErr(f.Index)
+				continue
+			}
+		case reflect.Slice, reflect.Array:
+			if i, err := strconv.Atoi(tok); err == nil && i < v.Len() {
+				sb.WriteString("[" + tok + "]")
+				v = v.Index(i)
+				continue
+			}
+		case reflect.Map:
+			sb.WriteString("." + tok)
+			if v.Type().Key().Kind() == reflect.String {
+				v = v.MapIndex(reflect.ValueOf(tok).Convert(v.Type().Key()))
+			} else {
+				v = reflect.Value{}
+			}
+			continue
+		}
+
+		// the JSON form comes from a marshaler
+		sb.WriteString("." + tok)
+		v = reflect.Value{}
+	}
+	return sb.String()
+}
+
+func indirectType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Pointer {
+		return typ.Elem()
+	}
+	return typ
+}
+
+// jsonField returns the field of the struct type typ encoded as name in
+// JSON.
+func jsonField(typ reflect.Type, name string) (reflect.StructField, bool) {
+	for _, f := range reflect.VisibleFields(typ) {
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || f.Anonymous && tag == "" && indirectType(f.Type).Kind() == reflect.Struct {
+			// fields of embedded structs are promoted
+			continue
+		}
+
+		switch tag {
+		case "-":
+			continue
+		case "":
+			tag = f.Name
+		}
+		if tag == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,82 @@
+package tlang
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateSchema(t *testing.T) {
+	type Item struct {
+		Name  string `json:"name"`
+		Count int
+	}
+	type Base struct {
+		ID string `json:"id"`
+	}
+	type Order struct {
+		Base
+		Items  []Item          `json:"items"`
+		Labels map[string]bool `json:"labels"`
+		Secret string          `json:"-"`
+	}
+
+	tmpl := Must(New("order").Parse(`range .Items; .Name; end`)).Schema(`{
+		"type": "object",
+		"required": ["id"],
+		"properties": {
+			"id": {"type": "string", "minLength": 1},
+			"items": {
+				"type": "array",
+				"minItems": 1,
+				"items": {
+					"type": "object",
+					"properties": {
+						"name": {"type": "string", "pattern": "^[a-z]+$"},
+						"Count": {"minimum": 1}
+					}
+				}
+			},
+			"labels": {"additionalProperties": {"const": true}}
+		}
+	}`)
+
+	var sb strings.Builder
+	require.NoError(t, tmpl.Execute(&sb, Order{Base: Base{ID: "1"}, Items: []Item{{Name: "a", Count: 1}}}))
+	assert.Equal(t, "a", sb.String())
+
+	sb.Reset()
+	err := tmpl.Execute(&sb, Order{
+		Items:  []Item{{Name: "a", Count: 1}, {Name: "B", Count: 0}},
+		Labels: map[string]bool{"x/y": false},
+	})
+	var serr *SchemaError
+	require.True(t, errors.As(err, &serr), err)
+	assert.Empty(t, sb.String(), "nothing must be written")
+	assert.Equal(t, []SchemaViolation{
+		{Field: ".ID", Pointer: "/id", Msg: "length 0 is less than 1"},
+		{Field: ".Items[1].Count", Pointer: "/items/1/Count", Msg: "0 is less than 1"},
+		{Field: ".Items[1].Name", Pointer: "/items/1/name", Msg: `"B" does not match "^[a-z]+$"`},
+		{Field: ".Labels.x/y", Pointer: "/labels/x~1y", Msg: "expected true"},
+	}, serr.Violations)
+	assert.EqualError(t, err, `template: data of "order" violates its schema: .ID: length 0 is less than 1; `+
+		`.Items[1].Count: 0 is less than 1; .Items[1].Name: "B" does not match "^[a-z]+$"; .Labels.x/y: expected true`)
+
+	err = tmpl.Execute(&sb, nil)
+	assert.EqualError(t, err, `template: data of "order" violates its schema: .: expected object, got null`)
+
+	err = tmpl.Execute(&sb, map[string]any{"id": "1", "items": []any{map[string]any{"name": 1}}})
+	require.True(t, errors.As(err, &serr))
+	assert.Equal(t, ".items[0].name", serr.Violations[0].Field)
+
+	// sub templates and clones
+	clone, err := tmpl.Clone()
+	require.NoError(t, err)
+	assert.Error(t, clone.Execute(&sb, nil))
+	assert.NoError(t, clone.Schema(nil).Execute(&sb, nil))
+
+	assert.Panics(t, func() { New("x").Schema(`{`) })
+}
@@ -0,0 +1,129 @@
+package tlang
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Scratch is a key/value store of a single execution, shared by all
+// templates it invokes, see Env.Scratch.
+//
+// Methods modifying the store return an empty string, so that they can be
+// called from actions without printing anything.
+type Scratch struct {
+	values map[string]any
+}
+
+// ScratchFuncs returns functions giving templates mutable storage that
+// survives across template invocations of an execution:
+//
+//	scratch
+//		Returns the *Scratch of the execution, e.g.
+//
+//		(scratch).Set "title" .Title
+//		(scratch).Add "count" 1
+//		(scratch).Get "title"
+func ScratchFuncs() FuncMap {
+	return FuncMap{
+		"scratch": func(env Env) *Scratch {
+			return env.Scratch()
+		},
+	}
+}
+
+// Set stores value as key.
+func (s *Scratch) Set(key string, value any) string {
+	if s.values == nil {
+		s.values = make(map[string]any)
+	}
+
+	s.values[key] = value
+	return ""
+}
+
+// Get returns the value stored as key, nil if there is none.
+func (s *Scratch) Get(key string) any {
+	return s.values[key]
+}
+
+// Add adds value to the value stored as key: numbers are summed, strings
+// concatenated and values appended to slices, it stores value when key is
+// not set.
+func (s *Scratch) Add(key string, value any) (string, error) {
+	old, ok := s.values[key]
+	if !ok {
+		return s.Set(key, value), nil
+	}
+
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(value)
+	if a, ok := toNumber(ov); ok {
+		b, ok := toNumber(nv)
+		if !ok {
+			return "", fmt.Errorf("cannot add %T to number %q", value, key)
+		}
+
+		sum, err := arith('+', a, b)
+		if err != nil {
+			return "", err
+		}
+		return s.Set(key, sum.value().Interface()), nil
+	}
+
+	switch ov.Kind() {
+	case reflect.String:
+		if nv.Kind() != reflect.String {
+			return "", fmt.Errorf("cannot add %T to string %q", value, key)
+		}
+		return s.Set(key, ov.String()+nv.String()), nil
+	case reflect.Slice:
+		elem := ov.Type().Elem()
+		switch {
+		case nv.Kind() == reflect.Slice && nv.Type().Elem().AssignableTo(elem):
+			ret := reflect.MakeSlice(ov.Type(), 0, ov.Len()+nv.Len())
+			return s.Set(key, reflect.AppendSlice(reflect.AppendSlice(ret, ov), nv).Interface()), nil
+		case nv.IsValid() && nv.Type().AssignableTo(elem):
+			ret := reflect.MakeSlice(ov.Type(), 0, ov.Len()+1)
+			return s.Set(key, reflect.Append(reflect.AppendSlice(ret, ov), nv).Interface()), nil
+		case !nv.IsValid() && isNilValue(reflect.Zero(elem)):
+			ret := reflect.MakeSlice(ov.Type(), 0, ov.Len()+1)
+			return s.Set(key, reflect.Append(reflect.AppendSlice(ret, ov), reflect.Zero(elem)).Interface()), nil
+		}
+		return "", fmt.Errorf("cannot add %T to %T %q", value, old, key)
+	default:
+		return "", fmt.Errorf("cannot add to %T %q", old, key)
+	}
+}
+
+// SetInMap stores value as mapKey of the map stored as key, creating the
+// map when key is not set.
+func (s *Scratch) SetInMap(key, mapKey string, value any) (string, error) {
+	m, ok := s.values[key].(map[string]any)
+	if !ok {
+		if _, exists := s.values[key]; exists {
+			return "", fmt.Errorf("%q is not a map", key)
+		}
+
+		m = make(map[string]any)
+		s.Set(key, m)
+	}
+
+	m[mapKey] = value
+	return "", nil
+}
+
+// Delete removes key.
+func (s *Scratch) Delete(key string) string {
+	delete(s.values, key)
+	return ""
+}
+
+// Keys returns stored keys in sorted order.
+func (s *Scratch) Keys() []string {
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
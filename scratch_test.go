@@ -0,0 +1,75 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScratch(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			name: "across invocations",
+			input: `define "count"; (scratch).Add "n" 1; end
+range .; template "count"; end
+(scratch).Get "n"`,
+			expected: "3",
+		},
+		{
+			name:     "strings",
+			input:    `$s := scratch; $s.Set "a" "x"; $s.Add "a" "y"; $s.Get "a"`,
+			expected: "xy",
+		},
+		{
+			name:     "slices",
+			input:    `$s := scratch; range .; $s.Add "l" (slice .); end; $s.Get "l"`,
+			expected: "[1 2 3]",
+		},
+		{
+			name:     "maps",
+			input:    `$s := scratch; $s.SetInMap "m" "b" 2; $s.SetInMap "m" "a" 1; $s.Get "m"; $s.Keys`,
+			expected: "map[a:1 b:2][m]",
+		},
+		{
+			name:     "delete",
+			input:    `$s := scratch; $s.Set "a" 1; $s.Delete "a"; $s.Get "a"`,
+			expected: "<no value>",
+		},
+		{
+			name:  "mismatched add",
+			input: `$s := scratch; $s.Set "a" 1; $s.Add "a" "x"`,
+			err:   `cannot add string to number "a"`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			funcs := ScratchFuncs()
+			funcs["slice"] = func(v ...int) []int { return v }
+			tmpl := Must(New(test.name).Funcs(funcs).Parse(test.input))
+
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, []int{1, 2, 3})
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	t.Run("per execution", func(t *testing.T) {
+		tmpl := Must(New("count").Funcs(ScratchFuncs()).Parse(`(scratch).Add "n" 1; (scratch).Get "n"`))
+		for i := 0; i < 2; i++ {
+			var sb strings.Builder
+			assert.NoError(t, tmpl.Execute(&sb, nil))
+			assert.Equal(t, "1", sb.String())
+		}
+	})
+}
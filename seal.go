@@ -0,0 +1,77 @@
+package tlang
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Sealed is a frozen template prepared for concurrent executions, see
+// Template.Seal. It is safe for concurrent use.
+type Sealed struct {
+	t    *Template     // the sealed template.
+	tmpl *Template     // copy of t executed.
+	snap *execSnapshot // state of executions, including templates.
+}
+
+// Seal freezes t and its associated templates, see Freeze, so that later
+// calls of Parse and of methods changing trees, like Optimize, fail and
+// calls of Funcs or Option panic, and returns a handle executing them.
+//
+// The options, functions and templates executions of the handle run with
+// are captured once when sealing, where executions of t take a snapshot of
+// them every time and look templates up when invoking them, so that
+// executions of the handle take no locks. Since frozen templates cannot be
+// changed, the handle and t execute the same templates.
+func (t *Template) Seal() *Sealed {
+	t.Freeze()
+	tmpl, snap := t.snapshot()
+
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+	snap.templates = make(map[string]*Template, len(t.tmpl))
+	for name, v := range t.tmpl {
+		snap.templates[name] = v.copy(v.common)
+	}
+
+	return &Sealed{t: t, tmpl: tmpl, snap: snap}
+}
+
+// Template returns the frozen template s was sealed from.
+func (s *Sealed) Template() *Template {
+	return s.t
+}
+
+// Name returns the name of the template.
+func (s *Sealed) Name() string {
+	return s.tmpl.name
+}
+
+// Execute is like Template.Execute.
+func (s *Sealed) Execute(wr io.Writer, data any) error {
+	return s.snap.execute(s.tmpl, wr, data, nil, nil)
+}
+
+// ExecuteTemplate is like Template.ExecuteTemplate.
+func (s *Sealed) ExecuteTemplate(wr io.Writer, name string, data any) error {
+	tmpl := s.snap.templates[name]
+	if tmpl == nil {
+		return fmt.Errorf("template: no template %q associated with template %q", name, s.tmpl.name)
+	}
+	return s.snap.execute(tmpl, wr, data, nil, nil)
+}
+
+// ExecuteContext is like Template.ExecuteContext.
+func (s *Sealed) ExecuteContext(ctx context.Context, wr io.Writer, data any) error {
+	return s.snap.execute(s.tmpl, wr, data, &ExecOptions{Context: ctx}, nil)
+}
+
+// ExecuteWithOptions is like Template.ExecuteWithOptions.
+func (s *Sealed) ExecuteWithOptions(wr io.Writer, data any, opts *ExecOptions) error {
+	return s.snap.execute(s.tmpl, wr, data, opts, nil)
+}
+
+// ExecuteWithResult is like Template.ExecuteWithResult.
+func (s *Sealed) ExecuteWithResult(wr io.Writer, data any, opts *ExecOptions) (*ExecResult, error) {
+	return s.snap.executeWithResult(s.tmpl, wr, data, opts)
+}
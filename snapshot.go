@@ -0,0 +1,140 @@
+package tlang
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"arhat.dev/tlang/parse"
+)
+
+// Snapshot is the state of a failed execution captured for error reports,
+// see ExecOptions.Snapshot and ExecError.Report.
+type Snapshot struct {
+	// Dot is the value of dot at the failing node.
+	Dot any
+
+	// Vars are values of variables in scope, and of global variables, by
+	// name with dollar signs, including $.
+	Vars map[string]any
+
+	// Trace lists the last executed nodes, oldest first, as
+	// "name:line:col: node", the last one was executing when it failed.
+	Trace []string
+}
+
+// snapshotter records the execution for snapshots, it is shared by all
+// templates invoked in an execution.
+type snapshotter struct {
+	redact func(name string, value any) any
+
+	dot   reflect.Value
+	trace []tracedNode // ring buffer of executed nodes.
+	next  int          // index of the next node in trace.
+	full  bool         // whether trace has wrapped around.
+}
+
+type tracedNode struct {
+	tmpl *Template
+	node parse.Node
+}
+
+func newSnapshotter(n int, redact func(name string, value any) any) *snapshotter {
+	return &snapshotter{
+		redact: redact,
+		trace:  make([]tracedNode, n),
+	}
+}
+
+// record records the walk of node in tmpl with dot.
+func (r *snapshotter) record(tmpl *Template, dot reflect.Value, node parse.Node) {
+	r.dot = dot
+	switch node.(type) {
+	case *parse.ListNode, *parse.TextNode, *parse.CommentNode:
+		return
+	}
+
+	r.trace[r.next] = tracedNode{tmpl, node}
+	r.next++
+	if r.next == len(r.trace) {
+		r.next, r.full = 0, true
+	}
+}
+
+// snapshot captures the state s is in.
+func (r *snapshotter) snapshot(s *state) *Snapshot {
+	ret := &Snapshot{
+		Dot:  r.value(".", r.dot),
+		Vars: make(map[string]any, len(s.vars)+len(s.globals)),
+	}
+	for name, v := range s.globals {
+		ret.Vars[name] = r.value(name, v)
+	}
+	for _, v := range s.vars {
+		// later declarations shadow earlier ones
+		ret.Vars[v.name] = r.value(v.name, v.value)
+	}
+
+	nodes := r.trace[:r.next]
+	if r.full {
+		nodes = append(append([]tracedNode(nil), r.trace[r.next:]...), nodes...)
+	}
+	for _, n := range nodes {
+		location, context := n.tmpl.ErrorContext(n.node)
+		ret.Trace = append(ret.Trace, location+": "+context)
+	}
+
+	return ret
+}
+
+// value returns the interface value of v named name, after redaction.
+func (r *snapshotter) value(name string, v reflect.Value) any {
+	var ret any
+	if v.IsValid() && v.CanInterface() {
+		ret = v.Interface()
+	}
+	if r.redact != nil {
+		ret = r.redact(name, ret)
+	}
+	return ret
+}
+
+// Report returns the error message followed by the snapshot of the
+// execution, if captured, for error reports. Values are encoded as JSON
+// when possible, so that the failure can be reproduced with them.
+func (e ExecError) Report() string {
+	if e.Snapshot == nil {
+		return e.Error()
+	}
+
+	var sb strings.Builder
+	sb.WriteString(e.Error())
+	fmt.Fprintf(&sb, "\ndot: %s\nvars:\n", reportValue(e.Snapshot.Dot))
+
+	names := make([]string, 0, len(e.Snapshot.Vars))
+	for name := range e.Snapshot.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, "\t%s = %s\n", name, reportValue(e.Snapshot.Vars[name]))
+	}
+
+	sb.WriteString("trace:\n")
+	for _, n := range e.Snapshot.Trace {
+		fmt.Fprintf(&sb, "\t%s\n", n)
+	}
+
+	return sb.String()
+}
+
+// reportValue formats v for reports, as JSON if possible.
+func reportValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%#v", v)
+	}
+	return string(data)
+}
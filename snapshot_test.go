@@ -0,0 +1,79 @@
+package tlang
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecSnapshot(t *testing.T) {
+	funcs := FuncMap{
+		"fail": func(v any) (string, error) { return "", errors.New("failed") },
+	}
+	tmpl := Must(New("main").Funcs(funcs).Parse(`$$g = "global"
+$token := .Token
+range $i, $v := .Items
+  template "item" $v
+end
+define "item"; $n := .Name; .Name; fail .; end
+`))
+
+	data := map[string]any{
+		"Token": "secret",
+		"Items": []map[string]any{{"Name": "a"}, {"Name": "b"}},
+	}
+
+	redact := func(name string, value any) any {
+		if name == "$token" {
+			return "<redacted>"
+		}
+		return value
+	}
+
+	err := tmpl.ExecuteWithOptions(io.Discard, data, nil)
+	var execErr ExecError
+	require.ErrorAs(t, err, &execErr)
+	assert.Nil(t, execErr.Snapshot)
+	assert.Equal(t, err.Error(), execErr.Report())
+
+	err = tmpl.ExecuteWithOptions(io.Discard, data, &ExecOptions{
+		Snapshot: 3,
+		Redact:   redact,
+	})
+	require.ErrorAs(t, err, &execErr)
+	if assert.NotNil(t, execErr.Snapshot) {
+		assert.Equal(t, map[string]any{"Name": "a"}, execErr.Snapshot.Dot)
+		assert.Equal(t, map[string]any{
+			"$":   map[string]any{"Name": "a"},
+			"$n":  "a",
+			"$$g": "global",
+		}, execErr.Snapshot.Vars)
+	}
+
+	assert.Equal(t, err.Error()+`
+dot: {"Name":"a"}
+vars:
+	$ = {"Name":"a"}
+	$$g = "global"
+	$n = "a"
+trace:
+	main:6:15: {{$n := .Name}}
+	main:6:28: {{.Name}}
+	main:6:35: {{fail .}}
+`, execErr.Report())
+
+	err = tmpl.ExecuteWithOptions(io.Discard, map[string]any{"Token": "secret", "Items": 1}, &ExecOptions{
+		Snapshot: 8,
+		Redact:   redact,
+	})
+	require.ErrorAs(t, err, &execErr)
+	assert.Equal(t, "<redacted>", execErr.Snapshot.Vars["$token"])
+	assert.Equal(t, []string{
+		`main:1:0: {{$$g = "global"}}`,
+		`main:2:0: {{$token := .Token}}`,
+		`main:3:6: {{range $i, $v := .Items}}{{template "item" $v}}{{end}}`,
+	}, execErr.Snapshot.Trace)
+}
@@ -0,0 +1,344 @@
+package tlang
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Store is a key/value store shared by executions, so that templates can keep
+// counters or remember what was already rendered across renders, see
+// StoreFuncs.
+//
+// Implementations must be safe for concurrent use, Add and SetIfAbsent must
+// be atomic.
+type Store interface {
+	// Get returns the value stored as key, ok is false if there is none.
+	Get(key string) (value any, ok bool, err error)
+
+	// Set stores value as key.
+	Set(key string, value any) error
+
+	// SetIfAbsent stores value as key unless key is set, and reports whether
+	// it was stored.
+	SetIfAbsent(key string, value any) (bool, error)
+
+	// Add adds delta to the integer stored as key, 0 if key is not set, and
+	// returns the sum.
+	Add(key string, delta int64) (int64, error)
+
+	// Delete removes key.
+	Delete(key string) error
+
+	// Keys returns stored keys in sorted order.
+	Keys() ([]string, error)
+}
+
+// StoreFuncs returns functions giving templates access to s, shared by all
+// executions of templates with these functions, e.g. all templates of a
+// Tenant when set in TenantConfig.Funcs:
+//
+//	store
+//		Returns the *StoreAccess of s, e.g.
+//
+//		(store).Set "last" .Title
+//		(store).Add "renders" 1
+//		if (store).Once .Section
+//		  template "header" .
+//		end
+func StoreFuncs(s Store) FuncMap {
+	access := &StoreAccess{s: s}
+	return FuncMap{
+		"store": func() *StoreAccess { return access },
+	}
+}
+
+// StoreAccess is the view of a Store from templates, returned by the store
+// function of StoreFuncs.
+//
+// Methods modifying the store return an empty string, so that they can be
+// called from actions without printing anything.
+type StoreAccess struct {
+	s Store
+}
+
+// Get returns the value stored as key, nil if there is none.
+func (a *StoreAccess) Get(key string) (any, error) {
+	value, _, err := a.s.Get(key)
+	return value, err
+}
+
+// Has reports whether key is set.
+func (a *StoreAccess) Has(key string) (bool, error) {
+	_, ok, err := a.s.Get(key)
+	return ok, err
+}
+
+// Set stores value as key.
+func (a *StoreAccess) Set(key string, value any) (string, error) {
+	return "", a.s.Set(key, value)
+}
+
+// Add adds delta to the integer stored as key and returns the sum.
+func (a *StoreAccess) Add(key string, delta int64) (int64, error) {
+	return a.s.Add(key, delta)
+}
+
+// Once reports whether key was not set, setting it, so that only the first
+// of concurrent or successive renders calling Once with key gets true.
+func (a *StoreAccess) Once(key string) (bool, error) {
+	return a.s.SetIfAbsent(key, true)
+}
+
+// Delete removes key.
+func (a *StoreAccess) Delete(key string) (string, error) {
+	return "", a.s.Delete(key)
+}
+
+// Keys returns stored keys in sorted order.
+func (a *StoreAccess) Keys() ([]string, error) {
+	return a.s.Keys()
+}
+
+// MemoryStore is a Store keeping values in memory, the zero value is an empty
+// store ready to use.
+type MemoryStore struct {
+	mu     sync.Mutex
+	values map[string]any
+}
+
+// Get implements Store.
+func (m *MemoryStore) Get(key string) (any, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.values[key]
+	return value, ok, nil
+}
+
+// Set implements Store.
+func (m *MemoryStore) Set(key string, value any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(key, value)
+	return nil
+}
+
+// SetIfAbsent implements Store.
+func (m *MemoryStore) SetIfAbsent(key string, value any) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setIfAbsent(key, value), nil
+}
+
+// Add implements Store.
+func (m *MemoryStore) Add(key string, delta int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.add(key, delta)
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.values, key)
+	return nil
+}
+
+// Keys implements Store.
+func (m *MemoryStore) Keys() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *MemoryStore) set(key string, value any) {
+	if m.values == nil {
+		m.values = make(map[string]any)
+	}
+	m.values[key] = value
+}
+
+func (m *MemoryStore) setIfAbsent(key string, value any) bool {
+	if _, ok := m.values[key]; ok {
+		return false
+	}
+	m.set(key, value)
+	return true
+}
+
+func (m *MemoryStore) add(key string, delta int64) (int64, error) {
+	var n int64
+	switch v := m.values[key].(type) {
+	case nil:
+	case int64:
+		n = v
+	case float64:
+		// decoded from JSON by FileStore
+		if v != float64(int64(v)) {
+			return 0, fmt.Errorf("cannot add to non-integer %q", key)
+		}
+		n = int64(v)
+	default:
+		// integers of other types, e.g. int set by templates
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.CanInt():
+			n = rv.Int()
+		case rv.CanUint() && rv.Uint() <= math.MaxInt64:
+			n = int64(rv.Uint())
+		default:
+			return 0, fmt.Errorf("cannot add to %T %q", v, key)
+		}
+	}
+
+	n += delta
+	m.set(key, n)
+	return n, nil
+}
+
+// FileStore is a Store persisting values as a JSON object in a file, so that
+// they survive restarts of the process, values must be encodable to JSON
+// and are decoded as encoding/json does into an any, e.g. numbers are
+// float64.
+//
+// Values are loaded once when opening the file, and the whole file is
+// written on every change, it suits small stores of a single process.
+type FileStore struct {
+	path string
+
+	mem MemoryStore // mem.mu also serializes writes of the file.
+}
+
+// OpenFileStore opens the store persisted at path, which is created on the
+// first change if missing.
+func OpenFileStore(path string) (*FileStore, error) {
+	ret := &FileStore{path: path}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return ret, nil
+	case err != nil:
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &ret.mem.values)
+	if err != nil {
+		return nil, fmt.Errorf("template: invalid store %s: %w", path, err)
+	}
+	return ret, nil
+}
+
+// Get implements Store.
+func (f *FileStore) Get(key string) (any, bool, error) {
+	return f.mem.Get(key)
+}
+
+// Set implements Store.
+func (f *FileStore) Set(key string, value any) error {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+
+	old, existed := f.mem.values[key]
+	f.mem.set(key, value)
+	return f.save(key, old, existed)
+}
+
+// SetIfAbsent implements Store.
+func (f *FileStore) SetIfAbsent(key string, value any) (bool, error) {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+
+	if !f.mem.setIfAbsent(key, value) {
+		return false, nil
+	}
+	return true, f.save(key, nil, false)
+}
+
+// Add implements Store.
+func (f *FileStore) Add(key string, delta int64) (int64, error) {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+
+	old, existed := f.mem.values[key]
+	n, err := f.mem.add(key, delta)
+	if err != nil {
+		return 0, err
+	}
+	return n, f.save(key, old, existed)
+}
+
+// Delete implements Store.
+func (f *FileStore) Delete(key string) error {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+
+	old, existed := f.mem.values[key]
+	if !existed {
+		return nil
+	}
+	delete(f.mem.values, key)
+	return f.save(key, old, existed)
+}
+
+// Keys implements Store.
+func (f *FileStore) Keys() ([]string, error) {
+	return f.mem.Keys()
+}
+
+// save writes the values to the file, restoring the previous value of the
+// changed key if it fails, so that the store matches the file.
+func (f *FileStore) save(key string, old any, existed bool) (err error) {
+	defer func() {
+		if err == nil {
+			return
+		}
+		if existed {
+			f.mem.values[key] = old
+		} else {
+			delete(f.mem.values, key)
+		}
+	}()
+
+	data, err := json.Marshal(f.mem.values)
+	if err != nil {
+		return fmt.Errorf("template: cannot store %q: %w", key, err)
+	}
+
+	dir, name := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(data, '\n'))
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,110 @@
+package tlang
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreFuncs(t *testing.T) {
+	const text = `define "header"; "# "; .; "\n"; end
+range .
+  if (store).Once .
+    template "header" .
+  end
+end
+$n := (store).Add "renders" 1
+"render "; $n`
+
+	render := func(t *testing.T, s Store, data any) string {
+		tmpl := Must(New("test").Funcs(StoreFuncs(s)).Parse(text))
+		var sb strings.Builder
+		assert.NoError(t, tmpl.Execute(&sb, data))
+		return sb.String()
+	}
+
+	t.Run("memory", func(t *testing.T) {
+		s := new(MemoryStore)
+		assert.Equal(t, "# a\n# b\nrender 1", render(t, s, []string{"a", "b", "a"}))
+		assert.Equal(t, "# c\nrender 2", render(t, s, []string{"b", "c"}))
+
+		keys, err := s.Keys()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c", "renders"}, keys)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "store.json")
+
+		s, err := OpenFileStore(path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "# a\nrender 1", render(t, s, []string{"a"}))
+
+		// reopened as by another process
+		s, err = OpenFileStore(path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "# b\nrender 2", render(t, s, []string{"a", "b"}))
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"a":true,"b":true,"renders":2}`, string(data))
+
+		// unencodable values are not kept
+		assert.Error(t, s.Set("f", func() {}))
+		_, ok, _ := s.Get("f")
+		assert.False(t, ok)
+	})
+
+	t.Run("access", func(t *testing.T) {
+		tmpl := Must(New("test").Funcs(StoreFuncs(new(MemoryStore))).Parse(
+			`$s := store; $s.Set "k" "v"; $s.Get "k"; $s.Has "k"; $s.Delete "k"; $s.Has "k"; $s.Add "k" 2`))
+		var sb strings.Builder
+		assert.NoError(t, tmpl.Execute(&sb, nil))
+		assert.Equal(t, "vtruefalse2", sb.String())
+
+		sb.Reset()
+		tmpl = Must(New("test").Funcs(StoreFuncs(new(MemoryStore))).Parse(`(store).Set "n" 1; (store).Add "n" 2`))
+		assert.NoError(t, tmpl.Execute(&sb, nil))
+		assert.Equal(t, "3", sb.String())
+
+		tmpl = Must(New("test").Funcs(StoreFuncs(new(MemoryStore))).Parse(`$s := store; $s.Set "k" "v"; $s.Add "k" 1`))
+		assert.ErrorContains(t, tmpl.Execute(&sb, nil), `cannot add to string "k"`)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		s := new(MemoryStore)
+		tmpl := Must(New("test").Funcs(StoreFuncs(s)).Parse(`if (store).Once "x"; "first"; end; (store).Add "n" 1`))
+
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			first int
+		)
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var sb strings.Builder
+				assert.NoError(t, tmpl.Execute(&sb, nil))
+				if strings.HasPrefix(sb.String(), "first") {
+					mu.Lock()
+					first++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, first)
+		n, _, _ := s.Get("n")
+		assert.Equal(t, int64(16), n)
+	})
+}
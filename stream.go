@@ -0,0 +1,80 @@
+package tlang
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MapMode is the way Template.Map splits input into records.
+type MapMode int
+
+const (
+	// MapLines makes every line a string record, without the line ending.
+	MapLines MapMode = iota
+	// MapJSON makes every JSON document a record, e.g. JSON lines.
+	MapJSON
+)
+
+// Map applies the template to every record read from r as dot and writes
+// the outputs to w, turning it into a stream processor like awk or jq:
+//
+//	t.Map(os.Stdout, os.Stdin, MapLines, nil)
+//
+// Global variables persist across records, so that they can accumulate
+// values, and $$NR is set to the number of the record, starting from 1.
+// If opts is not nil, its Vars is used as the initial globals and updated
+// as in ExecuteWithOptions.
+//
+// Processing stops at the first error, which is returned with the number of
+// the record.
+func (t *Template) Map(w io.Writer, r io.Reader, mode MapMode, opts *ExecOptions) error {
+	var o ExecOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Vars == nil {
+		o.Vars = make(map[string]any)
+	}
+
+	var next func() (any, error)
+	switch mode {
+	case MapLines:
+		br := bufio.NewReader(r)
+		next = func() (any, error) {
+			line, err := br.ReadString('\n')
+			if err == io.EOF && line != "" {
+				err = nil
+			}
+			line = strings.TrimSuffix(line, "\n")
+			return strings.TrimSuffix(line, "\r"), err
+		}
+	case MapJSON:
+		dec := json.NewDecoder(r)
+		next = func() (v any, err error) {
+			err = dec.Decode(&v)
+			return
+		}
+	default:
+		return fmt.Errorf("template: invalid map mode %d", mode)
+	}
+
+	for nr := 1; ; nr++ {
+		record, err := next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("template: %s: record %d: %w", t.name, nr, err)
+		}
+
+		o.Vars["NR"] = nr
+		err = t.ExecuteWithOptions(w, record, &o)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", nr, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMap(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		text     string
+		mode     MapMode
+		input    string
+		vars     map[string]any
+		expected string
+		err      string
+	}{
+		{"lines", `$$NR; ": "; .; "\n"`, MapLines, "a\r\nb\n\nc", nil, "1: a\n2: b\n3: \n4: c\n", ""},
+		{"json", `.name; " "`, MapJSON, `{"name": "a"}` + "\n" + `{"name": "b"} {"name": "c"}`, nil, "a b c ", ""},
+		{"globals", `if $$prev; $$prev; "-"; end; .; "\n"; $$prev = .`, MapLines, "a\nb\n", map[string]any{"prev": ""}, "a\na-b\n", ""},
+		{"bad json", `.`, MapJSON, `1 {`, nil, "1", `template: bad json: record 2: unexpected EOF`},
+		{"exec error", `.x`, MapJSON, `{} 1`, nil, "<no value>", `record 2: template: exec error:1:0: executing "exec error" at <.x>`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := Must(New(test.name).Parse(test.text))
+
+			var sb strings.Builder
+			err := tmpl.Map(&sb, strings.NewReader(test.input), test.mode, &ExecOptions{Vars: test.vars})
+			assert.Equal(t, test.expected, sb.String())
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwitch(t *testing.T) {
+	var calls int
+	funcs := FuncMap{
+		"next": func() int { calls++; return calls },
+		"default": func(d, v any) any {
+			if v == nil || v == "" {
+				return d
+			}
+			return v
+		},
+	}
+
+	for _, test := range []struct {
+		name     string
+		text     string
+		data     any
+		expected string
+		err      string
+	}{
+		{"first match", `switch .; case 1; "a"; case 2; "b"; case 2; "c"; end`, 2, "b", ""},
+		{"default", `switch .; case 1; "a"; default; "d"; end`, 3, "d", ""},
+		{"no match", `switch .; case 1; "a"; end; "-"`, 3, "-", ""},
+		{"numbers", `switch .; case 1.0; "a"; end`, uint8(1), "a", ""},
+		{"strings", `switch .; case "x"; "a"; case "y"; "b"; end`, "y", "b", ""},
+		{"evaluated once", `switch next; case 2; "a"; case 3; "b"; default; next; end`, nil, "2", ""},
+		{"conditions", `switch; case . > 2; "a"; case . > 1; "b"; end`, 2, "b", ""},
+		{"variable", `switch $x := .; case 1; $x; default; "-"; $x; end`, 2, "-2", ""},
+		{"case variables", `switch .; case 1; $x := "a"; $x; end`, 1, "a", ""},
+		{"break", `range $i := .; switch $i; case 1; break; end; $i; end`, []int{0, 1, 2}, "0", ""},
+		{"default function", `.B | default "foo"; default "bar" .B`, map[string]any{"B": ""}, "foobar", ""},
+		{"default function in case", `switch 1; case 1; .B | default "foo"; default; "-"; end`, map[string]any{"B": ""}, "foo", ""},
+		{"bad comparison", `switch .; case "a"; end`, 1, "", `error comparing case "a"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			calls = 0
+			tmpl, err := New("test").Funcs(funcs).Parse(test.text)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var sb strings.Builder
+			err = tmpl.Execute(&sb, test.data)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	tmpl := Must(New("test").Option("truthiness=strict").Parse(`switch; case .; "a"; end`))
+	assert.ErrorContains(t, tmpl.Execute(&strings.Builder{}, 1), "case requires a bool condition, got int")
+
+	tmpl = Must(New("test").Option("blocks=indent").Parse("switch .\ncase 1\n  \"a\"\ndefault\n  \"d\"\n\"-\""))
+	var sb strings.Builder
+	assert.NoError(t, tmpl.Execute(&sb, 1))
+	assert.Equal(t, "a-", sb.String())
+
+	// default closes the if block, it is not a keyword outside switch bodies
+	tmpl = Must(New("test").Funcs(funcs).Option("blocks=indent").Parse("if .\n  \"a\"\ndefault \"b\" \"\""))
+	sb.Reset()
+	assert.NoError(t, tmpl.Execute(&sb, true))
+	assert.Equal(t, "ab", sb.String())
+}
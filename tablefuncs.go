@@ -0,0 +1,238 @@
+package tlang
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TableFuncs returns functions rendering rows collected during execution
+// as an aligned table:
+//
+//	table [options...]
+//		Returns a new *Table configured by options in "key=value" form:
+//		- padding=N: spaces around every cell, defaults to 1.
+//		- border=none|ascii|box: lines drawn around cells, defaults to none.
+//		- align=SPEC: alignment of columns, one of l (left, default),
+//		  r (right) or c (center) for each column, e.g. "lrr".
+//
+// Rows are added with the Header and Row methods, which print nothing, the
+// table is rendered when printed:
+//
+//	$t := table "border=ascii" "align=lr"
+//	$t.Header "name" "count"
+//	range .
+//	  $t.Row .Name .Count
+//	end
+//	$t
+func TableFuncs() FuncMap {
+	return FuncMap{
+		"table": NewTable,
+	}
+}
+
+// Table borders.
+const (
+	BorderNone  = "none"
+	BorderASCII = "ascii"
+	BorderBox   = "box"
+)
+
+// Table collects rows of cells and renders them with aligned columns, cell
+// widths are measured in terminal columns, see TextFuncs.
+type Table struct {
+	// Padding is the number of spaces around every cell.
+	Padding int
+
+	// Border is one of Border* constants.
+	Border string
+
+	// Align is the alignment of columns, 'l', 'r' or 'c' for each column,
+	// columns without alignment are left aligned.
+	Align string
+
+	header []string
+	rows   [][]string
+}
+
+// NewTable creates a Table configured by options in "key=value" form, see
+// TableFuncs for available options.
+func NewTable(options ...string) (*Table, error) {
+	t := &Table{Padding: 1, Border: BorderNone}
+	for _, opt := range options {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "padding":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("table: invalid padding %q", value)
+			}
+			t.Padding = n
+		case "border":
+			switch value {
+			case BorderNone, BorderASCII, BorderBox:
+				t.Border = value
+			default:
+				return nil, fmt.Errorf("table: invalid border %q", value)
+			}
+		case "align":
+			if strings.Trim(value, "lrc") != "" {
+				return nil, fmt.Errorf("table: invalid align %q", value)
+			}
+			t.Align = value
+		default:
+			return nil, fmt.Errorf("table: unknown option %q", opt)
+		}
+	}
+
+	return t, nil
+}
+
+// Header sets the header row of the table, it returns an empty string so
+// that it can be called from an action.
+func (t *Table) Header(cells ...any) string {
+	t.header = formatCells(cells)
+	return ""
+}
+
+// Row appends a row to the table, it returns an empty string so that it
+// can be called from an action.
+func (t *Table) Row(cells ...any) string {
+	t.rows = append(t.rows, formatCells(cells))
+	return ""
+}
+
+func formatCells(cells []any) []string {
+	ret := make([]string, len(cells))
+	for i, c := range cells {
+		ret[i] = fmt.Sprint(c)
+	}
+	return ret
+}
+
+// tableBorder is the set of characters drawing a border, indexed by the
+// position of rules (top, middle, bottom) and of junctions (left, inner,
+// right).
+type tableBorder struct {
+	horizontal, vertical string
+	junctions            [3][3]string
+}
+
+var tableBorders = map[string]*tableBorder{
+	BorderASCII: {
+		horizontal: "-",
+		vertical:   "|",
+		junctions: [3][3]string{
+			{"+", "+", "+"},
+			{"+", "+", "+"},
+			{"+", "+", "+"},
+		},
+	},
+	BorderBox: {
+		horizontal: "─",
+		vertical:   "│",
+		junctions: [3][3]string{
+			{"┌", "┬", "┐"},
+			{"├", "┼", "┤"},
+			{"└", "┴", "┘"},
+		},
+	},
+}
+
+// String renders the table, rows are terminated by a newline.
+func (t *Table) String() string {
+	var widths []int
+	measure := func(row []string) {
+		for i, c := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := displayWidth(c); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	measure(t.header)
+	for _, row := range t.rows {
+		measure(row)
+	}
+
+	if len(widths) == 0 {
+		return ""
+	}
+
+	var (
+		sb     strings.Builder
+		border = tableBorders[t.Border]
+		pad    = strings.Repeat(" ", t.Padding)
+	)
+
+	rule := func(pos int) {
+		if border == nil {
+			return
+		}
+
+		j := border.junctions[pos]
+		sb.WriteString(j[0])
+		for i, w := range widths {
+			if i != 0 {
+				sb.WriteString(j[1])
+			}
+			sb.WriteString(strings.Repeat(border.horizontal, w+2*t.Padding))
+		}
+		sb.WriteString(j[2])
+		sb.WriteByte('\n')
+	}
+
+	line := func(row []string) {
+		var buf strings.Builder
+		if border != nil {
+			buf.WriteString(border.vertical)
+		}
+
+		for i, w := range widths {
+			if i != 0 && border != nil {
+				buf.WriteString(border.vertical)
+			}
+
+			var cell string
+			if i < len(row) {
+				cell = row[i]
+			}
+
+			side := 0
+			if i < len(t.Align) {
+				side = strings.IndexByte("lrc", t.Align[i])
+			}
+
+			if border != nil || i != 0 {
+				buf.WriteString(pad)
+			}
+			buf.WriteString(padWidth(cell, w, side))
+			buf.WriteString(pad)
+		}
+
+		if border != nil {
+			buf.WriteString(border.vertical)
+			sb.WriteString(buf.String())
+		} else {
+			sb.WriteString(strings.TrimRight(buf.String(), " "))
+		}
+		sb.WriteByte('\n')
+	}
+
+	rule(0)
+	if t.header != nil {
+		line(t.header)
+		if border != nil {
+			rule(1)
+		}
+	}
+	for _, row := range t.rows {
+		line(row)
+	}
+	rule(2)
+
+	return sb.String()
+}
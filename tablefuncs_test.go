@@ -0,0 +1,91 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableFuncs(t *testing.T) {
+	type item struct {
+		Name  string
+		Count int
+	}
+
+	data := []item{{"apple", 3}, {"日本", 12}, {"kiwi", 100}}
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "none",
+			input: `$t := table "align=lr"
+$t.Header "name" "count"
+range .; $t.Row .Name .Count; end
+$t`,
+			expected: "" +
+				"name   count\n" +
+				"apple      3\n" +
+				"日本      12\n" +
+				"kiwi     100\n",
+		},
+		{
+			name: "ascii",
+			input: `$t := table "border=ascii" "align=lr"
+$t.Header "name" "count"
+range .; $t.Row .Name .Count; end
+$t`,
+			expected: "" +
+				"+-------+-------+\n" +
+				"| name  | count |\n" +
+				"+-------+-------+\n" +
+				"| apple |     3 |\n" +
+				"| 日本  |    12 |\n" +
+				"| kiwi  |   100 |\n" +
+				"+-------+-------+\n",
+		},
+		{
+			name: "box without header",
+			input: `$t := table "border=box" "padding=0" "align=cr"
+range .; $t.Row .Name .Count; end
+$t`,
+			expected: "" +
+				"┌─────┬───┐\n" +
+				"│apple│  3│\n" +
+				"│日本 │ 12│\n" +
+				"│kiwi │100│\n" +
+				"└─────┴───┘\n",
+		},
+		{
+			name: "ragged rows",
+			input: `$t := table "padding=2"
+$t.Row "a"
+$t.Row "b" "c"
+$t`,
+			expected: "" +
+				"a\n" +
+				"b    c\n",
+		},
+		{
+			name:     "empty",
+			input:    `table`,
+			expected: "",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := Must(New(test.name).Funcs(TableFuncs()).Parse(test.input))
+
+			var sb strings.Builder
+			assert.NoError(t, tmpl.Execute(&sb, data))
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	for _, opt := range []string{"padding=-1", "border=double", "align=x", "width=3"} {
+		_, err := NewTable(opt)
+		assert.Error(t, err, opt)
+	}
+}
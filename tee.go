@@ -0,0 +1,92 @@
+package tlang
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WriterError reports the failure of one of the writers of ExecuteMulti.
+type WriterError struct {
+	Index   int   // Position of the writer in the list.
+	Written int64 // Bytes written to the writer before it failed.
+	Err     error // Error of the writer.
+}
+
+func (e *WriterError) Error() string {
+	return fmt.Sprintf("template: writer %d failed after %d bytes: %v", e.Index, e.Written, e.Err)
+}
+
+func (e *WriterError) Unwrap() error {
+	return e.Err
+}
+
+// ExecuteMulti is like Execute, but writes the output to every writer in ws,
+// e.g. a response body, a cache and an audit store, without losing which of
+// them failed as with io.MultiWriter.
+//
+// A writer failing, or writing less than requested, is dropped, and
+// execution continues with the other writers until all of them failed. The
+// returned error is then a *MultiError listing a *WriterError for every
+// failed writer, followed by errors of the execution, if any.
+func (t *Template) ExecuteMulti(ws []io.Writer, data any) error {
+	tee := &teeWriter{ws: ws, written: make([]int64, len(ws)), failed: make([]bool, len(ws))}
+	err := t.execute(tee, data, nil, nil)
+	if len(tee.errs) == 0 {
+		return err
+	}
+
+	errs := append(MultiError(nil), tee.errs...)
+	if me, ok := err.(*MultiError); ok {
+		for _, e := range *me {
+			if e != tee.stop {
+				errs = append(errs, e)
+			}
+		}
+	} else if err != nil && err != tee.stop {
+		errs = append(errs, err)
+	}
+	return &errs
+}
+
+// teeWriter writes to every writer not failed yet.
+type teeWriter struct {
+	ws      []io.Writer
+	written []int64
+	failed  []bool
+	errs    []error
+	stop    error // error stopping the execution once all writers failed.
+}
+
+func (tw *teeWriter) Write(p []byte) (int, error) {
+	if tw.stop != nil {
+		return 0, tw.stop
+	}
+
+	live := 0
+	for i, w := range tw.ws {
+		if tw.failed[i] {
+			continue
+		}
+
+		n, err := w.Write(p)
+		tw.written[i] += int64(n)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			tw.failed[i] = true
+			tw.errs = append(tw.errs, &WriterError{Index: i, Written: tw.written[i], Err: err})
+			continue
+		}
+		live++
+	}
+
+	if live == 0 && len(tw.ws) != 0 {
+		tw.stop = errAllWritersFailed
+		return 0, tw.stop
+	}
+	return len(p), nil
+}
+
+var errAllWritersFailed = errors.New("template: all writers failed")
@@ -0,0 +1,63 @@
+package tlang
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingWriter accepts n bytes, then fails.
+type failingWriter struct {
+	sb strings.Builder
+	n  int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n, _ := w.sb.Write(p[:w.n])
+		w.n = 0
+		return n, errors.New("full")
+	}
+	w.n -= len(p)
+	return w.sb.Write(p)
+}
+
+func TestExecuteMulti(t *testing.T) {
+	tmpl := Must(New("t").Parse(`"abc"; "def"; "ghi"`))
+
+	var a, b strings.Builder
+	assert.NoError(t, tmpl.ExecuteMulti([]io.Writer{&a, &b}, nil))
+	assert.Equal(t, "abcdefghi", a.String())
+	assert.Equal(t, "abcdefghi", b.String())
+
+	a.Reset()
+	f := &failingWriter{n: 4}
+	err := tmpl.ExecuteMulti([]io.Writer{&a, f}, nil)
+	if assert.Error(t, err) {
+		errs := *err.(*MultiError)
+		assert.Len(t, errs, 1)
+		var we *WriterError
+		if assert.ErrorAs(t, errs[0], &we) {
+			assert.Equal(t, 1, we.Index)
+			assert.Equal(t, int64(4), we.Written)
+		}
+		assert.EqualError(t, errs[0], "template: writer 1 failed after 4 bytes: full")
+	}
+	assert.Equal(t, "abcdefghi", a.String())
+	assert.Equal(t, "abcd", f.sb.String())
+
+	f1, f2 := &failingWriter{n: 1}, &failingWriter{n: 5}
+	err = tmpl.ExecuteMulti([]io.Writer{f1, f2}, nil)
+	if assert.Error(t, err) {
+		assert.EqualError(t, err, "template: writer 0 failed after 1 bytes: full\ntemplate: writer 1 failed after 5 bytes: full")
+	}
+	assert.Equal(t, "abcde", f2.sb.String())
+
+	err = Must(New("t").Parse(`"abc"; .field`)).ExecuteMulti([]io.Writer{&failingWriter{n: 1}, &a}, 1)
+	if assert.Error(t, err) {
+		assert.Len(t, *err.(*MultiError), 2)
+	}
+}
@@ -5,6 +5,10 @@
 package tlang
 
 import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
 	"sync"
 
 	"arhat.dev/tlang/parse"
@@ -13,12 +17,22 @@ import (
 // common holds the information shared by related templates.
 type common struct {
 	tmpl   map[string]*Template // Map from name to defined templates.
-	muTmpl sync.RWMutex         // protects tmpl
+	muTmpl sync.RWMutex         // protects tmpl and the trees, files, metadata and schemas of templates
+	muOpt  sync.RWMutex         // protects option and funcs, see Template.configure
 	option option
 	// We use two maps, one for parsing and one for execution.
 	// This separation makes the API cleaner since it doesn't
 	// expose reflection to the client.
 	funcs parse.TemplateFuncs
+	// vars holds the constants declared in vars blocks, by global variable
+	// name, protected by muTmpl. It is replaced rather than modified, so
+	// that executions can keep using it.
+	vars map[string]constVar
+	// warnings holds the warnings of parsing, protected by muTmpl.
+	warnings []string
+	// frozen is set by Template.Freeze, with both muTmpl and muOpt locked
+	// so that holding either is enough to read it.
+	frozen bool
 }
 
 // Template is the representation of a parsed template. The *parse.Tree
@@ -26,6 +40,11 @@ type common struct {
 // as unexported by all other clients.
 type Template struct {
 	name string
+	file string // source file of the definition, if parsed from a file.
+	// metadata is the front matter of the parsed text.
+	metadata map[string]any
+	// schema is the decoded JSON Schema data is validated against.
+	schema any
 	*parse.Tree
 	*common
 }
@@ -48,9 +67,9 @@ func (t *Template) Name() string {
 // delimiters. The association, which is transitive, allows one template to
 // invoke another with a {{template}} action.
 //
-// Because associated templates share underlying data, template construction
-// cannot be done safely in parallel. Once the templates are constructed, they
-// can be executed in parallel.
+// Associated templates share underlying data, which is locked so that
+// templates can be constructed and executed in parallel, see
+// Template.Freeze for what executions see of concurrent changes.
 func (t *Template) New(name string) *Template {
 	t.init()
 	nt := &Template{
@@ -65,6 +84,8 @@ func (t *Template) init() {
 	if t.common == nil {
 		c := new(common)
 		c.tmpl = make(map[string]*Template)
+		c.option.printMethods = defaultPrintMethods
+		c.option.maxDepth = defaultMaxExecDepth
 		t.common = c
 	}
 }
@@ -72,9 +93,10 @@ func (t *Template) init() {
 // Clone returns a duplicate of the template, including all associated
 // templates. The actual representation is not copied, but the name space of
 // associated templates is, so further calls to Parse in the copy will add
-// templates to the copy but not to the original. Clone can be used to prepare
-// common templates and use them with variant definitions for other templates
-// by adding the variants after the clone is made.
+// templates to the copy but not to the original, and the copy is not frozen.
+// Clone can be used to prepare common templates and use them with variant
+// definitions for other templates by adding the variants after the clone is
+// made.
 func (t *Template) Clone() (*Template, error) {
 	nt := t.copy(nil)
 	nt.init()
@@ -93,16 +115,27 @@ func (t *Template) Clone() (*Template, error) {
 		nt.tmpl[k] = tmpl
 	}
 
-	nt.funcs = t.funcs
+	for k, v := range t.vars {
+		if nt.vars == nil {
+			nt.vars = make(map[string]constVar, len(t.vars))
+		}
+		nt.vars[k] = v
+	}
+
+	nt.warnings = append([]string(nil), t.warnings...)
+	nt.option, nt.funcs = t.config()
 	return nt, nil
 }
 
 // copy returns a shallow copy of t, with common set to the argument.
 func (t *Template) copy(c *common) *Template {
 	return &Template{
-		name:   t.name,
-		Tree:   t.Tree,
-		common: c,
+		name:     t.name,
+		file:     t.file,
+		metadata: t.metadata,
+		schema:   t.schema,
+		Tree:     t.Tree,
+		common:   c,
 	}
 }
 
@@ -110,10 +143,29 @@ func (t *Template) copy(c *common) *Template {
 // it the specified name. If the template has not been defined, this tree becomes
 // its definition. If it has been defined and already has that name, the existing
 // definition is replaced; otherwise a new template is created, defined, and returned.
+//
+// It fails with ErrFrozen if t is frozen.
 func (t *Template) AddParseTree(name string, tree *parse.Tree) (*Template, error) {
 	t.init()
+	opt, _ := t.config()
 	t.muTmpl.Lock()
 	defer t.muTmpl.Unlock()
+	return t.addParseTree(name, tree, &opt)
+}
+
+// addParseTree is AddParseTree with muTmpl locked, opt holding the options
+// of t.
+func (t *Template) addParseTree(name string, tree *parse.Tree, opt *option) (*Template, error) {
+	if t.frozen {
+		return nil, fmt.Errorf("template: %s: cannot define template %q: %w", t.name, name, ErrFrozen)
+	}
+	if old := t.tmpl[name]; old != nil && keepFirst(opt, old, tree) {
+		t.warnings = append(t.warnings, fmt.Sprintf("template: %s:%d: multiple definition of template %q, keeping the first one", tree.ParseName, tree.Line, name))
+		return old, nil
+	}
+	if err := t.addVars(name, tree); err != nil {
+		return nil, err
+	}
 	nt := t
 	if name != t.name {
 		nt = t.New(name)
@@ -125,6 +177,25 @@ func (t *Template) AddParseTree(name string, tree *parse.Tree) (*Template, error
 	return nt, nil
 }
 
+// keepFirst reports whether tree must not replace the definition of old as of
+// the redefine option.
+func keepFirst(opt *option, old *Template, tree *parse.Tree) bool {
+	return opt.parseMode&parse.KeepFirstDefinition != 0 &&
+		old.Tree != nil && old.Tree != tree &&
+		!parse.IsEmptyTree(old.Root) && !parse.IsEmptyTree(tree.Root)
+}
+
+// Warnings returns the warnings recorded when parsing templates associated
+// with t, like templates redefined with the redefine option.
+func (t *Template) Warnings() []string {
+	if t.common == nil {
+		return nil
+	}
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+	return append([]string(nil), t.warnings...)
+}
+
 // Templates returns a slice of defined templates associated with t.
 func (t *Template) Templates() []*Template {
 	if t.common == nil {
@@ -157,10 +228,103 @@ func (t *Template) Delims(left, right string) *Template {
 // It is legal to overwrite elements of the map. The return value is the template,
 // so calls can be chained.
 func (t *Template) Funcs(funcMap parse.TemplateFuncs) *Template {
-	t.init()
-	t.funcs = funcMap
+	return t.configure("Funcs", func() {
+		t.funcs = funcMap
+		t.normalizeFuncs()
+		t.denyFuncs()
+	})
+}
 
-	return t
+// Normalize sets the normalization of identifiers and variable names in
+// templates parsed after the call, names of functions in a FuncMap are
+// normalized as well, so that names written differently in templates and Go
+// code match. The return value is the template, so calls can be chained.
+//
+// It is intended for Unicode normalization of user-authored templates, e.g.
+//
+//	t.Normalize(norm.NFC.String)
+//
+// with the norm package from golang.org/x/text/unicode/norm.
+func (t *Template) Normalize(f func(string) string) *Template {
+	return t.configure("Normalize", func() {
+		t.option.normalize = f
+		t.normalizeFuncs()
+	})
+}
+
+// DeclareDataType declares the type of the data templates parsed after the
+// call are executed with, v is a value of the type or its reflect.Type.
+// Pipelines are then type checked when parsing, so that e.g. a string field
+// piped into a function expecting an int is a parse error rather than an
+// execution error. Only functions in a FuncMap are checked, and fields
+// unknown to the type are accepted as they may be matched by struct tags. A
+// nil v disables type checking. The return value is the template, so calls
+// can be chained.
+func (t *Template) DeclareDataType(v any) *Template {
+	typ, ok := v.(reflect.Type)
+	if !ok {
+		typ = reflect.TypeOf(v)
+	}
+	return t.configure("DeclareDataType", func() {
+		t.option.dataType = typ
+	})
+}
+
+// normalizeFuncs adds normalized names of functions in a FuncMap.
+func (t *Template) normalizeFuncs() {
+	fm, ok := t.funcs.(FuncMap)
+	if !ok || t.option.normalize == nil {
+		return
+	}
+
+	normalized := make(FuncMap, len(fm))
+	for name, fn := range fm {
+		normalized[name] = fn
+	}
+	for name, fn := range fm {
+		normalized[t.option.normalize(name)] = fn
+	}
+	t.funcs = normalized
+}
+
+// denyFuncs removes functions denied by the denyfuncs option from the
+// function set.
+func (t *Template) denyFuncs() {
+	if len(t.option.deniedFuncs) == 0 || t.funcs == nil {
+		return
+	}
+
+	denied := toSet(t.option.deniedFuncs)
+	if fm, ok := t.funcs.(FuncMap); ok {
+		allowed := make(FuncMap, len(fm))
+		for name, fn := range fm {
+			if _, ok := denied[name]; !ok {
+				allowed[name] = fn
+			}
+		}
+		t.funcs = allowed
+		return
+	}
+
+	t.funcs = deniedFuncs{t.funcs, denied}
+}
+
+// deniedFuncs hides denied functions of a set other than FuncMap.
+type deniedFuncs struct {
+	parse.TemplateFuncs
+	denied map[string]struct{}
+}
+
+func (d deniedFuncs) Has(name string) bool {
+	_, ok := d.denied[name]
+	return !ok && d.TemplateFuncs.Has(name)
+}
+
+func (d deniedFuncs) GetByName(name string) reflect.Value {
+	if _, ok := d.denied[name]; ok {
+		return reflect.Value{}
+	}
+	return d.TemplateFuncs.GetByName(name)
 }
 
 // Lookup returns the template with the given name that is associated with t.
@@ -184,21 +348,86 @@ func (t *Template) Lookup(name string) *Template {
 // is considered empty and will not replace an existing template's body.
 // This allows using Parse to add new named template definitions without
 // overwriting the main template body.
+//
+// Front matter at the start of text is decoded into the metadata of t, see
+// Template.Metadata.
+//
+// It fails with ErrFrozen if t is frozen.
 func (t *Template) Parse(text string) (*Template, error) {
+	return t.parse(text, "")
+}
+
+// parse parses text read from file (empty if not from a file).
+func (t *Template) parse(text, file string) (*Template, error) {
 	t.init()
-	trees, err := parse.Parse(t.name, text, t.funcs)
+	if t.Frozen() {
+		return nil, fmt.Errorf("template: %s: %w", t.name, ErrFrozen)
+	}
+	meta, text, err := SplitFrontMatter(text)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("template: %s: %w", t.name, err)
+	}
+	opt, funcs := t.config()
+	key := cacheKey(&opt, t.name, text)
+	var trees map[string]*parse.Tree
+	if key != "" {
+		trees = cachedTrees(&opt, funcs, key)
 	}
+	if trees == nil {
+		trees = make(map[string]*parse.Tree)
+		tree := parse.New(t.name, funcs)
+		tree.Mode = opt.parseMode
+		tree.Normalize = opt.normalize
+		tree.Limits = opt.limits
+		tree.DataType = opt.dataType
+		_, err = tree.Parse(text, trees, funcs)
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			cacheTrees(&opt, key, trees)
+		}
+	}
+	resolveNames(trees, path.Dir(t.name))
+	t.addWarnings(trees)
 	// Add the newly parsed trees, including the one for t, into our common structure.
+	t.muTmpl.Lock()
+	defer t.muTmpl.Unlock()
 	for name, tree := range trees {
-		if _, err := t.AddParseTree(name, tree); err != nil {
+		nt, err := t.addParseTree(name, tree, &opt)
+		if err != nil {
 			return nil, err
 		}
+		if nt.Tree == tree {
+			nt.file = file
+		}
+	}
+	if meta != nil {
+		t.metadata = meta
 	}
 	return t, nil
 }
 
+// addWarnings records the warnings of parsing trees, in order of names.
+func (t *Template) addWarnings(trees map[string]*parse.Tree) {
+	var names []string
+	for name, tree := range trees {
+		if len(tree.Warnings) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	sort.Strings(names)
+	t.muTmpl.Lock()
+	defer t.muTmpl.Unlock()
+	for _, name := range names {
+		t.warnings = append(t.warnings, trees[name].Warnings...)
+	}
+}
+
 // associate installs the new template into the group of templates associated
 // with t. The two are already known to share the common structure.
 // The boolean return value reports whether to store this tree as t.Tree.
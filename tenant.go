@@ -0,0 +1,191 @@
+package tlang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrTenantQuota is returned when a tenant exceeds one of its quotas.
+var ErrTenantQuota = errors.New("template: tenant quota exceeded")
+
+// TenantConfig configures a Tenant.
+type TenantConfig struct {
+	// Funcs are the functions of the tenant, they override and extend the
+	// functions of the base templates.
+	Funcs FuncMap
+
+	// Options are the sandbox policy and quotas of executions, see
+	// Template.Option, e.g. denyfuncs, maxoutput and maxsteps. A nil slice
+	// applies the options of the Restricted profile.
+	Options []string
+
+	// Registry pulls bundles of the tenant, see Tenant.Pull.
+	Registry *Registry
+
+	// MaxTemplates bounds the number of templates of the tenant, including
+	// base templates, 0 means no limit.
+	MaxTemplates int
+
+	// MaxConcurrent bounds the number of concurrent executions of the
+	// tenant, 0 means no limit.
+	MaxConcurrent int
+}
+
+// Tenant is the isolated template set of a customer of a multi-tenant
+// renderer. It starts as a clone of shared base templates, templates defined
+// by a tenant and its functions are never visible to other tenants, nor to
+// the base templates.
+//
+// Definitions are transactional: they are parsed into a copy of the set,
+// which replaces the set only when they succeed within quotas, so resolving
+// templates is a map lookup and executions in flight are not affected.
+//
+// A Tenant is safe for concurrent use.
+type Tenant struct {
+	name string
+	cfg  TenantConfig
+	sem  chan struct{} // slots of concurrent executions, nil if unlimited.
+
+	mu   sync.Mutex   // serializes definitions.
+	muT  sync.RWMutex // protects tmpl.
+	tmpl *Template    // the current template set.
+}
+
+// NewTenant creates the tenant name with the templates associated with base,
+// which may be nil, changes to base after the call don't affect the tenant.
+// It panics if an option is invalid, like Template.Option.
+func NewTenant(name string, base *Template, cfg TenantConfig) *Tenant {
+	var tmpl *Template
+	if base != nil {
+		tmpl, _ = base.Clone()
+	} else {
+		tmpl = New(name)
+	}
+
+	options := cfg.Options
+	if options == nil {
+		options = restrictedOptions
+	}
+	tmpl.Option(options...)
+	tmpl.Funcs(FuncChain{cfg.Funcs, tmpl.funcs})
+
+	ret := &Tenant{name: name, cfg: cfg, tmpl: tmpl}
+	if cfg.MaxConcurrent > 0 {
+		ret.sem = make(chan struct{}, cfg.MaxConcurrent)
+	}
+	return ret
+}
+
+// Name returns the name of the tenant.
+func (t *Tenant) Name() string {
+	return t.name
+}
+
+// Lookup returns the template name of the tenant, or nil if there is none.
+func (t *Tenant) Lookup(name string) *Template {
+	t.muT.RLock()
+	defer t.muT.RUnlock()
+	return t.tmpl.Lookup(name)
+}
+
+// Templates returns the templates of the tenant.
+func (t *Tenant) Templates() []*Template {
+	t.muT.RLock()
+	defer t.muT.RUnlock()
+	return t.tmpl.Templates()
+}
+
+// Parse parses text as the template name of the tenant, templates defined
+// in text are added to the tenant as well.
+func (t *Tenant) Parse(name, text string) error {
+	return t.define(func(set *Template) error {
+		_, err := set.New(name).Parse(text)
+		return err
+	})
+}
+
+// Pull pulls the bundle at ref with the registry of the tenant, see
+// Registry.PullBundle, and adds its templates to the tenant. Functions
+// called by the bundle must be defined for the tenant, options of the bundle
+// are ignored in favor of the options of the tenant.
+func (t *Tenant) Pull(ctx context.Context, ref string) (*BundleManifest, error) {
+	if t.cfg.Registry == nil {
+		return nil, fmt.Errorf("template: tenant %q has no registry", t.name)
+	}
+
+	data, _, err := t.cfg.Registry.PullBundle(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	t.muT.RLock()
+	_, funcs := t.tmpl.config()
+	t.muT.RUnlock()
+
+	b, err := loadBundle(bytes.NewReader(data), int64(len(data)), funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.define(func(set *Template) error {
+		for _, tmpl := range b.Template.Templates() {
+			if _, err := set.AddParseTree(tmpl.Name(), tmpl.Tree); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Manifest, nil
+}
+
+// define applies def to a copy of the template set, which replaces the set
+// if def succeeds within quotas.
+func (t *Tenant) define(def func(set *Template) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.muT.RLock()
+	set, _ := t.tmpl.Clone()
+	t.muT.RUnlock()
+
+	if err := def(set); err != nil {
+		return err
+	}
+
+	if max := t.cfg.MaxTemplates; max > 0 && len(set.tmpl) > max {
+		return fmt.Errorf("%w: tenant %q can't have more than %d templates", ErrTenantQuota, t.name, max)
+	}
+
+	t.muT.Lock()
+	t.tmpl = set
+	t.muT.Unlock()
+	return nil
+}
+
+// ExecuteTemplate applies the template name of the tenant to data, writing
+// the output to w.
+func (t *Tenant) ExecuteTemplate(w io.Writer, name string, data any) error {
+	tmpl := t.Lookup(name)
+	if tmpl == nil {
+		return fmt.Errorf("template: tenant %q has no template %q", t.name, name)
+	}
+
+	if t.sem != nil {
+		select {
+		case t.sem <- struct{}{}:
+			defer func() { <-t.sem }()
+		default:
+			return fmt.Errorf("%w: tenant %q can't have more than %d concurrent executions", ErrTenantQuota, t.name, cap(t.sem))
+		}
+	}
+
+	return tmpl.Execute(w, data)
+}
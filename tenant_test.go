@@ -0,0 +1,113 @@
+package tlang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenant(t *testing.T) {
+	base := Must(New("base").Funcs(FuncMap{
+		"brand": func() string { return "acme" },
+		"env":   func() string { return "secret" },
+	}).Parse(`define "layout"; "<"; brand; ">"; end`))
+
+	a := NewTenant("a", base, TenantConfig{
+		Funcs:        FuncMap{"brand": func() string { return "a-corp" }},
+		MaxTemplates: 3,
+	})
+	b := NewTenant("b", base, TenantConfig{Options: []string{}})
+
+	require.NoError(t, a.Parse("page", `template "layout"; "a"`))
+	require.NoError(t, b.Parse("page", `template "layout"; env`))
+
+	render := func(tn *Tenant, name string) string {
+		var sb strings.Builder
+		require.NoError(t, tn.ExecuteTemplate(&sb, name, nil))
+		return sb.String()
+	}
+	assert.Equal(t, "<a-corp>a", render(a, "page"))
+	assert.Equal(t, "<acme>secret", render(b, "page"))
+	assert.Nil(t, base.Lookup("page"), "tenant templates must not leak into base")
+
+	// functions denied by the restricted profile
+	assert.Error(t, a.Parse("leak", `env`))
+
+	// failed and over quota definitions leave the tenant unchanged
+	assert.Error(t, a.Parse("broken", `define "x"; "x"; end; (`))
+	assert.Nil(t, a.Lookup("x"))
+	err := a.Parse("more", `define "x"; "x"; end; "more"`)
+	assert.True(t, errors.Is(err, ErrTenantQuota))
+	assert.Nil(t, a.Lookup("more"))
+	assert.Len(t, a.Templates(), 3)
+
+	err = a.ExecuteTemplate(&strings.Builder{}, "missing", nil)
+	assert.EqualError(t, err, `template: tenant "a" has no template "missing"`)
+}
+
+func TestTenantConcurrency(t *testing.T) {
+	var (
+		entered = make(chan struct{})
+		release = make(chan struct{})
+	)
+	tn := NewTenant("t", nil, TenantConfig{
+		Funcs: FuncMap{"wait": func() string {
+			entered <- struct{}{}
+			<-release
+			return "done"
+		}},
+		MaxConcurrent: 1,
+	})
+	require.NoError(t, tn.Parse("slow", `wait`))
+
+	errCh := make(chan error)
+	go func() { errCh <- tn.ExecuteTemplate(&strings.Builder{}, "slow", nil) }()
+	<-entered
+
+	err := tn.ExecuteTemplate(&strings.Builder{}, "slow", nil)
+	assert.True(t, errors.Is(err, ErrTenantQuota))
+
+	close(release)
+	assert.NoError(t, <-errCh)
+}
+
+func TestTenantPull(t *testing.T) {
+	srv := httptest.NewServer(&testRegistry{blobs: make(map[string][]byte), manifests: make(map[string][]byte)})
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	var buf bytes.Buffer
+	require.NoError(t, PackBundle(&buf, BundleManifest{
+		Name:  "main.tl",
+		Files: []string{"main.tl"},
+	}, fstest.MapFS{"main.tl": {Data: []byte(`define "greet"; "hi "; name; end`)}}))
+
+	reg := &Registry{PlainHTTP: true}
+	_, err := reg.PushBundle(context.Background(), host+"/team/templates:v1", buf.Bytes())
+	require.NoError(t, err)
+
+	tn := NewTenant("t", nil, TenantConfig{
+		Funcs:    FuncMap{"name": func() string { return "tenant" }},
+		Registry: reg,
+	})
+	m, err := tn.Pull(context.Background(), host+"/team/templates:v1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name"}, m.Funcs)
+
+	var sb strings.Builder
+	require.NoError(t, tn.ExecuteTemplate(&sb, "greet", nil))
+	assert.Equal(t, "hi tenant", sb.String())
+
+	_, err = NewTenant("other", nil, TenantConfig{Registry: reg}).Pull(context.Background(), host+"/team/templates:v1")
+	assert.ErrorContains(t, err, "requires undefined functions name")
+
+	_, err = NewTenant("none", nil, TenantConfig{}).Pull(context.Background(), host+"/team/templates:v1")
+	assert.EqualError(t, err, `template: tenant "none" has no registry`)
+}
@@ -0,0 +1,275 @@
+package tlang
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TextFuncs returns functions operating on user-perceived characters
+// (grapheme clusters) and their display width in terminals, rather than on
+// bytes, so that emoji and CJK text stay intact and aligned:
+//
+//	graphemeLen s
+//		Returns the number of grapheme clusters in s.
+//	displayWidth s
+//		Returns the number of terminal columns taken by s, wide characters
+//		take two columns, combining marks and control characters none.
+//	truncateWidth n s
+//		Returns the longest prefix of s no wider than n columns.
+//	ellipsis n s
+//		Like truncateWidth, but ends truncated text with "…".
+//	padLeft n s, padRight n s, center n s
+//		Pad s with spaces on the left, right or both sides to n columns.
+//	wrapWidth n s
+//		Wraps s at spaces into lines no wider than n columns, words wider
+//		than n are broken between grapheme clusters.
+func TextFuncs() FuncMap {
+	return FuncMap{
+		"graphemeLen": func(s string) int {
+			n := 0
+			for s != "" {
+				_, s = nextGrapheme(s)
+				n++
+			}
+			return n
+		},
+		"displayWidth": displayWidth,
+		"truncateWidth": func(n int, s string) string {
+			prefix, _ := truncateWidth(s, n)
+			return prefix
+		},
+		"ellipsis": func(n int, s string) string {
+			if displayWidth(s) <= n {
+				return s
+			}
+			if n <= 0 {
+				return ""
+			}
+			prefix, _ := truncateWidth(s, n-1)
+			return prefix + "…"
+		},
+		"padLeft": func(n int, s string) string {
+			return padWidth(s, n, 1)
+		},
+		"padRight": func(n int, s string) string {
+			return padWidth(s, n, 0)
+		},
+		"center": func(n int, s string) string {
+			return padWidth(s, n, 2)
+		},
+		"wrapWidth": func(n int, s string) (string, error) {
+			if n <= 0 {
+				return "", fmt.Errorf("invalid width %d", n)
+			}
+			return wrapWidth(s, n), nil
+		},
+	}
+}
+
+// nextGrapheme splits the first grapheme cluster from s. It implements the
+// common cases of extended grapheme clusters: CRLF, combining marks, emoji
+// modifiers, zero width joiner sequences and regional indicator pairs.
+func nextGrapheme(s string) (cluster, rest string) {
+	r, n := utf8.DecodeRuneInString(s)
+	if r == '\r' && strings.HasPrefix(s[n:], "\n") {
+		return s[:n+1], s[n+1:]
+	}
+
+	regional := isRegionalIndicator(r)
+	join := false
+	for n < len(s) {
+		next, size := utf8.DecodeRuneInString(s[n:])
+		switch {
+		case join, isGraphemeExtend(next):
+		case regional && isRegionalIndicator(next):
+			regional = false
+		default:
+			return s[:n], s[n:]
+		}
+
+		join = next == '\u200d'
+		n += size
+	}
+
+	return s, ""
+}
+
+func isGraphemeExtend(r rune) bool {
+	return unicode.Is(unicode.M, r) || r == '\u200d' || (r >= 0x1f3fb && r <= 0x1f3ff)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// wideRanges are ranges of runes displayed in two columns: East Asian wide
+// and fullwidth characters, and emoji.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f},
+	{0x231a, 0x231b},
+	{0x2329, 0x232a},
+	{0x23e9, 0x23ec},
+	{0x25fd, 0x25fe},
+	{0x2614, 0x2615},
+	{0x26aa, 0x26ab},
+	{0x26bd, 0x26be},
+	{0x26f5, 0x26f5},
+	{0x26fa, 0x26fa},
+	{0x2705, 0x2705},
+	{0x270a, 0x270b},
+	{0x2728, 0x2728},
+	{0x274c, 0x274c},
+	{0x2753, 0x2755},
+	{0x2795, 0x2797},
+	{0x2b1b, 0x2b1c},
+	{0x2e80, 0x303e},
+	{0x3041, 0x33ff},
+	{0x3400, 0x4dbf},
+	{0x4e00, 0x9fff},
+	{0xa000, 0xa4cf},
+	{0xa960, 0xa97f},
+	{0xac00, 0xd7a3},
+	{0xf900, 0xfaff},
+	{0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f},
+	{0xff00, 0xff60},
+	{0xffe0, 0xffe6},
+	{0x1f004, 0x1f004},
+	{0x1f0cf, 0x1f0cf},
+	{0x1f18e, 0x1f18e},
+	{0x1f191, 0x1f19a},
+	{0x1f1e6, 0x1f1ff},
+	{0x1f200, 0x1f251},
+	{0x1f300, 0x1f64f},
+	{0x1f680, 0x1f6ff},
+	{0x1f7e0, 0x1f7eb},
+	{0x1f90c, 0x1f9ff},
+	{0x1fa70, 0x1faff},
+	{0x20000, 0x2fffd},
+	{0x30000, 0x3fffd},
+}
+
+// runeWidth returns the number of columns taken by r.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0, unicode.IsControl(r), unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+
+	i := sort.Search(len(wideRanges), func(i int) bool {
+		return wideRanges[i][1] >= r
+	})
+	if i < len(wideRanges) && wideRanges[i][0] <= r {
+		return 2
+	}
+
+	return 1
+}
+
+// graphemeWidth returns the number of columns taken by a grapheme cluster,
+// the width of its first visible rune, or two for emoji presentation.
+func graphemeWidth(cluster string) int {
+	if strings.ContainsRune(cluster, '\ufe0f') {
+		return 2
+	}
+
+	for _, r := range cluster {
+		if w := runeWidth(r); w != 0 {
+			return w
+		}
+	}
+	return 0
+}
+
+func displayWidth(s string) int {
+	w := 0
+	for s != "" {
+		var cluster string
+		cluster, s = nextGrapheme(s)
+		w += graphemeWidth(cluster)
+	}
+	return w
+}
+
+// truncateWidth returns the longest prefix of s no wider than n columns and
+// its width.
+func truncateWidth(s string, n int) (prefix string, width int) {
+	rest := s
+	for rest != "" {
+		cluster, next := nextGrapheme(rest)
+		w := graphemeWidth(cluster)
+		if width+w > n {
+			break
+		}
+
+		width += w
+		rest = next
+	}
+	return s[:len(s)-len(rest)], width
+}
+
+// padWidth pads s with spaces to n columns, side is 0 for right, 1 for left
+// and 2 for both.
+func padWidth(s string, n, side int) string {
+	pad := n - displayWidth(s)
+	if pad <= 0 {
+		return s
+	}
+
+	switch side {
+	case 0:
+		return s + strings.Repeat(" ", pad)
+	case 1:
+		return strings.Repeat(" ", pad) + s
+	default:
+		return strings.Repeat(" ", pad/2) + s + strings.Repeat(" ", pad-pad/2)
+	}
+}
+
+// wrapWidth wraps text into lines no wider than n columns, existing line
+// breaks are kept.
+func wrapWidth(text string, n int) string {
+	var sb strings.Builder
+	for i, line := range strings.Split(text, "\n") {
+		if i != 0 {
+			sb.WriteByte('\n')
+		}
+
+		width := 0
+		for _, word := range strings.Fields(line) {
+			w := displayWidth(word)
+			switch {
+			case width == 0:
+			case width+1+w <= n:
+				sb.WriteByte(' ')
+				width++
+			default:
+				sb.WriteByte('\n')
+				width = 0
+			}
+
+			for w > n-width {
+				prefix, pw := truncateWidth(word, n-width)
+				if prefix == "" && width == 0 {
+					// a single cluster wider than n
+					prefix, _ = nextGrapheme(word)
+					pw = graphemeWidth(prefix)
+				}
+				if len(prefix) == len(word) {
+					break
+				}
+
+				sb.WriteString(prefix)
+				sb.WriteByte('\n')
+				word, w, width = word[len(prefix):], w-pw, 0
+			}
+
+			sb.WriteString(word)
+			width += w
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,43 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextFuncs(t *testing.T) {
+	const (
+		family = "\U0001F468\u200d\U0001F469\u200d\U0001F467" // ZWJ sequence
+		flag   = "\U0001F1EF\U0001F1F5"                       // regional indicator pair
+		accent = "e\u0301"                                    // combining mark
+	)
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		data     any
+		expected string
+	}{
+		{"graphemeLen", `graphemeLen .`, "a" + family + flag + accent + "\r\n", "5"},
+		{"displayWidth", `displayWidth .`, "ab日本" + family + accent, "9"},
+		{"truncateWidth", `truncateWidth 5 .`, "日本語です", "日本"},
+		{"truncateWidth keeps clusters", `truncateWidth 3 .`, "a" + family + "b", "a" + family},
+		{"ellipsis", `ellipsis 5 .`, "日本語です", "日本…"},
+		{"ellipsis short", `ellipsis 5 .`, "日本", "日本"},
+		{"padLeft", `padLeft 6 .`, "日本", "  日本"},
+		{"padRight", `padRight 6 .`, accent + "x", accent + "x    "},
+		{"center", `center 7 .`, "日本", " 日本  "},
+		{"wrapWidth", `wrapWidth 6 .`, "日本 語です abc\nde", "日本\n語です\nabc\nde"},
+		{"wrapWidth long word", `wrapWidth 4 .`, "abcdefghij k", "abcd\nefgh\nij k"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := Must(New(test.name).Funcs(TextFuncs()).Parse(test.input))
+
+			var sb strings.Builder
+			assert.NoError(t, tmpl.Execute(&sb, test.data))
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package tlang
+
+import (
+	"errors"
+	"time"
+)
+
+// TimeFuncs returns functions telling the time of the execution, as reported
+// by Env.Now, so that rendering is deterministic with a fixed ExecOptions.Clock
+// or the reproducible option:
+//
+//	now
+//		Returns the current time as time.Time.
+//	unixTime
+//		Returns the current time as seconds since the unix epoch.
+//	date layout [time]
+//		Returns the time (the current time if absent) formatted with
+//		the layout of time.Format.
+func TimeFuncs() FuncMap {
+	return FuncMap{
+		"now": func(env Env) time.Time {
+			return env.Now()
+		},
+		"unixTime": func(env Env) int64 {
+			return env.Now().Unix()
+		},
+		"date": func(env Env, layout string, t ...time.Time) (string, error) {
+			switch len(t) {
+			case 0:
+				return env.Now().Format(layout), nil
+			case 1:
+				return t[0].Format(layout), nil
+			default:
+				return "", errors.New("too many arguments")
+			}
+		},
+	}
+}
@@ -0,0 +1,180 @@
+package tlang
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"arhat.dev/tlang/parse"
+)
+
+// Kinds of TraceEvent.
+const (
+	TraceNode   = "node"   // a node is executed.
+	TraceCall   = "call"   // a function returned.
+	TraceOutput = "output" // output is written.
+	TraceError  = "error"  // the execution failed.
+)
+
+// TraceEvent is an event of an execution recorded by ExecOptions.Trace.
+// Values are encoded as JSON, or as JSON strings of their Go syntax
+// representation if they can't be encoded, so that traces can be replayed
+// without the types and data sources of the execution.
+type TraceEvent struct {
+	// Kind is one of Trace* constants.
+	Kind string `json:"kind"`
+
+	// Template is the name of the executing template.
+	Template string `json:"template,omitempty"`
+
+	// Location is the position of the node or call as name:line:col.
+	Location string `json:"location,omitempty"`
+
+	// Node is the text of the executed node.
+	Node string `json:"node,omitempty"`
+
+	// Dot is the value of dot when the node is executed.
+	Dot json.RawMessage `json:"dot,omitempty"`
+
+	// Func is the name of the called function, Args are its arguments and
+	// Result is the value it returned.
+	Func   string            `json:"func,omitempty"`
+	Args   []json.RawMessage `json:"args,omitempty"`
+	Result json.RawMessage   `json:"result,omitempty"`
+
+	// Error is the error returned by the function, or the error of the
+	// execution.
+	Error string `json:"error,omitempty"`
+
+	// Output is the text written.
+	Output string `json:"output,omitempty"`
+}
+
+// tracer writes events of an execution as JSON lines.
+type tracer struct {
+	enc *json.Encoder
+}
+
+func newTracer(w io.Writer) *tracer {
+	return &tracer{enc: json.NewEncoder(w)}
+}
+
+// emit writes ev, failing the execution if it can't be written.
+func (t *tracer) emit(s *state, ev *TraceEvent) {
+	if err := t.enc.Encode(ev); err != nil {
+		s.writeError(fmt.Errorf("template: writing trace: %w", err))
+	}
+}
+
+// node records the execution of node with dot.
+func (t *tracer) node(s *state, dot reflect.Value, node parse.Node) {
+	switch node.(type) {
+	case *parse.ListNode, *parse.TextNode, *parse.CommentNode:
+		return
+	}
+
+	location, context := s.tmpl.ErrorContext(node)
+	t.emit(s, &TraceEvent{
+		Kind:     TraceNode,
+		Template: s.tmpl.Name(),
+		Location: location,
+		Node:     context,
+		Dot:      traceValue(dot),
+	})
+}
+
+// call records the call of the function name at node.
+func (t *tracer) call(s *state, node parse.Node, name string, args []reflect.Value, result reflect.Value, err error) {
+	location, _ := s.tmpl.ErrorContext(node)
+	ev := &TraceEvent{
+		Kind:     TraceCall,
+		Template: s.tmpl.Name(),
+		Location: location,
+		Func:     name,
+		Args:     make([]json.RawMessage, len(args)),
+		Result:   traceValue(result),
+	}
+	for i, arg := range args {
+		ev.Args[i] = traceValue(arg)
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	t.emit(s, ev)
+}
+
+// traceValue encodes v for traces.
+func traceValue(v reflect.Value) json.RawMessage {
+	if !v.IsValid() || !v.CanInterface() {
+		return json.RawMessage("null")
+	}
+
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%#v", v.Interface()))
+	}
+	return data
+}
+
+// traceWriter records output written to w.
+type traceWriter struct {
+	w io.Writer
+	s *state
+}
+
+func (tw *traceWriter) Write(p []byte) (int, error) {
+	n, err := tw.w.Write(p)
+	if n > 0 {
+		tw.s.trace.emit(tw.s, &TraceEvent{Kind: TraceOutput, Output: string(p[:n])})
+	}
+	return n, err
+}
+
+// Trace is an execution trace read by ReadTrace.
+type Trace struct {
+	Events []TraceEvent
+}
+
+// ReadTrace reads the trace recorded by ExecOptions.Trace from r.
+func ReadTrace(r io.Reader) (*Trace, error) {
+	var (
+		ret = new(Trace)
+		dec = json.NewDecoder(bufio.NewReader(r))
+	)
+	for {
+		var ev TraceEvent
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("template: reading trace event %d: %w", len(ret.Events)+1, err)
+		}
+		ret.Events = append(ret.Events, ev)
+	}
+}
+
+// Replay writes the output of the traced execution to w, calling step, if
+// set, with every event before it is replayed, so that debuggers and viewers
+// can inspect the execution, replay stops when step returns false. The
+// error of a failed execution is returned at its event.
+func (t *Trace) Replay(w io.Writer, step func(ev *TraceEvent) bool) error {
+	for i := range t.Events {
+		ev := &t.Events[i]
+		if step != nil && !step(ev) {
+			return nil
+		}
+
+		switch ev.Kind {
+		case TraceOutput:
+			if _, err := io.WriteString(w, ev.Output); err != nil {
+				return err
+			}
+		case TraceError:
+			return fmt.Errorf("template: replayed error: %s", ev.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package tlang
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecTrace(t *testing.T) {
+	funcs := FuncMap{
+		"upper": strings.ToUpper,
+		"check": func(n int) (int, error) {
+			if n > 2 {
+				return 0, errors.New("too large")
+			}
+			return n, nil
+		},
+	}
+	tmpl := Must(New("main").Funcs(funcs).Parse(`range .
+  upper .Name; ":"; check .N; ","
+end
+`))
+
+	var (
+		trace bytes.Buffer
+		out   strings.Builder
+	)
+	err := tmpl.ExecuteWithOptions(&out, []map[string]any{
+		{"Name": "a", "N": 1},
+		{"Name": "b", "N": 3},
+	}, &ExecOptions{Trace: &trace})
+	require.Error(t, err)
+
+	tr, err2 := ReadTrace(&trace)
+	require.NoError(t, err2)
+
+	var kinds []string
+	for _, ev := range tr.Events {
+		kinds = append(kinds, ev.Kind)
+	}
+	assert.Equal(t, []string{
+		TraceNode,
+		TraceNode, TraceCall, TraceOutput, TraceNode, TraceOutput, TraceNode, TraceCall, TraceOutput, TraceNode, TraceOutput,
+		TraceNode, TraceCall, TraceOutput, TraceNode, TraceOutput, TraceNode, TraceCall,
+		TraceError,
+	}, kinds)
+
+	call := tr.Events[2]
+	assert.Equal(t, "upper", call.Func)
+	assert.Equal(t, "main:2:2", call.Location)
+	assert.JSONEq(t, `"a"`, string(call.Args[0]))
+	assert.JSONEq(t, `"A"`, string(call.Result))
+
+	node := tr.Events[1]
+	assert.Equal(t, "{{upper .Name}}", node.Node)
+	assert.JSONEq(t, `{"Name":"a","N":1}`, string(node.Dot))
+
+	failed := tr.Events[len(tr.Events)-2]
+	assert.Equal(t, "too large", failed.Error)
+
+	var replayed strings.Builder
+	err2 = tr.Replay(&replayed, nil)
+	assert.EqualError(t, err2, "template: replayed error: "+err.Error())
+	assert.Equal(t, out.String(), replayed.String())
+	assert.Equal(t, "A:1,B:", replayed.String())
+
+	replayed.Reset()
+	steps := 0
+	assert.NoError(t, tr.Replay(&replayed, func(ev *TraceEvent) bool {
+		steps++
+		return ev.Kind != TraceCall || ev.Func != "check"
+	}))
+	assert.Equal(t, 8, steps)
+	assert.Equal(t, "A:", replayed.String())
+}
@@ -0,0 +1,61 @@
+package tlang
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTry(t *testing.T) {
+	funcs := FuncMap{
+		"fail": func(msg string) (string, error) { return "", errors.New(msg) },
+		"ok":   func() string { return "ok" },
+	}
+
+	for _, test := range []struct {
+		name     string
+		text     string
+		expected string
+		err      string
+	}{
+		{"no error", `try; ok; catch; "-"; end`, "ok", ""},
+		{"caught", `try; "a"; fail "boom"; "b"; catch; "-"; end; "c"`, "a-c", ""},
+		{"error variable", `try; fail "boom"; catch $err; $err.Error; end`,
+			`template: test:1:5: executing "test" at <fail "boom">: error calling fail: boom`, ""},
+		{"without catch", `try; fail "boom"; end; "c"`, "c", ""},
+		{"template error", `define "x"; fail "boom"; end; try; template "x"; catch; "-"; end`, "-", ""},
+		{"variables", `$x := 1; try; $x = 2; $y := 3; fail "boom"; catch; $x; end`, "2", ""},
+		{"nested", `try; try; fail "a"; catch; fail "b"; end; catch $err; "caught "; $err.Unwrap; end`,
+			`caught template: test:1:27: executing "test" at <fail "b">: error calling fail: b`, ""},
+		{"error in catch", `try; fail "a"; catch; fail "b"; end`, "", "error calling fail: b"},
+		{"break", `range $i := 3; try; if $i == 1; break; end; $i; catch; "-"; end; end`, "0", ""},
+		{"return", `define "x"; try; return "r"; catch; "-"; end; end; $r := (template "x"); $r`, "r", ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := New("test").Funcs(funcs).Parse(test.text)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var sb strings.Builder
+			err = tmpl.Execute(&sb, nil)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+
+	// limits are not caught
+	tmpl := Must(New("test").Funcs(funcs).Option("maxsteps=5").Parse(`try; for $i := 0; true; $i = 1; end; catch; "-"; end`))
+	assert.ErrorContains(t, tmpl.Execute(&strings.Builder{}, nil), "exceeded maximum number of executed nodes")
+
+	tmpl = Must(New("test").Funcs(funcs).Option("blocks=indent").Parse("try\n  fail \"boom\"\ncatch\n  \"-\"\n\"c\""))
+	var sb strings.Builder
+	assert.NoError(t, tmpl.Execute(&sb, nil))
+	assert.Equal(t, "-c", sb.String())
+}
@@ -0,0 +1,305 @@
+package tlang
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ValidationError is returned by functions validating template input.
+//
+// Unlike other errors of functions, it does not stop the execution: the
+// function result is used as is, and all validation errors, positioned at
+// the failed calls, are returned together as a *MultiError once execution
+// completes, followed by the error stopping the execution, if any.
+type ValidationError struct {
+	Msg string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+func invalidf(format string, args ...any) *ValidationError {
+	return &ValidationError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// joinValidation returns the validation errors of an execution followed by
+// err, or err if there is no validation error.
+func joinValidation(invalid MultiError, err error) error {
+	if len(invalid) == 0 {
+		return err
+	}
+
+	if err != nil {
+		invalid = append(invalid, err)
+	}
+
+	return &invalid
+}
+
+// ValidationFuncs returns functions validating input values early in
+// templates. They return the validated value, so that they can be used in
+// pipelines, and fail with ValidationError:
+//
+//	required msg v
+//		Fails with msg if v is missing, nil or an empty string.
+//	matches pattern s
+//		Fails if the string s does not match the regular expression.
+//	oneOf choices... v
+//		Fails if v does not equal any of choices, as with eq.
+//	between min max v
+//		Fails if v is not in the inclusive range [min, max].
+//	validateSchema schema v
+//		Fails if v, as JSON, does not satisfy schema, a JSON Schema given
+//		as JSON text or decoded value. The keywords type, enum, const,
+//		properties, required, additionalProperties, items, minItems,
+//		maxItems, minLength, maxLength, pattern, minimum and maximum are
+//		supported, others are ignored.
+func ValidationFuncs() FuncMap {
+	return FuncMap{
+		"required": func(msg string, v reflect.Value) (reflect.Value, error) {
+			v = indirectInterface(v)
+			if isNilValue(v) || (v.Kind() == reflect.String && v.Len() == 0) {
+				return v, invalidf("%s", msg)
+			}
+			return v, nil
+		},
+		"matches": func(pattern, s string) (string, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return s, err
+			}
+			if !re.MatchString(s) {
+				return s, invalidf("%q does not match %q", s, pattern)
+			}
+			return s, nil
+		},
+		"oneOf": func(args ...reflect.Value) (reflect.Value, error) {
+			if len(args) < 2 {
+				return reflect.Value{}, errNoComparison
+			}
+
+			v, choices := args[len(args)-1], args[:len(args)-1]
+			for _, c := range choices {
+				ok, err := equal(v, c)
+				if err != nil {
+					return v, err
+				}
+				if ok {
+					return v, nil
+				}
+			}
+
+			list := make([]string, len(choices))
+			for i, c := range choices {
+				list[i] = fmt.Sprint(c)
+			}
+			return v, invalidf("%v is not one of %s", v, strings.Join(list, ", "))
+		},
+		"between": func(min, max, v reflect.Value) (reflect.Value, error) {
+			lo, unordered, err := compare(v, min)
+			if err != nil {
+				return v, err
+			}
+
+			hi, unordered2, err := compare(v, max)
+			if err != nil {
+				return v, err
+			}
+
+			if unordered || unordered2 || lo < 0 || hi > 0 {
+				return v, invalidf("%v is not between %v and %v", v, min, max)
+			}
+			return v, nil
+		},
+		"validateSchema": func(schema, v any) (any, error) {
+			if text, ok := schema.(string); ok {
+				if err := json.Unmarshal([]byte(text), &schema); err != nil {
+					return v, fmt.Errorf("invalid schema: %w", err)
+				}
+			}
+
+			s, err := toJSONValue(schema)
+			if err != nil {
+				return v, fmt.Errorf("invalid schema: %w", err)
+			}
+
+			doc, err := toJSONValue(v)
+			if err != nil {
+				return v, err
+			}
+
+			var errs []SchemaViolation
+			validateSchema(s, doc, "", &errs)
+			if len(errs) != 0 {
+				list := make([]string, len(errs))
+				for i, e := range errs {
+					list[i] = pointer(e.Pointer) + ": " + e.Msg
+				}
+				return v, invalidf("%s", strings.Join(list, "; "))
+			}
+			return v, nil
+		},
+	}
+}
+
+// toJSONValue converts v to the generic values decoded from its JSON form.
+func toJSONValue(v any) (ret any, err error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &ret)
+	return
+}
+
+// jsonType returns the JSON Schema type of a decoded JSON value.
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// validateSchema appends violations of schema by the value v at path, as
+// a JSON pointer, to errs.
+func validateSchema(schema, v any, path string, errs *[]SchemaViolation) {
+	s, ok := schema.(map[string]any)
+	if !ok {
+		// boolean schemas
+		if schema == false {
+			*errs = append(*errs, SchemaViolation{Pointer: path, Msg: "not allowed"})
+		}
+		return
+	}
+
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, SchemaViolation{Pointer: path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	typ := jsonType(v)
+	if want, ok := s["type"]; ok {
+		types, ok := want.([]any)
+		if !ok {
+			types = []any{want}
+		}
+
+		match := false
+		for _, t := range types {
+			match = match || t == typ || (t == "number" && typ == "integer")
+		}
+		if !match {
+			fail("expected %v, got %s", want, typ)
+			return
+		}
+	}
+
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, v) {
+		fail("expected %v", c)
+	}
+
+	if enum, ok := s["enum"].([]any); ok {
+		match := false
+		for _, e := range enum {
+			match = match || reflect.DeepEqual(e, v)
+		}
+		if !match {
+			fail("%v is not one of %v", v, enum)
+		}
+	}
+
+	limit := func(key string) (float64, bool) {
+		n, ok := s[key].(float64)
+		return n, ok
+	}
+
+	switch v := v.(type) {
+	case float64:
+		if n, ok := limit("minimum"); ok && v < n {
+			fail("%v is less than %v", v, n)
+		}
+		if n, ok := limit("maximum"); ok && v > n {
+			fail("%v is greater than %v", v, n)
+		}
+	case string:
+		l := float64(len([]rune(v)))
+		if n, ok := limit("minLength"); ok && l < n {
+			fail("length %v is less than %v", l, n)
+		}
+		if n, ok := limit("maxLength"); ok && l > n {
+			fail("length %v is greater than %v", l, n)
+		}
+		if p, ok := s["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err != nil {
+				fail("invalid pattern %q", p)
+			} else if !re.MatchString(v) {
+				fail("%q does not match %q", v, p)
+			}
+		}
+	case []any:
+		l := float64(len(v))
+		if n, ok := limit("minItems"); ok && l < n {
+			fail("%v items is less than %v", l, n)
+		}
+		if n, ok := limit("maxItems"); ok && l > n {
+			fail("%v items is greater than %v", l, n)
+		}
+		if items, ok := s["items"]; ok {
+			for i, item := range v {
+				validateSchema(items, item, fmt.Sprintf("%s/%d", path, i), errs)
+			}
+		}
+	case map[string]any:
+		if required, ok := s["required"].([]any); ok {
+			for _, r := range required {
+				if name, _ := r.(string); name != "" {
+					if _, ok := v[name]; !ok {
+						fail("missing property %q", name)
+					}
+				}
+			}
+		}
+
+		props, _ := s["properties"].(map[string]any)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			child := path + "/" + strings.ReplaceAll(strings.ReplaceAll(k, "~", "~0"), "/", "~1")
+			if p, ok := props[k]; ok {
+				validateSchema(p, v[k], child, errs)
+			} else if additional, ok := s["additionalProperties"]; ok {
+				validateSchema(additional, v[k], child, errs)
+			}
+		}
+	}
+}
+
+func pointer(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
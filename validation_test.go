@@ -0,0 +1,103 @@
+package tlang
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidationFuncs(t *testing.T) {
+	const schema = `{
+  "type": "object",
+  "required": ["name", "replicas"],
+  "properties": {
+    "name": {"type": "string", "pattern": "^[a-z]+$"},
+    "replicas": {"type": "integer", "minimum": 1, "maximum": 5},
+    "ports": {"type": "array", "items": {"type": "integer"}}
+  },
+  "additionalProperties": false
+}`
+
+	type input struct {
+		Name  string
+		Mode  string
+		Count int
+	}
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		data     any
+		expected string
+		errs     []string
+	}{
+		{
+			name:     "valid",
+			input:    `required "name is required" .Name; " "; oneOf "a" "b" .Mode; " "; between 1 10 .Count; " "; matches "^w" .Name`,
+			data:     input{Name: "web", Mode: "b", Count: 10},
+			expected: "web b 10 web",
+		},
+		{
+			name:  "aggregated",
+			input: "required \"name is required\" .Name\noneOf \"a\" \"b\" .Mode\nbetween 1 10 .Count\nmatches \"^w\" .Name",
+			data:  input{Mode: "c", Count: 11},
+			errs: []string{
+				`template: aggregated:1:0: executing "aggregated" at <required "name is required" .Name>: error calling required: name is required`,
+				`template: aggregated:2:0: executing "aggregated" at <oneOf "a" "b" .Mode>: error calling oneOf: c is not one of a, b`,
+				`template: aggregated:3:0: executing "aggregated" at <between 1 10 .Count>: error calling between: 11 is not between 1 and 10`,
+				`template: aggregated:4:0: executing "aggregated" at <matches "^w" .Name>: error calling matches: "" does not match "^w"`,
+			},
+		},
+		{
+			name:  "followed by execution error",
+			input: "required \"missing x\" .x\nfail",
+			data:  map[string]any{},
+			errs: []string{
+				`error calling required: missing x`,
+				`error calling fail: failed`,
+			},
+		},
+		{
+			name:     "schema",
+			input:    `$v := validateSchema .schema .value; "ok"`,
+			data:     map[string]any{"schema": schema, "value": map[string]any{"name": "web", "replicas": 2, "ports": []int{80}}},
+			expected: "ok",
+		},
+		{
+			name:  "schema violations",
+			input: `validateSchema .schema .value`,
+			data:  map[string]any{"schema": schema, "value": map[string]any{"name": "Web", "ports": []any{80, "x"}, "extra": true}},
+			errs: []string{
+				`error calling validateSchema: /: missing property "replicas"; /extra: not allowed; /name: "Web" does not match "^[a-z]+$"; /ports/1: expected integer, got string`,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			funcs := ValidationFuncs()
+			funcs["fail"] = func() (string, error) { return "", errors.New("failed") }
+			tmpl := Must(New(test.name).Funcs(funcs).Parse(test.input))
+
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, test.data)
+			if test.errs == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expected, sb.String())
+				return
+			}
+
+			var errs *MultiError
+			if !assert.ErrorAs(t, err, &errs) || !assert.Len(t, *errs, len(test.errs)) {
+				return
+			}
+
+			for i, msg := range test.errs {
+				assert.Contains(t, (*errs)[i].Error(), msg)
+
+				var invalid *ValidationError
+				assert.Equal(t, !strings.Contains(msg, "calling fail"), errors.As((*errs)[i], &invalid))
+			}
+		})
+	}
+}
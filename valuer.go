@@ -0,0 +1,65 @@
+package tlang
+
+import (
+	"database/sql/driver"
+	"reflect"
+)
+
+var driverValuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// unwrapValuer returns the value wrapped in v when v (or pointer to v)
+// implements driver.Valuer, such as sql.NullString and sql.NullInt64, null
+// values are unwrapped as the zero reflect.Value. Nil pointers to Valuers are
+// unwrapped as the zero reflect.Value as well.
+//
+// ok is false when v is not a Valuer.
+func unwrapValuer(v reflect.Value) (ret reflect.Value, ok bool, err error) {
+	v = indirectInterface(v)
+	if v.IsValid() && v.Kind() != reflect.Pointer && !methodsOf(v.Type()).valuer {
+		return v, false, nil
+	}
+	for v.Kind() == reflect.Pointer && !v.Type().Implements(driverValuerType) {
+		if v.IsNil() {
+			if reflect.PointerTo(v.Type().Elem()).Implements(driverValuerType) {
+				return zero, true, nil
+			}
+			return v, false, nil
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		return v, false, nil
+	}
+
+	var valuer driver.Valuer
+	switch {
+	case v.Type().Implements(driverValuerType):
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return zero, true, nil
+		}
+		valuer, _ = v.Interface().(driver.Valuer)
+	case v.CanAddr() && reflect.PointerTo(v.Type()).Implements(driverValuerType):
+		valuer, _ = v.Addr().Interface().(driver.Valuer)
+	default:
+		return v, false, nil
+	}
+
+	val, err := valuer.Value()
+	if err != nil {
+		return zero, true, err
+	}
+
+	return reflect.ValueOf(val), true, nil
+}
+
+// hasPrintMethod reports whether v formats itself with an Error, String or
+// MarshalText method, in which case it is printed as is.
+func hasPrintMethod(v reflect.Value) bool {
+	v, _ = indirect(v)
+	if !v.IsValid() {
+		return false
+	}
+
+	return methodsOf(v.Type()).printer
+}
@@ -0,0 +1,60 @@
+package tlang
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type badValuer struct{}
+
+func (badValuer) Value() (driver.Value, error) { return nil, errors.New("bad value") }
+
+func TestValuerUnwrapping(t *testing.T) {
+	type Row struct {
+		Name    sql.NullString
+		Age     sql.NullInt64
+		Nick    *sql.NullString
+		Missing *sql.NullString
+		Bad     badValuer
+	}
+
+	row := &Row{
+		Name: sql.NullString{String: "foo", Valid: true},
+		Age:  sql.NullInt64{},
+		Nick: &sql.NullString{String: "", Valid: true},
+	}
+
+	for _, test := range []struct {
+		input  string
+		output string
+		ok     bool
+	}{
+		{`.Name`, "foo", true},
+		{`.Age`, "<no value>", true},
+		{`.Nick`, "", true},
+		{`.Missing`, "<no value>", true},
+		{`if .Name; "yes"; end`, "yes", true},
+		{`if .Age; "yes"; else; "no"; end`, "no", true},
+		{`if .Nick; "yes"; else; "no"; end`, "no", true},
+		{`if .Missing; "yes"; else; "no"; end`, "no", true},
+		{`.Bad`, "", false},
+		{`if .Bad; end`, "", false},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			var sb strings.Builder
+			err := Must(New("test").Parse(test.input)).Execute(&sb, row)
+			if !test.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.output, sb.String())
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package tlang
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"arhat.dev/tlang/parse"
+)
+
+// constVar is a constant declared in a vars block.
+type constVar struct {
+	template string // name of the declaring template.
+	value    reflect.Value
+}
+
+// addVars installs the constants declared by tree, the definition of the
+// template name, they are shared by all associated templates.
+func (t *Template) addVars(name string, tree *parse.Tree) error {
+	for v := range tree.Vars {
+		if old, ok := t.vars[v]; ok && old.template != name {
+			return fmt.Errorf("template: %s: constant %s already declared in template %q", name, v, old.template)
+		}
+	}
+
+	if len(tree.Vars) == 0 {
+		return nil
+	}
+
+	// copied, executions may be using the current map
+	vars := make(map[string]constVar, len(t.vars)+len(tree.Vars))
+	for v, c := range t.vars {
+		vars[v] = c
+	}
+	for v, n := range tree.Vars {
+		vars[v] = constVar{template: name, value: constValue(n)}
+	}
+	t.vars = vars
+
+	return nil
+}
+
+// constValue returns the value of a literal node.
+func constValue(n parse.Node) reflect.Value {
+	switch n := n.(type) {
+	case *parse.StringNode:
+		return reflect.ValueOf(n.Text)
+	case *parse.BoolNode:
+		return reflect.ValueOf(n.True)
+	case *parse.NumberNode:
+		// as idealConstant, but keeping large integers
+		switch {
+		case n.IsComplex:
+			return reflect.ValueOf(n.Complex128)
+		case n.IsFloat && !isHexInt(n.Text) && !isRuneInt(n.Text) && strings.ContainsAny(n.Text, ".eEpP"):
+			return reflect.ValueOf(n.Float64)
+		case n.IsInt && int64(int(n.Int64)) == n.Int64:
+			return reflect.ValueOf(int(n.Int64))
+		case n.IsInt:
+			return reflect.ValueOf(n.Int64)
+		default:
+			return reflect.ValueOf(n.Uint64)
+		}
+	default:
+		return reflect.Value{}
+	}
+}
+
+// Vars returns the constants declared in vars blocks of the templates
+// associated with t, by name without the "$$" prefix.
+//
+// A vars block at the top of a template declares global variables with
+// literal values, available to all associated templates and to Go code,
+// which cannot be assigned:
+//
+//	vars
+//	  $$title := "Home"
+//	  $$layout := "base"
+//	end
+func (t *Template) Vars() map[string]any {
+	if t.common == nil {
+		return nil
+	}
+
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+
+	ret := make(map[string]any, len(t.vars))
+	for name, v := range t.vars {
+		var value any
+		if v.value.IsValid() {
+			value = v.value.Interface()
+		}
+		ret[name[2:]] = value
+	}
+	return ret
+}
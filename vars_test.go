@@ -0,0 +1,53 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVars(t *testing.T) {
+	const page = `vars
+  $$title := "Home"
+  $$layout := "base"
+  $$weight := 1.5
+end
+template "base" .; " "; $$layout`
+
+	tmpl := Must(New("page").Parse(page))
+	Must(tmpl.New("base").Parse(`$$title; " ("; .; ") "; $$weight`))
+
+	assert.Equal(t, map[string]any{"title": "Home", "layout": "base", "weight": 1.5}, tmpl.Vars())
+
+	t.Run("execute", func(t *testing.T) {
+		var sb strings.Builder
+		assert.NoError(t, tmpl.Execute(&sb, "data"))
+		assert.Equal(t, "Home (data) 1.5 base", sb.String())
+	})
+
+	t.Run("exported vars", func(t *testing.T) {
+		vars := map[string]any{"other": 1}
+		assert.NoError(t, tmpl.ExecuteWithOptions(&strings.Builder{}, nil, &ExecOptions{Vars: vars}))
+		assert.Equal(t, map[string]any{"other": 1}, vars)
+	})
+
+	t.Run("set constant", func(t *testing.T) {
+		err := tmpl.ExecuteWithOptions(&strings.Builder{}, nil, &ExecOptions{Vars: map[string]any{"title": "x"}})
+		assert.ErrorContains(t, err, "cannot set constant $$title")
+	})
+
+	t.Run("assign constant", func(t *testing.T) {
+		clone := Must(tmpl.Clone())
+		Must(clone.New("base").Parse(`$$title = "x"`))
+		assert.ErrorContains(t, clone.Execute(&strings.Builder{}, nil), "cannot assign constant $$title")
+
+		// the original set is not affected
+		assert.NoError(t, tmpl.Execute(&strings.Builder{}, nil))
+	})
+
+	t.Run("redeclared", func(t *testing.T) {
+		_, err := Must(tmpl.Clone()).New("other").Parse("vars\n$$title := \"Other\"\nend")
+		assert.EqualError(t, err, `template: other: constant $$title already declared in template "page"`)
+	})
+}
@@ -0,0 +1,132 @@
+package tlang
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// ErrUnverified is reported when the signature of a template file is missing
+// or invalid.
+var ErrUnverified = errors.New("template: signature verification failed")
+
+// Verifier parses template files only after verifying their detached ed25519
+// signatures, so that renderers execute approved templates only.
+//
+// A signature file contains the 64-byte signature of the whole template file,
+// either raw or base64 encoded (as created by `cosign sign-blob` with an
+// ed25519 key).
+type Verifier struct {
+	// Keys are the trusted public keys, a signature made by any of them is
+	// valid.
+	Keys []ed25519.PublicKey
+
+	// SignatureFile returns the name of the signature file of the template
+	// file, the default is the file name with ".sig" appended.
+	SignatureFile func(file string) string
+
+	// Policy decides whether a template file is parsed, err is the result of
+	// verification (nil if the signature is valid, otherwise wrapping
+	// ErrUnverified), a non-nil return value stops parsing with it.
+	//
+	// The default policy returns err as is.
+	Policy func(file string, content []byte, err error) error
+}
+
+// ParseFiles is like Template.ParseFiles but verifies every file before
+// parsing it, if t is nil, it is created from the first file.
+func (v *Verifier) ParseFiles(t *Template, filenames ...string) (*Template, error) {
+	if t != nil {
+		t.init()
+	}
+
+	return parseFiles(t, v.readFile(readFileOS, os.ReadFile), filenames...)
+}
+
+// ParseFS is like Template.ParseFS but verifies every file before parsing it,
+// if t is nil, it is created from the first file.
+func (v *Verifier) ParseFS(t *Template, fsys fs.FS, patterns ...string) (*Template, error) {
+	if t != nil {
+		t.init()
+	}
+
+	var filenames []string
+	for _, pattern := range patterns {
+		list, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("template: pattern matches no files: %#q", pattern)
+		}
+		filenames = append(filenames, list...)
+	}
+
+	return parseFiles(t, v.readFile(readFileFS(fsys), func(file string) ([]byte, error) {
+		return fs.ReadFile(fsys, file)
+	}), filenames...)
+}
+
+// Verify checks the detached signature sig of content, sig is raw or base64
+// encoded.
+func (v *Verifier) Verify(content, sig []byte) error {
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil || len(decoded) != ed25519.SignatureSize {
+			return fmt.Errorf("%w: malformed signature", ErrUnverified)
+		}
+		sig = decoded
+	}
+
+	for _, key := range v.Keys {
+		if ed25519.Verify(key, content, sig) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no trusted key matches", ErrUnverified)
+}
+
+// readFile wraps readFile with signature verification, signatures are read
+// with readSig.
+func (v *Verifier) readFile(
+	readFile func(string) (string, []byte, error),
+	readSig func(string) ([]byte, error),
+) func(string) (string, []byte, error) {
+	return func(file string) (string, []byte, error) {
+		name, b, err := readFile(file)
+		if err != nil {
+			return name, nil, err
+		}
+
+		sigFile := file + ".sig"
+		if v.SignatureFile != nil {
+			sigFile = v.SignatureFile(file)
+		}
+
+		sig, err := readSig(sigFile)
+		if err != nil {
+			err = fmt.Errorf("%w: %v", ErrUnverified, err)
+		} else {
+			err = v.Verify(b, sig)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("template: %s: %w", file, err)
+		}
+
+		if v.Policy != nil {
+			err = v.Policy(file, b, err)
+		}
+
+		if err != nil {
+			return name, nil, err
+		}
+
+		return name, b, nil
+	}
+}
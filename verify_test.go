@@ -0,0 +1,91 @@
+package tlang
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifier(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	const (
+		main    = `"main:"; template "partial"`
+		partial = `define "partial"; "partial"; end`
+	)
+
+	fsys := fstest.MapFS{
+		"main.tl":         {Data: []byte(main)},
+		"main.tl.sig":     {Data: ed25519.Sign(priv, []byte(main))},
+		"partial.tl":      {Data: []byte(partial)},
+		"partial.tl.sig":  {Data: []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(partial))) + "\n")},
+		"bad.tl":          {Data: []byte(main)},
+		"bad.tl.sig":      {Data: ed25519.Sign(otherPriv, []byte(main))},
+		"tampered.tl":     {Data: []byte(main + "; 1")},
+		"tampered.tl.sig": {Data: ed25519.Sign(priv, []byte(main))},
+		"unsigned.tl":     {Data: []byte(main)},
+	}
+
+	v := &Verifier{Keys: []ed25519.PublicKey{pub}}
+
+	t.Run("valid", func(t *testing.T) {
+		tmpl, err := v.ParseFS(nil, fsys, "main.tl", "partial.tl")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		var sb strings.Builder
+		assert.NoError(t, tmpl.Execute(&sb, nil))
+		assert.Equal(t, "main:partial", sb.String())
+	})
+
+	for _, file := range []string{"bad.tl", "tampered.tl", "unsigned.tl"} {
+		t.Run(file, func(t *testing.T) {
+			_, err := v.ParseFS(nil, fsys, file)
+			assert.ErrorIs(t, err, ErrUnverified)
+			assert.ErrorContains(t, err, file)
+		})
+	}
+
+	t.Run("policy", func(t *testing.T) {
+		var rejected []string
+		v := &Verifier{
+			Keys: []ed25519.PublicKey{pub},
+			Policy: func(file string, content []byte, err error) error {
+				if err != nil {
+					rejected = append(rejected, file)
+				}
+				// audit only
+				return nil
+			},
+		}
+
+		_, err := v.ParseFS(New("main.tl"), fsys, "main.tl", "unsigned.tl")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"unsigned.tl"}, rejected)
+	})
+
+	t.Run("signature file", func(t *testing.T) {
+		v := &Verifier{
+			Keys:          []ed25519.PublicKey{pub},
+			SignatureFile: func(string) string { return "main.tl.sig" },
+		}
+
+		_, err := v.ParseFS(nil, fsys, "tampered.tl")
+		assert.ErrorIs(t, err, ErrUnverified)
+
+		_, err = v.ParseFS(nil, fsys, "bad.tl")
+		assert.NoError(t, err)
+	})
+}
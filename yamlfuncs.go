@@ -0,0 +1,80 @@
+package tlang
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLFuncs returns functions serializing values as YAML indented for the
+// place they are inserted at, so that multi-line values do not break the
+// structure of the surrounding document:
+//
+//	toYaml v
+//		Returns v serialized as YAML, without the final newline.
+//	toYamlAt n v
+//		Like toYaml, but indents every line after the first with n spaces,
+//		for insertion at column n.
+//	insertYaml v
+//		Like toYamlAt, with the indentation tracked from the output. After
+//		indentation and sequence dashes (e.g. "  - "), lines are aligned to
+//		the current column; after other text (e.g. "key:"), multi-line
+//		values start on a new line indented two spaces more than the
+//		current line.
+func YAMLFuncs() FuncMap {
+	return FuncMap{
+		"toYaml": toYaml,
+		"toYamlAt": func(n int, v any) (string, error) {
+			if n < 0 {
+				return "", fmt.Errorf("invalid indent %d", n)
+			}
+
+			s, err := toYaml(v)
+			return indentLines(s, n, false), err
+		},
+		"insertYaml": func(env Env, v any) (string, error) {
+			s, err := toYaml(v)
+			if err != nil || !strings.Contains(s, "\n") {
+				return s, err
+			}
+
+			line := env.CurrentLine()
+			if strings.TrimLeft(line, " -") == "" {
+				return indentLines(s, utf8.RuneCountInString(line), false), nil
+			}
+
+			n := len(line) - len(strings.TrimLeft(line, " ")) + 2
+			return "\n" + indentLines(s, n, true), nil
+		},
+	}
+}
+
+func toYaml(v any) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// indentLines prefixes non-empty lines of s with n spaces, the first line
+// is only indented when first is true.
+func indentLines(s string, n int, first bool) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if l != "" && (i != 0 || first) {
+			lines[i] = pad + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,69 @@
+package tlang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestYAMLFuncs(t *testing.T) {
+	data := map[string]any{
+		"labels": map[string]string{"app": "web", "tier": "frontend"},
+		"ports":  []int{80, 443},
+		"name":   "web",
+	}
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "toYaml",
+			input:    `toYaml .labels`,
+			expected: "app: web\ntier: frontend",
+		},
+		{
+			name:     "toYamlAt",
+			input:    `"  "; toYamlAt 2 .ports`,
+			expected: "  - 80\n  - 443",
+		},
+		{
+			name:     "insertYaml scalar",
+			input:    `"name: "; insertYaml .name`,
+			expected: "name: web",
+		},
+		{
+			name:     "insertYaml at indentation",
+			input:    `"spec:\n    "; insertYaml .labels`,
+			expected: "spec:\n    app: web\n    tier: frontend",
+		},
+		{
+			name:     "insertYaml after sequence dash",
+			input:    `"items:\n  - "; insertYaml .labels`,
+			expected: "items:\n  - app: web\n    tier: frontend",
+		},
+		{
+			name:     "insertYaml after key",
+			input:    `"spec:\n  ports:"; insertYaml .ports`,
+			expected: "spec:\n  ports:\n    - 80\n    - 443",
+		},
+		{
+			name: "insertYaml in template value",
+			input: `define "ports"; "ports:"; insertYaml .ports; end
+"spec:\n  "; indent 2 (template "ports" .)`,
+			expected: "spec:\n  ports:\n    - 80\n    - 443",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			funcs := YAMLFuncs()
+			funcs["indent"] = func(n int, s string) string { return indentLines(s, n, false) }
+			tmpl := Must(New(test.name).Funcs(funcs).Parse(test.input))
+
+			var sb strings.Builder
+			assert.NoError(t, tmpl.Execute(&sb, data))
+			assert.Equal(t, test.expected, sb.String())
+		})
+	}
+}